@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -16,6 +17,7 @@ import (
 	"ssh-tunnel/router"
 	"ssh-tunnel/safe"
 	"ssh-tunnel/tunnel"
+	sshtunnel "ssh-tunnel/tunnel"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,14 +32,59 @@ type profileSwitchRequest struct {
 }
 
 type profileUpsertRequest struct {
-	ProfileID string         `json:"profileId"`
-	Profile   cfg.SSHProfile `json:"profile"`
+	ProfileID    string                 `json:"profileId"`
+	Profile      cfg.SSHProfile         `json:"profile"`
+	ClearSecrets cfg.ProfileSecretClear `json:"clearSecrets"`
 }
 
 type profileDeleteRequest struct {
 	ProfileID string `json:"profileId"`
 }
 
+type sshConfigImportRequest struct {
+	Path      string   `json:"path"`
+	Hosts     []string `json:"hosts"`
+	Overwrite bool     `json:"overwrite"`
+}
+
+type keyUnlockRequest struct {
+	Path       string `json:"path"`
+	Passphrase string `json:"passphrase"`
+}
+
+type authChallengeRequest struct {
+	ID      string   `json:"id"`
+	Answers []string `json:"answers"`
+	Cancel  bool     `json:"cancel"`
+}
+
+type localForwardUpsertRequest struct {
+	// ProfileID 为空时使用当前激活的profile
+	ProfileID string           `json:"profileId"`
+	Forward   cfg.LocalForward `json:"forward"`
+}
+
+type localForwardDeleteRequest struct {
+	ProfileID string `json:"profileId"`
+	Name      string `json:"name"`
+}
+
+type proxyUserUpsertRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type proxyUserDeleteRequest struct {
+	Username string `json:"username"`
+}
+
+type hostKeyAcceptRequest struct {
+	ProfileID   string `json:"profileId"`
+	Fingerprint string `json:"fingerprint"`
+	// JumpHost 跳板机序号(从1开始)，0 表示目标服务器
+	JumpHost *int `json:"jumpHost"`
+}
+
 type profileSwitchStatus struct {
 	SwitchID      string `json:"switchId"`
 	FromProfileID string `json:"fromProfileId"`
@@ -47,6 +94,8 @@ type profileSwitchStatus struct {
 	StartedAt     string `json:"startedAt"`
 	UpdatedAt     string `json:"updatedAt"`
 	DurationMs    int64  `json:"durationMs"`
+	FailedHop     string `json:"failedHop,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
 }
 
 const (
@@ -56,6 +105,9 @@ const (
 	SwitchStatusFailed    = "FAILED"
 )
 
+// maxRuleImportSize 上传的 Clash/Surge 规则文件大小上限
+const maxRuleImportSize = 10 << 20
+
 var profileSwitchState = struct {
 	mu     sync.Mutex
 	latest profileSwitchStatus
@@ -92,16 +144,40 @@ func getConfigKeyMapping() map[string]string {
 		"ServerSshPort":              appConfig.ServerSshPort.Key,
 		"LoginUser":                  appConfig.LoginUser.Key,
 		"SshPrivateKeyPath":          appConfig.SshPrivateKeyPath.Key,
+		"SshPrivateKeyPassphrase":    appConfig.SshPrivateKeyPassphrase.Key,
 		"LocalAddress":               appConfig.LocalAddress.Key,
 		"HttpLocalAddress":           appConfig.HttpLocalAddress.Key,
+		"MixedLocalAddress":          appConfig.MixedLocalAddress.Key,
 		"EnableHttp":                 appConfig.EnableHttp.Key,
+		"HttpTlsEnable":              appConfig.HttpTlsEnable.Key,
+		"HttpTlsCertFile":            appConfig.HttpTlsCertFile.Key,
+		"HttpTlsKeyFile":             appConfig.HttpTlsKeyFile.Key,
+		"HttpAuthUsersFile":          appConfig.HttpAuthUsersFile.Key,
+		"HttpAuthMaxFailures":        appConfig.HttpAuthMaxFailures.Key,
+		"HttpAuthBlockSec":           appConfig.HttpAuthBlockSec.Key,
+		"RouteEnable":                appConfig.RouteEnable.Key,
+		"RouteRulesFile":             appConfig.RouteRulesFile.Key,
 		"EnableSocks5":               appConfig.EnableSocks5.Key,
+		"EnableMixed":                appConfig.EnableMixed.Key,
+		"Socks5UdpEnable":            appConfig.Socks5UdpEnable.Key,
+		"Socks5UdpRelayAddress":      appConfig.Socks5UdpRelayAddress.Key,
+		"Socks5UdpIdleTimeoutSec":    appConfig.Socks5UdpIdleTimeoutSec.Key,
 		"EnableHttpOverSSH":          appConfig.EnableHttpOverSSH.Key,
 		"HttpBasicAuthEnable":        appConfig.HttpBasicAuthEnable.Key,
 		"HttpBasicUserName":          appConfig.HttpBasicUserName.Key,
 		"HttpBasicPassword":          appConfig.HttpBasicPassword.Key,
+		"Socks5AuthEnable":           appConfig.Socks5AuthEnable.Key,
+		"Socks5NoAuthEnable":         appConfig.Socks5NoAuthEnable.Key,
+		"Socks5AuthShareHttpBasic":   appConfig.Socks5AuthShareHttpBasic.Key,
+		"Socks5AuthUserName":         appConfig.Socks5AuthUserName.Key,
+		"Socks5AuthPassword":         appConfig.Socks5AuthPassword.Key,
 		"EnableHttpDomainFilter":     appConfig.EnableHttpDomainFilter.Key,
 		"HttpDomainFilterFilePath":   appConfig.HttpDomainFilterFilePath.Key,
+		"HttpDomainCacheSize":        appConfig.HttpDomainCacheSize.Key,
+		"HttpDomainCacheTTLSec":      appConfig.HttpDomainCacheTTLSec.Key,
+		"HttpDomainSubscriptions":    appConfig.HttpDomainSubscriptions.Key,
+		"HttpDomainSubIntervalMin":   appConfig.HttpDomainSubIntervalMin.Key,
+		"HttpDomainSubViaSSH":        appConfig.HttpDomainSubViaSSH.Key,
 		"EnableAdmin":                appConfig.EnableAdmin.Key,
 		"AdminAddress":               appConfig.AdminAddress.Key,
 		"RetryIntervalSec":           appConfig.RetryIntervalSec.Key,
@@ -111,6 +187,13 @@ func getConfigKeyMapping() map[string]string {
 		"SSHKeepAliveCountMax":       appConfig.SSHKeepAliveCountMax.Key,
 		"SSHReconnectMaxRetries":     appConfig.SSHReconnectMaxRetries.Key,
 		"SSHReconnectMaxIntervalSec": appConfig.SSHReconnectMaxIntervalSec.Key,
+		"SSHAuthChallengeTimeoutSec": appConfig.SSHAuthChallengeTimeoutSec.Key,
+		"SSHCertExpiryWarnMin":       appConfig.SSHCertExpiryWarnMin.Key,
+		"SSHProbeEnable":             appConfig.SSHProbeEnable.Key,
+		"SSHProbeTarget":             appConfig.SSHProbeTarget.Key,
+		"SSHProbeIntervalSec":        appConfig.SSHProbeIntervalSec.Key,
+		"SSHProbeTimeoutSec":         appConfig.SSHProbeTimeoutSec.Key,
+		"SSHProbeFailureThreshold":   appConfig.SSHProbeFailureThreshold.Key,
 		"LogFilePath":                appConfig.LogFilePath.Key,
 		"HomeDir":                    appConfig.HomeDir.Key,
 	}
@@ -128,6 +211,80 @@ func respondWithError(writer http.ResponseWriter, message string, statusCode int
 	writer.Write(jsonResponse)
 }
 
+// validateProfileConnection 校验 profile 的传输代理与封装、本地/远程端口转发，以及 profile 和跳板机的算法配置是否都被 x/crypto/ssh 支持
+func validateProfileConnection(profile cfg.SSHProfile) error {
+	names := make(map[string]bool, len(profile.LocalForwards))
+	listens := make(map[string]bool, len(profile.LocalForwards))
+	for _, forward := range profile.LocalForwards {
+		if err := tunnel.ValidateLocalForward(forward); err != nil {
+			return err
+		}
+		if names[forward.Name] || listens[forward.ListenAddress] {
+			return fmt.Errorf("转发名称或监听地址重复: %s(%s)", forward.Name, forward.ListenAddress)
+		}
+		names[forward.Name] = true
+		listens[forward.ListenAddress] = true
+	}
+	remoteNames := make(map[string]bool, len(profile.RemoteForwards))
+	for _, forward := range profile.RemoteForwards {
+		if err := tunnel.ValidateRemoteForward(forward); err != nil {
+			return err
+		}
+		if remoteNames[forward.Name] {
+			return fmt.Errorf("远程转发名称重复: %s", forward.Name)
+		}
+		remoteNames[forward.Name] = true
+	}
+	if err := tunnel.ValidateTransportProxy(profile.TransportProxy); err != nil {
+		return err
+	}
+	if err := tunnel.ValidateTransportWrap(profile.TransportWrap); err != nil {
+		return err
+	}
+	if _, err := tunnel.ResolveAlgorithms(profile.Algorithms); err != nil {
+		return err
+	}
+	for i, jump := range profile.JumpHosts {
+		if _, err := tunnel.ResolveAlgorithms(jump.Algorithms); err != nil {
+			return fmt.Errorf("jump host #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// readRuleImportUpload 读取上传的规则：multipart 表单的 file 字段，或直接作为请求体
+func readRuleImportUpload(request *http.Request) ([]byte, string, error) {
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := request.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		return data, header.Filename, err
+	}
+	data, err := io.ReadAll(request.Body)
+	return data, "", err
+}
+
+// applyImportedActiveProfile 导入/同步更新了当前激活的profile时，立即应用到运行时配置（下次重连生效）
+func applyImportedActiveProfile(tun *tunnel.Tunnel, result cfg.SSHConfigImportResult) {
+	activeID := result.Store.ActiveProfileID
+	if activeID == "" {
+		return
+	}
+	for _, id := range result.Updated {
+		if id != activeID {
+			continue
+		}
+		cfg.ApplyProfileToAppConfig(tun.AppConfig(), result.Store.Profiles[id])
+		if err := tun.RefreshRuntimeConfigFromAppConfig(); err != nil {
+			log.Printf("应用同步后的profile(%s)失败: %v", id, err)
+		}
+		return
+	}
+}
+
 func monitorProfileSwitchResult(switchID string, timeout time.Duration, tun *tunnel.Tunnel) {
 	startedAt := time.Now()
 	ticker := time.NewTicker(1 * time.Second)
@@ -145,10 +302,23 @@ func monitorProfileSwitchResult(switchID string, timeout time.Duration, tun *tun
 			return
 		}
 
+		// 记录最近一次失败发生在哪一跳，便于定位跳板机问题
+		stats := tun.SnapshotSSHConnectionStats()
+		if stats.LastReconnectFailureAt.After(startedAt) {
+			updateProfileSwitchStatusIfMatch(switchID, func(status *profileSwitchStatus) {
+				status.FailedHop = stats.LastFailedHop
+				status.LastError = stats.LastReconnectError
+				status.UpdatedAt = time.Now().Format(time.RFC3339)
+			})
+		}
+
 		if time.Now().After(deadline) {
 			updateProfileSwitchStatusIfMatch(switchID, func(status *profileSwitchStatus) {
 				status.Status = SwitchStatusFailed
 				status.Message = "等待SSH重连超时"
+				if status.FailedHop != "" {
+					status.Message = fmt.Sprintf("等待SSH重连超时，失败位置: %s", status.FailedHop)
+				}
 				status.UpdatedAt = time.Now().Format(time.RFC3339)
 				status.DurationMs = time.Since(startedAt).Milliseconds()
 			})
@@ -394,11 +564,19 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				return
 			}
 
-			store, err := cfg.UpsertProfile(strings.TrimSpace(req.ProfileID), req.Profile, tunnel.AppConfig())
+			if err := validateProfileConnection(req.Profile); err != nil {
+				respondWithError(writer, fmt.Sprintf("profile连接配置无效: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			store, err := cfg.UpsertProfile(strings.TrimSpace(req.ProfileID), req.Profile, req.ClearSecrets, tunnel.AppConfig())
 			if err != nil {
 				respondWithError(writer, fmt.Sprintf("保存profile失败: %v", err), http.StatusInternalServerError)
 				return
 			}
+			if activeID, _ := cfg.ActiveProfile(tunnel.AppConfig()); activeID == strings.TrimSpace(req.ProfileID) {
+				tunnel.SyncLocalForwards(connCtx, req.Profile.LocalForwards)
+			}
 
 			response := map[string]interface{}{
 				"success": true,
@@ -453,6 +631,7 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				respondWithError(writer, fmt.Sprintf("应用profile到隧道运行时失败: %v", err), http.StatusInternalServerError)
 				return
 			}
+			tunnel.SyncLocalForwards(connCtx, store.Profiles[profileID].LocalForwards)
 
 			setProfileSwitchStatus(profileSwitchStatus{
 				SwitchID:      switchID,
@@ -556,30 +735,43 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 			writer.Write(jsonResponse)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/state", func(writer http.ResponseWriter, request *http.Request) {
-			client := tunnel.PeekSSHClient()
-			if client == nil {
-				writer.WriteHeader(500)
-				writer.Write([]byte("SSH client is not connected"))
+		adminRouter.HandleFunc("/admin/profiles/sshconfig", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "GET" {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
 				return
 			}
-			version := client.ClientVersion()
-			addr := client.LocalAddr()
-			remoteAddr := client.RemoteAddr()
-			id := client.SessionID()
-			user := client.User()
 
-			m := make(map[string]interface{})
-			m["version"] = version
-			m["localAddr"] = addr
-			m["remoteAddr"] = remoteAddr
-			m["sessionId"] = id
-			m["user"] = user
-			mbytes, _ := json.Marshal(m)
-			writer.Write(mbytes)
+			sshConfig, err := cfg.LoadSSHConfig(request.URL.Query().Get("path"))
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("读取ssh config失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			hosts := make([]cfg.SSHHostConfig, 0)
+			for _, alias := range sshConfig.Hosts() {
+				hosts = append(hosts, sshConfig.Resolve(alias))
+			}
+
+			response := map[string]interface{}{
+				"success": true,
+				"data": map[string]interface{}{
+					"path":  sshConfig.Path,
+					"hosts": hosts,
+				},
+			}
+			jsonResponse, _ := json.Marshal(response)
+			writer.Write(jsonResponse)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/reconnect", func(writer http.ResponseWriter, request *http.Request) {
+		adminRouter.HandleFunc("/admin/profiles/sshconfig/import", func(writer http.ResponseWriter, request *http.Request) {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 			writer.Header().Set("Access-Control-Allow-Origin", "*")
 			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -594,26 +786,64 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				return
 			}
 
-			if err := triggerConfigReload(); err != nil {
-				respondWithError(writer, fmt.Sprintf("重载配置失败: %v", err), http.StatusInternalServerError)
+			var req sshConfigImportRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
 				return
 			}
 
-			if err := tunnel.RefreshRuntimeConfigFromAppConfig(); err != nil {
-				respondWithError(writer, fmt.Sprintf("刷新隧道运行时配置失败: %v", err), http.StatusInternalServerError)
+			result, err := cfg.ImportSSHConfigHosts(req.Path, req.Hosts, req.Overwrite, tunnel.AppConfig())
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("导入ssh config失败: %v", err), http.StatusBadRequest)
 				return
 			}
+			applyImportedActiveProfile(tunnel, result)
 
-			tunnel.DisconnectSSHClient()
-			tunnel.ReconnectSSHWithSource(connCtx, "admin-manual")
+			response := map[string]interface{}{
+				"success": true,
+				"message": fmt.Sprintf("新增%d个，更新%d个，冲突%d个，未找到%d个", len(result.Imported), len(result.Updated), len(result.Conflicts), len(result.NotFound)),
+				"data":    result,
+			}
+			jsonResponse, _ := json.Marshal(response)
+			writer.Write(jsonResponse)
+		})
+
+		adminRouter.HandleFunc("/admin/profiles/sshconfig/sync", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			result, err := cfg.SyncSSHConfigProfiles(tunnel.AppConfig())
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("同步ssh config失败: %v", err), http.StatusInternalServerError)
+				return
+			}
+			applyImportedActiveProfile(tunnel, result)
+
+			response := map[string]interface{}{
+				"success": true,
+				"message": fmt.Sprintf("更新%d个，未变化%d个，来源缺失%d个", len(result.Updated), len(result.Unchanged), len(result.Missing)),
+				"data":    result,
+			}
+			jsonResponse, _ := json.Marshal(response)
+			writer.Write(jsonResponse)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/state", func(writer http.ResponseWriter, request *http.Request) {
 			client := tunnel.PeekSSHClient()
 			if client == nil {
-				stats := tunnel.SnapshotSSHConnectionStats()
-				errMsg := stats.LastReconnectError
-				if strings.TrimSpace(errMsg) == "" {
-					errMsg = "SSH client is not connected"
-				}
-				respondWithError(writer, errMsg, http.StatusInternalServerError)
+				writer.WriteHeader(500)
+				writer.Write([]byte("SSH client is not connected"))
 				return
 			}
 			version := client.ClientVersion()
@@ -628,107 +858,413 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 			m["remoteAddr"] = remoteAddr
 			m["sessionId"] = id
 			m["user"] = user
-			m["message"] = "已按最新配置重新连接SSH"
+			m["hostKey"] = tunnel.HostKeyStatus()
+			m["authMethodUsed"] = tunnel.SnapshotSSHConnectionStats().AuthMethodUsed
+			m["algorithms"] = tunnel.NegotiatedAlgorithms()
 			mbytes, _ := json.Marshal(m)
 			writer.Write(mbytes)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/reconnect-count/reset", func(writer http.ResponseWriter, request *http.Request) {
+		adminRouter.HandleFunc("/admin/ssh/hostkey", func(writer http.ResponseWriter, request *http.Request) {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-			if request.Method != http.MethodPost {
-				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
 				return
 			}
 
-			tunnel.ResetReconnectCount()
-			sshStats := tunnel.SnapshotSSHConnectionStats()
 			response := map[string]interface{}{
-				"success":                      true,
-				"message":                      "重连次数已清零",
-				"connectionCount":              sshStats.ConnectionCount,
-				"reconnectCount":               sshStats.ReconnectCount,
-				"consecutiveReconnectFailures": sshStats.ConsecutiveReconnectFailures,
-				"lastReconnectAt":              formatOptionalTime(sshStats.LastReconnectAt),
-				"lastReconnectFailureAt":       formatOptionalTime(sshStats.LastReconnectFailureAt),
-				"lastReconnectError":           sshStats.LastReconnectError,
+				"success": true,
+				"data":    tunnel.HostKeyStatus(),
 			}
 			mbytes, _ := json.Marshal(response)
 			writer.Write(mbytes)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/metrics", func(writer http.ResponseWriter, request *http.Request) {
+		adminRouter.HandleFunc("/admin/ssh/hostkey/accept", func(writer http.ResponseWriter, request *http.Request) {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-			if request.Method != http.MethodGet {
-				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
 				return
 			}
 
-			metrics := tunnel.SnapshotProxyMetrics()
-			sshStats := tunnel.SnapshotSSHConnectionStats()
-			listenerStats := tunnel.SnapshotListenerStats()
-			tracker := tunnel.GetRequestTracker()
+			var req hostKeyAcceptRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil && err != io.EOF {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			status := tunnel.HostKeyStatus()
+			profileID := strings.TrimSpace(req.ProfileID)
+			if profileID == "" {
+				profileID = status.ProfileID
+			}
+			if profileID == "" {
+				respondWithError(writer, "当前未使用profile，请先创建profile或直接更新known_hosts文件", http.StatusBadRequest)
+				return
+			}
+
+			// 未指定指纹时接受最近一次不匹配时服务器提供的公钥
+			fingerprint := strings.TrimSpace(req.Fingerprint)
+			jumpHost := 0
+			if req.JumpHost != nil {
+				jumpHost = *req.JumpHost
+			} else if status.Mismatch != nil {
+				jumpHost = status.Mismatch.JumpHost
+			}
+			if fingerprint == "" && status.Mismatch != nil && status.Mismatch.JumpHost == jumpHost {
+				fingerprint = status.Mismatch.Offered
+			}
+			if fingerprint == "" {
+				respondWithError(writer, "fingerprint不能为空，且当前没有待确认的主机公钥", http.StatusBadRequest)
+				return
+			}
+			if !strings.HasPrefix(fingerprint, "SHA256:") {
+				fingerprint = "SHA256:" + fingerprint
+			}
+
+			var store cfg.ProfileStore
+			var err error
+			if jumpHost > 0 {
+				store, err = cfg.SetProfileJumpHostFingerprint(profileID, jumpHost, fingerprint, tunnel.AppConfig())
+			} else {
+				store, err = cfg.SetProfileHostKeyFingerprint(profileID, fingerprint, tunnel.AppConfig())
+			}
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("保存主机公钥指纹失败: %v", err), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("profile(%s) 主机公钥指纹已更新为: %s (jumpHost=%d)", profileID, fingerprint, jumpHost)
+
+			if profileID == status.ProfileID {
+				if err := tunnel.RefreshRuntimeConfigFromAppConfig(); err != nil {
+					respondWithError(writer, fmt.Sprintf("刷新隧道运行时配置失败: %v", err), http.StatusInternalServerError)
+					return
+				}
+				tunnel.DisconnectSSHClient()
+				safe.GO(func() {
+					tunnel.ReconnectSSHWithSource(connCtx, "hostkey-accept")
+				})
+			}
+
 			response := map[string]interface{}{
-				"success":                      true,
-				"uploadBytesTotal":             metrics.UploadBytesTotal,
-				"downloadBytesTotal":           metrics.DownloadBytesTotal,
-				"uploadBps":                    metrics.UploadBps,
-				"downloadBps":                  metrics.DownloadBps,
-				"uploadSpeed":                  formatNetworkSpeed(metrics.UploadBps),
-				"downloadSpeed":                formatNetworkSpeed(metrics.DownloadBps),
-				"activeProxyConns":             metrics.ActiveProxyConns,
-				"activeRequests":               tracker.ActiveCount(),
-				"connectionCount":              sshStats.ConnectionCount,
-				"reconnectCount":               sshStats.ReconnectCount,
-				"consecutiveReconnectFailures": sshStats.ConsecutiveReconnectFailures,
-				"lastReconnectError":           sshStats.LastReconnectError,
-				"lastReconnectAt":              formatOptionalTime(sshStats.LastReconnectAt),
-				"lastReconnectFailureAt":       formatOptionalTime(sshStats.LastReconnectFailureAt),
-				"acceptErrors":                 listenerStats.AcceptErrors,
-				"listenerRestarts":             listenerStats.ListenerRestarts,
+				"success":     true,
+				"message":     fmt.Sprintf("已固定profile(%s)的主机公钥指纹", profileID),
+				"profileId":   profileID,
+				"jumpHost":    jumpHost,
+				"fingerprint": fingerprint,
+				"data":        store,
 			}
 			mbytes, _ := json.Marshal(response)
 			writer.Write(mbytes)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/exit-info", func(writer http.ResponseWriter, request *http.Request) {
+		adminRouter.HandleFunc("/admin/ssh/auth", func(writer http.ResponseWriter, request *http.Request) {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 			if request.Method != http.MethodGet {
 				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
 				return
 			}
 
-			forceRefresh := request.URL.Query().Get("refresh") == "1"
-			exitInfo := tunnel.GetExitIPInfo(request.Context(), forceRefresh)
 			response := map[string]interface{}{
-				"success":      true,
-				"available":    exitInfo.Available,
-				"ip":           exitInfo.IP,
-				"city":         exitInfo.City,
-				"region":       exitInfo.Region,
-				"country":      exitInfo.Country,
-				"location":     exitInfo.Location,
-				"organization": exitInfo.Organization,
-				"timezone":     exitInfo.Timezone,
-				"updatedAt":    formatOptionalTime(exitInfo.UpdatedAt),
-				"error":        exitInfo.Error,
-			}
-			if !exitInfo.Available && strings.TrimSpace(exitInfo.Error) != "" {
-				response["message"] = exitInfo.Error
+				"success": true,
+				"data":    tunnel.AuthStatus(),
 			}
 			mbytes, _ := json.Marshal(response)
 			writer.Write(mbytes)
 		})
 
-		adminRouter.HandleFunc("/admin/ssh/test", func(writer http.ResponseWriter, request *http.Request) {
+		adminRouter.HandleFunc("/admin/ssh/keys/unlock", func(writer http.ResponseWriter, request *http.Request) {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-			if request.Method != http.MethodPost {
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req keyUnlockRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			// 未指定路径时解锁第一个处于锁定状态的私钥
+			keyPath := strings.TrimSpace(req.Path)
+			if keyPath == "" {
+				for _, identity := range tunnel.AuthStatus().Identities {
+					if identity.Locked {
+						keyPath = identity.Path
+						break
+					}
+				}
+			}
+			if keyPath == "" {
+				respondWithError(writer, "path不能为空，且当前没有待解锁的私钥", http.StatusBadRequest)
+				return
+			}
+
+			if err := tunnel.UnlockIdentity(keyPath, req.Passphrase); err != nil {
+				respondWithError(writer, fmt.Sprintf("解锁私钥失败: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if tunnel.PeekSSHClient() == nil {
+				safe.GO(func() {
+					tunnel.ReconnectSSHWithSource(connCtx, "key-unlock")
+				})
+			}
+
+			response := map[string]interface{}{
+				"success": true,
+				"message": fmt.Sprintf("私钥已解锁: %s", keyPath),
+				"data":    tunnel.AuthStatus(),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/auth/challenge", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			switch request.Method {
+			case "OPTIONS":
+				writer.WriteHeader(http.StatusOK)
+				return
+			case http.MethodGet:
+				response := map[string]interface{}{
+					"success": true,
+					"data":    tunnel.PendingAuthChallenge(),
+				}
+				mbytes, _ := json.Marshal(response)
+				writer.Write(mbytes)
+				return
+			case http.MethodPost:
+			default:
+				respondWithError(writer, "只支持GET/POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req authChallengeRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if req.Cancel {
+				if err := tunnel.CancelAuthChallenge(req.ID); err != nil {
+					respondWithError(writer, fmt.Sprintf("取消认证失败: %v", err), http.StatusConflict)
+					return
+				}
+				response := map[string]interface{}{
+					"success": true,
+					"message": "已取消键盘交互认证",
+				}
+				mbytes, _ := json.Marshal(response)
+				writer.Write(mbytes)
+				return
+			}
+
+			if err := tunnel.AnswerAuthChallenge(req.ID, req.Answers); err != nil {
+				respondWithError(writer, fmt.Sprintf("提交应答失败: %v", err), http.StatusConflict)
+				return
+			}
+			response := map[string]interface{}{
+				"success": true,
+				"message": "已提交应答，正在继续SSH认证",
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/reconnect", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			if err := triggerConfigReload(); err != nil {
+				respondWithError(writer, fmt.Sprintf("重载配置失败: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			if err := tunnel.RefreshRuntimeConfigFromAppConfig(); err != nil {
+				respondWithError(writer, fmt.Sprintf("刷新隧道运行时配置失败: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			tunnel.DisconnectSSHClient()
+			tunnel.ReconnectSSHWithSource(connCtx, "admin-manual")
+			client := tunnel.PeekSSHClient()
+			if client == nil {
+				stats := tunnel.SnapshotSSHConnectionStats()
+				errMsg := stats.LastReconnectError
+				if strings.TrimSpace(errMsg) == "" {
+					errMsg = "SSH client is not connected"
+				}
+				respondWithError(writer, errMsg, http.StatusInternalServerError)
+				return
+			}
+			version := client.ClientVersion()
+			addr := client.LocalAddr()
+			remoteAddr := client.RemoteAddr()
+			id := client.SessionID()
+			user := client.User()
+
+			m := make(map[string]interface{})
+			m["version"] = version
+			m["localAddr"] = addr
+			m["remoteAddr"] = remoteAddr
+			m["sessionId"] = id
+			m["user"] = user
+			m["message"] = "已按最新配置重新连接SSH"
+			mbytes, _ := json.Marshal(m)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/reconnect-count/reset", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodPost {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			tunnel.ResetReconnectCount()
+			sshStats := tunnel.SnapshotSSHConnectionStats()
+			response := map[string]interface{}{
+				"success":                      true,
+				"message":                      "重连次数已清零",
+				"connectionCount":              sshStats.ConnectionCount,
+				"reconnectCount":               sshStats.ReconnectCount,
+				"consecutiveReconnectFailures": sshStats.ConsecutiveReconnectFailures,
+				"lastReconnectAt":              formatOptionalTime(sshStats.LastReconnectAt),
+				"lastReconnectFailureAt":       formatOptionalTime(sshStats.LastReconnectFailureAt),
+				"lastReconnectError":           sshStats.LastReconnectError,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/metrics", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			metrics := tunnel.SnapshotProxyMetrics()
+			sshStats := tunnel.SnapshotSSHConnectionStats()
+			listenerStats := tunnel.SnapshotListenerStats()
+			tracker := tunnel.GetRequestTracker()
+			response := map[string]interface{}{
+				"success":                      true,
+				"uploadBytesTotal":             metrics.UploadBytesTotal,
+				"downloadBytesTotal":           metrics.DownloadBytesTotal,
+				"uploadBps":                    metrics.UploadBps,
+				"downloadBps":                  metrics.DownloadBps,
+				"uploadSpeed":                  formatNetworkSpeed(metrics.UploadBps),
+				"downloadSpeed":                formatNetworkSpeed(metrics.DownloadBps),
+				"activeProxyConns":             metrics.ActiveProxyConns,
+				"activeRequests":               tracker.ActiveCount(),
+				"connectionCount":              sshStats.ConnectionCount,
+				"reconnectCount":               sshStats.ReconnectCount,
+				"consecutiveReconnectFailures": sshStats.ConsecutiveReconnectFailures,
+				"lastReconnectError":           sshStats.LastReconnectError,
+				"lastReconnectAt":              formatOptionalTime(sshStats.LastReconnectAt),
+				"lastReconnectFailureAt":       formatOptionalTime(sshStats.LastReconnectFailureAt),
+				"acceptErrors":                 listenerStats.AcceptErrors,
+				"listenerRestarts":             listenerStats.ListenerRestarts,
+				"hostKeyFingerprint":           sshStats.HostKeyFingerprint,
+				"hostKeyMismatch":              sshStats.HostKeyMismatch,
+				"authMethodUsed":               sshStats.AuthMethodUsed,
+				"authChallenge":                tunnel.PendingAuthChallenge(),
+				"certificateWarnings":          tunnel.CertificateWarnings(),
+				"lastFailedHop":                sshStats.LastFailedHop,
+				"channelProbe":                 tunnel.SnapshotChannelProbeStats(),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/exit-info", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			forceRefresh := request.URL.Query().Get("refresh") == "1"
+			exitInfo := tunnel.GetExitIPInfo(request.Context(), forceRefresh)
+			response := map[string]interface{}{
+				"success":      true,
+				"available":    exitInfo.Available,
+				"ip":           exitInfo.IP,
+				"city":         exitInfo.City,
+				"region":       exitInfo.Region,
+				"country":      exitInfo.Country,
+				"location":     exitInfo.Location,
+				"organization": exitInfo.Organization,
+				"timezone":     exitInfo.Timezone,
+				"updatedAt":    formatOptionalTime(exitInfo.UpdatedAt),
+				"error":        exitInfo.Error,
+			}
+			if !exitInfo.Available && strings.TrimSpace(exitInfo.Error) != "" {
+				response["message"] = exitInfo.Error
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/ssh/test", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodPost {
 				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
 				return
 			}
 
 			latencyMs, err := tunnel.MeasureSSHLatency()
 			if err != nil {
-				respondWithError(writer, fmt.Sprintf("SSH延迟测试失败: %v", err), http.StatusInternalServerError)
+				// 探测传输链路，区分是代理一段还是SSH一段失败
+				probe := tunnel.ProbeTransport()
+				failedLeg := probe.FailedLeg
+				if failedLeg == "" {
+					failedLeg = "ssh"
+				}
+				response := map[string]interface{}{
+					"success":   false,
+					"error":     true,
+					"message":   fmt.Sprintf("SSH延迟测试失败: %v", err),
+					"failedLeg": failedLeg,
+					"transport": probe,
+				}
+				mbytes, _ := json.Marshal(response)
+				writer.WriteHeader(http.StatusInternalServerError)
+				writer.Write(mbytes)
 				return
 			}
 
@@ -837,11 +1373,16 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				Host      string `json:"host"`
 				Port      string `json:"port"`
 				Protocol  string `json:"protocol"`
+				Forward   string `json:"forward,omitempty"`
+				User      string `json:"user,omitempty"`
+				Rule      string `json:"rule,omitempty"`
 				Status    string `json:"status"`
 				StartTime string `json:"startTime"`
 				Duration  string `json:"duration"`
 				Error     string `json:"error,omitempty"`
 				ViaSSH    bool   `json:"viaSSH"`
+				Upload    uint64 `json:"uploadBytes,omitempty"`
+				Download  uint64 `json:"downloadBytes,omitempty"`
 			}
 
 			formatDuration := func(d time.Duration) string {
@@ -864,11 +1405,16 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 					Host:      r.Host,
 					Port:      r.Port,
 					Protocol:  r.Protocol,
+					Forward:   r.Forward,
+					User:      r.User,
+					Rule:      r.Rule,
 					Status:    string(r.Status),
 					StartTime: r.StartTime.Format("15:04:05"),
 					Duration:  dur,
 					Error:     r.Error,
 					ViaSSH:    r.ViaSSH,
+					Upload:    r.UploadBytes,
+					Download:  r.DownloadBytes,
 				})
 			}
 
@@ -881,10 +1427,365 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 			writer.Write(mbytes)
 		})
 
+		adminRouter.HandleFunc("/admin/forwards", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			profileID, profile := cfg.ActiveProfile(tunnel.AppConfig())
+			response := map[string]interface{}{
+				"success":    true,
+				"profileId":  profileID,
+				"configured": profile.LocalForwards,
+				"forwards":   tunnel.LocalForwards(),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/forwards/remote", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			response := map[string]interface{}{
+				"success":  true,
+				"forwards": tunnel.RemoteForwards(),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/forwards/upsert", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req localForwardUpsertRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			forward := req.Forward
+			forward.Name = strings.TrimSpace(forward.Name)
+			forward.ListenAddress = strings.TrimSpace(forward.ListenAddress)
+			forward.Target = strings.TrimSpace(forward.Target)
+			forward.Network = strings.TrimSpace(forward.Network)
+			if err := sshtunnel.ValidateLocalForward(forward); err != nil {
+				respondWithError(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			activeID, _ := cfg.ActiveProfile(tunnel.AppConfig())
+			profileID := strings.TrimSpace(req.ProfileID)
+			if profileID == "" {
+				profileID = activeID
+			}
+			if profileID == "" {
+				respondWithError(writer, "当前未使用profile，请先创建profile", http.StatusBadRequest)
+				return
+			}
+
+			// 当前profile的转发先启动监听，冲突时不保存
+			if profileID == activeID {
+				if err := tunnel.StartLocalForward(connCtx, forward); err != nil {
+					respondWithError(writer, fmt.Sprintf("启动转发失败: %v", err), http.StatusBadRequest)
+					return
+				}
+			}
+			store, err := cfg.UpsertProfileLocalForward(profileID, forward, tunnel.AppConfig())
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("保存转发失败: %v", err), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("profile(%s) 静态端口转发已保存: %s %s -> %s", profileID, forward.Name, forward.ListenAddress, forward.Target)
+
+			response := map[string]interface{}{
+				"success":   true,
+				"message":   fmt.Sprintf("已保存转发: %s", forward.Name),
+				"profileId": profileID,
+				"forwards":  store.Profiles[profileID].LocalForwards,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/forwards/delete", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req localForwardDeleteRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			name := strings.TrimSpace(req.Name)
+			if name == "" {
+				respondWithError(writer, "name不能为空", http.StatusBadRequest)
+				return
+			}
+
+			activeID, _ := cfg.ActiveProfile(tunnel.AppConfig())
+			profileID := strings.TrimSpace(req.ProfileID)
+			if profileID == "" {
+				profileID = activeID
+			}
+			if profileID == "" {
+				respondWithError(writer, "当前未使用profile，请先创建profile", http.StatusBadRequest)
+				return
+			}
+
+			store, err := cfg.DeleteProfileLocalForward(profileID, name, tunnel.AppConfig())
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("删除转发失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			if profileID == activeID {
+				tunnel.StopLocalForward(name)
+			}
+
+			response := map[string]interface{}{
+				"success":   true,
+				"message":   fmt.Sprintf("已删除转发: %s", name),
+				"profileId": profileID,
+				"forwards":  store.Profiles[profileID].LocalForwards,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/proxy-users", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			users, filePath := tunnel.ProxyUsers()
+			response := map[string]interface{}{
+				"success": true,
+				"file":    filePath,
+				"users":   users,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/proxy-users/upsert", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req proxyUserUpsertRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := tunnel.UpsertProxyUser(req.Username, req.Password); err != nil {
+				respondWithError(writer, fmt.Sprintf("保存代理用户失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			log.Printf("代理用户已保存: %s", req.Username)
+
+			users, _ := tunnel.ProxyUsers()
+			response := map[string]interface{}{
+				"success": true,
+				"message": fmt.Sprintf("已保存用户: %s", req.Username),
+				"users":   users,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/proxy-users/delete", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req proxyUserDeleteRequest
+			if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+				respondWithError(writer, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := tunnel.DeleteProxyUser(req.Username); err != nil {
+				respondWithError(writer, fmt.Sprintf("删除代理用户失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			log.Printf("代理用户已删除: %s", req.Username)
+
+			users, _ := tunnel.ProxyUsers()
+			response := map[string]interface{}{
+				"success": true,
+				"message": fmt.Sprintf("已删除用户: %s", req.Username),
+				"users":   users,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/route/rules", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			enabled, filePath, rules, ruleErrors := tunnel.RouteRules()
+			response := map[string]interface{}{
+				"success": true,
+				"enabled": enabled,
+				"file":    filePath,
+				"rules":   rules,
+				"errors":  ruleErrors,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/route/test", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			query := request.URL.Query()
+			target := strings.TrimSpace(query.Get("target"))
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				respondWithError(writer, "target 格式应为 host:port", http.StatusBadRequest)
+				return
+			}
+			protocol := strings.TrimSpace(query.Get("protocol"))
+			if protocol == "" {
+				protocol = "socks5"
+			}
+			decision := tunnel.TestRoute(target, strings.TrimSpace(query.Get("src")), protocol)
+			response := map[string]interface{}{
+				"success":  true,
+				"target":   target,
+				"protocol": protocol,
+				"action":   decision.Action,
+				"rule":     decision.Rule,
+				"line":     decision.Line,
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/route/import", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			request.Body = http.MaxBytesReader(writer, request.Body, maxRuleImportSize)
+			data, source, err := readRuleImportUpload(request)
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("读取上传的规则失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			query := request.URL.Query()
+			policies, err := sshtunnel.ParseRulePolicies(query.Get("policy"))
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("导入规则失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			result, err := sshtunnel.ImportRuleSet(data, policies)
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("导入规则失败: %v", err), http.StatusBadRequest)
+				return
+			}
+			content := sshtunnel.RenderImportedRules(result, source)
+
+			filePath := tunnel.RouteRulesFilePath()
+			dryRun := query.Get("dryRun") == "true"
+			if !dryRun && len(result.Rules) > 0 {
+				if filePath == "" {
+					respondWithError(writer, "路由规则文件路径未配置", http.StatusInternalServerError)
+					return
+				}
+				if err := sshtunnel.WriteRouteRulesFile(filePath, content); err != nil {
+					respondWithError(writer, fmt.Sprintf("写入路由规则文件失败: %v", err), http.StatusInternalServerError)
+					return
+				}
+				log.Printf("已从%s规则导入%d条路由规则到 %s，%d行无法转换", result.Format, len(result.Rules), filePath, len(result.Unsupported))
+			}
+
+			response := map[string]interface{}{
+				"success":     true,
+				"dryRun":      dryRun,
+				"written":     !dryRun && len(result.Rules) > 0,
+				"file":        filePath,
+				"format":      result.Format,
+				"rules":       result.Rules,
+				"policies":    result.Policies,
+				"unsupported": result.Unsupported,
+				"content":     string(content),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
 		adminRouter.HandleFunc("/admin/monitor", func(writer http.ResponseWriter, request *http.Request) {
 			m := make(map[string]interface{})
 			m["matchedDomain"] = tunnel.DomainMatchCache()
 			m["domainFilters"] = tunnel.Domains()
+			m["domainCache"] = tunnel.DomainCacheStats()
+			m["domainListErrors"] = tunnel.DomainListErrors()
 
 			mbytes, _ := json.Marshal(m)
 			writer.Write(mbytes)
@@ -905,8 +1806,15 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				return
 			}
 
+			entry, err := sshtunnel.ValidateDomainEntry(domain)
+			if err != nil {
+				writer.WriteHeader(400)
+				writer.Write([]byte(err.Error()))
+				return
+			}
+
 			domains := tunnel.Domains()
-			domains[strings.ToLower(domain)] = true
+			domains[entry] = true
 			tunnel.SetDomains(domains)
 			writer.Write([]byte("success"))
 		})
@@ -925,19 +1833,53 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 			writer.Write([]byte("success"))
 		})
 
+		adminRouter.HandleFunc("/admin/domains/subscriptions", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if request.Method != http.MethodGet {
+				respondWithError(writer, "只支持GET方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			response := map[string]interface{}{
+				"success":       true,
+				"subscriptions": tunnel.DomainSubscriptions(),
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
+		adminRouter.HandleFunc("/admin/domains/subscriptions/refresh", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if request.Method == "OPTIONS" {
+				writer.WriteHeader(http.StatusOK)
+				return
+			}
+			if request.Method != "POST" {
+				respondWithError(writer, "只支持POST方法", http.StatusMethodNotAllowed)
+				return
+			}
+
+			tunnel.RefreshDomainSubscriptions()
+			response := map[string]interface{}{
+				"success": true,
+				"message": "已开始刷新域名列表订阅",
+			}
+			mbytes, _ := json.Marshal(response)
+			writer.Write(mbytes)
+		})
+
 		adminRouter.HandleFunc("/admin/domains/flush", func(writer http.ResponseWriter, request *http.Request) {
 			appConfig := tunnel.AppConfig()
 			filePath := appConfig.HttpDomainFilterFilePath.GetValue()
-			file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-			if err != nil {
+			if err := tunnel.FlushDomainList(filePath); err != nil {
+				writer.WriteHeader(http.StatusConflict)
 				writer.Write([]byte(err.Error()))
 				return
 			}
-			defer file.Close()
-
-			for domain, _ := range tunnel.Domains() {
-				file.WriteString(domain + "\n")
-			}
 
 			writer.Write([]byte("flush to file:" + filePath + " success"))
 		})
@@ -1044,8 +1986,12 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				return
 			}
 
-			// 记录配置更新日志
-			log.Printf("配置更新请求: frontend_key=%s -> actual_key=%s, value=%v, type=%s", configKey, actualConfigKey, typedValue, configType)
+			// 记录配置更新日志，敏感配置项不输出明文
+			displayValue := typedValue
+			if cfg.IsSecretConfigKey(actualConfigKey) {
+				displayValue = "******"
+			}
+			log.Printf("配置更新请求: frontend_key=%s -> actual_key=%s, value=%v, type=%s", configKey, actualConfigKey, displayValue, configType)
 
 			// 使用viper更新配置，使用实际的配置键
 			if err = cfg.UpdateConfigValue(actualConfigKey, typedValue); err != nil {
@@ -1057,10 +2003,10 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 			// 返回成功响应
 			response := map[string]interface{}{
 				"success":   true,
-				"message":   fmt.Sprintf("配置项 %s 已成功更新为 %v", configKey, typedValue),
+				"message":   fmt.Sprintf("配置项 %s 已成功更新为 %v", configKey, displayValue),
 				"key":       configKey,
 				"actualKey": actualConfigKey,
-				"value":     typedValue,
+				"value":     displayValue,
 				"type":      configType,
 			}
 
@@ -1102,16 +2048,40 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				{"key": appConfig.ServerSshPort.Key, "type": "int", "description": "SSH端口", "category": "服务器"},
 				{"key": appConfig.LoginUser.Key, "type": "string", "description": "登录用户名", "category": "服务器"},
 				{"key": appConfig.SshPrivateKeyPath.Key, "type": "string", "description": "私钥文件路径", "category": "SSH"},
+				{"key": appConfig.SshPrivateKeyPassphrase.Key, "type": "string", "description": "SSH私钥口令(用于加密私钥)", "category": "SSH"},
 				{"key": appConfig.LocalAddress.Key, "type": "string", "description": "本地SOCKS5监听地址", "category": "代理"},
 				{"key": appConfig.HttpLocalAddress.Key, "type": "string", "description": "本地HTTP监听地址", "category": "代理"},
+				{"key": appConfig.MixedLocalAddress.Key, "type": "string", "description": "混合端口本地地址", "category": "代理"},
 				{"key": appConfig.EnableHttp.Key, "type": "bool", "description": "启用HTTP代理", "category": "代理"},
+				{"key": appConfig.HttpTlsEnable.Key, "type": "bool", "description": "HTTP代理监听端口启用TLS(https代理)", "category": "代理"},
+				{"key": appConfig.HttpTlsCertFile.Key, "type": "string", "description": "HTTP代理TLS证书文件(留空则在主目录生成自签名证书)", "category": "代理"},
+				{"key": appConfig.HttpTlsKeyFile.Key, "type": "string", "description": "HTTP代理TLS私钥文件", "category": "代理"},
+				{"key": appConfig.HttpAuthUsersFile.Key, "type": "string", "description": "HTTP代理多用户文件(htpasswd格式,支持bcrypt/SHA)", "category": "代理"},
+				{"key": appConfig.HttpAuthMaxFailures.Key, "type": "int", "description": "同一客户端IP允许的连续认证失败次数(0为不限制)", "category": "代理"},
+				{"key": appConfig.HttpAuthBlockSec.Key, "type": "int", "description": "认证失败次数超限后封禁客户端IP的时长(秒)", "category": "代理"},
+				{"key": appConfig.RouteEnable.Key, "type": "bool", "description": "启用规则路由(DIRECT/SSH/REJECT)", "category": "代理"},
+				{"key": appConfig.RouteRulesFile.Key, "type": "string", "description": "路由规则文件(留空则使用主目录下的rules.txt)", "category": "代理"},
 				{"key": appConfig.EnableSocks5.Key, "type": "bool", "description": "启用SOCKS5代理", "category": "代理"},
+				{"key": appConfig.EnableMixed.Key, "type": "bool", "description": "开启混合端口代理(自动识别SOCKS5/SOCKS4/HTTP)", "category": "代理"},
+				{"key": appConfig.Socks5UdpEnable.Key, "type": "bool", "description": "是否启用SOCKS5 UDP ASSOCIATE", "category": "代理"},
+				{"key": appConfig.Socks5UdpRelayAddress.Key, "type": "string", "description": "SOCKS5 UDP中继地址(经SSH连接的udpgw兼容服务)", "category": "代理"},
+				{"key": appConfig.Socks5UdpIdleTimeoutSec.Key, "type": "int", "description": "SOCKS5 UDP关联空闲超时(秒)", "category": "代理"},
 				{"key": appConfig.HttpBasicAuthEnable.Key, "type": "bool", "description": "启用HTTP Basic认证", "category": "认证"},
 				{"key": appConfig.HttpBasicUserName.Key, "type": "string", "description": "HTTP Basic用户名", "category": "认证"},
 				{"key": appConfig.HttpBasicPassword.Key, "type": "string", "description": "HTTP Basic密码", "category": "认证"},
+				{"key": appConfig.Socks5AuthEnable.Key, "type": "bool", "description": "是否启用SOCKS5用户名密码认证(RFC 1929)", "category": "认证"},
+				{"key": appConfig.Socks5NoAuthEnable.Key, "type": "bool", "description": "是否允许SOCKS5无认证连接", "category": "认证"},
+				{"key": appConfig.Socks5AuthShareHttpBasic.Key, "type": "bool", "description": "SOCKS5认证使用HTTP基本认证的用户名密码", "category": "认证"},
+				{"key": appConfig.Socks5AuthUserName.Key, "type": "string", "description": "SOCKS5认证用户名", "category": "认证"},
+				{"key": appConfig.Socks5AuthPassword.Key, "type": "string", "description": "SOCKS5认证密码", "category": "认证"},
 				{"key": appConfig.EnableHttpOverSSH.Key, "type": "bool", "description": "启用HTTP Over SSH", "category": "代理"},
 				{"key": appConfig.EnableHttpDomainFilter.Key, "type": "bool", "description": "启用域名过滤", "category": "过滤"},
 				{"key": appConfig.HttpDomainFilterFilePath.Key, "type": "string", "description": "域名过滤文件路径", "category": "过滤"},
+				{"key": appConfig.HttpDomainCacheSize.Key, "type": "int", "description": "域名匹配缓存容量(条)", "category": "过滤"},
+				{"key": appConfig.HttpDomainCacheTTLSec.Key, "type": "int", "description": "域名匹配缓存过期时间(秒)", "category": "过滤"},
+				{"key": appConfig.HttpDomainSubscriptions.Key, "type": "string", "description": "域名列表订阅地址(多个用逗号分隔)", "category": "过滤"},
+				{"key": appConfig.HttpDomainSubIntervalMin.Key, "type": "int", "description": "域名列表订阅刷新间隔(分钟)", "category": "过滤"},
+				{"key": appConfig.HttpDomainSubViaSSH.Key, "type": "bool", "description": "通过SSH隧道下载域名列表订阅", "category": "过滤"},
 				{"key": appConfig.EnableAdmin.Key, "type": "bool", "description": "启用管理界面", "category": "管理"},
 				{"key": appConfig.AdminAddress.Key, "type": "string", "description": "管理界面监听地址", "category": "管理"},
 				{"key": appConfig.RetryIntervalSec.Key, "type": "int", "description": "重试间隔(秒)", "category": "高级"},
@@ -1121,6 +2091,13 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) {
 				{"key": appConfig.SSHKeepAliveCountMax.Key, "type": "int", "description": "SSH保活最大连续失败次数", "category": "高级"},
 				{"key": appConfig.SSHReconnectMaxRetries.Key, "type": "int", "description": "SSH重连最大重试次数", "category": "高级"},
 				{"key": appConfig.SSHReconnectMaxIntervalSec.Key, "type": "int", "description": "SSH重连最大退避间隔(秒)", "category": "高级"},
+				{"key": appConfig.SSHAuthChallengeTimeoutSec.Key, "type": "int", "description": "SSH键盘交互认证等待应答超时(秒)", "category": "高级"},
+				{"key": appConfig.SSHCertExpiryWarnMin.Key, "type": "int", "description": "SSH用户证书到期提前告警时间(分钟)", "category": "高级"},
+				{"key": appConfig.SSHProbeEnable.Key, "type": "bool", "description": "是否启用direct-tcpip通道健康探测", "category": "高级"},
+				{"key": appConfig.SSHProbeTarget.Key, "type": "string", "description": "通道健康探测目标地址(由SSH服务器连接)", "category": "高级"},
+				{"key": appConfig.SSHProbeIntervalSec.Key, "type": "int", "description": "通道健康探测间隔(秒)", "category": "高级"},
+				{"key": appConfig.SSHProbeTimeoutSec.Key, "type": "int", "description": "通道健康探测超时(秒)", "category": "高级"},
+				{"key": appConfig.SSHProbeFailureThreshold.Key, "type": "int", "description": "通道健康探测连续失败多少次后重建SSH连接", "category": "高级"},
 				{"key": appConfig.LogFilePath.Key, "type": "string", "description": "日志文件路径", "category": "高级"},
 				{"key": appConfig.HomeDir.Key, "type": "string", "description": "运行状态目录", "category": "高级"},
 				{"key": appConfig.AutoUpdateEnabled.Key, "type": "bool", "description": "启用自动更新检查", "category": "更新"},
@@ -1570,19 +2547,43 @@ func cleanupDuplicateConfigs() error {
 		appConfig.ServerIp.Key,
 		appConfig.ServerSshPort.Key,
 		appConfig.SshPrivateKeyPath.Key,
+		appConfig.SshPrivateKeyPassphrase.Key,
 		appConfig.LoginUser.Key,
 		appConfig.LocalAddress.Key,
 		appConfig.HttpLocalAddress.Key,
+		appConfig.MixedLocalAddress.Key,
 		appConfig.EnableHttp.Key,
+		appConfig.HttpTlsEnable.Key,
+		appConfig.HttpTlsCertFile.Key,
+		appConfig.HttpTlsKeyFile.Key,
+		appConfig.HttpAuthUsersFile.Key,
+		appConfig.HttpAuthMaxFailures.Key,
+		appConfig.HttpAuthBlockSec.Key,
+		appConfig.RouteEnable.Key,
+		appConfig.RouteRulesFile.Key,
 		appConfig.EnableSocks5.Key,
+		appConfig.EnableMixed.Key,
+		appConfig.Socks5UdpEnable.Key,
+		appConfig.Socks5UdpRelayAddress.Key,
+		appConfig.Socks5UdpIdleTimeoutSec.Key,
 		appConfig.EnableHttpOverSSH.Key,
 		appConfig.EnableHttpDomainFilter.Key,
 		appConfig.HttpDomainFilterFilePath.Key,
+		appConfig.HttpDomainCacheSize.Key,
+		appConfig.HttpDomainCacheTTLSec.Key,
+		appConfig.HttpDomainSubscriptions.Key,
+		appConfig.HttpDomainSubIntervalMin.Key,
+		appConfig.HttpDomainSubViaSSH.Key,
 		appConfig.EnableAdmin.Key,
 		appConfig.AdminAddress.Key,
 		appConfig.HttpBasicAuthEnable.Key,
 		appConfig.HttpBasicUserName.Key,
 		appConfig.HttpBasicPassword.Key,
+		appConfig.Socks5AuthEnable.Key,
+		appConfig.Socks5NoAuthEnable.Key,
+		appConfig.Socks5AuthShareHttpBasic.Key,
+		appConfig.Socks5AuthUserName.Key,
+		appConfig.Socks5AuthPassword.Key,
 		appConfig.RetryIntervalSec.Key,
 		appConfig.SSHDialTimeoutSec.Key,
 		appConfig.SSHDestDialTimeoutSec.Key,
@@ -1590,6 +2591,13 @@ func cleanupDuplicateConfigs() error {
 		appConfig.SSHKeepAliveCountMax.Key,
 		appConfig.SSHReconnectMaxRetries.Key,
 		appConfig.SSHReconnectMaxIntervalSec.Key,
+		appConfig.SSHAuthChallengeTimeoutSec.Key,
+		appConfig.SSHCertExpiryWarnMin.Key,
+		appConfig.SSHProbeEnable.Key,
+		appConfig.SSHProbeTarget.Key,
+		appConfig.SSHProbeIntervalSec.Key,
+		appConfig.SSHProbeTimeoutSec.Key,
+		appConfig.SSHProbeFailureThreshold.Key,
 		appConfig.LogFilePath.Key,
 		appConfig.AutoUpdateEnabled.Key,
 		appConfig.AutoUpdateOwner.Key,
@@ -39,16 +39,28 @@ func SaveConfig() error {
 	return configInstance.WriteConfig()
 }
 
-// UpdateConfigValue 更新配置项
+// UpdateConfigValue 更新配置项，敏感配置项以 EncryptSecret 加密后保存
 func UpdateConfigValue(key string, value interface{}) error {
 	if configInstance == nil {
 		return fmt.Errorf("配置实例未初始化")
 	}
 
+	if plain, ok := value.(string); ok && IsSecretConfigKey(key) {
+		encrypted, err := EncryptSecret(plain)
+		if err != nil {
+			return fmt.Errorf("加密配置项 %s 失败: %w", key, err)
+		}
+		value = encrypted
+	}
 	configInstance.Set(key, value)
 	return SaveConfig()
 }
 
+// IsSecretConfigKey 判断配置项是否为加密保存的敏感配置，使用时需经 DecryptSecret 解密
+func IsSecretConfigKey(key string) bool {
+	return key == SSH_PRIVATE_KEY_PASSPHRASE_KEY
+}
+
 func NewAppConfig() *AppConfig {
 	appConfigOnce.Do(func() {
 		u, err := user.Current()
@@ -69,17 +81,41 @@ func NewAppConfig() *AppConfig {
 				ServerIp:                   NewConfigItem(SERVER_IP_KEY, "s", "", "服务器IP地址", ""),
 				ServerSshPort:              NewConfigItem(SERVER_SSH_PORT_KEY, "p", 22, "SSH服务器端口", 22),
 				SshPrivateKeyPath:          NewConfigItem(SSH_PRIVATE_KEY_PATH_KEY, "", path.Join(defaultHomeDir, ".ssh/id_rsa"), "SSH私钥文件路径", ""),
+				SshPrivateKeyPassphrase:    NewConfigItem(SSH_PRIVATE_KEY_PASSPHRASE_KEY, "", "", "SSH私钥口令(用于加密私钥)", ""),
 				LoginUser:                  NewConfigItem(LOGIN_USER_KEY, "u", "root", "SSH登录用户名", ""),
 				LocalAddress:               NewConfigItem(LOCAL_ADDRESS_KEY, "l", "0.0.0.0:1081", "本地地址", ""),
 				HttpLocalAddress:           NewConfigItem(HTTP_LOCAL_ADDRESS_KEY, "", "0.0.0.0:1082", "HTTP本地地址", ""),
+				MixedLocalAddress:          NewConfigItem(MIXED_LOCAL_ADDRESS_KEY, "", "0.0.0.0:1080", "混合端口本地地址", ""),
 				HttpBasicAuthEnable:        NewConfigItem(HTTP_BASIC_AUTH_ENABLE_KEY, "", false, "是否启用HTTP基本认证", false),
 				HttpBasicUserName:          NewConfigItem(HTTP_BASIC_USER_NAME_KEY, "", "", "HTTP基本认证用户名", ""),
 				HttpBasicPassword:          NewConfigItem(HTTP_BASIC_PASSWORD_KEY, "", "", "HTTP基本认证密码", ""),
+				Socks5AuthEnable:           NewConfigItem(SOCKS5_AUTH_ENABLE_KEY, "", false, "是否启用SOCKS5用户名密码认证(RFC 1929)", false),
+				Socks5NoAuthEnable:         NewConfigItem(SOCKS5_NOAUTH_ENABLE_KEY, "", true, "是否允许SOCKS5无认证连接", true),
+				Socks5AuthShareHttpBasic:   NewConfigItem(SOCKS5_AUTH_SHARE_HTTP_BASIC_KEY, "", false, "SOCKS5认证使用HTTP基本认证的用户名密码", false),
+				Socks5AuthUserName:         NewConfigItem(SOCKS5_AUTH_USER_NAME_KEY, "", "", "SOCKS5认证用户名", ""),
+				Socks5AuthPassword:         NewConfigItem(SOCKS5_AUTH_PASSWORD_KEY, "", "", "SOCKS5认证密码", ""),
 				EnableHttp:                 NewConfigItem(ENABLE_HTTP_KEY, "", false, "开启Http代理", false),
+				HttpTlsEnable:              NewConfigItem(HTTP_TLS_ENABLE_KEY, "", false, "HTTP代理监听端口启用TLS(https代理)", false),
+				HttpTlsCertFile:            NewConfigItem(HTTP_TLS_CERT_FILE_KEY, "", "", "HTTP代理TLS证书文件(留空则在主目录生成自签名证书)", ""),
+				HttpTlsKeyFile:             NewConfigItem(HTTP_TLS_KEY_FILE_KEY, "", "", "HTTP代理TLS私钥文件", ""),
+				HttpAuthUsersFile:          NewConfigItem(HTTP_AUTH_USERS_FILE_KEY, "", "", "HTTP代理多用户文件(htpasswd格式,支持bcrypt/SHA)", ""),
+				HttpAuthMaxFailures:        NewConfigItem(HTTP_AUTH_MAX_FAILURES_KEY, "", 5, "同一客户端IP允许的连续认证失败次数(0为不限制)", 5),
+				HttpAuthBlockSec:           NewConfigItem(HTTP_AUTH_BLOCK_SEC_KEY, "", 300, "认证失败次数超限后封禁客户端IP的时长(秒)", 300),
+				RouteEnable:                NewConfigItem(ROUTE_ENABLE_KEY, "", false, "启用规则路由(DIRECT/SSH/REJECT)", false),
+				RouteRulesFile:             NewConfigItem(ROUTE_RULES_FILE_KEY, "", "", "路由规则文件(留空则使用主目录下的rules.txt)", ""),
 				EnableSocks5:               NewConfigItem(ENABLE_SOCKS5_KEY, "", true, "开启Socks5代理", false),
+				EnableMixed:                NewConfigItem(ENABLE_MIXED_KEY, "", false, "开启混合端口代理(自动识别SOCKS5/SOCKS4/HTTP)", false),
+				Socks5UdpEnable:            NewConfigItem(SOCKS5_UDP_ENABLE_KEY, "", false, "是否启用SOCKS5 UDP ASSOCIATE", false),
+				Socks5UdpRelayAddress:      NewConfigItem(SOCKS5_UDP_RELAY_ADDRESS_KEY, "", "127.0.0.1:7300", "SOCKS5 UDP中继地址(经SSH连接的udpgw兼容服务)", ""),
+				Socks5UdpIdleTimeoutSec:    NewConfigItem(SOCKS5_UDP_IDLE_TIMEOUT_SEC_KEY, "", 60, "SOCKS5 UDP关联空闲超时(秒)", 60),
 				EnableHttpOverSSH:          NewConfigItem(ENABLE_HTTP_OVER_SSH_KEY, "", false, "开启HTTP Over SSH", false),
 				EnableHttpDomainFilter:     NewConfigItem(ENABLE_HTTP_DOMAIN_FILTER_KEY, "", false, "启用HTTP域名过滤", false),
 				HttpDomainFilterFilePath:   NewConfigItem(HTTP_DOMAIN_FILTER_FILE_PATH_KEY, "", path.Join(defaultHomeDir, APP_NAME_HIDE, "domain.txt"), "HTTP域名过滤文件路径", ""),
+				HttpDomainCacheSize:        NewConfigItem(HTTP_DOMAIN_CACHE_SIZE_KEY, "", 4096, "域名匹配缓存容量(条)", 4096),
+				HttpDomainCacheTTLSec:      NewConfigItem(HTTP_DOMAIN_CACHE_TTL_SEC_KEY, "", 600, "域名匹配缓存过期时间(秒)", 600),
+				HttpDomainSubscriptions:    NewConfigItem(HTTP_DOMAIN_SUBSCRIPTIONS_KEY, "", "", "域名列表订阅地址(多个用逗号分隔)", ""),
+				HttpDomainSubIntervalMin:   NewConfigItem(HTTP_DOMAIN_SUB_INTERVAL_MIN_KEY, "", 360, "域名列表订阅刷新间隔(分钟)", 360),
+				HttpDomainSubViaSSH:        NewConfigItem(HTTP_DOMAIN_SUB_VIA_SSH_KEY, "", false, "通过SSH隧道下载域名列表订阅", false),
 				EnableAdmin:                NewConfigItem(ENABLE_ADMIN_KEY, "", true, "开启管理页面", true),
 				AdminAddress:               NewConfigItem(ADMIN_ADDRESS_KEY, "", ":1083", "管理页面监听地址", ""),
 				RetryIntervalSec:           NewConfigItem(RETRY_INTERVAL_SEC_KEY, "", 3, "重试间隔时间(秒)", 3),
@@ -89,6 +125,13 @@ func NewAppConfig() *AppConfig {
 				SSHKeepAliveCountMax:       NewConfigItem(SSH_KEEPALIVE_COUNT_MAX_KEY, "", 2, "SSH保活最大连续失败次数", 2),
 				SSHReconnectMaxRetries:     NewConfigItem(SSH_RECONNECT_MAX_RETRIES_KEY, "", 20, "SSH重连最大重试次数", 20),
 				SSHReconnectMaxIntervalSec: NewConfigItem(SSH_RECONNECT_MAX_INTERVAL_SEC_KEY, "", 5, "SSH重连最大退避间隔(秒)", 5),
+				SSHAuthChallengeTimeoutSec: NewConfigItem(SSH_AUTH_CHALLENGE_TIMEOUT_SEC_KEY, "", 300, "SSH键盘交互认证等待应答超时(秒)", 300),
+				SSHCertExpiryWarnMin:       NewConfigItem(SSH_CERT_EXPIRY_WARN_MIN_KEY, "", 60, "SSH用户证书到期提前告警时间(分钟)", 60),
+				SSHProbeEnable:             NewConfigItem(SSH_PROBE_ENABLE_KEY, "", false, "是否启用direct-tcpip通道健康探测", false),
+				SSHProbeTarget:             NewConfigItem(SSH_PROBE_TARGET_KEY, "", "127.0.0.1:22", "通道健康探测目标地址(由SSH服务器连接)", ""),
+				SSHProbeIntervalSec:        NewConfigItem(SSH_PROBE_INTERVAL_SEC_KEY, "", 30, "通道健康探测间隔(秒)", 30),
+				SSHProbeTimeoutSec:         NewConfigItem(SSH_PROBE_TIMEOUT_SEC_KEY, "", 5, "通道健康探测超时(秒)", 5),
+				SSHProbeFailureThreshold:   NewConfigItem(SSH_PROBE_FAILURE_THRESHOLD_KEY, "", 3, "通道健康探测连续失败多少次后重建SSH连接", 3),
 				LogFilePath:                NewConfigItem(LOG_FILE_PATH_KEY, "", path.Join(defaultHomeDir, APP_NAME_HIDE, "console.log"), "日志文件路径", ""),
 
 				// 自动更新配置
@@ -104,17 +147,41 @@ func NewAppConfig() *AppConfig {
 				ServerIp:                   NewConfigItem(SERVER_IP_KEY, "s", "", "服务器IP地址", ""),
 				ServerSshPort:              NewConfigItem(SERVER_SSH_PORT_KEY, "p", 22, "SSH服务器端口", 22),
 				SshPrivateKeyPath:          NewConfigItem(SSH_PRIVATE_KEY_PATH_KEY, "", path.Join(u.HomeDir, ".ssh/id_rsa"), "SSH私钥文件路径", ""),
+				SshPrivateKeyPassphrase:    NewConfigItem(SSH_PRIVATE_KEY_PASSPHRASE_KEY, "", "", "SSH私钥口令(用于加密私钥)", ""),
 				LoginUser:                  NewConfigItem(LOGIN_USER_KEY, "u", "root", "SSH登录用户名", ""),
 				LocalAddress:               NewConfigItem(LOCAL_ADDRESS_KEY, "l", "0.0.0.0:1081", "本地地址", ""),
 				HttpLocalAddress:           NewConfigItem(HTTP_LOCAL_ADDRESS_KEY, "", "0.0.0.0:1082", "HTTP本地地址", ""),
+				MixedLocalAddress:          NewConfigItem(MIXED_LOCAL_ADDRESS_KEY, "", "0.0.0.0:1080", "混合端口本地地址", ""),
 				HttpBasicAuthEnable:        NewConfigItem(HTTP_BASIC_AUTH_ENABLE_KEY, "", false, "是否启用HTTP基本认证", false),
 				HttpBasicUserName:          NewConfigItem(HTTP_BASIC_USER_NAME_KEY, "", "", "HTTP基本认证用户名", ""),
 				HttpBasicPassword:          NewConfigItem(HTTP_BASIC_PASSWORD_KEY, "", "", "HTTP基本认证密码", ""),
+				Socks5AuthEnable:           NewConfigItem(SOCKS5_AUTH_ENABLE_KEY, "", false, "是否启用SOCKS5用户名密码认证(RFC 1929)", false),
+				Socks5NoAuthEnable:         NewConfigItem(SOCKS5_NOAUTH_ENABLE_KEY, "", true, "是否允许SOCKS5无认证连接", true),
+				Socks5AuthShareHttpBasic:   NewConfigItem(SOCKS5_AUTH_SHARE_HTTP_BASIC_KEY, "", false, "SOCKS5认证使用HTTP基本认证的用户名密码", false),
+				Socks5AuthUserName:         NewConfigItem(SOCKS5_AUTH_USER_NAME_KEY, "", "", "SOCKS5认证用户名", ""),
+				Socks5AuthPassword:         NewConfigItem(SOCKS5_AUTH_PASSWORD_KEY, "", "", "SOCKS5认证密码", ""),
 				EnableHttp:                 NewConfigItem(ENABLE_HTTP_KEY, "", false, "开启Http代理", false),
+				HttpTlsEnable:              NewConfigItem(HTTP_TLS_ENABLE_KEY, "", false, "HTTP代理监听端口启用TLS(https代理)", false),
+				HttpTlsCertFile:            NewConfigItem(HTTP_TLS_CERT_FILE_KEY, "", "", "HTTP代理TLS证书文件(留空则在主目录生成自签名证书)", ""),
+				HttpTlsKeyFile:             NewConfigItem(HTTP_TLS_KEY_FILE_KEY, "", "", "HTTP代理TLS私钥文件", ""),
+				HttpAuthUsersFile:          NewConfigItem(HTTP_AUTH_USERS_FILE_KEY, "", "", "HTTP代理多用户文件(htpasswd格式,支持bcrypt/SHA)", ""),
+				HttpAuthMaxFailures:        NewConfigItem(HTTP_AUTH_MAX_FAILURES_KEY, "", 5, "同一客户端IP允许的连续认证失败次数(0为不限制)", 5),
+				HttpAuthBlockSec:           NewConfigItem(HTTP_AUTH_BLOCK_SEC_KEY, "", 300, "认证失败次数超限后封禁客户端IP的时长(秒)", 300),
+				RouteEnable:                NewConfigItem(ROUTE_ENABLE_KEY, "", false, "启用规则路由(DIRECT/SSH/REJECT)", false),
+				RouteRulesFile:             NewConfigItem(ROUTE_RULES_FILE_KEY, "", "", "路由规则文件(留空则使用主目录下的rules.txt)", ""),
 				EnableSocks5:               NewConfigItem(ENABLE_SOCKS5_KEY, "", true, "开启Socks5代理", false),
+				EnableMixed:                NewConfigItem(ENABLE_MIXED_KEY, "", false, "开启混合端口代理(自动识别SOCKS5/SOCKS4/HTTP)", false),
+				Socks5UdpEnable:            NewConfigItem(SOCKS5_UDP_ENABLE_KEY, "", false, "是否启用SOCKS5 UDP ASSOCIATE", false),
+				Socks5UdpRelayAddress:      NewConfigItem(SOCKS5_UDP_RELAY_ADDRESS_KEY, "", "127.0.0.1:7300", "SOCKS5 UDP中继地址(经SSH连接的udpgw兼容服务)", ""),
+				Socks5UdpIdleTimeoutSec:    NewConfigItem(SOCKS5_UDP_IDLE_TIMEOUT_SEC_KEY, "", 60, "SOCKS5 UDP关联空闲超时(秒)", 60),
 				EnableHttpOverSSH:          NewConfigItem(ENABLE_HTTP_OVER_SSH_KEY, "", false, "开启HTTP Over SSH", false),
 				EnableHttpDomainFilter:     NewConfigItem(ENABLE_HTTP_DOMAIN_FILTER_KEY, "", false, "启用HTTP域名过滤", false),
 				HttpDomainFilterFilePath:   NewConfigItem(HTTP_DOMAIN_FILTER_FILE_PATH_KEY, "", path.Join(u.HomeDir, APP_NAME_HIDE, "domain.txt"), "HTTP域名过滤文件路径", ""),
+				HttpDomainCacheSize:        NewConfigItem(HTTP_DOMAIN_CACHE_SIZE_KEY, "", 4096, "域名匹配缓存容量(条)", 4096),
+				HttpDomainCacheTTLSec:      NewConfigItem(HTTP_DOMAIN_CACHE_TTL_SEC_KEY, "", 600, "域名匹配缓存过期时间(秒)", 600),
+				HttpDomainSubscriptions:    NewConfigItem(HTTP_DOMAIN_SUBSCRIPTIONS_KEY, "", "", "域名列表订阅地址(多个用逗号分隔)", ""),
+				HttpDomainSubIntervalMin:   NewConfigItem(HTTP_DOMAIN_SUB_INTERVAL_MIN_KEY, "", 360, "域名列表订阅刷新间隔(分钟)", 360),
+				HttpDomainSubViaSSH:        NewConfigItem(HTTP_DOMAIN_SUB_VIA_SSH_KEY, "", false, "通过SSH隧道下载域名列表订阅", false),
 				EnableAdmin:                NewConfigItem(ENABLE_ADMIN_KEY, "", true, "开启管理页面", true),
 				AdminAddress:               NewConfigItem(ADMIN_ADDRESS_KEY, "", ":1083", "管理页面监听地址", ""),
 				RetryIntervalSec:           NewConfigItem(RETRY_INTERVAL_SEC_KEY, "", 3, "重试间隔时间(秒)", 3),
@@ -124,6 +191,13 @@ func NewAppConfig() *AppConfig {
 				SSHKeepAliveCountMax:       NewConfigItem(SSH_KEEPALIVE_COUNT_MAX_KEY, "", 2, "SSH保活最大连续失败次数", 2),
 				SSHReconnectMaxRetries:     NewConfigItem(SSH_RECONNECT_MAX_RETRIES_KEY, "", 20, "SSH重连最大重试次数", 20),
 				SSHReconnectMaxIntervalSec: NewConfigItem(SSH_RECONNECT_MAX_INTERVAL_SEC_KEY, "", 5, "SSH重连最大退避间隔(秒)", 5),
+				SSHAuthChallengeTimeoutSec: NewConfigItem(SSH_AUTH_CHALLENGE_TIMEOUT_SEC_KEY, "", 300, "SSH键盘交互认证等待应答超时(秒)", 300),
+				SSHCertExpiryWarnMin:       NewConfigItem(SSH_CERT_EXPIRY_WARN_MIN_KEY, "", 60, "SSH用户证书到期提前告警时间(分钟)", 60),
+				SSHProbeEnable:             NewConfigItem(SSH_PROBE_ENABLE_KEY, "", false, "是否启用direct-tcpip通道健康探测", false),
+				SSHProbeTarget:             NewConfigItem(SSH_PROBE_TARGET_KEY, "", "127.0.0.1:22", "通道健康探测目标地址(由SSH服务器连接)", ""),
+				SSHProbeIntervalSec:        NewConfigItem(SSH_PROBE_INTERVAL_SEC_KEY, "", 30, "通道健康探测间隔(秒)", 30),
+				SSHProbeTimeoutSec:         NewConfigItem(SSH_PROBE_TIMEOUT_SEC_KEY, "", 5, "通道健康探测超时(秒)", 5),
+				SSHProbeFailureThreshold:   NewConfigItem(SSH_PROBE_FAILURE_THRESHOLD_KEY, "", 3, "通道健康探测连续失败多少次后重建SSH连接", 3),
 				LogFilePath:                NewConfigItem(LOG_FILE_PATH_KEY, "", path.Join(u.HomeDir, APP_NAME_HIDE, "console.log"), "日志文件路径", ""),
 
 				// 自动更新配置
@@ -162,17 +236,41 @@ func (appConfig *AppConfig) Update() {
 	appConfigInstance.ServerIp.SetValue(config.GetString(appConfigInstance.ServerIp.Key))
 	appConfigInstance.ServerSshPort.SetValue(config.GetInt(appConfigInstance.ServerSshPort.Key))
 	appConfigInstance.SshPrivateKeyPath.SetValue(config.GetString(appConfigInstance.SshPrivateKeyPath.Key))
+	appConfigInstance.SshPrivateKeyPassphrase.SetValue(config.GetString(appConfigInstance.SshPrivateKeyPassphrase.Key))
 	appConfigInstance.LoginUser.SetValue(config.GetString(appConfigInstance.LoginUser.Key))
 	appConfigInstance.LocalAddress.SetValue(config.GetString(appConfigInstance.LocalAddress.Key))
 	appConfigInstance.HttpLocalAddress.SetValue(config.GetString(appConfigInstance.HttpLocalAddress.Key))
+	appConfigInstance.MixedLocalAddress.SetValue(config.GetString(appConfigInstance.MixedLocalAddress.Key))
 	appConfigInstance.HttpBasicAuthEnable.SetValue(config.GetBool(appConfigInstance.HttpBasicAuthEnable.Key))
 	appConfigInstance.HttpBasicUserName.SetValue(config.GetString(appConfigInstance.HttpBasicUserName.Key))
 	appConfigInstance.HttpBasicPassword.SetValue(config.GetString(appConfigInstance.HttpBasicPassword.Key))
+	appConfigInstance.Socks5AuthEnable.SetValue(config.GetBool(appConfigInstance.Socks5AuthEnable.Key))
+	appConfigInstance.Socks5NoAuthEnable.SetValue(config.GetBool(appConfigInstance.Socks5NoAuthEnable.Key))
+	appConfigInstance.Socks5AuthShareHttpBasic.SetValue(config.GetBool(appConfigInstance.Socks5AuthShareHttpBasic.Key))
+	appConfigInstance.Socks5AuthUserName.SetValue(config.GetString(appConfigInstance.Socks5AuthUserName.Key))
+	appConfigInstance.Socks5AuthPassword.SetValue(config.GetString(appConfigInstance.Socks5AuthPassword.Key))
 	appConfigInstance.EnableHttp.SetValue(config.GetBool(appConfigInstance.EnableHttp.Key))
+	appConfigInstance.HttpTlsEnable.SetValue(config.GetBool(appConfigInstance.HttpTlsEnable.Key))
+	appConfigInstance.HttpTlsCertFile.SetValue(config.GetString(appConfigInstance.HttpTlsCertFile.Key))
+	appConfigInstance.HttpTlsKeyFile.SetValue(config.GetString(appConfigInstance.HttpTlsKeyFile.Key))
+	appConfigInstance.HttpAuthUsersFile.SetValue(config.GetString(appConfigInstance.HttpAuthUsersFile.Key))
+	appConfigInstance.HttpAuthMaxFailures.SetValue(config.GetInt(appConfigInstance.HttpAuthMaxFailures.Key))
+	appConfigInstance.HttpAuthBlockSec.SetValue(config.GetInt(appConfigInstance.HttpAuthBlockSec.Key))
+	appConfigInstance.RouteEnable.SetValue(config.GetBool(appConfigInstance.RouteEnable.Key))
+	appConfigInstance.RouteRulesFile.SetValue(config.GetString(appConfigInstance.RouteRulesFile.Key))
 	appConfigInstance.EnableSocks5.SetValue(config.GetBool(appConfigInstance.EnableSocks5.Key))
+	appConfigInstance.EnableMixed.SetValue(config.GetBool(appConfigInstance.EnableMixed.Key))
+	appConfigInstance.Socks5UdpEnable.SetValue(config.GetBool(appConfigInstance.Socks5UdpEnable.Key))
+	appConfigInstance.Socks5UdpRelayAddress.SetValue(config.GetString(appConfigInstance.Socks5UdpRelayAddress.Key))
+	appConfigInstance.Socks5UdpIdleTimeoutSec.SetValue(config.GetInt(appConfigInstance.Socks5UdpIdleTimeoutSec.Key))
 	appConfigInstance.EnableHttpOverSSH.SetValue(config.GetBool(appConfigInstance.EnableHttpOverSSH.Key))
 	appConfigInstance.EnableHttpDomainFilter.SetValue(config.GetBool(appConfigInstance.EnableHttpDomainFilter.Key))
 	appConfigInstance.HttpDomainFilterFilePath.SetValue(config.GetString(appConfigInstance.HttpDomainFilterFilePath.Key))
+	appConfigInstance.HttpDomainCacheSize.SetValue(config.GetInt(appConfigInstance.HttpDomainCacheSize.Key))
+	appConfigInstance.HttpDomainCacheTTLSec.SetValue(config.GetInt(appConfigInstance.HttpDomainCacheTTLSec.Key))
+	appConfigInstance.HttpDomainSubscriptions.SetValue(config.GetString(appConfigInstance.HttpDomainSubscriptions.Key))
+	appConfigInstance.HttpDomainSubIntervalMin.SetValue(config.GetInt(appConfigInstance.HttpDomainSubIntervalMin.Key))
+	appConfigInstance.HttpDomainSubViaSSH.SetValue(config.GetBool(appConfigInstance.HttpDomainSubViaSSH.Key))
 	appConfigInstance.EnableAdmin.SetValue(config.GetBool(appConfigInstance.EnableAdmin.Key))
 	appConfigInstance.AdminAddress.SetValue(config.GetString(appConfigInstance.AdminAddress.Key))
 	appConfigInstance.RetryIntervalSec.SetValue(config.GetInt(appConfigInstance.RetryIntervalSec.Key))
@@ -182,6 +280,13 @@ func (appConfig *AppConfig) Update() {
 	appConfigInstance.SSHKeepAliveCountMax.SetValue(config.GetInt(appConfigInstance.SSHKeepAliveCountMax.Key))
 	appConfigInstance.SSHReconnectMaxRetries.SetValue(config.GetInt(appConfigInstance.SSHReconnectMaxRetries.Key))
 	appConfigInstance.SSHReconnectMaxIntervalSec.SetValue(config.GetInt(appConfigInstance.SSHReconnectMaxIntervalSec.Key))
+	appConfigInstance.SSHAuthChallengeTimeoutSec.SetValue(config.GetInt(appConfigInstance.SSHAuthChallengeTimeoutSec.Key))
+	appConfigInstance.SSHCertExpiryWarnMin.SetValue(config.GetInt(appConfigInstance.SSHCertExpiryWarnMin.Key))
+	appConfigInstance.SSHProbeEnable.SetValue(config.GetBool(appConfigInstance.SSHProbeEnable.Key))
+	appConfigInstance.SSHProbeTarget.SetValue(config.GetString(appConfigInstance.SSHProbeTarget.Key))
+	appConfigInstance.SSHProbeIntervalSec.SetValue(config.GetInt(appConfigInstance.SSHProbeIntervalSec.Key))
+	appConfigInstance.SSHProbeTimeoutSec.SetValue(config.GetInt(appConfigInstance.SSHProbeTimeoutSec.Key))
+	appConfigInstance.SSHProbeFailureThreshold.SetValue(config.GetInt(appConfigInstance.SSHProbeFailureThreshold.Key))
 	appConfigInstance.LogFilePath.SetValue(config.GetString(appConfigInstance.LogFilePath.Key))
 
 	// 更新自动更新配置
@@ -200,25 +305,49 @@ func (appConfig *AppConfig) Update() {
 }
 
 const (
-	APP_NAME                 = "ssh-tunnel"
-	APP_NAME_HIDE            = ".ssh-tunnel"
-	HOME_DIR_KEY             = "home.dir"
-	SERVER_IP_KEY            = "server.ip"
-	SERVER_SSH_PORT_KEY      = "server.ssh.port"
-	SSH_PRIVATE_KEY_PATH_KEY = "ssh.private_key_path"
-	LOGIN_USER_KEY           = "login.username"
-	LOCAL_ADDRESS_KEY        = "local.address"
-	HTTP_LOCAL_ADDRESS_KEY   = "http.local.address"
-
-	HTTP_BASIC_AUTH_ENABLE_KEY = "http.basic.enable"
-	HTTP_BASIC_USER_NAME_KEY   = "http.basic.username"
-	HTTP_BASIC_PASSWORD_KEY    = "http.basic.password"
+	APP_NAME                       = "ssh-tunnel"
+	APP_NAME_HIDE                  = ".ssh-tunnel"
+	HOME_DIR_KEY                   = "home.dir"
+	SERVER_IP_KEY                  = "server.ip"
+	SERVER_SSH_PORT_KEY            = "server.ssh.port"
+	SSH_PRIVATE_KEY_PATH_KEY       = "ssh.private_key_path"
+	SSH_PRIVATE_KEY_PASSPHRASE_KEY = "ssh.private_key_passphrase"
+	LOGIN_USER_KEY                 = "login.username"
+	LOCAL_ADDRESS_KEY              = "local.address"
+	HTTP_LOCAL_ADDRESS_KEY         = "http.local.address"
+	MIXED_LOCAL_ADDRESS_KEY        = "mixed.local.address"
+
+	HTTP_BASIC_AUTH_ENABLE_KEY       = "http.basic.enable"
+	HTTP_BASIC_USER_NAME_KEY         = "http.basic.username"
+	HTTP_BASIC_PASSWORD_KEY          = "http.basic.password"
+	SOCKS5_AUTH_ENABLE_KEY           = "socks5.auth.enable"
+	SOCKS5_NOAUTH_ENABLE_KEY         = "socks5.noauth.enable"
+	SOCKS5_AUTH_SHARE_HTTP_BASIC_KEY = "socks5.auth.share.http.basic"
+	SOCKS5_AUTH_USER_NAME_KEY        = "socks5.auth.username"
+	SOCKS5_AUTH_PASSWORD_KEY         = "socks5.auth.password"
 
 	ENABLE_HTTP_KEY                  = "http.enable"
+	HTTP_TLS_ENABLE_KEY              = "http.tls.enable"
+	HTTP_TLS_CERT_FILE_KEY           = "http.tls.cert.file"
+	HTTP_TLS_KEY_FILE_KEY            = "http.tls.key.file"
+	HTTP_AUTH_USERS_FILE_KEY         = "http.auth.users.file"
+	HTTP_AUTH_MAX_FAILURES_KEY       = "http.auth.max.failures"
+	HTTP_AUTH_BLOCK_SEC_KEY          = "http.auth.block.sec"
+	ROUTE_ENABLE_KEY                 = "route.enable"
+	ROUTE_RULES_FILE_KEY             = "route.rules.file"
 	ENABLE_SOCKS5_KEY                = "socks5.enable"
+	ENABLE_MIXED_KEY                 = "mixed.enable"
+	SOCKS5_UDP_ENABLE_KEY            = "socks5.udp.enable"
+	SOCKS5_UDP_RELAY_ADDRESS_KEY     = "socks5.udp.relay.address"
+	SOCKS5_UDP_IDLE_TIMEOUT_SEC_KEY  = "socks5.udp.idle.timeout.sec"
 	ENABLE_HTTP_OVER_SSH_KEY         = "http.over-ssh.enable"
 	ENABLE_HTTP_DOMAIN_FILTER_KEY    = "http.domain-filter.enable"
 	HTTP_DOMAIN_FILTER_FILE_PATH_KEY = "http.domain-filter.file-path"
+	HTTP_DOMAIN_CACHE_SIZE_KEY       = "http.domain.cache.size"
+	HTTP_DOMAIN_CACHE_TTL_SEC_KEY    = "http.domain.cache.ttl.sec"
+	HTTP_DOMAIN_SUBSCRIPTIONS_KEY    = "http.domain.subscriptions"
+	HTTP_DOMAIN_SUB_INTERVAL_MIN_KEY = "http.domain.subscription.interval.min"
+	HTTP_DOMAIN_SUB_VIA_SSH_KEY      = "http.domain.subscription.via.ssh"
 
 	ENABLE_ADMIN_KEY  = "admin.enable"
 	ADMIN_ADDRESS_KEY = "admin.address"
@@ -230,6 +359,13 @@ const (
 	SSH_KEEPALIVE_COUNT_MAX_KEY        = "ssh.keepalive.count.max"
 	SSH_RECONNECT_MAX_RETRIES_KEY      = "ssh.reconnect.max.retries"
 	SSH_RECONNECT_MAX_INTERVAL_SEC_KEY = "ssh.reconnect.max.interval.sec"
+	SSH_AUTH_CHALLENGE_TIMEOUT_SEC_KEY = "ssh.auth.challenge.timeout.sec"
+	SSH_CERT_EXPIRY_WARN_MIN_KEY       = "ssh.certificate.expiry.warn.min"
+	SSH_PROBE_ENABLE_KEY               = "ssh.probe.enable"
+	SSH_PROBE_TARGET_KEY               = "ssh.probe.target"
+	SSH_PROBE_INTERVAL_SEC_KEY         = "ssh.probe.interval.sec"
+	SSH_PROBE_TIMEOUT_SEC_KEY          = "ssh.probe.timeout.sec"
+	SSH_PROBE_FAILURE_THRESHOLD_KEY    = "ssh.probe.failure.threshold"
 	LOG_FILE_PATH_KEY                  = "log.file.path"
 
 	// 自动更新相关配置
@@ -297,17 +433,41 @@ type AppConfig struct {
 	ServerIp                   ConfigItem[string]
 	ServerSshPort              ConfigItem[int]
 	SshPrivateKeyPath          ConfigItem[string]
+	SshPrivateKeyPassphrase    ConfigItem[string]
 	LoginUser                  ConfigItem[string]
 	LocalAddress               ConfigItem[string]
 	HttpLocalAddress           ConfigItem[string]
+	MixedLocalAddress          ConfigItem[string]
 	HttpBasicAuthEnable        ConfigItem[bool]
 	HttpBasicUserName          ConfigItem[string]
 	HttpBasicPassword          ConfigItem[string]
+	Socks5AuthEnable           ConfigItem[bool]
+	Socks5NoAuthEnable         ConfigItem[bool]
+	Socks5AuthShareHttpBasic   ConfigItem[bool]
+	Socks5AuthUserName         ConfigItem[string]
+	Socks5AuthPassword         ConfigItem[string]
 	EnableHttp                 ConfigItem[bool]
+	HttpTlsEnable              ConfigItem[bool]
+	HttpTlsCertFile            ConfigItem[string]
+	HttpTlsKeyFile             ConfigItem[string]
+	HttpAuthUsersFile          ConfigItem[string]
+	HttpAuthMaxFailures        ConfigItem[int]
+	HttpAuthBlockSec           ConfigItem[int]
+	RouteEnable                ConfigItem[bool]
+	RouteRulesFile             ConfigItem[string]
 	EnableSocks5               ConfigItem[bool]
+	EnableMixed                ConfigItem[bool]
+	Socks5UdpEnable            ConfigItem[bool]
+	Socks5UdpRelayAddress      ConfigItem[string]
+	Socks5UdpIdleTimeoutSec    ConfigItem[int]
 	EnableHttpOverSSH          ConfigItem[bool]
 	EnableHttpDomainFilter     ConfigItem[bool]
 	HttpDomainFilterFilePath   ConfigItem[string]
+	HttpDomainCacheSize        ConfigItem[int]
+	HttpDomainCacheTTLSec      ConfigItem[int]
+	HttpDomainSubscriptions    ConfigItem[string]
+	HttpDomainSubIntervalMin   ConfigItem[int]
+	HttpDomainSubViaSSH        ConfigItem[bool]
 	EnableAdmin                ConfigItem[bool]
 	AdminAddress               ConfigItem[string]
 	RetryIntervalSec           ConfigItem[int]
@@ -317,6 +477,13 @@ type AppConfig struct {
 	SSHKeepAliveCountMax       ConfigItem[int]
 	SSHReconnectMaxRetries     ConfigItem[int]
 	SSHReconnectMaxIntervalSec ConfigItem[int]
+	SSHAuthChallengeTimeoutSec ConfigItem[int]
+	SSHCertExpiryWarnMin       ConfigItem[int]
+	SSHProbeEnable             ConfigItem[bool]
+	SSHProbeTarget             ConfigItem[string]
+	SSHProbeIntervalSec        ConfigItem[int]
+	SSHProbeTimeoutSec         ConfigItem[int]
+	SSHProbeFailureThreshold   ConfigItem[int]
 	LogFilePath                ConfigItem[string]
 
 	// 自动更新配置
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -31,6 +32,113 @@ type SSHProfile struct {
 	EnableHttpDomainFilter   bool   `json:"enableHttpDomainFilter"`
 	HttpDomainFilterFilePath string `json:"httpDomainFilterFilePath"`
 	RetryIntervalSec         int    `json:"retryIntervalSec"`
+
+	// 主机公钥校验：policy 为 tofu(默认)/strict/insecure，指纹为 ssh.FingerprintSHA256 格式
+	HostKeyPolicy      string   `json:"hostKeyPolicy,omitempty"`
+	HostKeyFingerprint string   `json:"hostKeyFingerprint,omitempty"`
+	KnownHostsFiles    []string `json:"knownHostsFiles,omitempty"`
+	// HostCAFiles 受信任的主机证书CA公钥文件，服务器出示由这些CA签发的主机证书时直接通过校验
+	HostCAFiles []string `json:"hostCaFiles,omitempty"`
+
+	// 认证链：按 AuthMethods 顺序尝试(publickey/agent/password/keyboard-interactive)，IdentityFiles 为额外私钥，IdentityAgent 覆盖 SSH_AUTH_SOCK
+	AuthMethods   []string `json:"authMethods,omitempty"`
+	IdentityFiles []string `json:"identityFiles,omitempty"`
+	IdentityAgent string   `json:"identityAgent,omitempty"`
+	// Password 用于 password 认证及键盘交互中的密码提示，保存时以 EncryptSecret 加密
+	Password string `json:"password,omitempty"`
+	// CertificateFile OpenSSH 用户证书(通常为 id_xxx-cert.pub)，与 sshPrivateKeyPath 配对使用
+	CertificateFile string `json:"certificateFile,omitempty"`
+
+	// Algorithms 限定或扩展SSH协商算法，为空时使用默认算法
+	Algorithms *SSHAlgorithms `json:"algorithms,omitempty"`
+
+	// TransportProxy 连接SSH服务器(有跳板机时为第一个跳板机)时经过的上游代理
+	TransportProxy *TransportProxy `json:"transportProxy,omitempty"`
+	// TransportWrap 将SSH流量封装在TLS或WebSocket中，用于只放行HTTPS的网络
+	TransportWrap *TransportWrap `json:"transportWrap,omitempty"`
+
+	// LocalForwards 静态本地端口转发(-L)，每条转发单独监听，经SSH连接到固定目标
+	LocalForwards []LocalForward `json:"localForwards,omitempty"`
+	// RemoteForwards 远程端口转发(-R)，在SSH服务器上监听并把连接转发到本地地址，每次重连后重新建立
+	RemoteForwards []RemoteForward `json:"remoteForwards,omitempty"`
+
+	// JumpHosts 按顺序经过的跳板机(ProxyJump)，最后一跳之后再连接目标服务器
+	JumpHosts []JumpHost `json:"jumpHosts,omitempty"`
+
+	// 保活设置(来自 ssh config 的 ServerAliveInterval/ServerAliveCountMax)，大于0时覆盖全局配置
+	KeepAliveIntervalSec int `json:"keepAliveIntervalSec,omitempty"`
+	KeepAliveCountMax    int `json:"keepAliveCountMax,omitempty"`
+
+	// ImportSource 非空表示该profile由外部配置导入，可重新同步
+	ImportSource *ProfileImportSource `json:"importSource,omitempty"`
+}
+
+// JumpHost 跳板机配置；未设置的认证字段沿用所属profile的配置（密码除外）
+type JumpHost struct {
+	Name               string   `json:"name,omitempty"`
+	Host               string   `json:"host"`
+	Port               int      `json:"port,omitempty"`
+	User               string   `json:"user,omitempty"`
+	PrivateKeyPath     string   `json:"privateKeyPath,omitempty"`
+	CertificateFile    string   `json:"certificateFile,omitempty"`
+	IdentityFiles      []string `json:"identityFiles,omitempty"`
+	AuthMethods        []string `json:"authMethods,omitempty"`
+	Password           string   `json:"password,omitempty"`
+	HostKeyPolicy      string   `json:"hostKeyPolicy,omitempty"`
+	HostKeyFingerprint string   `json:"hostKeyFingerprint,omitempty"`
+	KnownHostsFiles    []string `json:"knownHostsFiles,omitempty"`
+	HostCAFiles        []string `json:"hostCaFiles,omitempty"`
+	// Algorithms 未设置时沿用所属profile的算法配置
+	Algorithms *SSHAlgorithms `json:"algorithms,omitempty"`
+}
+
+// SSHAlgorithms SSH协商算法列表。条目为完整列表时按顺序使用；
+// 以 + 开头表示追加到默认列表末尾，- 表示从默认列表移除，^ 表示放到默认列表最前（同 OpenSSH 语法）
+type SSHAlgorithms struct {
+	Ciphers      []string `json:"ciphers,omitempty"`
+	KeyExchanges []string `json:"kex,omitempty"`
+	MACs         []string `json:"macs,omitempty"`
+	HostKeys     []string `json:"hostKeys,omitempty"`
+}
+
+// TransportProxy 上游代理设置，与下载代理(download.proxy.*)的字段一致；
+// URL 为 http://host:port(HTTP CONNECT) 或 socks5://host:port，Password 保存时以 EncryptSecret 加密
+type TransportProxy struct {
+	Enabled  bool   `json:"enabled"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// TransportWrap SSH流量的封装方式。Type 为 tls 时与 serverIp:serverSshPort 建立TLS连接(stunnel 等)；
+// 为 websocket 时连接 URL(ws:// 或 wss://)指定的网关，由网关转发到SSH服务器
+type TransportWrap struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+	// ServerName TLS SNI 及证书校验的主机名，缺省为连接的主机名
+	ServerName         string `json:"serverName,omitempty"`
+	CAFile             string `json:"caFile,omitempty"`
+	ClientCertFile     string `json:"clientCertFile,omitempty"`
+	ClientKeyFile      string `json:"clientKeyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	// Headers WebSocket 握手时附加的请求头（如网关鉴权）
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// LocalForward 静态本地端口转发，相当于 ssh -L 15432:db.internal:5432；Name 在profile内唯一。
+// Network 为 unix 时 Target 是SSH服务器上的Unix套接字路径(如 /var/run/docker.sock)，经 direct-streamlocal 转发
+type LocalForward struct {
+	Name          string `json:"name"`
+	ListenAddress string `json:"listenAddress"`
+	Target        string `json:"target"`
+	Network       string `json:"network,omitempty"`
+}
+
+// RemoteForward 远程端口转发，相当于 ssh -R 8080:localhost:3000；RemoteAddress 为服务器上的监听地址，端口为0时由服务器分配
+type RemoteForward struct {
+	Name          string `json:"name"`
+	RemoteAddress string `json:"remoteAddress"`
+	LocalTarget   string `json:"localTarget"`
 }
 
 type ProfileStore struct {
@@ -340,7 +448,15 @@ func SwitchActiveProfile(profileID string, appConfig *AppConfig) (ProfileStore,
 	return store, nil
 }
 
-func UpsertProfile(profileID string, profile SSHProfile, appConfig *AppConfig) (ProfileStore, error) {
+// ProfileSecretClear 指定保存profile时要清除的已保存密码；未指定清除的密码留空表示保留原值
+type ProfileSecretClear struct {
+	Password               bool  `json:"password,omitempty"`
+	TransportProxyPassword bool  `json:"transportProxyPassword,omitempty"`
+	JumpHostPasswords      []int `json:"jumpHostPasswords,omitempty"` // 跳板机在 jumpHosts 中的下标
+}
+
+// UpsertProfile 新增或替换profile，密码加密后保存；clear 中指定的密码被清除，其余留空的密码保留原值
+func UpsertProfile(profileID string, profile SSHProfile, clear ProfileSecretClear, appConfig *AppConfig) (ProfileStore, error) {
 	if profileID == "" {
 		return ProfileStore{}, fmt.Errorf("profile id 不能为空")
 	}
@@ -351,6 +467,9 @@ func UpsertProfile(profileID string, profile SSHProfile, appConfig *AppConfig) (
 	if store.Profiles == nil {
 		store.Profiles = make(map[string]SSHProfile)
 	}
+	if err := encryptProfileSecrets(&profile, store.Profiles[profileID], clear); err != nil {
+		return ProfileStore{}, err
+	}
 	store.Profiles[profileID] = profile
 	if err := saveProfileStore(store); err != nil {
 		return ProfileStore{}, err
@@ -358,6 +477,127 @@ func UpsertProfile(profileID string, profile SSHProfile, appConfig *AppConfig) (
 	return store, nil
 }
 
+// encryptProfileSecrets 加密profile、传输代理及跳板机密码；密码留空且未在 clear 中指定时保留原有密码
+func encryptProfileSecrets(profile *SSHProfile, previous SSHProfile, clear ProfileSecretClear) error {
+	var err error
+	if profile.Password == "" && !clear.Password {
+		profile.Password = previous.Password
+	}
+	if profile.Password, err = EncryptSecret(profile.Password); err != nil {
+		return fmt.Errorf("加密profile密码失败: %w", err)
+	}
+	if proxy := profile.TransportProxy; proxy != nil {
+		if proxy.Password == "" && !clear.TransportProxyPassword && previous.TransportProxy != nil && previous.TransportProxy.URL == proxy.URL {
+			proxy.Password = previous.TransportProxy.Password
+		}
+		if proxy.Password, err = EncryptSecret(proxy.Password); err != nil {
+			return fmt.Errorf("加密传输代理密码失败: %w", err)
+		}
+	}
+	for i := range profile.JumpHosts {
+		jump := &profile.JumpHosts[i]
+		if jump.Password == "" && !slices.Contains(clear.JumpHostPasswords, i) && i < len(previous.JumpHosts) && previous.JumpHosts[i].Host == jump.Host {
+			jump.Password = previous.JumpHosts[i].Password
+		}
+		if jump.Password, err = EncryptSecret(jump.Password); err != nil {
+			return fmt.Errorf("加密跳板机(%s)密码失败: %w", jump.Host, err)
+		}
+	}
+	return nil
+}
+
+// ActiveProfile 返回当前激活的profile；未配置profiles或激活项不存在时，返回由AppConfig构造的默认profile且ID为空
+func ActiveProfile(appConfig *AppConfig) (string, SSHProfile) {
+	store, err := loadProfileStoreFromConfig()
+	if err != nil || len(store.Profiles) == 0 {
+		return "", defaultProfileFromAppConfig(appConfig)
+	}
+
+	activeProfileID := strings.TrimSpace(store.ActiveProfileID)
+	if activeProfileID == "" {
+		activeProfileID = DEFAULT_PROFILE_ID
+	}
+	profile, ok := store.Profiles[activeProfileID]
+	if !ok {
+		return "", defaultProfileFromAppConfig(appConfig)
+	}
+	return activeProfileID, profile
+}
+
+// updateProfile 读取profile并通过mutate修改后保存
+func updateProfile(profileID string, appConfig *AppConfig, mutate func(profile *SSHProfile) error) (ProfileStore, error) {
+	if profileID == "" {
+		return ProfileStore{}, fmt.Errorf("profile id 不能为空")
+	}
+	store, err := ListProfiles(appConfig)
+	if err != nil {
+		return ProfileStore{}, err
+	}
+	profile, ok := store.Profiles[profileID]
+	if !ok {
+		return ProfileStore{}, fmt.Errorf("profile不存在: %s", profileID)
+	}
+	if err := mutate(&profile); err != nil {
+		return ProfileStore{}, err
+	}
+	store.Profiles[profileID] = profile
+	if err := saveProfileStore(store); err != nil {
+		return ProfileStore{}, err
+	}
+	return store, nil
+}
+
+// SetProfileHostKeyFingerprint 固定（或轮换）profile的SSH主机公钥指纹，传空字符串表示清除固定指纹
+func SetProfileHostKeyFingerprint(profileID string, fingerprint string, appConfig *AppConfig) (ProfileStore, error) {
+	return updateProfile(profileID, appConfig, func(profile *SSHProfile) error {
+		profile.HostKeyFingerprint = strings.TrimSpace(fingerprint)
+		return nil
+	})
+}
+
+// SetProfileJumpHostFingerprint 固定（或轮换）profile中第 index 个跳板机(从1开始)的主机公钥指纹
+func SetProfileJumpHostFingerprint(profileID string, index int, fingerprint string, appConfig *AppConfig) (ProfileStore, error) {
+	return updateProfile(profileID, appConfig, func(profile *SSHProfile) error {
+		if index < 1 || index > len(profile.JumpHosts) {
+			return fmt.Errorf("跳板机序号无效: %d", index)
+		}
+		profile.JumpHosts[index-1].HostKeyFingerprint = strings.TrimSpace(fingerprint)
+		return nil
+	})
+}
+
+// UpsertProfileLocalForward 按名称新增或替换profile的本地端口转发
+func UpsertProfileLocalForward(profileID string, forward LocalForward, appConfig *AppConfig) (ProfileStore, error) {
+	return updateProfile(profileID, appConfig, func(profile *SSHProfile) error {
+		for _, existing := range profile.LocalForwards {
+			if existing.Name != forward.Name && existing.ListenAddress == forward.ListenAddress {
+				return fmt.Errorf("监听地址 %s 已被转发 %s 使用", forward.ListenAddress, existing.Name)
+			}
+		}
+		for i, existing := range profile.LocalForwards {
+			if existing.Name == forward.Name {
+				profile.LocalForwards[i] = forward
+				return nil
+			}
+		}
+		profile.LocalForwards = append(profile.LocalForwards, forward)
+		return nil
+	})
+}
+
+// DeleteProfileLocalForward 删除profile中指定名称的本地端口转发
+func DeleteProfileLocalForward(profileID string, name string, appConfig *AppConfig) (ProfileStore, error) {
+	return updateProfile(profileID, appConfig, func(profile *SSHProfile) error {
+		for i, existing := range profile.LocalForwards {
+			if existing.Name == name {
+				profile.LocalForwards = append(profile.LocalForwards[:i], profile.LocalForwards[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("转发不存在: %s", name)
+	})
+}
+
 func DeleteProfile(profileID string, appConfig *AppConfig) (ProfileStore, error) {
 	if profileID == "" {
 		return ProfileStore{}, fmt.Errorf("profile id 不能为空")
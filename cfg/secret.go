@@ -0,0 +1,139 @@
+package cfg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	encryptedSecretPrefix = "enc:v1:"
+	secretKeyFileName     = "secret.key"
+	// SECRET_KEY_ENV 可通过环境变量提供 base64 编码的 32 字节主密钥，优先于密钥文件
+	SECRET_KEY_ENV = "SSH_TUNNEL_SECRET_KEY"
+)
+
+var (
+	secretKeyMu     sync.Mutex
+	secretKeyCached []byte
+)
+
+// IsEncryptedSecret 判断值是否为 EncryptSecret 生成的密文
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// EncryptSecret 使用本地主密钥(AES-256-GCM)加密敏感字段；空值和已加密的值原样返回
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" || IsEncryptedSecret(plain) {
+		return plain, nil
+	}
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret 解密 EncryptSecret 生成的密文；未加密的旧值原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("解码密文失败: %w", err)
+	}
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("密文长度无效")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败(主密钥可能已变更): %w", err)
+	}
+	return string(plain), nil
+}
+
+func secretAEAD() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func secretKeyFilePath() string {
+	if config := GetConfigInstance(); config != nil {
+		if paths := resolveProfilesFilePaths(config); len(paths) > 0 {
+			return filepath.Join(filepath.Dir(paths[0]), secretKeyFileName)
+		}
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil && strings.TrimSpace(homeDir) != "" {
+		return filepath.Join(homeDir, APP_NAME_HIDE, secretKeyFileName)
+	}
+	return secretKeyFileName
+}
+
+// loadSecretKey 读取主密钥，密钥文件不存在时自动生成（权限 0600）
+func loadSecretKey() ([]byte, error) {
+	if raw := strings.TrimSpace(os.Getenv(SECRET_KEY_ENV)); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("环境变量%s必须是base64编码的32字节密钥", SECRET_KEY_ENV)
+		}
+		return key, nil
+	}
+
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	if secretKeyCached != nil {
+		return secretKeyCached, nil
+	}
+
+	keyPath := secretKeyFilePath()
+	content, err := os.ReadFile(keyPath)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("主密钥文件格式无效(%s)", keyPath)
+		}
+		secretKeyCached = key
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取主密钥文件失败(%s): %w", keyPath, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, fmt.Errorf("创建主密钥目录失败(%s): %w", keyPath, err)
+	}
+	if err := os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("写入主密钥文件失败(%s): %w", keyPath, err)
+	}
+	secretKeyCached = key
+	return key, nil
+}
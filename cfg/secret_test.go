@@ -0,0 +1,115 @@
+package cfg
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	t.Setenv(SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(key))
+
+	encrypted, err := EncryptSecret("p@ssw0rd")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !IsEncryptedSecret(encrypted) || encrypted == "p@ssw0rd" {
+		t.Fatalf("expected encrypted value, got %q", encrypted)
+	}
+	again, err := EncryptSecret(encrypted)
+	if err != nil || again != encrypted {
+		t.Fatalf("expected already encrypted value to be kept, got %q %v", again, err)
+	}
+
+	plain, err := DecryptSecret(encrypted)
+	if err != nil || plain != "p@ssw0rd" {
+		t.Fatalf("decrypt: %q %v", plain, err)
+	}
+	legacy, err := DecryptSecret("plain-text")
+	if err != nil || legacy != "plain-text" {
+		t.Fatalf("expected legacy plain value to pass through, got %q %v", legacy, err)
+	}
+
+	other := make([]byte, 32)
+	rand.Read(other)
+	t.Setenv(SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(other))
+	if _, err := DecryptSecret(encrypted); err == nil {
+		t.Fatalf("expected decrypt with another key to fail")
+	}
+}
+
+func TestEncryptProfileSecretsKeepsOrClearsPasswords(t *testing.T) {
+	t.Setenv(SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	previous := SSHProfile{
+		Password:       "enc:v1:old",
+		TransportProxy: &TransportProxy{URL: "http://proxy:8080", Password: "enc:v1:proxy"},
+		JumpHosts:      []JumpHost{{Host: "jump1", Password: "enc:v1:j1"}, {Host: "jump2", Password: "enc:v1:j2"}},
+	}
+	newProfile := func() SSHProfile {
+		return SSHProfile{
+			TransportProxy: &TransportProxy{URL: "http://proxy:8080"},
+			JumpHosts:      []JumpHost{{Host: "jump1"}, {Host: "jump2"}},
+		}
+	}
+
+	// 留空的密码保留原值
+	kept := newProfile()
+	if err := encryptProfileSecrets(&kept, previous, ProfileSecretClear{}); err != nil {
+		t.Fatal(err)
+	}
+	if kept.Password != "enc:v1:old" || kept.TransportProxy.Password != "enc:v1:proxy" || kept.JumpHosts[1].Password != "enc:v1:j2" {
+		t.Fatalf("expected empty passwords to keep previous values, got %+v", kept)
+	}
+
+	// 明确指定清除的密码被清空，其余保留
+	cleared := newProfile()
+	if err := encryptProfileSecrets(&cleared, previous, ProfileSecretClear{Password: true, TransportProxyPassword: true, JumpHostPasswords: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Password != "" || cleared.TransportProxy.Password != "" || cleared.JumpHosts[1].Password != "" {
+		t.Fatalf("expected passwords to be cleared, got %+v", cleared)
+	}
+	if cleared.JumpHosts[0].Password != "enc:v1:j1" {
+		t.Fatalf("expected other jump host password to be kept, got %q", cleared.JumpHosts[0].Password)
+	}
+}
+
+func TestUpdateConfigValueEncryptsPrivateKeyPassphrase(t *testing.T) {
+	t.Setenv(SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	configFile := filepath.Join(t.TempDir(), "config.properties")
+	if err := os.WriteFile(configFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	SetConfigInstance(v)
+
+	if err := UpdateConfigValue(SSH_PRIVATE_KEY_PASSPHRASE_KEY, "key-pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateConfigValue(LOGIN_USER_KEY, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "key-pass") || !strings.Contains(string(data), encryptedSecretPrefix) {
+		t.Fatalf("expected passphrase to be stored encrypted, got %q", data)
+	}
+	if plain, err := DecryptSecret(v.GetString(SSH_PRIVATE_KEY_PASSPHRASE_KEY)); err != nil || plain != "key-pass" {
+		t.Fatalf("expected stored passphrase to decrypt, got %q %v", plain, err)
+	}
+	if v.GetString(LOGIN_USER_KEY) != "ops" {
+		t.Fatal("expected other config values to be stored as is")
+	}
+}
@@ -0,0 +1,689 @@
+package cfg
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ProfileImportTypeSSHConfig = "ssh_config"
+
+	sshConfigMaxIncludeDepth = 16
+	sshConfigMaxJumpDepth    = 8
+)
+
+// ProfileImportSource 记录profile的导入来源，用于后续重新同步
+type ProfileImportSource struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Host       string `json:"host"`
+	Hash       string `json:"hash"`
+	ImportedAt string `json:"importedAt"`
+}
+
+// SSHHostConfig 从 OpenSSH 配置中解析出的单个 Host 的有效配置
+type SSHHostConfig struct {
+	Alias               string         `json:"alias"`
+	HostName            string         `json:"hostName"`
+	Port                int            `json:"port"`
+	User                string         `json:"user,omitempty"`
+	IdentityFiles       []string       `json:"identityFiles,omitempty"`
+	CertificateFile     string         `json:"certificateFile,omitempty"`
+	IdentityAgent       string         `json:"identityAgent,omitempty"`
+	ProxyJump           string         `json:"proxyJump,omitempty"`
+	ServerAliveInterval int            `json:"serverAliveInterval,omitempty"`
+	ServerAliveCountMax int            `json:"serverAliveCountMax,omitempty"`
+	UserKnownHostsFiles []string       `json:"userKnownHostsFiles,omitempty"`
+	StrictHostKey       string         `json:"strictHostKeyChecking,omitempty"`
+	PreferredAuth       []string       `json:"preferredAuthentications,omitempty"`
+	Algorithms          *SSHAlgorithms `json:"algorithms,omitempty"`
+}
+
+// SSHConfigImportResult 导入或同步的结果，按profile ID分类
+type SSHConfigImportResult struct {
+	Imported  []string     `json:"imported"`
+	Updated   []string     `json:"updated"`
+	Unchanged []string     `json:"unchanged"`
+	Conflicts []string     `json:"conflicts"`
+	Missing   []string     `json:"missing"`
+	NotFound  []string     `json:"notFound"`
+	Store     ProfileStore `json:"store"`
+}
+
+type sshConfigOption struct {
+	key  string
+	args []string
+}
+
+type sshConfigBlock struct {
+	patterns []string
+	// match 为 Match 块，仅支持 Match all，其它条件视为不匹配
+	match   bool
+	options []sshConfigOption
+}
+
+// SSHConfig 解析后的 OpenSSH 客户端配置
+type SSHConfig struct {
+	Path   string
+	blocks []*sshConfigBlock
+}
+
+// DefaultSSHConfigPath 返回 ~/.ssh/config
+func DefaultSSHConfigPath() string {
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(homeDir, ".ssh", "config")
+	}
+	return filepath.Join(".ssh", "config")
+}
+
+// LoadSSHConfig 读取并解析 OpenSSH 配置文件（支持 Include 与 Host 通配符）
+func LoadSSHConfig(configPath string) (*SSHConfig, error) {
+	if strings.TrimSpace(configPath) == "" {
+		configPath = DefaultSSHConfigPath()
+	}
+	configPath = expandUserPath(configPath)
+	config := &SSHConfig{Path: configPath}
+	global := &sshConfigBlock{patterns: []string{"*"}}
+	config.blocks = append(config.blocks, global)
+	if _, err := config.parseFile(configPath, global, 0); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *SSHConfig) parseFile(filePath string, current *sshConfigBlock, depth int) (*sshConfigBlock, error) {
+	if depth > sshConfigMaxIncludeDepth {
+		return current, fmt.Errorf("ssh config Include 嵌套过深: %s", filePath)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return current, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		key, args, err := splitSSHConfigLine(scanner.Text())
+		if err != nil {
+			return current, fmt.Errorf("%s:%d: %w", filePath, lineNo, err)
+		}
+		if key == "" {
+			continue
+		}
+		switch key {
+		case "host":
+			current = &sshConfigBlock{patterns: args}
+			c.blocks = append(c.blocks, current)
+		case "match":
+			current = &sshConfigBlock{match: true, patterns: args}
+			c.blocks = append(c.blocks, current)
+		case "include":
+			for _, pattern := range args {
+				matches, err := filepath.Glob(resolveIncludePath(pattern, filePath))
+				if err != nil {
+					return current, fmt.Errorf("%s:%d: %w", filePath, lineNo, err)
+				}
+				sort.Strings(matches)
+				for _, included := range matches {
+					// Include 中出现的 Host 只作用于被包含文件内部，之后仍回到当前块
+					if _, err := c.parseFile(included, current, depth+1); err != nil {
+						return current, err
+					}
+				}
+			}
+		default:
+			current.options = append(current.options, sshConfigOption{key: key, args: args})
+		}
+	}
+	return current, scanner.Err()
+}
+
+func resolveIncludePath(pattern string, fromFile string) string {
+	pattern = expandUserPath(pattern)
+	if filepath.IsAbs(pattern) {
+		return pattern
+	}
+	// 与 OpenSSH 一致：用户配置中的相对路径相对于 ~/.ssh
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(homeDir, ".ssh", pattern)
+	}
+	return filepath.Join(filepath.Dir(fromFile), pattern)
+}
+
+func splitSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+	rest = strings.TrimLeft(rest, " \t")
+
+	var args []string
+	var buf strings.Builder
+	inQuote := false
+	hasToken := false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasToken = true
+		case (r == ' ' || r == '\t') && !inQuote:
+			if hasToken {
+				args = append(args, buf.String())
+				buf.Reset()
+				hasToken = false
+			}
+		case r == '#' && !inQuote && !hasToken:
+			// 行尾注释
+			return key, args, nil
+		default:
+			buf.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if inQuote {
+		return "", nil, fmt.Errorf("unterminated quote")
+	}
+	if hasToken {
+		args = append(args, buf.String())
+	}
+	return key, args, nil
+}
+
+func (b *sshConfigBlock) matches(alias string) bool {
+	if b.match {
+		return len(b.patterns) == 1 && strings.EqualFold(b.patterns[0], "all")
+	}
+	matched := false
+	for _, pattern := range b.patterns {
+		for _, p := range strings.Split(pattern, ",") {
+			negate := strings.HasPrefix(p, "!")
+			p = strings.TrimPrefix(p, "!")
+			ok, err := path.Match(strings.ToLower(p), strings.ToLower(alias))
+			if err != nil || !ok {
+				continue
+			}
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Hosts 返回配置中显式声明（不含通配符和否定）的 Host 别名
+func (c *SSHConfig) Hosts() []string {
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	for _, block := range c.blocks {
+		if block.match {
+			continue
+		}
+		for _, pattern := range block.patterns {
+			for _, p := range strings.Split(pattern, ",") {
+				if p == "" || strings.ContainsAny(p, "*?![") || seen[p] {
+					continue
+				}
+				seen[p] = true
+				hosts = append(hosts, p)
+			}
+		}
+	}
+	return hosts
+}
+
+// Resolve 按 OpenSSH 规则（先出现的值优先，IdentityFile 累加）计算 Host 的有效配置
+func (c *SSHConfig) Resolve(alias string) SSHHostConfig {
+	values := make(map[string][]string)
+	var identityFiles []string
+	var knownHostsFiles []string
+	for _, block := range c.blocks {
+		if !block.matches(alias) {
+			continue
+		}
+		for _, option := range block.options {
+			switch option.key {
+			case "identityfile":
+				identityFiles = append(identityFiles, option.args...)
+			case "userknownhostsfile":
+				if knownHostsFiles == nil {
+					knownHostsFiles = append([]string{}, option.args...)
+				}
+			default:
+				if _, ok := values[option.key]; !ok {
+					values[option.key] = option.args
+				}
+			}
+		}
+	}
+
+	first := func(key string) string {
+		if args := values[key]; len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	}
+	atoi := func(key string) int {
+		n, _ := strconv.Atoi(first(key))
+		return n
+	}
+
+	host := SSHHostConfig{
+		Alias:               alias,
+		HostName:            first("hostname"),
+		Port:                atoi("port"),
+		User:                first("user"),
+		IdentityAgent:       first("identityagent"),
+		CertificateFile:     first("certificatefile"),
+		ProxyJump:           first("proxyjump"),
+		ServerAliveInterval: atoi("serveraliveinterval"),
+		ServerAliveCountMax: atoi("serveralivecountmax"),
+		StrictHostKey:       strings.ToLower(first("stricthostkeychecking")),
+	}
+	if host.HostName == "" {
+		host.HostName = alias
+	}
+	// 展开 HostName 自身时 %h 表示命令行上的主机别名，而不是尚未展开的 HostName
+	hostNameTemplate := host
+	hostNameTemplate.HostName = ""
+	host.HostName = expandSSHTokens(host.HostName, alias, hostNameTemplate)
+	if host.Port <= 0 {
+		host.Port = 22
+	}
+	if strings.EqualFold(host.IdentityAgent, "none") {
+		host.IdentityAgent = ""
+	}
+	if strings.EqualFold(host.ProxyJump, "none") {
+		host.ProxyJump = ""
+	}
+	if preferred := first("preferredauthentications"); preferred != "" {
+		host.PreferredAuth = strings.Split(preferred, ",")
+	}
+	for _, f := range identityFiles {
+		if strings.EqualFold(f, "none") {
+			continue
+		}
+		host.IdentityFiles = append(host.IdentityFiles, expandUserPath(expandSSHTokens(f, alias, host)))
+	}
+	for _, f := range knownHostsFiles {
+		if strings.EqualFold(f, "none") {
+			continue
+		}
+		host.UserKnownHostsFiles = append(host.UserKnownHostsFiles, expandUserPath(expandSSHTokens(f, alias, host)))
+	}
+	if host.IdentityAgent != "" {
+		host.IdentityAgent = expandUserPath(expandSSHTokens(host.IdentityAgent, alias, host))
+	}
+	if host.CertificateFile != "" {
+		host.CertificateFile = expandUserPath(expandSSHTokens(host.CertificateFile, alias, host))
+	}
+	algorithms := SSHAlgorithms{
+		Ciphers:      algorithmsFromSSHConfig(first("ciphers")),
+		KeyExchanges: algorithmsFromSSHConfig(first("kexalgorithms")),
+		MACs:         algorithmsFromSSHConfig(first("macs")),
+		HostKeys:     algorithmsFromSSHConfig(first("hostkeyalgorithms")),
+	}
+	if len(algorithms.Ciphers)+len(algorithms.KeyExchanges)+len(algorithms.MACs)+len(algorithms.HostKeys) > 0 {
+		host.Algorithms = &algorithms
+	}
+	return host
+}
+
+// algorithmsFromSSHConfig 将 OpenSSH 的算法列表(如 "+ssh-rsa,ssh-dss")转换为逐项带修饰符的列表
+func algorithmsFromSSHConfig(value string) []string {
+	if value == "" {
+		return nil
+	}
+	modifier := ""
+	if value[0] == '+' || value[0] == '-' || value[0] == '^' {
+		modifier, value = value[:1], value[1:]
+	}
+	var list []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, modifier+name)
+		}
+	}
+	return list
+}
+
+func expandSSHTokens(value string, alias string, host SSHHostConfig) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	homeDir, _ := os.UserHomeDir()
+	hostName := host.HostName
+	if hostName == "" {
+		hostName = alias
+	}
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%h", hostName,
+		"%n", alias,
+		"%p", strconv.Itoa(host.Port),
+		"%r", host.User,
+		"%u", localUser,
+		"%d", homeDir,
+	)
+	return replacer.Replace(value)
+}
+
+func expandUserPath(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, `~\`) {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, p[1:])
+		}
+	}
+	return p
+}
+
+// resolveJumpHosts 展开 ProxyJump，跳板机自身的 ProxyJump 会递归展开到前面
+func (c *SSHConfig) resolveJumpHosts(proxyJump string, depth int) ([]JumpHost, error) {
+	if proxyJump == "" {
+		return nil, nil
+	}
+	if depth > sshConfigMaxJumpDepth {
+		return nil, fmt.Errorf("ProxyJump 嵌套过深或存在循环: %s", proxyJump)
+	}
+	var jumps []JumpHost
+	for _, spec := range strings.Split(proxyJump, ",") {
+		spec = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(spec), "ssh://"))
+		if spec == "" {
+			continue
+		}
+		jumpUser := ""
+		if at := strings.LastIndex(spec, "@"); at >= 0 {
+			jumpUser = spec[:at]
+			spec = spec[at+1:]
+		}
+		alias := spec
+		port := 0
+		if h, p, err := net.SplitHostPort(spec); err == nil {
+			alias = h
+			port, _ = strconv.Atoi(p)
+		}
+
+		resolved := c.Resolve(alias)
+		nested, err := c.resolveJumpHosts(resolved.ProxyJump, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		jumps = append(jumps, nested...)
+
+		jump := JumpHost{Name: alias, Host: resolved.HostName, Port: resolved.Port, User: resolved.User}
+		if port > 0 {
+			jump.Port = port
+		}
+		if jumpUser != "" {
+			jump.User = jumpUser
+		}
+		if len(resolved.IdentityFiles) > 0 {
+			jump.PrivateKeyPath = resolved.IdentityFiles[0]
+			jump.IdentityFiles = append([]string(nil), resolved.IdentityFiles[1:]...)
+		}
+		jump.CertificateFile = resolved.CertificateFile
+		jump.Algorithms = resolved.Algorithms
+		jump.KnownHostsFiles = resolved.UserKnownHostsFiles
+		jump.HostKeyPolicy = hostKeyPolicyFromSSHConfig(resolved.StrictHostKey)
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
+
+func hostKeyPolicyFromSSHConfig(value string) string {
+	switch value {
+	case "yes":
+		return "strict"
+	case "no", "off":
+		return "insecure"
+	case "":
+		return ""
+	default:
+		return "tofu"
+	}
+}
+
+func authMethodsFromSSHConfig(preferred []string) []string {
+	var methods []string
+	for _, m := range preferred {
+		switch strings.ToLower(strings.TrimSpace(m)) {
+		case "publickey":
+			methods = append(methods, "publickey", "agent")
+		case "password":
+			methods = append(methods, "password")
+		case "keyboard-interactive":
+			methods = append(methods, "keyboard-interactive")
+		}
+	}
+	return methods
+}
+
+// profileFromSSHHost 将 Host 配置合并到 base profile 上，保留 base 中与 ssh config 无关的本地设置
+func (c *SSHConfig) profileFromSSHHost(host SSHHostConfig, base SSHProfile) (SSHProfile, error) {
+	jumps, err := c.resolveJumpHosts(host.ProxyJump, 0)
+	if err != nil {
+		return SSHProfile{}, err
+	}
+	// 已固定的跳板机指纹和密码在地址不变时保留
+	for i := range jumps {
+		if i < len(base.JumpHosts) && base.JumpHosts[i].Host == jumps[i].Host && base.JumpHosts[i].Port == jumps[i].Port {
+			if jumps[i].HostKeyFingerprint == "" {
+				jumps[i].HostKeyFingerprint = base.JumpHosts[i].HostKeyFingerprint
+			}
+			jumps[i].Password = base.JumpHosts[i].Password
+		}
+	}
+
+	profile := base
+	if profile.ServerIp != host.HostName || profile.ServerSshPort != host.Port {
+		profile.HostKeyFingerprint = ""
+	}
+	profile.ServerIp = host.HostName
+	profile.ServerSshPort = host.Port
+	if host.User != "" {
+		profile.LoginUser = host.User
+	}
+	profile.IdentityFiles = nil
+	if len(host.IdentityFiles) > 0 {
+		profile.SshPrivateKeyPath = host.IdentityFiles[0]
+		profile.IdentityFiles = append([]string(nil), host.IdentityFiles[1:]...)
+	}
+	profile.IdentityAgent = host.IdentityAgent
+	profile.CertificateFile = host.CertificateFile
+	profile.Algorithms = host.Algorithms
+	profile.JumpHosts = jumps
+	profile.KeepAliveIntervalSec = host.ServerAliveInterval
+	profile.KeepAliveCountMax = host.ServerAliveCountMax
+	profile.KnownHostsFiles = host.UserKnownHostsFiles
+	profile.HostKeyPolicy = hostKeyPolicyFromSSHConfig(host.StrictHostKey)
+	if methods := authMethodsFromSSHConfig(host.PreferredAuth); len(methods) > 0 {
+		profile.AuthMethods = methods
+	}
+	return profile, nil
+}
+
+// hostHash 计算 Host 有效配置（含展开后的跳板机）的摘要，用于判断是否需要重新同步
+func (c *SSHConfig) hostHash(host SSHHostConfig) string {
+	jumps, _ := c.resolveJumpHosts(host.ProxyJump, 0)
+	content, _ := json.Marshal(struct {
+		Host  SSHHostConfig `json:"host"`
+		Jumps []JumpHost    `json:"jumps"`
+	}{host, jumps})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ImportSSHConfigHosts 将 ssh config 中选定的 Host 导入为profile（profile ID 即 Host 别名）；hosts 为空时导入全部显式 Host。
+// 同名profile若不是从 ssh config 导入的，只有 overwrite 为 true 时才会覆盖；配置中没有显式声明的 Host 记入 NotFound，不会导入
+func ImportSSHConfigHosts(configPath string, hosts []string, overwrite bool, appConfig *AppConfig) (SSHConfigImportResult, error) {
+	result := newSSHConfigImportResult()
+	sshConfig, err := LoadSSHConfig(configPath)
+	if err != nil {
+		return result, fmt.Errorf("读取ssh config失败: %w", err)
+	}
+	declared := sshConfig.Hosts()
+	if len(hosts) == 0 {
+		hosts = declared
+	}
+
+	store, err := ListProfiles(appConfig)
+	if err != nil {
+		return result, err
+	}
+	for _, alias := range hosts {
+		alias = strings.TrimSpace(alias)
+		if alias == "" {
+			continue
+		}
+		if !containsString(declared, alias) {
+			result.NotFound = append(result.NotFound, alias)
+			continue
+		}
+		existing, exists := store.Profiles[alias]
+		if exists && !overwrite && (existing.ImportSource == nil || existing.ImportSource.Type != ProfileImportTypeSSHConfig) {
+			result.Conflicts = append(result.Conflicts, alias)
+			continue
+		}
+		base := existing
+		if !exists {
+			base = defaultProfileFromAppConfig(appConfig)
+		}
+		changed, err := sshConfig.syncProfile(alias, base, exists, &result, appConfig)
+		if err != nil {
+			return result, err
+		}
+		if changed != nil {
+			store = *changed
+		}
+	}
+	result.Store = store
+	return result, nil
+}
+
+// SyncSSHConfigProfiles 重新读取之前从 ssh config 导入的profile来源，配置变化时更新对应profile
+func SyncSSHConfigProfiles(appConfig *AppConfig) (SSHConfigImportResult, error) {
+	result := newSSHConfigImportResult()
+	store, err := ListProfiles(appConfig)
+	if err != nil {
+		return result, err
+	}
+
+	ids := make([]string, 0, len(store.Profiles))
+	for id, profile := range store.Profiles {
+		if profile.ImportSource != nil && profile.ImportSource.Type == ProfileImportTypeSSHConfig {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	configs := make(map[string]*SSHConfig)
+	for _, id := range ids {
+		profile := store.Profiles[id]
+		source := profile.ImportSource
+		sshConfig, ok := configs[source.Path]
+		if !ok {
+			sshConfig, err = LoadSSHConfig(source.Path)
+			if err != nil {
+				log.Printf("同步profile(%s)失败，读取ssh config出错: %v", id, err)
+				result.Missing = append(result.Missing, id)
+				continue
+			}
+			configs[source.Path] = sshConfig
+		}
+		if !containsString(sshConfig.Hosts(), source.Host) {
+			result.Missing = append(result.Missing, id)
+			continue
+		}
+		changed, err := sshConfig.syncProfileAs(id, source.Host, profile, true, &result, appConfig)
+		if err != nil {
+			return result, err
+		}
+		if changed != nil {
+			store = *changed
+		}
+	}
+	result.Store = store
+	return result, nil
+}
+
+func (c *SSHConfig) syncProfile(alias string, base SSHProfile, exists bool, result *SSHConfigImportResult, appConfig *AppConfig) (*ProfileStore, error) {
+	return c.syncProfileAs(alias, alias, base, exists, result, appConfig)
+}
+
+func (c *SSHConfig) syncProfileAs(profileID string, alias string, base SSHProfile, exists bool, result *SSHConfigImportResult, appConfig *AppConfig) (*ProfileStore, error) {
+	host := c.Resolve(alias)
+	hash := c.hostHash(host)
+	if exists && base.ImportSource != nil && base.ImportSource.Hash == hash && base.ImportSource.Path == c.Path {
+		result.Unchanged = append(result.Unchanged, profileID)
+		return nil, nil
+	}
+
+	profile, err := c.profileFromSSHHost(host, base)
+	if err != nil {
+		return nil, fmt.Errorf("解析Host(%s)失败: %w", alias, err)
+	}
+	profile.ImportSource = &ProfileImportSource{
+		Type:       ProfileImportTypeSSHConfig,
+		Path:       c.Path,
+		Host:       alias,
+		Hash:       hash,
+		ImportedAt: time.Now().Format(time.RFC3339),
+	}
+	store, err := UpsertProfile(profileID, profile, ProfileSecretClear{}, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		result.Updated = append(result.Updated, profileID)
+	} else {
+		result.Imported = append(result.Imported, profileID)
+	}
+	return &store, nil
+}
+
+func newSSHConfigImportResult() SSHConfigImportResult {
+	return SSHConfigImportResult{
+		Imported:  []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Conflicts: []string{},
+		Missing:   []string{},
+		NotFound:  []string{},
+	}
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
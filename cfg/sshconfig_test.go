@@ -0,0 +1,214 @@
+package cfg
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func writeSSHConfigFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSSHConfigResolve(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	configPath := filepath.Join(home, ".ssh", "config")
+	writeSSHConfigFile(t, configPath, `
+# global
+Include conf.d/*.conf
+
+Host web-* !web-legacy
+    User deploy
+    IdentityFile ~/.ssh/web_ed25519
+
+Host web-1
+    HostName 10.0.0.11
+    Port=2222
+    User ignored-because-first-wins
+    ProxyJump bastion
+
+Host bastion
+    HostName "bastion.example.com"
+    User jump
+    ProxyJump edge:2200
+
+Host edge
+    HostName edge.example.com
+
+Host *.corp
+    HostName %h.example.com
+
+Host *
+    IdentityFile ~/.ssh/id_%h
+    ServerAliveInterval 15
+    ServerAliveCountMax 4
+`)
+	writeSSHConfigFile(t, filepath.Join(home, ".ssh", "conf.d", "db.conf"), `
+Host db
+    HostName db.internal
+    StrictHostKeyChecking yes
+    Ciphers aes256-gcm@openssh.com,aes256-ctr
+    HostKeyAlgorithms +ssh-rsa,ssh-dss
+`)
+
+	sshConfig, err := LoadSSHConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadSSHConfig: %v", err)
+	}
+
+	wantHosts := []string{"db", "web-1", "bastion", "edge"}
+	if got := sshConfig.Hosts(); !reflect.DeepEqual(got, wantHosts) {
+		t.Fatalf("hosts = %v, want %v", got, wantHosts)
+	}
+
+	web := sshConfig.Resolve("web-1")
+	if web.HostName != "10.0.0.11" || web.Port != 2222 || web.User != "deploy" {
+		t.Fatalf("unexpected web-1 resolution: %+v", web)
+	}
+	wantKeys := []string{filepath.Join(home, ".ssh", "web_ed25519"), filepath.Join(home, ".ssh", "id_10.0.0.11")}
+	if !reflect.DeepEqual(web.IdentityFiles, wantKeys) {
+		t.Fatalf("identity files = %v, want %v", web.IdentityFiles, wantKeys)
+	}
+	if web.ServerAliveInterval != 15 || web.ServerAliveCountMax != 4 {
+		t.Fatalf("unexpected keepalive: %+v", web)
+	}
+
+	// HostName 中的 %h 是别名本身，其它字段中的 %h 是展开后的 HostName
+	if app := sshConfig.Resolve("app.corp"); app.HostName != "app.corp.example.com" ||
+		!reflect.DeepEqual(app.IdentityFiles, []string{filepath.Join(home, ".ssh", "id_app.corp.example.com")}) {
+		t.Fatalf("unexpected %%h expansion: %+v", app)
+	}
+
+	if legacy := sshConfig.Resolve("web-legacy"); legacy.User != "" {
+		t.Fatalf("negated pattern should not match, got user %q", legacy.User)
+	}
+	if db := sshConfig.Resolve("db"); db.HostName != "db.internal" || db.StrictHostKey != "yes" {
+		t.Fatalf("included host not resolved: %+v", db)
+	} else if db.Algorithms == nil ||
+		!reflect.DeepEqual(db.Algorithms.Ciphers, []string{"aes256-gcm@openssh.com", "aes256-ctr"}) ||
+		!reflect.DeepEqual(db.Algorithms.HostKeys, []string{"+ssh-rsa", "+ssh-dss"}) {
+		t.Fatalf("unexpected algorithms: %+v", db.Algorithms)
+	}
+
+	jumps, err := sshConfig.resolveJumpHosts(web.ProxyJump, 0)
+	if err != nil {
+		t.Fatalf("resolveJumpHosts: %v", err)
+	}
+	if len(jumps) != 2 {
+		t.Fatalf("expected nested ProxyJump to expand to 2 hops, got %+v", jumps)
+	}
+	if jumps[0].Host != "edge.example.com" || jumps[0].Port != 2200 {
+		t.Fatalf("unexpected first hop: %+v", jumps[0])
+	}
+	if jumps[1].Host != "bastion.example.com" || jumps[1].User != "jump" || jumps[1].Port != 22 {
+		t.Fatalf("unexpected second hop: %+v", jumps[1])
+	}
+}
+
+func TestSSHConfigRejectsJumpLoop(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".ssh", "config")
+	writeSSHConfigFile(t, configPath, "Host a\n  ProxyJump b\nHost b\n  ProxyJump a\n")
+
+	sshConfig, err := LoadSSHConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sshConfig.resolveJumpHosts("a", 0); err == nil {
+		t.Fatal("expected ProxyJump loop to be rejected")
+	}
+}
+
+func TestImportAndSyncSSHConfigProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	appConfigFile := filepath.Join(home, ".ssh-tunnel", "config.properties")
+	writeSSHConfigFile(t, appConfigFile, "")
+	v := viper.New()
+	v.SetConfigFile(appConfigFile)
+	SetConfigInstance(v)
+	appConfig := NewAppConfig()
+
+	configPath := filepath.Join(home, ".ssh", "config")
+	writeSSHConfigFile(t, configPath, "Host prod\n  HostName prod.example.com\n  User ops\n  ServerAliveInterval 30\nHost manual\n  HostName manual.example.com\n")
+
+	if _, err := UpsertProfile("manual", SSHProfile{ServerIp: "1.2.3.4"}, ProfileSecretClear{}, appConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ImportSSHConfigHosts(configPath, []string{"prod", "manual", "prdo"}, false, appConfig)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if !reflect.DeepEqual(result.Imported, []string{"prod"}) || !reflect.DeepEqual(result.Conflicts, []string{"manual"}) ||
+		!reflect.DeepEqual(result.NotFound, []string{"prdo"}) {
+		t.Fatalf("unexpected import result: %+v", result)
+	}
+	prod := result.Store.Profiles["prod"]
+	if prod.ServerIp != "prod.example.com" || prod.ServerSshPort != 22 || prod.LoginUser != "ops" || prod.KeepAliveIntervalSec != 30 {
+		t.Fatalf("unexpected imported profile: %+v", prod)
+	}
+	if prod.ImportSource == nil || prod.ImportSource.Host != "prod" || prod.ImportSource.Path != configPath {
+		t.Fatalf("import source not recorded: %+v", prod.ImportSource)
+	}
+	if _, ok := result.Store.Profiles["prdo"]; ok {
+		t.Fatal("unknown host must not be imported")
+	}
+
+	// ssh config未变化时不改写profile，本地固定的指纹应保留
+	if _, err := SetProfileHostKeyFingerprint("prod", "SHA256:pinned", appConfig); err != nil {
+		t.Fatal(err)
+	}
+	result, err = SyncSSHConfigProfiles(appConfig)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if !reflect.DeepEqual(result.Unchanged, []string{"prod"}) {
+		t.Fatalf("expected unchanged profile, got %+v", result)
+	}
+	if got := result.Store.Profiles["prod"].HostKeyFingerprint; got != "SHA256:pinned" {
+		t.Fatalf("pinned fingerprint lost on unchanged sync: %q", got)
+	}
+
+	writeSSHConfigFile(t, configPath, "Host prod\n  HostName prod.example.com\n  Port 2022\n  User ops\n")
+	result, err = SyncSSHConfigProfiles(appConfig)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if !reflect.DeepEqual(result.Updated, []string{"prod"}) {
+		t.Fatalf("expected updated profile, got %+v", result)
+	}
+	prod = result.Store.Profiles["prod"]
+	if prod.ServerSshPort != 2022 || prod.KeepAliveIntervalSec != 0 {
+		t.Fatalf("profile not re-synced: %+v", prod)
+	}
+	if prod.HostKeyFingerprint != "" {
+		t.Fatalf("pinned fingerprint should be cleared when the target port changes")
+	}
+
+	writeSSHConfigFile(t, configPath, "Host other\n  HostName other.example.com\n")
+	result, err = SyncSSHConfigProfiles(appConfig)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if !reflect.DeepEqual(result.Missing, []string{"prod"}) {
+		t.Fatalf("expected missing profile, got %+v", result)
+	}
+	if _, ok := result.Store.Profiles["prod"]; !ok {
+		t.Fatal("missing source must not delete the profile")
+	}
+}
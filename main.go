@@ -3,11 +3,13 @@ package main
 import (
 	_ "embed"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
 	"ssh-tunnel/api/admin"
 	"ssh-tunnel/buildinfo"
 	"ssh-tunnel/cfg"
@@ -29,12 +31,19 @@ import (
 
 var started atomic.Bool
 
+// oneShot 标记本次运行是执行完即退出的命令行模式（如导入），出错时直接退出而不是重启
+var oneShot atomic.Bool
+
 func main() {
 	for {
 		err := safe.SafeCallWithReturnRecover(runOnce)
 		if err == nil {
 			return
 		}
+		if oneShot.Load() {
+			log.Printf("command failed: %v", err)
+			os.Exit(1)
+		}
 		if started.Load() {
 			log.Printf("panic/error after startup: %v; keep process alive to avoid double-start", err)
 			select {}
@@ -74,15 +83,39 @@ func runOnce() error {
 	// 默认值设置
 	vConfig.SetDefault(config.HomeDir.GetKey(), config.HomeDir.GetDefaultValue())
 	vConfig.SetDefault(config.SshPrivateKeyPath.GetKey(), config.SshPrivateKeyPath.GetDefaultValue())
+	vConfig.SetDefault(config.SshPrivateKeyPassphrase.GetKey(), config.SshPrivateKeyPassphrase.GetDefaultValue())
 	vConfig.SetDefault(config.LoginUser.GetKey(), config.LoginUser.GetDefaultValue())
 	vConfig.SetDefault(config.LocalAddress.GetKey(), config.LocalAddress.GetDefaultValue())
 	vConfig.SetDefault(config.HttpLocalAddress.GetKey(), config.HttpLocalAddress.GetDefaultValue())
+	vConfig.SetDefault(config.MixedLocalAddress.GetKey(), config.MixedLocalAddress.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttp.GetKey(), config.EnableHttp.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsEnable.GetKey(), config.HttpTlsEnable.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsCertFile.GetKey(), config.HttpTlsCertFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsKeyFile.GetKey(), config.HttpTlsKeyFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthUsersFile.GetKey(), config.HttpAuthUsersFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthMaxFailures.GetKey(), config.HttpAuthMaxFailures.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthBlockSec.GetKey(), config.HttpAuthBlockSec.GetDefaultValue())
+	vConfig.SetDefault(config.RouteEnable.GetKey(), config.RouteEnable.GetDefaultValue())
+	vConfig.SetDefault(config.RouteRulesFile.GetKey(), config.RouteRulesFile.GetDefaultValue())
 	vConfig.SetDefault(config.EnableSocks5.GetKey(), config.EnableSocks5.GetDefaultValue())
+	vConfig.SetDefault(config.EnableMixed.GetKey(), config.EnableMixed.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpEnable.GetKey(), config.Socks5UdpEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpRelayAddress.GetKey(), config.Socks5UdpRelayAddress.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpIdleTimeoutSec.GetKey(), config.Socks5UdpIdleTimeoutSec.GetDefaultValue())
 	vConfig.SetDefault(config.HttpBasicAuthEnable.GetKey(), config.HttpBasicAuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthEnable.GetKey(), config.Socks5AuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5NoAuthEnable.GetKey(), config.Socks5NoAuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthShareHttpBasic.GetKey(), config.Socks5AuthShareHttpBasic.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthUserName.GetKey(), config.Socks5AuthUserName.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthPassword.GetKey(), config.Socks5AuthPassword.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttpOverSSH.GetKey(), config.EnableHttpOverSSH.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttpDomainFilter.GetKey(), config.EnableHttpDomainFilter.GetDefaultValue())
 	vConfig.SetDefault(config.HttpDomainFilterFilePath.GetKey(), config.HttpDomainFilterFilePath.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainCacheSize.GetKey(), config.HttpDomainCacheSize.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainCacheTTLSec.GetKey(), config.HttpDomainCacheTTLSec.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubscriptions.GetKey(), config.HttpDomainSubscriptions.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubIntervalMin.GetKey(), config.HttpDomainSubIntervalMin.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubViaSSH.GetKey(), config.HttpDomainSubViaSSH.GetDefaultValue())
 	vConfig.SetDefault(config.EnableAdmin.GetKey(), config.EnableAdmin.GetDefaultValue())
 	vConfig.SetDefault(config.AdminAddress.GetKey(), config.AdminAddress.GetDefaultValue())
 	vConfig.SetDefault(config.RetryIntervalSec.GetKey(), config.RetryIntervalSec.GetDefaultValue())
@@ -92,6 +125,13 @@ func runOnce() error {
 	vConfig.SetDefault(config.SSHKeepAliveCountMax.GetKey(), config.SSHKeepAliveCountMax.GetDefaultValue())
 	vConfig.SetDefault(config.SSHReconnectMaxRetries.GetKey(), config.SSHReconnectMaxRetries.GetDefaultValue())
 	vConfig.SetDefault(config.SSHReconnectMaxIntervalSec.GetKey(), config.SSHReconnectMaxIntervalSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHAuthChallengeTimeoutSec.GetKey(), config.SSHAuthChallengeTimeoutSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHCertExpiryWarnMin.GetKey(), config.SSHCertExpiryWarnMin.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeEnable.GetKey(), config.SSHProbeEnable.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeTarget.GetKey(), config.SSHProbeTarget.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeIntervalSec.GetKey(), config.SSHProbeIntervalSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeTimeoutSec.GetKey(), config.SSHProbeTimeoutSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeFailureThreshold.GetKey(), config.SSHProbeFailureThreshold.GetDefaultValue())
 	vConfig.SetDefault(config.LogFilePath.GetKey(), config.LogFilePath.GetDefaultValue())
 
 	// 自动更新默认值
@@ -155,17 +195,41 @@ func runOnce() error {
 	pflag.StringP(config.ServerIp.GetKey(), config.ServerIp.GetShorthand(), config.ServerIp.GetDefaultValue(), config.ServerIp.GetDescription())
 	pflag.IntP(config.ServerSshPort.GetKey(), config.ServerSshPort.GetShorthand(), config.ServerSshPort.GetDefaultValue(), config.ServerSshPort.GetDescription())
 	pflag.String(config.SshPrivateKeyPath.GetKey(), config.SshPrivateKeyPath.GetDefaultValue(), config.SshPrivateKeyPath.GetDescription())
+	pflag.String(config.SshPrivateKeyPassphrase.GetKey(), config.SshPrivateKeyPassphrase.GetDefaultValue(), config.SshPrivateKeyPassphrase.GetDescription())
 	pflag.StringP(config.LoginUser.GetKey(), config.LoginUser.GetShorthand(), config.LoginUser.GetDefaultValue(), config.LoginUser.GetDescription())
 	pflag.StringP(config.LocalAddress.GetKey(), config.LocalAddress.GetShorthand(), config.LocalAddress.GetDefaultValue(), config.LocalAddress.GetDescription())
 	pflag.String(config.HttpLocalAddress.GetKey(), config.HttpLocalAddress.GetDefaultValue(), config.HttpLocalAddress.GetDescription())
+	pflag.String(config.MixedLocalAddress.GetKey(), config.MixedLocalAddress.GetDefaultValue(), config.MixedLocalAddress.GetDescription())
 	pflag.Bool(config.HttpBasicAuthEnable.GetKey(), config.HttpBasicAuthEnable.GetDefaultValue(), config.HttpBasicAuthEnable.GetDescription())
 	pflag.String(config.HttpBasicUserName.GetKey(), config.HttpBasicUserName.GetDefaultValue(), config.HttpBasicUserName.GetDescription())
 	pflag.String(config.HttpBasicPassword.GetKey(), config.HttpBasicPassword.GetDefaultValue(), config.HttpBasicPassword.GetDescription())
+	pflag.Bool(config.Socks5AuthEnable.GetKey(), config.Socks5AuthEnable.GetDefaultValue(), config.Socks5AuthEnable.GetDescription())
+	pflag.Bool(config.Socks5NoAuthEnable.GetKey(), config.Socks5NoAuthEnable.GetDefaultValue(), config.Socks5NoAuthEnable.GetDescription())
+	pflag.Bool(config.Socks5AuthShareHttpBasic.GetKey(), config.Socks5AuthShareHttpBasic.GetDefaultValue(), config.Socks5AuthShareHttpBasic.GetDescription())
+	pflag.String(config.Socks5AuthUserName.GetKey(), config.Socks5AuthUserName.GetDefaultValue(), config.Socks5AuthUserName.GetDescription())
+	pflag.String(config.Socks5AuthPassword.GetKey(), config.Socks5AuthPassword.GetDefaultValue(), config.Socks5AuthPassword.GetDescription())
 	pflag.Bool(config.EnableHttp.GetKey(), config.EnableHttp.GetDefaultValue(), config.EnableHttp.GetDescription())
+	pflag.Bool(config.HttpTlsEnable.GetKey(), config.HttpTlsEnable.GetDefaultValue(), config.HttpTlsEnable.GetDescription())
+	pflag.String(config.HttpTlsCertFile.GetKey(), config.HttpTlsCertFile.GetDefaultValue(), config.HttpTlsCertFile.GetDescription())
+	pflag.String(config.HttpTlsKeyFile.GetKey(), config.HttpTlsKeyFile.GetDefaultValue(), config.HttpTlsKeyFile.GetDescription())
+	pflag.String(config.HttpAuthUsersFile.GetKey(), config.HttpAuthUsersFile.GetDefaultValue(), config.HttpAuthUsersFile.GetDescription())
+	pflag.Int(config.HttpAuthMaxFailures.GetKey(), config.HttpAuthMaxFailures.GetDefaultValue(), config.HttpAuthMaxFailures.GetDescription())
+	pflag.Int(config.HttpAuthBlockSec.GetKey(), config.HttpAuthBlockSec.GetDefaultValue(), config.HttpAuthBlockSec.GetDescription())
+	pflag.Bool(config.RouteEnable.GetKey(), config.RouteEnable.GetDefaultValue(), config.RouteEnable.GetDescription())
+	pflag.String(config.RouteRulesFile.GetKey(), config.RouteRulesFile.GetDefaultValue(), config.RouteRulesFile.GetDescription())
 	pflag.Bool(config.EnableSocks5.GetKey(), config.EnableSocks5.GetDefaultValue(), config.EnableSocks5.GetDescription())
+	pflag.Bool(config.EnableMixed.GetKey(), config.EnableMixed.GetDefaultValue(), config.EnableMixed.GetDescription())
+	pflag.Bool(config.Socks5UdpEnable.GetKey(), config.Socks5UdpEnable.GetDefaultValue(), config.Socks5UdpEnable.GetDescription())
+	pflag.String(config.Socks5UdpRelayAddress.GetKey(), config.Socks5UdpRelayAddress.GetDefaultValue(), config.Socks5UdpRelayAddress.GetDescription())
+	pflag.Int(config.Socks5UdpIdleTimeoutSec.GetKey(), config.Socks5UdpIdleTimeoutSec.GetDefaultValue(), config.Socks5UdpIdleTimeoutSec.GetDescription())
 	pflag.Bool(config.EnableHttpOverSSH.GetKey(), config.EnableHttpOverSSH.GetDefaultValue(), config.EnableHttpOverSSH.GetDescription())
 	pflag.Bool(config.EnableHttpDomainFilter.GetKey(), config.EnableHttpDomainFilter.GetDefaultValue(), config.EnableHttpDomainFilter.GetDescription())
 	pflag.String(config.HttpDomainFilterFilePath.GetKey(), config.HttpDomainFilterFilePath.GetDefaultValue(), config.HttpDomainFilterFilePath.GetDescription())
+	pflag.Int(config.HttpDomainCacheSize.GetKey(), config.HttpDomainCacheSize.GetDefaultValue(), config.HttpDomainCacheSize.GetDescription())
+	pflag.Int(config.HttpDomainCacheTTLSec.GetKey(), config.HttpDomainCacheTTLSec.GetDefaultValue(), config.HttpDomainCacheTTLSec.GetDescription())
+	pflag.String(config.HttpDomainSubscriptions.GetKey(), config.HttpDomainSubscriptions.GetDefaultValue(), config.HttpDomainSubscriptions.GetDescription())
+	pflag.Int(config.HttpDomainSubIntervalMin.GetKey(), config.HttpDomainSubIntervalMin.GetDefaultValue(), config.HttpDomainSubIntervalMin.GetDescription())
+	pflag.Bool(config.HttpDomainSubViaSSH.GetKey(), config.HttpDomainSubViaSSH.GetDefaultValue(), config.HttpDomainSubViaSSH.GetDescription())
 	pflag.Bool(config.EnableAdmin.GetKey(), config.EnableAdmin.GetDefaultValue(), config.EnableAdmin.GetDescription())
 	pflag.String(config.AdminAddress.GetKey(), config.AdminAddress.GetDefaultValue(), config.AdminAddress.GetDescription())
 	pflag.Int(config.RetryIntervalSec.GetKey(), config.RetryIntervalSec.GetDefaultValue(), config.RetryIntervalSec.GetDescription())
@@ -175,11 +239,34 @@ func runOnce() error {
 	pflag.Int(config.SSHKeepAliveCountMax.GetKey(), config.SSHKeepAliveCountMax.GetDefaultValue(), config.SSHKeepAliveCountMax.GetDescription())
 	pflag.Int(config.SSHReconnectMaxRetries.GetKey(), config.SSHReconnectMaxRetries.GetDefaultValue(), config.SSHReconnectMaxRetries.GetDescription())
 	pflag.Int(config.SSHReconnectMaxIntervalSec.GetKey(), config.SSHReconnectMaxIntervalSec.GetDefaultValue(), config.SSHReconnectMaxIntervalSec.GetDescription())
+	pflag.Int(config.SSHAuthChallengeTimeoutSec.GetKey(), config.SSHAuthChallengeTimeoutSec.GetDefaultValue(), config.SSHAuthChallengeTimeoutSec.GetDescription())
+	pflag.Int(config.SSHCertExpiryWarnMin.GetKey(), config.SSHCertExpiryWarnMin.GetDefaultValue(), config.SSHCertExpiryWarnMin.GetDescription())
+	pflag.Bool(config.SSHProbeEnable.GetKey(), config.SSHProbeEnable.GetDefaultValue(), config.SSHProbeEnable.GetDescription())
+	pflag.String(config.SSHProbeTarget.GetKey(), config.SSHProbeTarget.GetDefaultValue(), config.SSHProbeTarget.GetDescription())
+	pflag.Int(config.SSHProbeIntervalSec.GetKey(), config.SSHProbeIntervalSec.GetDefaultValue(), config.SSHProbeIntervalSec.GetDescription())
+	pflag.Int(config.SSHProbeTimeoutSec.GetKey(), config.SSHProbeTimeoutSec.GetDefaultValue(), config.SSHProbeTimeoutSec.GetDescription())
+	pflag.Int(config.SSHProbeFailureThreshold.GetKey(), config.SSHProbeFailureThreshold.GetDefaultValue(), config.SSHProbeFailureThreshold.GetDescription())
+	importSSHConfig := pflag.String("import.ssh.config", "", "从ssh config导入Host为profile后退出，多个Host用逗号分隔，* 表示全部显式Host")
+	sshConfigPath := pflag.String("ssh.config.path", "", "导入使用的ssh config路径，默认 ~/.ssh/config")
+	overwriteProfiles := pflag.Bool("import.ssh.config.overwrite", false, "导入时覆盖同名的非导入profile")
+	syncSSHConfig := pflag.Bool("sync.ssh.config", false, "重新同步从ssh config导入的profile后退出")
+	importRules := pflag.String("import.rules", "", "从Clash YAML或Surge配置导入规则，写入路由规则文件后退出")
+	importRulesPolicy := pflag.String("import.rules.policy", "", "导入规则时的策略映射，如 Proxy=SSH,AdBlock=REJECT；未指定的策略按 DIRECT/REJECT/SSH 推断")
+	importRulesDryRun := pflag.Bool("import.rules.dry.run", false, "只输出转换结果，不写入路由规则文件")
 
 	pflag.Parse()
 
 	vConfig.BindPFlags(pflag.CommandLine)
 
+	if *importSSHConfig != "" || *syncSSHConfig {
+		oneShot.Store(true)
+		return runSSHConfigImport(config, *sshConfigPath, *importSSHConfig, *overwriteProfiles, *syncSSHConfig)
+	}
+	if *importRules != "" {
+		oneShot.Store(true)
+		return runRulesImport(config, *importRules, *importRulesPolicy, *importRulesDryRun)
+	}
+
 	// 非服务管理器模式下，读取配置文件后，覆盖配置项的值
 	if service.Interactive() {
 		logFile, err := os.OpenFile(config.LogFilePath.GetValue(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -212,6 +299,79 @@ func runOnce() error {
 	return nil
 }
 
+// runSSHConfigImport 处理 --import.ssh.config / --sync.ssh.config 命令行参数
+func runSSHConfigImport(config *cfg.AppConfig, sshConfigPath string, hosts string, overwrite bool, syncOnly bool) error {
+	var result cfg.SSHConfigImportResult
+	var err error
+	if syncOnly {
+		result, err = cfg.SyncSSHConfigProfiles(config)
+	} else {
+		var aliases []string
+		if strings.TrimSpace(hosts) != "*" {
+			for _, alias := range strings.Split(hosts, ",") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					aliases = append(aliases, alias)
+				}
+			}
+		}
+		result, err = cfg.ImportSSHConfigHosts(sshConfigPath, aliases, overwrite, config)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("imported: %v", result.Imported)
+	log.Printf("updated: %v", result.Updated)
+	log.Printf("unchanged: %v", result.Unchanged)
+	if len(result.Conflicts) > 0 {
+		log.Printf("conflicts (existing profiles not imported from ssh config, use --import.ssh.config.overwrite): %v", result.Conflicts)
+	}
+	if len(result.Missing) > 0 {
+		log.Printf("missing in ssh config: %v", result.Missing)
+	}
+	if len(result.NotFound) > 0 {
+		log.Printf("hosts not found in ssh config (not imported): %v", result.NotFound)
+	}
+	return nil
+}
+
+// runRulesImport 处理 --import.rules 启动参数：转换 Clash/Surge 规则并写入路由规则文件
+func runRulesImport(config *cfg.AppConfig, sourcePath string, policyText string, dryRun bool) error {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return err
+	}
+	policies, err := tunnel.ParseRulePolicies(policyText)
+	if err != nil {
+		return err
+	}
+	result, err := tunnel.ImportRuleSet(data, policies)
+	if err != nil {
+		return err
+	}
+	content := tunnel.RenderImportedRules(result, filepath.Base(sourcePath))
+	log.Printf("format: %s, converted: %d, unsupported: %d", result.Format, len(result.Rules), len(result.Unsupported))
+	log.Printf("policies: %v", result.Policies)
+	for _, unsupported := range result.Unsupported {
+		log.Printf("unsupported line %d: %s (%s)", unsupported.Line, unsupported.Content, unsupported.Message)
+	}
+	if dryRun {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	if len(result.Rules) == 0 {
+		return fmt.Errorf("没有可导入的规则")
+	}
+	filePath := tunnel.RouteRulesFilePath(config.RouteRulesFile.GetValue(), config.HomeDir.GetValue())
+	if err := tunnel.WriteRouteRulesFile(filePath, content); err != nil {
+		return err
+	}
+	log.Printf("rules written to %s", filePath)
+	if !config.RouteEnable.GetValue() {
+		log.Printf("路由规则未启用，设置 %s=true 后生效", config.RouteEnable.GetKey())
+	}
+	return nil
+}
+
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -190,15 +190,39 @@ func innerStart() {
 	// 默认值设置
 	vConfig.SetDefault(config.HomeDir.GetKey(), config.HomeDir.GetDefaultValue())
 	vConfig.SetDefault(config.SshPrivateKeyPath.GetKey(), config.SshPrivateKeyPath.GetDefaultValue())
+	vConfig.SetDefault(config.SshPrivateKeyPassphrase.GetKey(), config.SshPrivateKeyPassphrase.GetDefaultValue())
 	vConfig.SetDefault(config.LoginUser.GetKey(), config.LoginUser.GetDefaultValue())
 	vConfig.SetDefault(config.LocalAddress.GetKey(), config.LocalAddress.GetDefaultValue())
 	vConfig.SetDefault(config.HttpLocalAddress.GetKey(), config.HttpLocalAddress.GetDefaultValue())
+	vConfig.SetDefault(config.MixedLocalAddress.GetKey(), config.MixedLocalAddress.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttp.GetKey(), config.EnableHttp.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsEnable.GetKey(), config.HttpTlsEnable.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsCertFile.GetKey(), config.HttpTlsCertFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpTlsKeyFile.GetKey(), config.HttpTlsKeyFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthUsersFile.GetKey(), config.HttpAuthUsersFile.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthMaxFailures.GetKey(), config.HttpAuthMaxFailures.GetDefaultValue())
+	vConfig.SetDefault(config.HttpAuthBlockSec.GetKey(), config.HttpAuthBlockSec.GetDefaultValue())
+	vConfig.SetDefault(config.RouteEnable.GetKey(), config.RouteEnable.GetDefaultValue())
+	vConfig.SetDefault(config.RouteRulesFile.GetKey(), config.RouteRulesFile.GetDefaultValue())
 	vConfig.SetDefault(config.EnableSocks5.GetKey(), config.EnableSocks5.GetDefaultValue())
+	vConfig.SetDefault(config.EnableMixed.GetKey(), config.EnableMixed.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpEnable.GetKey(), config.Socks5UdpEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpRelayAddress.GetKey(), config.Socks5UdpRelayAddress.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5UdpIdleTimeoutSec.GetKey(), config.Socks5UdpIdleTimeoutSec.GetDefaultValue())
 	vConfig.SetDefault(config.HttpBasicAuthEnable.GetKey(), config.HttpBasicAuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthEnable.GetKey(), config.Socks5AuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5NoAuthEnable.GetKey(), config.Socks5NoAuthEnable.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthShareHttpBasic.GetKey(), config.Socks5AuthShareHttpBasic.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthUserName.GetKey(), config.Socks5AuthUserName.GetDefaultValue())
+	vConfig.SetDefault(config.Socks5AuthPassword.GetKey(), config.Socks5AuthPassword.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttpOverSSH.GetKey(), config.EnableHttpOverSSH.GetDefaultValue())
 	vConfig.SetDefault(config.EnableHttpDomainFilter.GetKey(), config.EnableHttpDomainFilter.GetDefaultValue())
 	vConfig.SetDefault(config.HttpDomainFilterFilePath.GetKey(), config.HttpDomainFilterFilePath.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainCacheSize.GetKey(), config.HttpDomainCacheSize.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainCacheTTLSec.GetKey(), config.HttpDomainCacheTTLSec.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubscriptions.GetKey(), config.HttpDomainSubscriptions.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubIntervalMin.GetKey(), config.HttpDomainSubIntervalMin.GetDefaultValue())
+	vConfig.SetDefault(config.HttpDomainSubViaSSH.GetKey(), config.HttpDomainSubViaSSH.GetDefaultValue())
 	vConfig.SetDefault(config.EnableAdmin.GetKey(), config.EnableAdmin.GetDefaultValue())
 	vConfig.SetDefault(config.AdminAddress.GetKey(), config.AdminAddress.GetDefaultValue())
 	vConfig.SetDefault(config.RetryIntervalSec.GetKey(), config.RetryIntervalSec.GetDefaultValue())
@@ -208,6 +232,13 @@ func innerStart() {
 	vConfig.SetDefault(config.SSHKeepAliveCountMax.GetKey(), config.SSHKeepAliveCountMax.GetDefaultValue())
 	vConfig.SetDefault(config.SSHReconnectMaxRetries.GetKey(), config.SSHReconnectMaxRetries.GetDefaultValue())
 	vConfig.SetDefault(config.SSHReconnectMaxIntervalSec.GetKey(), config.SSHReconnectMaxIntervalSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHAuthChallengeTimeoutSec.GetKey(), config.SSHAuthChallengeTimeoutSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHCertExpiryWarnMin.GetKey(), config.SSHCertExpiryWarnMin.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeEnable.GetKey(), config.SSHProbeEnable.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeTarget.GetKey(), config.SSHProbeTarget.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeIntervalSec.GetKey(), config.SSHProbeIntervalSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeTimeoutSec.GetKey(), config.SSHProbeTimeoutSec.GetDefaultValue())
+	vConfig.SetDefault(config.SSHProbeFailureThreshold.GetKey(), config.SSHProbeFailureThreshold.GetDefaultValue())
 	vConfig.SetDefault(config.LogFilePath.GetKey(), config.LogFilePath.GetDefaultValue())
 	vConfig.SetDefault(config.AutoUpdateEnabled.GetKey(), config.AutoUpdateEnabled.GetDefaultValue())
 	vConfig.SetDefault(config.AutoUpdateOwner.GetKey(), config.AutoUpdateOwner.GetDefaultValue())
@@ -0,0 +1,171 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NegotiatedAlgorithms 当前SSH连接实际协商使用的算法
+type NegotiatedAlgorithms struct {
+	KeyExchange string                `json:"kex"`
+	HostKey     string                `json:"hostKey"`
+	Write       DirectionalAlgorithms `json:"clientToServer"`
+	Read        DirectionalAlgorithms `json:"serverToClient"`
+}
+
+// DirectionalAlgorithms 单个方向上的加密和MAC算法（AEAD 加密算法没有独立的MAC）
+type DirectionalAlgorithms struct {
+	Cipher string `json:"cipher"`
+	MAC    string `json:"mac,omitempty"`
+}
+
+// algorithmCategory 一类算法的可用范围：defaults 为修饰符(+ - ^)的基准列表，insecure 需要显式开启
+type algorithmCategory struct {
+	name     string
+	defaults []string
+	insecure []string
+}
+
+// ResolveAlgorithms 校验并展开 profile 中的算法配置，返回可直接用于 ssh.ClientConfig 的列表；
+// 某一类未配置时对应字段为 nil，即使用 x/crypto/ssh 的默认值
+func ResolveAlgorithms(algorithms *cfg.SSHAlgorithms) (ssh.Algorithms, error) {
+	var resolved ssh.Algorithms
+	if algorithms == nil {
+		return resolved, nil
+	}
+	supported := ssh.SupportedAlgorithms()
+	insecure := ssh.InsecureAlgorithms()
+
+	var err error
+	if resolved.Ciphers, err = resolveAlgorithmList(algorithmCategory{"ciphers", supported.Ciphers, insecure.Ciphers}, algorithms.Ciphers); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	if resolved.KeyExchanges, err = resolveAlgorithmList(algorithmCategory{"kex", supported.KeyExchanges, insecure.KeyExchanges}, algorithms.KeyExchanges); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	if resolved.MACs, err = resolveAlgorithmList(algorithmCategory{"macs", supported.MACs, insecure.MACs}, algorithms.MACs); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	if resolved.HostKeys, err = resolveAlgorithmList(algorithmCategory{"hostKeys", supported.HostKeys, insecure.HostKeys}, algorithms.HostKeys); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	return resolved, nil
+}
+
+func resolveAlgorithmList(category algorithmCategory, entries []string) ([]string, error) {
+	names := make([]string, 0, len(entries))
+	modifier := byte(0)
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var m byte
+		if entry[0] == '+' || entry[0] == '-' || entry[0] == '^' {
+			m = entry[0]
+			entry = strings.TrimSpace(entry[1:])
+		}
+		if len(names) > 0 && m != modifier {
+			return nil, fmt.Errorf("%s: cannot mix %q with other entries, use either a full list or a single modifier (+, -, ^)", category.name, entry)
+		}
+		modifier = m
+		if !containsString(category.defaults, entry) && !containsString(category.insecure, entry) {
+			return nil, fmt.Errorf("%s: unsupported algorithm %q", category.name, entry)
+		}
+		names = append(names, entry)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var result []string
+	switch modifier {
+	case '+':
+		result = append([]string(nil), category.defaults...)
+		for _, name := range names {
+			if !containsString(result, name) {
+				result = append(result, name)
+			}
+		}
+	case '^':
+		result = append([]string(nil), names...)
+		for _, name := range category.defaults {
+			if !containsString(result, name) {
+				result = append(result, name)
+			}
+		}
+	case '-':
+		for _, name := range category.defaults {
+			if !containsString(names, name) {
+				result = append(result, name)
+			}
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("%s: no algorithms left after removal", category.name)
+		}
+	default:
+		for _, name := range names {
+			if !containsString(result, name) {
+				result = append(result, name)
+			}
+		}
+	}
+
+	for _, name := range result {
+		if containsString(category.insecure, name) {
+			log.Printf("已启用不安全的SSH算法(%s): %s", category.name, name)
+		}
+	}
+	return result, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAlgorithms 将算法列表写入客户端配置，nil 字段保持 x/crypto/ssh 默认值
+func applyAlgorithms(clientConfig *ssh.ClientConfig, algorithms ssh.Algorithms) *ssh.ClientConfig {
+	clientConfig.Ciphers = algorithms.Ciphers
+	clientConfig.KeyExchanges = algorithms.KeyExchanges
+	clientConfig.MACs = algorithms.MACs
+	clientConfig.HostKeyAlgorithms = algorithms.HostKeys
+	return clientConfig
+}
+
+func negotiatedAlgorithms(client *ssh.Client) *NegotiatedAlgorithms {
+	if client == nil {
+		return nil
+	}
+	meta, ok := client.Conn.(ssh.AlgorithmsConnMetadata)
+	if !ok {
+		return nil
+	}
+	algorithms := meta.Algorithms()
+	return &NegotiatedAlgorithms{
+		KeyExchange: algorithms.KeyExchange,
+		HostKey:     algorithms.HostKey,
+		Write: DirectionalAlgorithms{
+			Cipher: algorithms.Write.Cipher,
+			MAC:    algorithms.Write.MAC,
+		},
+		Read: DirectionalAlgorithms{
+			Cipher: algorithms.Read.Cipher,
+			MAC:    algorithms.Read.MAC,
+		},
+	}
+}
+
+// NegotiatedAlgorithms 返回当前SSH连接协商的算法，未连接时返回 nil
+func (t *Tunnel) NegotiatedAlgorithms() *NegotiatedAlgorithms {
+	return negotiatedAlgorithms(t.PeekSSHClient())
+}
@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	supported := ssh.SupportedAlgorithms()
+
+	resolved, err := ResolveAlgorithms(nil)
+	if err != nil || resolved.Ciphers != nil || resolved.HostKeys != nil {
+		t.Fatalf("nil config should keep defaults, got %+v, %v", resolved, err)
+	}
+
+	resolved, err = ResolveAlgorithms(&cfg.SSHAlgorithms{
+		Ciphers:      []string{"aes256-gcm@openssh.com", "aes256-ctr"},
+		KeyExchanges: []string{"+" + ssh.InsecureKeyExchangeDH1SHA1},
+		MACs:         []string{"-" + ssh.HMACSHA256},
+		HostKeys:     []string{"^" + ssh.KeyAlgoRSA},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if strings.Join(resolved.Ciphers, ",") != "aes256-gcm@openssh.com,aes256-ctr" {
+		t.Fatalf("unexpected ciphers %v", resolved.Ciphers)
+	}
+	if len(resolved.KeyExchanges) != len(supported.KeyExchanges)+1 || resolved.KeyExchanges[len(resolved.KeyExchanges)-1] != ssh.InsecureKeyExchangeDH1SHA1 {
+		t.Fatalf("expected legacy kex appended to defaults, got %v", resolved.KeyExchanges)
+	}
+	if containsString(resolved.MACs, ssh.HMACSHA256) || len(resolved.MACs) != len(supported.MACs)-1 {
+		t.Fatalf("expected %s removed, got %v", ssh.HMACSHA256, resolved.MACs)
+	}
+	if resolved.HostKeys[0] != ssh.KeyAlgoRSA {
+		t.Fatalf("expected %s first, got %v", ssh.KeyAlgoRSA, resolved.HostKeys)
+	}
+
+	invalid := []*cfg.SSHAlgorithms{
+		{Ciphers: []string{"blowfish-cbc"}},
+		{MACs: []string{"hmac-sha2-256", "+hmac-sha1"}},
+		{KeyExchanges: prefixAll("-", supported.KeyExchanges)},
+	}
+	for _, algorithms := range invalid {
+		if _, err := ResolveAlgorithms(algorithms); err == nil {
+			t.Fatalf("expected %+v to be rejected", algorithms)
+		}
+	}
+}
+
+func prefixAll(prefix string, list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, s := range list {
+		result = append(result, prefix+s)
+	}
+	return result
+}
+
+func TestDialUsesConfiguredAlgorithms(t *testing.T) {
+	serverConfig := passwordServerConfig("secret")
+	serverConfig.Ciphers = []string{"aes128-ctr", "aes256-ctr"}
+	serverConfig.MACs = []string{ssh.HMACSHA256, ssh.HMACSHA512}
+	addr := startTestSSHServer(t, serverConfig, nil)
+
+	tunnel := newJumpTestTunnel(addr, "secret")
+	algorithms, err := ResolveAlgorithms(&cfg.SSHAlgorithms{
+		Ciphers:      []string{"aes256-ctr"},
+		KeyExchanges: []string{ssh.KeyExchangeCurve25519},
+		MACs:         []string{ssh.HMACSHA512},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	tunnel.algorithms = algorithms
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	negotiated := negotiatedAlgorithms(client)
+	if negotiated == nil {
+		t.Fatal("expected negotiated algorithms")
+	}
+	if negotiated.Write.Cipher != "aes256-ctr" || negotiated.Read.Cipher != "aes256-ctr" {
+		t.Fatalf("unexpected cipher %+v", negotiated)
+	}
+	if negotiated.Write.MAC != ssh.HMACSHA512 || negotiated.KeyExchange != ssh.KeyExchangeCurve25519 {
+		t.Fatalf("unexpected negotiated algorithms %+v", negotiated)
+	}
+
+	// 客户端只允许服务器不支持的算法时握手失败
+	tunnel.algorithms = ssh.Algorithms{Ciphers: []string{"chacha20-poly1305@openssh.com"}}
+	if _, err := tunnel.dialSSH(); err == nil {
+		t.Fatal("expected handshake to fail without a common cipher")
+	}
+}
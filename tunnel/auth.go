@@ -0,0 +1,584 @@
+package tunnel
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	AuthMethodPublicKey           = "publickey"
+	AuthMethodAgent               = "agent"
+	AuthMethodPassword            = "password"
+	AuthMethodKeyboardInteractive = "keyboard-interactive"
+)
+
+var defaultAuthMethods = []string{AuthMethodPublicKey, AuthMethodAgent}
+
+// IdentityStatus 单个私钥文件的加载状态
+type IdentityStatus struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Encrypted   bool   `json:"encrypted"`
+	Locked      bool   `json:"locked"`
+	Error       string `json:"error,omitempty"`
+	// Certificate 与私钥配对的 OpenSSH 用户证书
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+}
+
+// AuthStatus 当前认证链配置与状态
+type AuthStatus struct {
+	Methods        []string         `json:"methods"`
+	Identities     []IdentityStatus `json:"identities"`
+	AgentSocket    string           `json:"agentSocket,omitempty"`
+	AgentAvailable bool             `json:"agentAvailable"`
+	AgentKeys      int              `json:"agentKeys"`
+	AgentError     string           `json:"agentError,omitempty"`
+	PasswordSet    bool             `json:"passwordSet"`
+	LastMethod     string           `json:"lastMethod,omitempty"`
+	Challenge      *AuthChallenge   `json:"challenge,omitempty"`
+}
+
+type identity struct {
+	path      string
+	signer    ssh.Signer
+	encrypted bool
+	locked    bool
+	err       error
+	cert      *certificateFile
+}
+
+type authChain struct {
+	mu          sync.Mutex
+	methods     []string
+	identities  []*identity
+	agentSocket string
+	agentConn   net.Conn
+	agentClient agent.ExtendedAgent
+	password    string
+	// challenge 在键盘交互提示无法用已保存的密码应答时向操作员请求应答
+	challenge func(user, instruction string, questions []string, echos []bool) ([]string, error)
+	// lastAttempt 记录最近一次被服务器接受并用于签名的认证方式
+	lastAttempt string
+	// certExpiryWarn 用户证书到期前多久开始告警
+	certExpiryWarn time.Duration
+}
+
+func normalizeAuthMethods(methods []string) []string {
+	result := make([]string, 0, len(methods))
+	seen := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m == "" || seen[m] {
+			continue
+		}
+		switch m {
+		case AuthMethodPublicKey, AuthMethodAgent, AuthMethodPassword, AuthMethodKeyboardInteractive:
+		default:
+			log.Printf("忽略未知的SSH认证方式: %s", m)
+			continue
+		}
+		seen[m] = true
+		result = append(result, m)
+	}
+	if len(result) == 0 {
+		return append([]string(nil), defaultAuthMethods...)
+	}
+	return result
+}
+
+func identityPaths(primary string, extra []string) []string {
+	paths := make([]string, 0, len(extra)+1)
+	seen := make(map[string]bool, len(extra)+1)
+	for _, p := range append([]string{primary}, extra...) {
+		p = expandHomePath(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// loadIdentity 读取并解析私钥；加密私钥依次尝试 passphrases，都失败时标记为锁定而不是报错
+func loadIdentity(path string, passphrases ...string) *identity {
+	id := &identity{path: path}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		id.err = err
+		return id
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err == nil {
+		id.signer = signer
+		return id
+	}
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		id.err = err
+		return id
+	}
+
+	id.encrypted = true
+	for _, passphrase := range passphrases {
+		if passphrase == "" {
+			continue
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+		if err == nil {
+			id.signer = signer
+			return id
+		}
+		if !errors.Is(err, x509.IncorrectPasswordError) {
+			id.err = err
+			return id
+		}
+	}
+	id.locked = true
+	return id
+}
+
+func (c *authChain) record(label string) {
+	c.mu.Lock()
+	c.lastAttempt = label
+	c.mu.Unlock()
+}
+
+func (c *authChain) resetAttempt() {
+	c.record("")
+}
+
+func (c *authChain) lastMethod() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastAttempt
+}
+
+func (c *authChain) agentSigners() ([]ssh.Signer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.agentSocket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	if c.agentClient != nil {
+		signers, err := c.agentClient.Signers()
+		if err == nil {
+			return signers, nil
+		}
+		// agent 连接可能已失效，关闭后重连一次
+		c.agentConn.Close()
+		c.agentConn = nil
+		c.agentClient = nil
+	}
+	conn, err := net.Dial("unix", c.agentSocket)
+	if err != nil {
+		return nil, err
+	}
+	c.agentConn = conn
+	c.agentClient = agent.NewClient(conn)
+	return c.agentClient.Signers()
+}
+
+func (c *authChain) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.agentConn != nil {
+		c.agentConn.Close()
+		c.agentConn = nil
+		c.agentClient = nil
+	}
+}
+
+// signers 按认证方式顺序汇总所有可用的签名器；所有公钥类方式合并在同一个回调里，
+// 因为 x/crypto/ssh 对同名认证方式只会尝试一次
+func (c *authChain) signers() ([]ssh.Signer, error) {
+	var result []ssh.Signer
+	for _, method := range c.methods {
+		switch method {
+		case AuthMethodPublicKey:
+			for _, id := range c.identities {
+				if id.signer == nil {
+					continue
+				}
+				// 证书优先，服务器不接受证书时再尝试裸私钥
+				if certSigner := id.certSigner(); certSigner != nil {
+					result = append(result, c.wrapSigner(certSigner, "publickey-cert ("+id.cert.path+")"))
+				}
+				result = append(result, c.wrapSigner(id.signer, "publickey ("+id.path+")"))
+			}
+		case AuthMethodAgent:
+			if c.agentSocket == "" {
+				continue
+			}
+			signers, err := c.agentSigners()
+			if err != nil {
+				log.Printf("获取ssh-agent密钥失败: %v", err)
+				continue
+			}
+			for _, signer := range signers {
+				result = append(result, c.wrapSigner(signer, "agent ("+ssh.FingerprintSHA256(signer.PublicKey())+")"))
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no usable ssh identity")
+	}
+	return result, nil
+}
+
+// authMethods 按配置顺序生成认证方式，publickey 与 agent 合并为一个公钥认证
+func (c *authChain) authMethods() []ssh.AuthMethod {
+	methods := make([]ssh.AuthMethod, 0, len(c.methods))
+	publicKeyAdded := false
+	for _, method := range c.methods {
+		switch method {
+		case AuthMethodPublicKey, AuthMethodAgent:
+			if !publicKeyAdded {
+				methods = append(methods, ssh.PublicKeysCallback(c.signers))
+				publicKeyAdded = true
+			}
+		case AuthMethodPassword:
+			if c.password != "" {
+				methods = append(methods, ssh.PasswordCallback(c.passwordCallback))
+			}
+		case AuthMethodKeyboardInteractive:
+			methods = append(methods, ssh.KeyboardInteractive(c.keyboardInteractive))
+		}
+	}
+	return methods
+}
+
+func (c *authChain) passwordCallback() (string, error) {
+	c.record(AuthMethodPassword)
+	return c.password, nil
+}
+
+func isPasswordPrompt(prompt string, echo bool) bool {
+	return !echo && strings.Contains(strings.ToLower(prompt), "password")
+}
+
+func (c *authChain) keyboardInteractive(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	c.record(AuthMethodKeyboardInteractive)
+	if len(questions) == 0 {
+		return []string{}, nil
+	}
+
+	// 所有提示都是密码提示时直接使用已保存的密码应答
+	if c.password != "" {
+		answers := make([]string, len(questions))
+		allPassword := true
+		for i, q := range questions {
+			if !isPasswordPrompt(q, i < len(echos) && echos[i]) {
+				allPassword = false
+				break
+			}
+			answers[i] = c.password
+		}
+		if allPassword {
+			return answers, nil
+		}
+	}
+
+	if c.challenge == nil {
+		return nil, errors.New("keyboard-interactive challenge requires an operator but no handler is configured")
+	}
+	return c.challenge(user, instruction, questions, echos)
+}
+
+func (c *authChain) usable() bool {
+	for _, method := range c.methods {
+		switch method {
+		case AuthMethodPublicKey:
+			for _, id := range c.identities {
+				if id.signer != nil || id.locked {
+					return true
+				}
+			}
+		case AuthMethodAgent:
+			if c.agentSocket != "" {
+				return true
+			}
+		case AuthMethodPassword:
+			if c.password != "" {
+				return true
+			}
+		case AuthMethodKeyboardInteractive:
+			return true
+		}
+	}
+	return false
+}
+
+func (c *authChain) identityStatuses() []IdentityStatus {
+	result := make([]IdentityStatus, 0, len(c.identities))
+	for _, id := range c.identities {
+		item := IdentityStatus{Path: id.path, Encrypted: id.encrypted, Locked: id.locked}
+		if id.signer != nil {
+			item.Fingerprint = ssh.FingerprintSHA256(id.signer.PublicKey())
+		}
+		if id.err != nil {
+			item.Error = id.err.Error()
+		}
+		if id.cert != nil {
+			certStatus := id.cert.status(c.certExpiryWarn)
+			item.Certificate = &certStatus
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func (c *authChain) status() AuthStatus {
+	status := AuthStatus{
+		Methods:     append([]string(nil), c.methods...),
+		Identities:  c.identityStatuses(),
+		AgentSocket: c.agentSocket,
+		PasswordSet: c.password != "",
+	}
+	for _, method := range c.methods {
+		if method != AuthMethodAgent {
+			continue
+		}
+		signers, err := c.agentSigners()
+		if err != nil {
+			status.AgentError = err.Error()
+			break
+		}
+		status.AgentAvailable = true
+		status.AgentKeys = len(signers)
+	}
+	return status
+}
+
+// wrapSigner 包装签名器以记录实际被使用的认证方式，同时保留原签名器的算法协商能力
+func (c *authChain) wrapSigner(signer ssh.Signer, label string) ssh.Signer {
+	base := &recordingSigner{Signer: signer, label: label, record: c.record}
+	algSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return base
+	}
+	withAlg := &recordingAlgorithmSigner{recordingSigner: base, algSigner: algSigner}
+	if multi, ok := signer.(ssh.MultiAlgorithmSigner); ok {
+		return &recordingMultiAlgorithmSigner{recordingAlgorithmSigner: withAlg, multi: multi}
+	}
+	return withAlg
+}
+
+type recordingSigner struct {
+	ssh.Signer
+	label  string
+	record func(string)
+}
+
+func (s *recordingSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.record(s.label)
+	return s.Signer.Sign(rand, data)
+}
+
+type recordingAlgorithmSigner struct {
+	*recordingSigner
+	algSigner ssh.AlgorithmSigner
+}
+
+func (s *recordingAlgorithmSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.record(s.label)
+	return s.algSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+type recordingMultiAlgorithmSigner struct {
+	*recordingAlgorithmSigner
+	multi ssh.MultiAlgorithmSigner
+}
+
+func (s *recordingMultiAlgorithmSigner) Algorithms() []string {
+	return s.multi.Algorithms()
+}
+
+// authSpec 构建认证链所需的配置，目标服务器与跳板机各自一份
+type authSpec struct {
+	methods       []string
+	keyPath       string
+	certificate   string
+	identityFiles []string
+	agentSocket   string
+	password      string
+}
+
+func (t *Tunnel) buildAuthChain(spec authSpec, globalPassphrase string) (*authChain, error) {
+	agentSocket := strings.TrimSpace(spec.agentSocket)
+	if agentSocket == "" {
+		agentSocket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	password, err := cfg.DecryptSecret(spec.password)
+	if err != nil {
+		log.Printf("解密SSH密码失败: %v", err)
+	}
+	if globalPassphrase, err = cfg.DecryptSecret(globalPassphrase); err != nil {
+		log.Printf("解密SSH私钥口令失败: %v", err)
+	}
+	chain := &authChain{
+		methods:        normalizeAuthMethods(spec.methods),
+		agentSocket:    expandHomePath(agentSocket),
+		password:       password,
+		challenge:      t.askAuthChallenge,
+		certExpiryWarn: t.certExpiryWarn,
+	}
+
+	paths := identityPaths(spec.keyPath, spec.identityFiles)
+	if !slices.Contains(chain.methods, AuthMethodPublicKey) {
+		paths = nil
+	}
+	primary := expandHomePath(spec.keyPath)
+	for _, p := range paths {
+		id := loadIdentity(p, t.cachedPassphrase(p), globalPassphrase)
+		configuredCert := ""
+		if p == primary {
+			configuredCert = spec.certificate
+		}
+		if certPath := userCertificatePath(p, configuredCert); certPath != "" {
+			id.cert = &certificateFile{path: certPath}
+		}
+		switch {
+		case id.err != nil:
+			log.Printf("加载SSH私钥失败(%s): %v", p, id.err)
+		case id.locked:
+			log.Printf("SSH私钥(%s)已加密，请通过管理接口提供口令解锁", p)
+		}
+		chain.identities = append(chain.identities, id)
+	}
+
+	if !chain.usable() {
+		return nil, fmt.Errorf("no usable ssh auth method: check private key files, SSH_AUTH_SOCK or profile password")
+	}
+	return chain, nil
+}
+
+// refreshAuthChain 根据当前配置和 profile 重建目标服务器及跳板机的认证链、算法与传输链路配置
+func (t *Tunnel) refreshAuthChain(config *cfg.AppConfig) error {
+	profileID, profile := cfg.ActiveProfile(config)
+	algorithms, err := ResolveAlgorithms(profile.Algorithms)
+	if err != nil {
+		return err
+	}
+	proxy, err := newTransportProxy(profile.TransportProxy)
+	if err != nil {
+		return err
+	}
+	wrapper, err := newTransportWrapper(profile.TransportWrap)
+	if err != nil {
+		return err
+	}
+	chain, err := t.buildAuthChain(authSpec{
+		methods:       profile.AuthMethods,
+		keyPath:       config.SshPrivateKeyPath.GetValue(),
+		certificate:   profile.CertificateFile,
+		identityFiles: profile.IdentityFiles,
+		agentSocket:   profile.IdentityAgent,
+		password:      profile.Password,
+	}, config.SshPrivateKeyPassphrase.GetValue())
+	if err != nil {
+		return err
+	}
+
+	hops, err := t.buildJumpHops(config, profileID, profile)
+	if err != nil {
+		chain.close()
+		return err
+	}
+
+	t.authMutex.Lock()
+	old := t.authChain
+	oldHops := t.jumpHops
+	t.authChain = chain
+	t.auth = chain.authMethods()
+	t.jumpHops = hops
+	t.algorithms = algorithms
+	t.transportProxy = proxy
+	t.transportWrapper = wrapper
+	t.authMutex.Unlock()
+	if old != nil {
+		old.close()
+	}
+	for _, hop := range oldHops {
+		hop.chain.close()
+	}
+	return nil
+}
+
+func (t *Tunnel) cachedPassphrase(path string) string {
+	t.authMutex.Lock()
+	defer t.authMutex.Unlock()
+	return t.keyPassphrases[path]
+}
+
+// UnlockIdentity 使用口令解锁加密私钥，成功后缓存口令（仅内存）并重建认证链
+func (t *Tunnel) UnlockIdentity(path string, passphrase string) error {
+	path = expandHomePath(path)
+	if path == "" {
+		return errors.New("path is required")
+	}
+	if passphrase == "" {
+		return errors.New("passphrase is required")
+	}
+	id := loadIdentity(path, passphrase)
+	if id.err != nil {
+		return id.err
+	}
+	if id.locked {
+		return errors.New("incorrect passphrase")
+	}
+
+	t.authMutex.Lock()
+	if t.keyPassphrases == nil {
+		t.keyPassphrases = make(map[string]string)
+	}
+	t.keyPassphrases[path] = passphrase
+	t.authMutex.Unlock()
+
+	log.Printf("SSH私钥已解锁: %s", path)
+	config := t.AppConfig()
+	if config == nil {
+		return errors.New("app config is nil")
+	}
+	return t.refreshAuthChain(config)
+}
+
+// AuthStatus 返回认证链配置、私钥加载状态、ssh-agent 状态以及最近一次成功的认证方式
+func (t *Tunnel) AuthStatus() AuthStatus {
+	t.authMutex.Lock()
+	chain := t.authChain
+	hops := t.jumpHops
+	t.authMutex.Unlock()
+	if chain == nil {
+		return AuthStatus{Methods: append([]string(nil), defaultAuthMethods...), Identities: []IdentityStatus{}, Challenge: t.PendingAuthChallenge()}
+	}
+	status := chain.status()
+	for _, hop := range hops {
+		for _, id := range hop.chain.identityStatuses() {
+			if !slices.ContainsFunc(status.Identities, func(item IdentityStatus) bool { return item.Path == id.Path }) {
+				status.Identities = append(status.Identities, id)
+			}
+		}
+	}
+
+	t.reconnectMutex.Lock()
+	status.LastMethod = t.authMethodUsed
+	t.reconnectMutex.Unlock()
+	status.Challenge = t.PendingAuthChallenge()
+	return status
+}
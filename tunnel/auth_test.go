@@ -0,0 +1,203 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var errTestAuthRejected = errors.New("public key rejected")
+
+func writeTestIdentity(t *testing.T, dir string, name string, key interface{}, passphrase string) (string, ssh.Signer) {
+	t.Helper()
+	var block *pem.Block
+	var err error
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	keyPath := filepath.Join(dir, name)
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("write private key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return keyPath, signer
+}
+
+func newTestEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return priv
+}
+
+func startTestAgent(t *testing.T, keys ...interface{}) string {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+			t.Fatalf("add agent key: %v", err)
+		}
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix socket not available: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return socket
+}
+
+func signerLabel(signer ssh.Signer) string {
+	switch s := signer.(type) {
+	case *recordingSigner:
+		return s.label
+	case *recordingAlgorithmSigner:
+		return s.label
+	case *recordingMultiAlgorithmSigner:
+		return s.label
+	}
+	return ""
+}
+
+func TestLoadIdentityEncryptedKey(t *testing.T) {
+	keyPath, signer := writeTestIdentity(t, t.TempDir(), "id_ed25519", newTestEd25519Key(t), "secret")
+
+	locked := loadIdentity(keyPath)
+	if !locked.encrypted || !locked.locked || locked.signer != nil {
+		t.Fatalf("expected encrypted key to be locked without passphrase, got %+v", locked)
+	}
+
+	wrong := loadIdentity(keyPath, "wrong")
+	if !wrong.locked || wrong.err != nil {
+		t.Fatalf("expected wrong passphrase to keep key locked, got %+v", wrong)
+	}
+
+	unlocked := loadIdentity(keyPath, "wrong", "secret")
+	if unlocked.signer == nil || unlocked.locked {
+		t.Fatalf("expected key to be unlocked, got %+v", unlocked)
+	}
+	if ssh.FingerprintSHA256(unlocked.signer.PublicKey()) != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Fatalf("unlocked key fingerprint mismatch")
+	}
+}
+
+func TestAuthChainDecryptsGlobalPassphrase(t *testing.T) {
+	t.Setenv(cfg.SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	keyPath, _ := writeTestIdentity(t, t.TempDir(), "id_ed25519", newTestEd25519Key(t), "secret")
+	encrypted, err := cfg.EncryptSecret("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel := newTestTunnel()
+	chain, err := tunnel.buildAuthChain(authSpec{keyPath: keyPath}, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.close()
+	if len(chain.identities) != 1 || chain.identities[0].signer == nil || chain.identities[0].locked {
+		t.Fatalf("expected encrypted global passphrase to unlock the key, got %+v", chain.identities)
+	}
+}
+
+func TestAuthChainSignerOrder(t *testing.T) {
+	dir := t.TempDir()
+	firstPath, _ := writeTestIdentity(t, dir, "first", newTestEd25519Key(t), "")
+	secondPath, _ := writeTestIdentity(t, dir, "second", newTestEd25519Key(t), "")
+	socket := startTestAgent(t, newTestEd25519Key(t))
+
+	chain := &authChain{
+		methods:     normalizeAuthMethods([]string{"agent", "publickey", "bogus"}),
+		agentSocket: socket,
+	}
+	defer chain.close()
+	for _, p := range identityPaths(firstPath, []string{secondPath, firstPath}) {
+		chain.identities = append(chain.identities, loadIdentity(p))
+	}
+
+	signers, err := chain.signers()
+	if err != nil {
+		t.Fatalf("signers: %v", err)
+	}
+	if len(signers) != 3 {
+		t.Fatalf("expected 3 signers, got %d", len(signers))
+	}
+	if got := signerLabel(signers[0]); !strings.HasPrefix(got, "agent (") {
+		t.Fatalf("expected agent signer first, got %q", got)
+	}
+	if got := signerLabel(signers[1]); got != "publickey ("+firstPath+")" {
+		t.Fatalf("unexpected second signer %q", got)
+	}
+	if got := signerLabel(signers[2]); got != "publickey ("+secondPath+")" {
+		t.Fatalf("unexpected third signer %q", got)
+	}
+}
+
+func TestAuthChainRecordsSuccessfulMethod(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	rejectedPath, _ := writeTestIdentity(t, dir, "rejected", newTestEd25519Key(t), "")
+	acceptedPath, acceptedSigner := writeTestIdentity(t, dir, "id_rsa", rsaKey, "pass")
+
+	serverConfig := &ssh.ServerConfig{PublicKeyCallback: acceptPublicKeys(acceptedSigner.PublicKey())}
+	addr := startTestSSHServer(t, serverConfig, nil)
+
+	chain := &authChain{methods: defaultAuthMethods}
+	chain.identities = []*identity{loadIdentity(rejectedPath), loadIdentity(acceptedPath, "pass")}
+
+	tunnel := newTestTunnel()
+	tunnel.serverAddress = addr
+	tunnel.user = "test"
+	tunnel.hostKeys = ssh.InsecureIgnoreHostKey()
+	tunnel.authChain = chain
+	tunnel.auth = chain.authMethods()
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	stats := tunnel.SnapshotSSHConnectionStats()
+	if stats.AuthMethodUsed != "publickey ("+acceptedPath+")" {
+		t.Fatalf("unexpected auth method %q", stats.AuthMethodUsed)
+	}
+}
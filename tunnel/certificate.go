@@ -0,0 +1,265 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultCertExpiryWarning = time.Hour
+
+// CertificateStatus 用户证书的加载与有效期状态
+type CertificateStatus struct {
+	Path         string     `json:"path"`
+	KeyID        string     `json:"keyId,omitempty"`
+	Serial       uint64     `json:"serial"`
+	Principals   []string   `json:"principals,omitempty"`
+	ValidAfter   *time.Time `json:"validAfter,omitempty"`
+	ValidBefore  *time.Time `json:"validBefore,omitempty"`
+	Expired      bool       `json:"expired"`
+	ExpiringSoon bool       `json:"expiringSoon"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// HostCertificateError 服务器出示了受信任CA签发的主机证书，但证书本身无效（过期、主机名不在 principals 中等）
+type HostCertificateError struct {
+	Host  string
+	KeyID string
+	Err   error
+}
+
+func (e *HostCertificateError) Error() string {
+	return fmt.Sprintf("host certificate %q for %s is invalid: %v", e.KeyID, e.Host, e.Err)
+}
+
+func (e *HostCertificateError) Unwrap() error {
+	return e.Err
+}
+
+// certificateFile 用户证书文件，文件变化时自动重新加载，证书续签后无需重启进程
+type certificateFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	cert    *ssh.Certificate
+	err     error
+}
+
+func parseUserCertificate(b []byte) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not an OpenSSH certificate")
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errors.New("not a user certificate")
+	}
+	return cert, nil
+}
+
+// current 返回最新的证书，文件的修改时间或大小变化时重新读取
+func (f *certificateFile) current() (*ssh.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		f.cert, f.err, f.modTime = nil, err, time.Time{}
+		return nil, err
+	}
+	if !f.modTime.IsZero() && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.cert, f.err
+	}
+
+	previous := f.cert
+	f.modTime, f.size = info.ModTime(), info.Size()
+	b, err := os.ReadFile(f.path)
+	if err == nil {
+		f.cert, err = parseUserCertificate(b)
+	}
+	f.err = err
+	if err != nil {
+		f.cert = nil
+		log.Printf("加载SSH用户证书失败(%s): %v", f.path, err)
+		return nil, err
+	}
+	if previous != nil && previous.Serial != f.cert.Serial {
+		log.Printf("已重新加载SSH用户证书(%s)，serial: %d -> %d", f.path, previous.Serial, f.cert.Serial)
+	}
+	return f.cert, nil
+}
+
+func certificateExpired(cert *ssh.Certificate, now time.Time) bool {
+	unix := uint64(now.Unix())
+	return unix < cert.ValidAfter || (cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore)
+}
+
+func (f *certificateFile) status(warn time.Duration) CertificateStatus {
+	status := CertificateStatus{Path: f.path}
+	cert, err := f.current()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	now := time.Now()
+	status.KeyID = cert.KeyId
+	status.Serial = cert.Serial
+	status.Principals = append([]string(nil), cert.ValidPrincipals...)
+	if cert.ValidAfter > 0 {
+		validAfter := time.Unix(int64(cert.ValidAfter), 0)
+		status.ValidAfter = &validAfter
+	}
+	status.Expired = certificateExpired(cert, now)
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		validBefore := time.Unix(int64(cert.ValidBefore), 0)
+		status.ValidBefore = &validBefore
+		if warn <= 0 {
+			warn = defaultCertExpiryWarning
+		}
+		status.ExpiringSoon = !status.Expired && validBefore.Sub(now) <= warn
+	}
+	return status
+}
+
+// userCertificatePath 确定私钥对应的证书：显式配置优先，否则按 OpenSSH 约定查找 <私钥>-cert.pub
+func userCertificatePath(keyPath string, configured string) string {
+	if configured = expandHomePath(configured); configured != "" {
+		return configured
+	}
+	candidate := keyPath + "-cert.pub"
+	if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+		return candidate
+	}
+	return ""
+}
+
+// certSigner 使用当前证书包装私钥签名器；证书缺失、过期或与私钥不匹配时返回 nil，仅使用裸私钥认证
+func (id *identity) certSigner() ssh.Signer {
+	if id.cert == nil || id.signer == nil {
+		return nil
+	}
+	cert, err := id.cert.current()
+	if err != nil {
+		return nil
+	}
+	if certificateExpired(cert, time.Now()) {
+		log.Printf("SSH用户证书(%s)不在有效期内，跳过证书认证", id.cert.path)
+		return nil
+	}
+	signer, err := ssh.NewCertSigner(cert, id.signer)
+	if err != nil {
+		log.Printf("SSH用户证书(%s)与私钥(%s)不匹配: %v", id.cert.path, id.path, err)
+		return nil
+	}
+	return signer
+}
+
+// loadHostCAKeys 读取受信任的主机CA公钥，每个文件可包含多行 authorized_keys 格式的公钥
+func loadHostCAKeys(files []string) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for _, file := range files {
+		file = expandHomePath(file)
+		if file == "" {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("读取主机CA公钥失败(%s): %v", file, err)
+			continue
+		}
+		for len(bytes.TrimSpace(b)) > 0 {
+			pub, _, _, rest, err := ssh.ParseAuthorizedKey(b)
+			if err != nil {
+				log.Printf("解析主机CA公钥失败(%s): %v", file, err)
+				break
+			}
+			keys = append(keys, pub)
+			b = rest
+		}
+	}
+	return keys
+}
+
+func containsPublicKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	marshaled := key.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), marshaled) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyHostCertificate 校验主机证书：签发者在受信任CA(profile 配置或 known_hosts 的 @cert-authority)中时返回CA指纹，
+// 受信任CA签发但证书无效时返回错误；签发者不受信任时返回空字符串，交由调用方按证书内的公钥继续校验
+func verifyHostCertificate(hostname string, remote net.Addr, cert *ssh.Certificate, caFiles []string, knownHostsFiles []string) (string, error) {
+	cas := loadHostCAKeys(caFiles)
+	if containsPublicKey(cas, cert.SignatureKey) {
+		checker := &ssh.CertChecker{
+			IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+				return containsPublicKey(cas, auth)
+			},
+		}
+		if err := checker.CheckHostKey(hostname, remote, cert); err != nil {
+			return "", &HostCertificateError{Host: hostname, KeyID: cert.KeyId, Err: err}
+		}
+		return ssh.FingerprintSHA256(cert.SignatureKey), nil
+	}
+
+	if files := existingFiles(knownHostsFiles); len(files) > 0 {
+		callback, err := knownhosts.New(files...)
+		if err == nil && callback(hostname, remote, cert) == nil {
+			return ssh.FingerprintSHA256(cert.SignatureKey), nil
+		}
+	}
+	return "", nil
+}
+
+// hostKeyFingerprint 主机证书取证书内公钥的指纹，这样证书重新签发后固定的指纹仍然有效
+func hostKeyFingerprint(key ssh.PublicKey) string {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return ssh.FingerprintSHA256(cert.Key)
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// CertificateWarnings 返回已过期、即将过期或加载失败的用户证书（含跳板机）
+func (t *Tunnel) CertificateWarnings() []CertificateStatus {
+	t.authMutex.Lock()
+	chains := make([]*authChain, 0, len(t.jumpHops)+1)
+	if t.authChain != nil {
+		chains = append(chains, t.authChain)
+	}
+	for _, hop := range t.jumpHops {
+		chains = append(chains, hop.chain)
+	}
+	t.authMutex.Unlock()
+
+	warnings := make([]CertificateStatus, 0)
+	seen := make(map[string]bool)
+	for _, chain := range chains {
+		for _, id := range chain.identities {
+			if id.cert == nil || seen[id.cert.path] {
+				continue
+			}
+			seen[id.cert.path] = true
+			status := id.cert.status(chain.certExpiryWarn)
+			if status.Expired || status.ExpiringSoon || status.Error != "" {
+				warnings = append(warnings, status)
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func signTestCertificate(t *testing.T, ca ssh.Signer, key ssh.PublicKey, certType uint32, principals []string, validBefore time.Time) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          uint64(time.Now().UnixNano()),
+		CertType:        certType,
+		KeyId:           "test-cert",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("sign certificate: %v", err)
+	}
+	return cert
+}
+
+func writeTestCertificate(t *testing.T, path string, cert *ssh.Certificate, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	signer, err := ssh.NewSignerFromKey(newTestEd25519Key(t))
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer
+}
+
+func TestUserCertificateAuthAndReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestSigner(t)
+	keyPath, signer := writeTestIdentity(t, dir, "id_ed25519", newTestEd25519Key(t), "")
+	certPath := keyPath + "-cert.pub"
+
+	// 服务器只接受CA签发的用户证书，不接受裸公钥
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.PublicKey().Marshal())
+		},
+	}
+	addr := startTestSSHServer(t, &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate}, nil)
+
+	expired := signTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, []string{"test"}, time.Now().Add(-time.Minute))
+	writeTestCertificate(t, certPath, expired, time.Now().Add(-time.Hour))
+
+	tunnel := newTestTunnel()
+	tunnel.serverAddress = addr
+	tunnel.user = "test"
+	tunnel.hostKeys = ssh.InsecureIgnoreHostKey()
+	tunnel.certExpiryWarn = 30 * time.Minute
+	chain, err := tunnel.buildAuthChain(authSpec{keyPath: keyPath}, "")
+	if err != nil {
+		t.Fatalf("build auth chain: %v", err)
+	}
+	tunnel.authChain = chain
+	tunnel.auth = chain.authMethods()
+
+	warnings := tunnel.CertificateWarnings()
+	if len(warnings) != 1 || !warnings[0].Expired || warnings[0].Path != certPath {
+		t.Fatalf("expected expired certificate warning, got %+v", warnings)
+	}
+	if _, err := tunnel.dialSSH(); err == nil {
+		t.Fatal("expected dial to fail with an expired certificate")
+	}
+
+	// 续签后覆盖证书文件，无需重建认证链即可生效
+	renewed := signTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, []string{"test"}, time.Now().Add(10*time.Minute))
+	writeTestCertificate(t, certPath, renewed, time.Now())
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial with renewed certificate: %v", err)
+	}
+	defer client.Close()
+	if got := tunnel.SnapshotSSHConnectionStats().AuthMethodUsed; got != "publickey-cert ("+certPath+")" {
+		t.Fatalf("unexpected auth method %q", got)
+	}
+
+	warnings = tunnel.CertificateWarnings()
+	if len(warnings) != 1 || warnings[0].Expired || !warnings[0].ExpiringSoon || warnings[0].Serial != renewed.Serial {
+		t.Fatalf("expected expiring-soon warning for renewed certificate, got %+v", warnings)
+	}
+}
+
+func TestHostCertificateVerification(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestSigner(t)
+	caFile := filepath.Join(dir, "host_ca.pub")
+	if err := os.WriteFile(caFile, ssh.MarshalAuthorizedKey(ca.PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hostSigner := newTestSigner(t)
+	hostCert := signTestCertificate(t, ca, hostSigner.PublicKey(), ssh.HostCert, []string{"127.0.0.1"}, time.Now().Add(time.Hour))
+	certSigner, err := ssh.NewCertSigner(hostCert, hostSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, clientSigner := writeTestIdentity(t, dir, "id_ed25519", newTestEd25519Key(t), "")
+	serverConfig := &ssh.ServerConfig{PublicKeyCallback: acceptPublicKeys(clientSigner.PublicKey())}
+	serverConfig.AddHostKey(certSigner)
+	addr := startTestSSHServer(t, serverConfig, nil)
+
+	dial := func(verifier *hostKeyVerifier) error {
+		client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+			User:            "test",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(clientSigner)},
+			HostKeyCallback: verifier.verify,
+			Timeout:         5 * time.Second,
+		})
+		if err == nil {
+			client.Close()
+		}
+		return err
+	}
+
+	trusted := &hostKeyVerifier{policy: HostKeyPolicyStrict, hostCAFiles: []string{caFile}}
+	if err := dial(trusted); err != nil {
+		t.Fatalf("expected CA-signed host certificate to be accepted: %v", err)
+	}
+	if trusted.authority != ssh.FingerprintSHA256(ca.PublicKey()) {
+		t.Fatalf("expected authority to be recorded, got %q", trusted.authority)
+	}
+
+	// 未配置CA时 strict 策略按证书内的公钥校验，未知主机应被拒绝
+	untrusted := &hostKeyVerifier{policy: HostKeyPolicyStrict}
+	var unknown *HostKeyUnknownError
+	if err := dial(untrusted); !errors.As(err, &unknown) {
+		t.Fatalf("expected unknown host error, got %v", err)
+	}
+	if unknown.Offered != ssh.FingerprintSHA256(hostSigner.PublicKey()) {
+		t.Fatalf("expected fingerprint of the certified key, got %s", unknown.Offered)
+	}
+
+	// 受信任CA签发但 principals 不包含连接地址的证书必须拒绝
+	wrongCert := signTestCertificate(t, ca, hostSigner.PublicKey(), ssh.HostCert, []string{"other.example.com"}, time.Now().Add(time.Hour))
+	remote := &fakeAddr{}
+	var certErr *HostCertificateError
+	if err := trusted.verify(addr, remote, wrongCert); !errors.As(err, &certErr) {
+		t.Fatalf("expected host certificate error, got %v", err)
+	}
+}
+
+type fakeAddr struct{}
+
+func (fakeAddr) Network() string { return "tcp" }
+func (fakeAddr) String() string  { return "127.0.0.1:22" }
@@ -0,0 +1,165 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAuthChallengeTimeout   = errors.New("keyboard-interactive challenge was not answered in time")
+	ErrAuthChallengeCancelled = errors.New("keyboard-interactive challenge was cancelled")
+)
+
+const defaultAuthChallengeTimeout = 5 * time.Minute
+
+// AuthChallengeQuestion 键盘交互认证中的单个提示
+type AuthChallengeQuestion struct {
+	Prompt string `json:"prompt"`
+	Echo   bool   `json:"echo"`
+}
+
+// AuthChallenge 等待操作员通过管理接口应答的键盘交互认证
+type AuthChallenge struct {
+	ID          string                  `json:"id"`
+	User        string                  `json:"user"`
+	Instruction string                  `json:"instruction,omitempty"`
+	Questions   []AuthChallengeQuestion `json:"questions"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	ExpiresAt   time.Time               `json:"expiresAt"`
+}
+
+type pendingChallenge struct {
+	challenge AuthChallenge
+	answers   chan []string
+	cancelled chan struct{}
+}
+
+// challengeBroker 同一时间只挂起一个待应答的认证提示（重连本身是单飞的）
+type challengeBroker struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending *pendingChallenge
+}
+
+func (b *challengeBroker) ask(ctx context.Context, timeout time.Duration, user, instruction string, questions []string, echos []bool) ([]string, error) {
+	if timeout <= 0 {
+		timeout = defaultAuthChallengeTimeout
+	}
+	now := time.Now()
+	p := &pendingChallenge{
+		challenge: AuthChallenge{
+			User:        user,
+			Instruction: instruction,
+			Questions:   make([]AuthChallengeQuestion, 0, len(questions)),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(timeout),
+		},
+		answers:   make(chan []string, 1),
+		cancelled: make(chan struct{}),
+	}
+	for i, q := range questions {
+		p.challenge.Questions = append(p.challenge.Questions, AuthChallengeQuestion{Prompt: q, Echo: i < len(echos) && echos[i]})
+	}
+
+	b.mu.Lock()
+	b.seq++
+	p.challenge.ID = strconv.FormatUint(b.seq, 10)
+	b.pending = p
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		if b.pending == p {
+			b.pending = nil
+		}
+		b.mu.Unlock()
+	}()
+
+	log.Printf("SSH键盘交互认证等待操作员应答(id=%s, user=%s, 提示数=%d)", p.challenge.ID, user, len(questions))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case answers := <-p.answers:
+		return answers, nil
+	case <-p.cancelled:
+		return nil, ErrAuthChallengeCancelled
+	case <-timer.C:
+		return nil, ErrAuthChallengeTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *challengeBroker) current() *AuthChallenge {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		return nil
+	}
+	challenge := b.pending.challenge
+	challenge.Questions = append([]AuthChallengeQuestion(nil), challenge.Questions...)
+	return &challenge
+}
+
+func (b *challengeBroker) take(id string, answerCount int) (*pendingChallenge, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		return nil, errors.New("no pending challenge")
+	}
+	if id != "" && id != b.pending.challenge.ID {
+		return nil, fmt.Errorf("challenge %s is no longer pending", id)
+	}
+	if answerCount >= 0 && answerCount != len(b.pending.challenge.Questions) {
+		return nil, fmt.Errorf("expected %d answers, got %d", len(b.pending.challenge.Questions), answerCount)
+	}
+	p := b.pending
+	b.pending = nil
+	return p, nil
+}
+
+func (b *challengeBroker) answer(id string, answers []string) error {
+	p, err := b.take(id, len(answers))
+	if err != nil {
+		return err
+	}
+	p.answers <- answers
+	return nil
+}
+
+func (b *challengeBroker) cancel(id string) error {
+	p, err := b.take(id, -1)
+	if err != nil {
+		return err
+	}
+	close(p.cancelled)
+	return nil
+}
+
+func isAuthChallengeAborted(err error) bool {
+	return errors.Is(err, ErrAuthChallengeTimeout) || errors.Is(err, ErrAuthChallengeCancelled)
+}
+
+func (t *Tunnel) askAuthChallenge(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	return t.challenges.ask(t.reconnectContext(nil), t.authChallengeTimeout, user, instruction, questions, echos)
+}
+
+// PendingAuthChallenge 返回当前等待应答的键盘交互认证，没有时返回 nil
+func (t *Tunnel) PendingAuthChallenge() *AuthChallenge {
+	return t.challenges.current()
+}
+
+// AnswerAuthChallenge 提交键盘交互认证的应答，answers 与提示一一对应
+func (t *Tunnel) AnswerAuthChallenge(id string, answers []string) error {
+	return t.challenges.answer(id, answers)
+}
+
+// CancelAuthChallenge 放弃当前键盘交互认证，本次重连将停止重试
+func (t *Tunnel) CancelAuthChallenge(id string) error {
+	return t.challenges.cancel(id)
+}
@@ -0,0 +1,120 @@
+package tunnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newChallengeTestTunnel(t *testing.T, serverConfig *ssh.ServerConfig, chain *authChain) *Tunnel {
+	t.Helper()
+	tunnel := newTestTunnel()
+	tunnel.serverAddress = startTestSSHServer(t, serverConfig, nil)
+	tunnel.user = "test"
+	tunnel.hostKeys = ssh.InsecureIgnoreHostKey()
+	tunnel.authChallengeTimeout = time.Second
+	chain.challenge = tunnel.askAuthChallenge
+	tunnel.authChain = chain
+	tunnel.auth = chain.authMethods()
+	return tunnel
+}
+
+func otpServerConfig(password string, otp string) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client(conn.User(), "two factor", []string{"Password: ", "Verification code: "}, []bool{false, true})
+			if err != nil {
+				return nil, err
+			}
+			if answers[0] != password || answers[1] != otp {
+				return nil, errors.New("wrong answers")
+			}
+			return nil, nil
+		},
+	}
+}
+
+func TestKeyboardInteractiveWaitsForOperator(t *testing.T) {
+	chain := &authChain{methods: normalizeAuthMethods([]string{"keyboard-interactive"})}
+	tunnel := newChallengeTestTunnel(t, otpServerConfig("secret", "123456"), chain)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if challenge := tunnel.PendingAuthChallenge(); challenge != nil {
+				if len(challenge.Questions) != 2 || !challenge.Questions[1].Echo {
+					t.Errorf("unexpected challenge %+v", challenge)
+				}
+				if err := tunnel.AnswerAuthChallenge(challenge.ID, []string{"secret"}); err == nil {
+					t.Errorf("expected answer count mismatch to be rejected")
+				}
+				if err := tunnel.AnswerAuthChallenge(challenge.ID, []string{"secret", "123456"}); err != nil {
+					t.Errorf("answer: %v", err)
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("challenge never became pending")
+	}()
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	client.Close()
+	if got := tunnel.SnapshotSSHConnectionStats().AuthMethodUsed; got != AuthMethodKeyboardInteractive {
+		t.Fatalf("unexpected auth method %q", got)
+	}
+	if tunnel.PendingAuthChallenge() != nil {
+		t.Fatalf("expected no pending challenge after answer")
+	}
+}
+
+func TestReconnectStopsWhenChallengeUnanswered(t *testing.T) {
+	chain := &authChain{methods: normalizeAuthMethods([]string{"keyboard-interactive"})}
+	tunnel := newChallengeTestTunnel(t, otpServerConfig("secret", "123456"), chain)
+	tunnel.authChallengeTimeout = 50 * time.Millisecond
+	attempts := 0
+	tunnel.sshDialFn = func() (*ssh.Client, error) {
+		attempts++
+		return tunnel.dialSSHClient()
+	}
+
+	tunnel.ReconnectSSHWithSource(t.Context(), "test")
+
+	if attempts != 1 {
+		t.Fatalf("expected reconnect to stop after unanswered challenge, got %d attempts", attempts)
+	}
+	if stats := tunnel.SnapshotSSHConnectionStats(); stats.ConnectionCount != 0 {
+		t.Fatalf("expected no connection")
+	}
+}
+
+func TestPasswordAuthAnswersPasswordPrompts(t *testing.T) {
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	chain := &authChain{methods: normalizeAuthMethods([]string{"publickey", "password"}), password: "secret"}
+	tunnel := newChallengeTestTunnel(t, serverConfig, chain)
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	client.Close()
+	if got := tunnel.SnapshotSSHConnectionStats().AuthMethodUsed; got != AuthMethodPassword {
+		t.Fatalf("unexpected auth method %q", got)
+	}
+
+	answers, err := chain.keyboardInteractive("test", "", []string{"Password:"}, []bool{false})
+	if err != nil || len(answers) != 1 || answers[0] != "secret" {
+		t.Fatalf("expected saved password to answer password prompt, got %v %v", answers, err)
+	}
+}
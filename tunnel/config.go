@@ -3,11 +3,11 @@ package tunnel
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"ssh-tunnel/cfg"
 	"ssh-tunnel/safe"
 	"strconv"
@@ -17,7 +17,6 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
-	"golang.org/x/crypto/ssh"
 )
 
 var DefaultSshTunnel = Tunnel{}
@@ -53,8 +52,14 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) error {
 				}
 			})
 		}
+		if config.EnableHttpDomainFilter.GetValue() {
+			DefaultSshTunnel.startDomainSubscriptions(ctx)
+		}
 	}
 
+	DefaultSshTunnel.startProxyUsersWatcher(ctx)
+	DefaultSshTunnel.startRouteRulesWatcher(ctx)
+
 	safe.GO(func() {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
@@ -80,8 +85,19 @@ func Load(config *cfg.AppConfig, wg *sync.WaitGroup) error {
 		})
 	}
 
+	if DefaultSshTunnel.enableMixed {
+		wg.Add(1)
+		safe.GO(func() {
+			defer wg.Done()
+			DefaultSshTunnel.bindMixedTunnel(ctx)
+		})
+	}
+
+	_, profile := cfg.ActiveProfile(config)
+	DefaultSshTunnel.SyncLocalForwards(ctx, profile.LocalForwards)
+
 	// need open ssh tunnel
-	if DefaultSshTunnel.enableSocks5 || DefaultSshTunnel.enableHttpOverSSH {
+	if DefaultSshTunnel.needsSSH(profile) {
 		safe.GO(func() {
 			connCtx, cancel := context.WithCancel(ctx)
 			defer cancel()
@@ -125,20 +141,60 @@ func (t *Tunnel) RefreshRuntimeConfigFromAppConfig() error {
 
 	t.enableSocks5 = config.EnableSocks5.GetValue()
 	t.enableHttp = config.EnableHttp.GetValue()
+	t.enableMixed = config.EnableMixed.GetValue()
+	t.httpTls = httpTlsConfig{
+		enabled:  config.HttpTlsEnable.GetValue(),
+		certFile: config.HttpTlsCertFile.GetValue(),
+		keyFile:  config.HttpTlsKeyFile.GetValue(),
+		homeDir:  config.HomeDir.GetValue(),
+	}
+	t.mixedLocalAddress = config.MixedLocalAddress.GetValue()
 	t.enableHttpBasic = config.HttpBasicAuthEnable.GetValue()
 	t.enableHttpOverSSH = config.EnableHttpOverSSH.GetValue()
 	t.enableHttpDomainFilter = config.EnableHttpDomainFilter.GetValue()
+	t.configureDomainCache(config.HttpDomainCacheSize.GetValue(), time.Duration(config.HttpDomainCacheTTLSec.GetValue())*time.Second)
+	t.domainSubs.configure(parseDomainSubscriptionURLs(config.HttpDomainSubscriptions.GetValue()),
+		time.Duration(config.HttpDomainSubIntervalMin.GetValue())*time.Minute, config.HttpDomainSubViaSSH.GetValue(), config.HomeDir.GetValue())
 	t.httpLocalAddress = config.HttpLocalAddress.GetValue()
 	t.httpBasicUserName = config.HttpBasicUserName.GetValue()
 	t.httpBasicPassword = config.HttpBasicPassword.GetValue()
 	t.serverAddress = config.ServerIp.GetValue() + ":" + strconv.Itoa(config.ServerSshPort.GetValue())
 	t.localAddress = config.LocalAddress.GetValue()
+	t.setProxyUsersFile(strings.TrimSpace(config.HttpAuthUsersFile.GetValue()))
+	t.socks5Auth = socks5AuthConfig{
+		enabled:        config.Socks5AuthEnable.GetValue(),
+		allowNoAuth:    config.Socks5NoAuthEnable.GetValue(),
+		shareHttpBasic: config.Socks5AuthShareHttpBasic.GetValue(),
+		username:       config.Socks5AuthUserName.GetValue(),
+		password:       config.Socks5AuthPassword.GetValue(),
+	}
+	usersFileShared := t.socks5Auth.shareHttpBasic && t.proxyUsers.path() != ""
+	if user, _ := t.socks5Credentials(); t.socks5Auth.enabled && user == "" && !usersFileShared {
+		log.Printf("已启用SOCKS5认证但未配置用户名，所有用户名密码认证都会失败")
+	}
+	if !t.socks5Auth.enabled && !t.socks5Auth.allowNoAuth {
+		log.Printf("SOCKS5认证与无认证连接均未启用，SOCKS5代理将拒绝所有连接")
+	}
+	t.configureRouteRules(config.RouteEnable.GetValue(), RouteRulesFilePath(config.RouteRulesFile.GetValue(), config.HomeDir.GetValue()))
+	t.authLimiter.configure(config.HttpAuthMaxFailures.GetValue(), time.Duration(config.HttpAuthBlockSec.GetValue())*time.Second)
+	t.socks5Udp = socks5UdpConfig{
+		enabled:      config.Socks5UdpEnable.GetValue(),
+		relayAddress: config.Socks5UdpRelayAddress.GetValue(),
+		idleTimeout:  time.Duration(config.Socks5UdpIdleTimeoutSec.GetValue()) * time.Second,
+	}
 	t.user = config.LoginUser.GetValue()
 	keepAliveInterval := config.SSHKeepAliveIntervalSec.GetValue()
+	keepAliveCountMax := config.SSHKeepAliveCountMax.GetValue()
+	_, profile := cfg.ActiveProfile(config)
+	if profile.KeepAliveIntervalSec > 0 {
+		keepAliveInterval = profile.KeepAliveIntervalSec
+		if profile.KeepAliveCountMax > 0 {
+			keepAliveCountMax = profile.KeepAliveCountMax
+		}
+	}
 	if keepAliveInterval <= 0 {
 		keepAliveInterval = 2
 	}
-	keepAliveCountMax := config.SSHKeepAliveCountMax.GetValue()
 	if keepAliveCountMax <= 0 {
 		keepAliveCountMax = 2
 	}
@@ -148,25 +204,50 @@ func (t *Tunnel) RefreshRuntimeConfigFromAppConfig() error {
 	t.sshDestTimeout = time.Duration(config.SSHDestDialTimeoutSec.GetValue()) * time.Second
 	t.reconnectMaxRetries = config.SSHReconnectMaxRetries.GetValue()
 	t.reconnectMaxInterval = time.Duration(config.SSHReconnectMaxIntervalSec.GetValue()) * time.Second
-	t.hostKeys = ssh.InsecureIgnoreHostKey()
+	t.authChallengeTimeout = time.Duration(config.SSHAuthChallengeTimeoutSec.GetValue()) * time.Second
+	t.certExpiryWarn = time.Duration(config.SSHCertExpiryWarnMin.GetValue()) * time.Minute
+	t.channelProbe = channelProbeConfig{
+		enabled:          config.SSHProbeEnable.GetValue(),
+		target:           config.SSHProbeTarget.GetValue(),
+		interval:         time.Duration(config.SSHProbeIntervalSec.GetValue()) * time.Second,
+		timeout:          time.Duration(config.SSHProbeTimeoutSec.GetValue()) * time.Second,
+		failureThreshold: config.SSHProbeFailureThreshold.GetValue(),
+	}
+	t.setRemoteForwardConfigs(profile.RemoteForwards)
+	t.refreshHostKeyVerifier(config)
 
-	if t.enableSocks5 || t.enableHttpOverSSH {
-		b, err := ioutil.ReadFile(config.SshPrivateKeyPath.GetValue())
-		if err != nil {
-			log.Printf("Failed to read private key file: %v", err)
-			return err
-		}
-		k, err := ssh.ParsePrivateKey(b)
-		if err != nil {
-			log.Printf("Failed to parse private key: %v", err)
+	if t.needsSSH(profile) {
+		if err := t.refreshAuthChain(config); err != nil {
+			log.Printf("Failed to build ssh auth chain: %v", err)
 			return err
 		}
-		t.auth = []ssh.AuthMethod{ssh.PublicKeys(k)}
 	}
 
 	return nil
 }
 
+// needsSSH 启用SOCKS5（含混合端口）、HTTP经SSH，或profile配置了端口转发时需要建立SSH连接
+func (t *Tunnel) needsSSH(profile cfg.SSHProfile) bool {
+	return t.enableSocks5 || t.enableMixed || t.enableHttpOverSSH || len(profile.LocalForwards) > 0 || len(profile.RemoteForwards) > 0
+}
+
+func (t *Tunnel) refreshHostKeyVerifier(config *cfg.AppConfig) {
+	profileID, profile := cfg.ActiveProfile(config)
+	verifier := newHostKeyVerifier(config.HomeDir.GetValue(), profile.HostKeyPolicy, profile.HostKeyFingerprint, profile.KnownHostsFiles, profile.HostCAFiles, profileID,
+		func(fingerprint string) error {
+			_, err := cfg.SetProfileHostKeyFingerprint(profileID, fingerprint, config)
+			return err
+		})
+
+	hostKeys := t.hostKeyCallback(verifier, 0)
+
+	t.authMutex.Lock()
+	t.profileID = profileID
+	t.hostKeyVerifier = verifier
+	t.hostKeys = hostKeys
+	t.authMutex.Unlock()
+}
+
 func domainFilterFileWatcher(filePath string, tunnel *Tunnel) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -193,13 +274,18 @@ func domainFilterFileWatcher(filePath string, tunnel *Tunnel) error {
 					return
 				}
 
-				if event.Name != filePath {
+				if event.Name != filePath && !tunnel.isDomainListFile(event.Name) {
 					continue
 				}
 				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
 					log.Println("file modified", event.Name)
 					changed <- true
 				} else if event.Has(fsnotify.Remove) {
+					if event.Name != filePath {
+						// include 的文件被删除，重新加载以记录错误
+						changed <- true
+						continue
+					}
 					tunnel.SetDomains(make(map[string]bool))
 					tunnel.SetDomainMatchCache(make(map[string]bool))
 					continue
@@ -219,22 +305,12 @@ func domainFilterFileWatcher(filePath string, tunnel *Tunnel) error {
 		case result := <-changed:
 			{
 				if result == true {
-					file, err2 := os.ReadFile(filePath)
-					if err2 != nil {
-						log.Printf("Failed to read domain filter file: %v", err2)
-						continue
-					}
-					s := string(file)
-					log.Printf("domain list loaded!")
-					domains := strings.Split(strings.Trim(strings.Trim(strings.Trim(s, "\r"), " "), "\n"), "\n")
-					tmpDomains := make(map[string]bool)
-					for _, domain := range domains {
-						tmp := strings.Trim(strings.ToLower(domain), " ")
-						if tmp != "" {
-							tmpDomains[tmp] = true
+					for _, file := range tunnel.reloadDomainList(filePath) {
+						// 同时监听 include 的文件所在目录
+						if dir := path.Dir(file); dir != configPath {
+							_ = watcher.Add(dir)
 						}
 					}
-					tunnel.SetDomains(tmpDomains)
 					tunnel.SetDomainMatchCache(make(map[string]bool))
 				}
 			}
@@ -242,3 +318,78 @@ func domainFilterFileWatcher(filePath string, tunnel *Tunnel) error {
 		}
 	}
 }
+
+// watchFile 先调用一次 reload，之后在文件写入或创建时重新调用，文件被删除时调用 removed；ctx 取消后返回
+func watchFile(ctx context.Context, filePath string, reload func(), removed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	reload()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(filePath) {
+				continue
+			}
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
+				reload()
+			} else if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// 原子替换会先产生 Rename/Remove 再产生 Create，文件仍在时以其内容为准
+				if _, err := os.Stat(filePath); err == nil {
+					reload()
+					continue
+				}
+				removed()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Println(err)
+		}
+	}
+}
+
+// restartableWatch 可在运行时按新配置重启的后台文件监听
+type restartableWatch struct {
+	mu     sync.Mutex
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// bind 记录 Load 的上下文，之后启动的监听随其结束
+func (w *restartableWatch) bind(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.parent = ctx
+}
+
+// restart 停止当前监听，run 不为 nil 时在后台重新启动；bind 之前调用不启动监听
+func (w *restartableWatch) restart(run func(ctx context.Context)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	if w.parent == nil || run == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(w.parent)
+	w.cancel = cancel
+	safe.GO(func() {
+		run(ctx)
+	})
+}
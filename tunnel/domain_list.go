@@ -0,0 +1,344 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// domainEntryExcludePrefix 排除条目：命中的主机不走SSH，优先于其它条目
+	domainEntryExcludePrefix = "!"
+
+	domainListMaxIncludeDepth = 8
+)
+
+var domainLabelPattern = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?$`)
+
+// DomainListError 域名列表文件中某一行的解析错误
+type DomainListError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Message string `json:"message"`
+}
+
+func (e DomainListError) Error() string {
+	return fmt.Sprintf("%s 第%d行: %s", e.File, e.Line, e.Message)
+}
+
+// normalizeDomainEntry 校验并规范化一个域名列表条目，支持：
+// example.com（域名及子域名）、full:example.com（仅域名本身）、*.example.com（仅子域名）、
+// 10.0.0.0/8 或 1.2.3.4（IP/CIDR），以及以上任一形式前加 ! 表示排除
+func normalizeDomainEntry(entry string) (string, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	prefix := ""
+	if strings.HasPrefix(entry, domainEntryExcludePrefix) {
+		prefix, entry = domainEntryExcludePrefix, strings.TrimSpace(strings.TrimPrefix(entry, domainEntryExcludePrefix))
+	}
+	if entry == "" {
+		return "", errors.New("条目为空")
+	}
+	if strings.ContainsAny(entry, " \t") {
+		return "", errors.New("条目不能包含空白")
+	}
+
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return "", fmt.Errorf("CIDR无效: %s", entry)
+		}
+		return prefix + network.String(), nil
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		return prefix + ip.String(), nil
+	}
+
+	kind := ""
+	for _, candidate := range []string{domainEntryExactPrefix, domainEntryWildcardPrefix} {
+		if strings.HasPrefix(entry, candidate) {
+			kind, entry = candidate, strings.TrimPrefix(entry, candidate)
+			break
+		}
+	}
+	entry = strings.TrimSuffix(entry, ".")
+	if strings.Contains(entry, "*") {
+		return "", errors.New("通配符只能出现在开头，如 *.example.com")
+	}
+	if entry == "" || len(entry) > 253 {
+		return "", errors.New("域名长度无效")
+	}
+	for _, label := range strings.Split(entry, ".") {
+		if !domainLabelPattern.MatchString(label) {
+			return "", fmt.Errorf("域名无效: %s", entry)
+		}
+	}
+	return prefix + kind + entry, nil
+}
+
+// domainListLoader 解析域名列表文件及其 include 的文件
+type domainListLoader struct {
+	entries  map[string]bool
+	errors   []DomainListError
+	files    []string
+	visiting map[string]bool
+}
+
+// loadDomainList 读取域名列表文件，返回条目、涉及的全部文件（供监听）与逐行的解析错误。
+// 格式：每行一个条目；# 之后为注释；include <路径> 引入其它文件（相对路径相对于当前文件所在目录）
+func loadDomainList(filePath string) (map[string]bool, []string, []DomainListError, error) {
+	loader := &domainListLoader{entries: make(map[string]bool), visiting: make(map[string]bool)}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	loader.parse(filePath, data, 0)
+	return loader.entries, loader.files, loader.errors, nil
+}
+
+func (l *domainListLoader) parse(filePath string, data []byte, depth int) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filepath.Clean(filePath)
+	}
+	l.visiting[absPath] = true
+	defer delete(l.visiting, absPath)
+	l.files = append(l.files, absPath)
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		line, _, _ := strings.Cut(raw, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fail := func(format string, args ...interface{}) {
+			l.errors = append(l.errors, DomainListError{File: filePath, Line: i + 1, Content: strings.TrimSpace(raw), Message: fmt.Sprintf(format, args...)})
+		}
+
+		fields := strings.Fields(line)
+		if strings.EqualFold(fields[0], "include") {
+			if len(fields) != 2 {
+				fail("include 格式应为 include <文件路径>")
+				continue
+			}
+			l.include(filePath, fields[1], depth, fail)
+			continue
+		}
+		entry, err := normalizeDomainEntry(line)
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+		l.entries[entry] = true
+	}
+}
+
+func (l *domainListLoader) include(parent, target string, depth int, fail func(string, ...interface{})) {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(parent), target)
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		absTarget = filepath.Clean(target)
+	}
+	if l.visiting[absTarget] {
+		fail("循环 include: %s", target)
+		return
+	}
+	if depth+1 > domainListMaxIncludeDepth {
+		fail("include 嵌套超过%d层", domainListMaxIncludeDepth)
+		return
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		// 文件暂不存在时仍然监听，创建后自动加载
+		l.files = append(l.files, absTarget)
+		fail("读取 include 文件失败: %v", err)
+		return
+	}
+	l.parse(target, data, depth+1)
+}
+
+// domainMatcher 域名过滤匹配器：排除条目优先，IP目标按 CIDR 匹配，域名按后缀树匹配
+type domainMatcher struct {
+	include     *domainTrie
+	exclude     *domainTrie
+	includeNets []*net.IPNet
+	excludeNets []*net.IPNet
+}
+
+// newDomainMatcher 由域名列表条目构建匹配器，无效条目被忽略
+func newDomainMatcher(entries map[string]bool) *domainMatcher {
+	matcher := &domainMatcher{include: &domainTrie{}, exclude: &domainTrie{}}
+	for raw, enabled := range entries {
+		if !enabled {
+			continue
+		}
+		entry, err := normalizeDomainEntry(raw)
+		if err != nil {
+			continue
+		}
+		trie, nets := matcher.include, &matcher.includeNets
+		if strings.HasPrefix(entry, domainEntryExcludePrefix) {
+			entry = strings.TrimPrefix(entry, domainEntryExcludePrefix)
+			trie, nets = matcher.exclude, &matcher.excludeNets
+		}
+		if network := parseDomainEntryNetwork(entry); network != nil {
+			*nets = append(*nets, network)
+			continue
+		}
+		trie.insert(entry)
+	}
+	return matcher
+}
+
+func parseDomainEntryNetwork(entry string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+func (m *domainMatcher) match(host string) bool {
+	if m == nil || host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return !containsIP(m.excludeNets, ip) && containsIP(m.includeNets, ip)
+	}
+	return !m.exclude.match(host) && m.include.match(host)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadDomainList 重新加载域名列表文件，返回需要监听的文件；加载失败时保留当前条目
+func (t *Tunnel) reloadDomainList(filePath string) []string {
+	entries, files, listErrors, err := loadDomainList(filePath)
+	if err != nil {
+		log.Printf("Failed to read domain filter file: %v", err)
+		return nil
+	}
+	for _, listErr := range listErrors {
+		log.Printf("域名列表解析错误，已跳过: %v", listErr)
+	}
+	t.SetDomains(entries)
+	t.domainMutex.Lock()
+	t.domainListErrors = listErrors
+	t.domainListFiles = files
+	t.domainMutex.Unlock()
+	log.Printf("domain list loaded! entries: %d, errors: %d", len(entries), len(listErrors))
+	return files
+}
+
+// isDomainListFile 判断文件是否属于当前域名列表（主文件或 include 的文件）
+func (t *Tunnel) isDomainListFile(name string) bool {
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		absName = filepath.Clean(name)
+	}
+	t.domainMutex.RLock()
+	defer t.domainMutex.RUnlock()
+	for _, file := range t.domainListFiles {
+		if file == absName {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainListErrors 返回最近一次加载域名列表文件时的解析错误
+func (t *Tunnel) DomainListErrors() []DomainListError {
+	t.domainMutex.RLock()
+	defer t.domainMutex.RUnlock()
+	return append([]DomainListError(nil), t.domainListErrors...)
+}
+
+// FlushDomainList 把运行时添加与删除的条目写回域名列表主文件：删除的条目从主文件中去掉对应行，
+// 新增的条目追加到末尾，注释、include 与其余行保持不变。删除的条目来自 include 的文件时返回错误，不修改文件
+func (t *Tunnel) FlushDomainList(filePath string) error {
+	current := t.Domains()
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]bool)
+	if data != nil {
+		if loaded, _, _, err = loadDomainList(filePath); err != nil {
+			return err
+		}
+	}
+
+	removed := make(map[string]bool)
+	for entry := range loaded {
+		if !current[entry] {
+			removed[entry] = true
+		}
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	kept := make([]string, 0, len(lines))
+	found := make(map[string]bool)
+	for _, raw := range lines {
+		line, _, _ := strings.Cut(raw, "#")
+		if entry, err := normalizeDomainEntry(line); err == nil && removed[entry] {
+			found[entry] = true
+			continue
+		}
+		kept = append(kept, raw)
+	}
+	var fromIncludes []string
+	for entry := range removed {
+		if !found[entry] {
+			fromIncludes = append(fromIncludes, entry)
+		}
+	}
+	if len(fromIncludes) > 0 {
+		sort.Strings(fromIncludes)
+		return fmt.Errorf("以下条目来自 include 的文件，无法写回，请直接编辑对应文件: %s", strings.Join(fromIncludes, ", "))
+	}
+
+	var added []string
+	for entry, enabled := range current {
+		if enabled && !loaded[entry] {
+			added = append(added, entry)
+		}
+	}
+	sort.Strings(added)
+	kept = append(kept, added...)
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return os.WriteFile(filePath, []byte(content), 0666)
+}
+
+// ValidateDomainEntry 校验并规范化管理界面添加的域名条目
+func ValidateDomainEntry(entry string) (string, error) {
+	return normalizeDomainEntry(entry)
+}
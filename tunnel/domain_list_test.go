@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDomainListParsesRichFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filePath
+	}
+	writeFile("extra.txt", "extra.org\ninclude domains.txt\n")
+	main := writeFile("domains.txt", `# 注释
+Example.com   # 行尾注释
+full:api.example.org
+*.cdn.example.net
+!www.example.com
+10.0.0.0/8
+!10.1.2.3
+include extra.txt
+include missing.txt
+bad domain.com
+foo.*.com
+-bad-.com
+10.0.0.0/33
+`)
+
+	entries, files, listErrors, err := loadDomainList(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"example.com":          true,
+		"full:api.example.org": true,
+		"*.cdn.example.net":    true,
+		"!www.example.com":     true,
+		"10.0.0.0/8":           true,
+		"!10.1.2.3":            true,
+		"extra.org":            true,
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected main, included and missing include files to be watched, got %v", files)
+	}
+
+	lines := map[int]bool{}
+	for _, listErr := range listErrors {
+		if filepath.Base(listErr.File) == "extra.txt" {
+			if listErr.Line != 2 {
+				t.Fatalf("expected include cycle on extra.txt line 2, got %+v", listErr)
+			}
+			continue
+		}
+		lines[listErr.Line] = true
+	}
+	for _, line := range []int{9, 10, 11, 12, 13} {
+		if !lines[line] {
+			t.Fatalf("expected error on line %d, got %+v", line, listErrors)
+		}
+	}
+	if len(listErrors) != 6 {
+		t.Fatalf("expected 6 errors, got %+v", listErrors)
+	}
+}
+
+func TestDomainMatcherExclusionsAndNetworks(t *testing.T) {
+	tunnel := newTestTunnel()
+	tunnel.SetDomains(map[string]bool{
+		"example.com":      true,
+		"!www.example.com": true,
+		"*.cdn.test":       true,
+		"!full:a.cdn.test": true,
+		"10.0.0.0/8":       true,
+		"!10.1.0.0/16":     true,
+		"2001:db8::/32":    true,
+		"192.168.1.1":      true,
+	})
+
+	for host, expected := range map[string]bool{
+		"example.com:443":     true,
+		"api.example.com":     true,
+		"www.example.com:443": false,
+		"x.www.example.com":   false,
+		"b.cdn.test":          true,
+		"a.cdn.test":          false,
+		"x.a.cdn.test":        true,
+		"10.2.3.4:22":         true,
+		"10.1.3.4:22":         false,
+		"[2001:db8::1]:443":   true,
+		"2001:db8::2":         true,
+		"192.168.1.1:80":      true,
+		"192.168.1.2:80":      false,
+	} {
+		if matched := tunnel.shouldUseSSHForHost(host); matched != expected {
+			t.Errorf("%q: expected %v, got %v", host, expected, matched)
+		}
+	}
+}
+
+func TestNormalizeDomainEntry(t *testing.T) {
+	for entry, expected := range map[string]string{
+		" Example.COM. ":     "example.com",
+		"! *.Foo.net":        "!*.foo.net",
+		"full:a_b.test":      "full:a_b.test",
+		"10.1.2.3/8":         "10.0.0.0/8",
+		"2001:DB8::1":        "2001:db8::1",
+		"xn--fiqs8s.example": "xn--fiqs8s.example",
+	} {
+		normalized, err := normalizeDomainEntry(entry)
+		if err != nil || normalized != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", entry, expected, normalized, err)
+		}
+	}
+	for _, entry := range []string{"", "!", "*.", "a..b", "*example.com", "exa mple.com", "http://example.com", "-a.com"} {
+		if normalized, err := normalizeDomainEntry(entry); err == nil {
+			t.Errorf("%q: expected error, got %q", entry, normalized)
+		}
+	}
+}
+
+func TestFlushDomainListKeepsFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "domains.txt")
+	if err := os.WriteFile(filepath.Join(dir, "extra.txt"), []byte("extra.org\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(main, []byte("# 注释\nExample.com   # 公司\n*.cdn.test\ninclude extra.txt\nbad domain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel := newTestTunnel()
+	tunnel.reloadDomainList(main)
+	domains := tunnel.Domains()
+	delete(domains, "*.cdn.test")
+	domains["new.example.net"] = true
+	domains["!www.example.com"] = true
+	tunnel.SetDomains(domains)
+	if err := tunnel.FlushDomainList(main); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# 注释\nExample.com   # 公司\ninclude extra.txt\nbad domain\n!www.example.com\nnew.example.net\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected file content:\n%s", data)
+	}
+
+	// 删除来自 include 文件的条目无法写回主文件
+	domains = tunnel.Domains()
+	delete(domains, "extra.org")
+	tunnel.SetDomains(domains)
+	if err := tunnel.FlushDomainList(main); err == nil {
+		t.Fatal("expected removing an included entry to fail")
+	}
+	if after, _ := os.ReadFile(main); string(after) != expected {
+		t.Fatalf("expected file to be left unchanged, got:\n%s", after)
+	}
+}
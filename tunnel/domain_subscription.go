@@ -0,0 +1,573 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ssh-tunnel/safe"
+)
+
+const (
+	domainSubscriptionDirName   = "subscriptions"
+	domainSubscriptionUserAgent = "ssh-tunnel-domain-subscription"
+	defaultDomainSubInterval    = 6 * time.Hour
+	domainSubRetryInterval      = 5 * time.Minute
+	domainSubFetchTimeout       = 60 * time.Second
+	domainSubMaxBodySize        = 32 << 20
+
+	domainSubFormatPlain   = "plain"
+	domainSubFormatGfwlist = "gfwlist"
+	domainSubFormatAdblock = "adblock"
+)
+
+// 域名列表订阅的下载状态
+const (
+	DomainSubStatusPending     = "pending"
+	DomainSubStatusOK          = "ok"
+	DomainSubStatusNotModified = "not-modified"
+	DomainSubStatusError       = "error"
+)
+
+// DomainSubscriptionStatus 域名列表订阅的最近一次下载状态
+type DomainSubscriptionStatus struct {
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Format     string    `json:"format,omitempty"`
+	Entries    int       `json:"entries"`
+	Skipped    int       `json:"skipped"`
+	ViaSSH     bool      `json:"viaSSH"`
+	LastFetch  time.Time `json:"lastFetch"`
+	LastUpdate time.Time `json:"lastUpdate"`
+}
+
+// domainSubscriptionCache 订阅在磁盘上的缓存，启动时先用缓存生效，并用于条件请求
+type domainSubscriptionCache struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Format       string    `json:"format"`
+	Skipped      int       `json:"skipped"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Entries      []string  `json:"entries"`
+}
+
+type domainSubscription struct {
+	cacheFile string
+	cache     domainSubscriptionCache
+	status    DomainSubscriptionStatus
+}
+
+// domainSubscriptionSet 保存订阅配置与各订阅的下载结果
+type domainSubscriptionSet struct {
+	mu       sync.Mutex
+	urls     []string
+	interval time.Duration
+	viaSSH   bool
+	cacheDir string
+	subs     map[string]*domainSubscription
+	trigger  chan struct{}
+}
+
+// parseDomainSubscriptionURLs 解析逗号或换行分隔的订阅地址，忽略空项与重复项
+func parseDomainSubscriptionURLs(value string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		urls = append(urls, item)
+	}
+	return urls
+}
+
+// domainSubscriptionDisplayURL 隐藏订阅地址中的密码，用于日志与管理界面
+func domainSubscriptionDisplayURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Redacted()
+}
+
+func (s *domainSubscriptionSet) configure(urls []string, interval time.Duration, viaSSH bool, cacheDir string) {
+	if interval <= 0 {
+		interval = defaultDomainSubInterval
+	}
+	s.mu.Lock()
+	changed := strings.Join(s.urls, "\n") != strings.Join(urls, "\n") || s.viaSSH != viaSSH || s.cacheDir != cacheDir
+	s.urls = append([]string(nil), urls...)
+	s.interval = interval
+	s.viaSSH = viaSSH
+	s.cacheDir = cacheDir
+	if s.subs == nil {
+		s.subs = make(map[string]*domainSubscription)
+	}
+	for rawURL := range s.subs {
+		if !containsString(urls, rawURL) {
+			delete(s.subs, rawURL)
+		}
+	}
+	for _, rawURL := range urls {
+		if s.subs[rawURL] == nil {
+			s.subs[rawURL] = &domainSubscription{
+				cacheFile: domainSubscriptionCacheFile(cacheDir, rawURL),
+				status:    DomainSubscriptionStatus{URL: domainSubscriptionDisplayURL(rawURL), Status: DomainSubStatusPending},
+			}
+		}
+	}
+	s.mu.Unlock()
+	if changed {
+		s.requestRefresh()
+	}
+}
+
+func domainSubscriptionCacheFile(cacheDir, rawURL string) string {
+	if cacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(cacheDir, domainSubscriptionDirName, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (s *domainSubscriptionSet) triggerChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trigger == nil {
+		s.trigger = make(chan struct{}, 1)
+	}
+	return s.trigger
+}
+
+// requestRefresh 通知后台立即刷新全部订阅
+func (s *domainSubscriptionSet) requestRefresh() {
+	select {
+	case s.triggerChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (s *domainSubscriptionSet) settings() ([]string, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.urls...), s.interval, s.viaSSH
+}
+
+func (s *domainSubscriptionSet) get(rawURL string) (domainSubscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[rawURL]
+	if !ok {
+		return domainSubscription{}, false
+	}
+	return *sub, true
+}
+
+func (s *domainSubscriptionSet) update(rawURL string, apply func(sub *domainSubscription)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subs[rawURL]; ok {
+		apply(sub)
+	}
+}
+
+// entries 合并全部订阅的条目
+func (s *domainSubscriptionSet) entries() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	merged := make(map[string]bool)
+	for _, rawURL := range s.urls {
+		if sub := s.subs[rawURL]; sub != nil {
+			for _, entry := range sub.cache.Entries {
+				merged[entry] = true
+			}
+		}
+	}
+	return merged
+}
+
+func (s *domainSubscriptionSet) statuses() []DomainSubscriptionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]DomainSubscriptionStatus, 0, len(s.urls))
+	for _, rawURL := range s.urls {
+		if sub := s.subs[rawURL]; sub != nil {
+			result = append(result, sub.status)
+		}
+	}
+	return result
+}
+
+// parseDomainSubscription 解析订阅内容，自动识别 gfwlist（base64）、AdBlock（||domain^）与普通域名列表格式，
+// 返回条目、识别出的格式与跳过的不支持行数
+func parseDomainSubscription(data []byte) (map[string]bool, string, int) {
+	format := domainSubFormatPlain
+	if decoded, ok := decodeGfwlist(data); ok {
+		data, format = decoded, domainSubFormatGfwlist
+	} else if looksLikeAdblock(data) {
+		format = domainSubFormatAdblock
+	}
+
+	entries := make(map[string]bool)
+	skipped := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		var entry string
+		var err error
+		if format == domainSubFormatPlain {
+			line, _, _ = strings.Cut(line, "#")
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			entry, err = normalizeDomainEntry(line)
+		} else {
+			entry, err = parseAdblockRule(line)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		if entry != "" {
+			entries[entry] = true
+		}
+	}
+	return entries, format, skipped
+}
+
+// decodeGfwlist gfwlist 整体是一段 base64 编码的 AutoProxy 规则
+func decodeGfwlist(data []byte) ([]byte, bool) {
+	compact := strings.Join(strings.Fields(string(data)), "")
+	if compact == "" {
+		return nil, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(compact)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(compact, "=")); err != nil {
+			return nil, false
+		}
+	}
+	if !utf8.Valid(decoded) || !bytes.ContainsAny(decoded, "\n.") {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func looksLikeAdblock(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "[Adblock") || strings.HasPrefix(line, "[AutoProxy") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAdblockRule 把一行 AdBlock/AutoProxy 规则转换为域名列表条目：
+// ||example.com^ 与 .example.com 匹配域名及子域名，|http://host/ 与 host/path 取主机名，@@ 开头为排除；
+// 空行、! 注释与 [..] 头部返回空条目，正则等无法转换为域名的规则返回错误
+func parseAdblockRule(line string) (string, error) {
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return "", nil
+	}
+	prefix := ""
+	if strings.HasPrefix(line, "@@") {
+		prefix, line = domainEntryExcludePrefix, strings.TrimPrefix(line, "@@")
+	}
+	if strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") && len(line) > 1 {
+		return "", errors.New("不支持正则规则")
+	}
+	line, _, _ = strings.Cut(line, "$")
+
+	var host string
+	switch {
+	case strings.HasPrefix(line, "||"):
+		host = strings.TrimPrefix(line, "||")
+		if end := strings.IndexAny(host, "^/|:"); end >= 0 {
+			host = host[:end]
+		}
+	case strings.HasPrefix(line, "|"):
+		parsed, err := url.Parse(strings.Trim(line, "|"))
+		if err != nil || parsed.Hostname() == "" {
+			return "", fmt.Errorf("无法解析地址: %s", line)
+		}
+		host = parsed.Hostname()
+	default:
+		host = strings.TrimPrefix(line, "http://")
+		host = strings.TrimPrefix(host, "https://")
+		host = strings.TrimPrefix(host, ".")
+		if end := strings.IndexAny(host, "/^|"); end >= 0 {
+			host = host[:end]
+		}
+		if splitHost, _, err := net.SplitHostPort(host); err == nil {
+			host = splitHost
+		}
+	}
+	host = strings.TrimPrefix(host, "*.")
+	if host == "" || strings.Contains(host, "*") {
+		return "", fmt.Errorf("无法转换为域名: %s", line)
+	}
+	entry, err := normalizeDomainEntry(host)
+	if err != nil {
+		return "", err
+	}
+	return prefix + entry, nil
+}
+
+func loadDomainSubscriptionCache(cacheFile string) (domainSubscriptionCache, error) {
+	var cache domainSubscriptionCache
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return cache, err
+	}
+	err = json.Unmarshal(data, &cache)
+	return cache, err
+}
+
+// writeDomainSubscriptionCache 先写临时文件再重命名，避免读到写了一半的缓存
+func writeDomainSubscriptionCache(cacheFile string, cache domainSubscriptionCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(cacheFile)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".subscription-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFile)
+}
+
+// domainSubscriptionClient 下载订阅用的 HTTP 客户端，viaSSH 时经SSH隧道连接订阅服务器
+func (t *Tunnel) domainSubscriptionClient(viaSSH bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if viaSSH {
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			dest, err := t.dialRoute(address, RouteActionSSH)
+			return dest.conn, err
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: domainSubFetchTimeout}
+}
+
+// fetchDomainSubscription 下载一个订阅：带上 ETag/If-Modified-Since 做条件请求，内容未变化时沿用缓存
+func (t *Tunnel) fetchDomainSubscription(ctx context.Context, client *http.Client, rawURL string, viaSSH bool) error {
+	sub, ok := t.domainSubs.get(rawURL)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	cache, status, err := fetchDomainSubscriptionContent(ctx, client, rawURL, sub.cache)
+	if err == nil && status == DomainSubStatusOK && sub.cacheFile != "" {
+		if writeErr := writeDomainSubscriptionCache(sub.cacheFile, cache); writeErr != nil {
+			log.Printf("写入域名订阅缓存失败: %v", writeErr)
+		}
+	}
+
+	t.domainSubs.update(rawURL, func(current *domainSubscription) {
+		current.status.LastFetch = now
+		current.status.ViaSSH = viaSSH
+		if err != nil {
+			current.status.Status, current.status.Error = DomainSubStatusError, err.Error()
+			return
+		}
+		current.cache = cache
+		current.status.Status, current.status.Error = status, ""
+		current.status.Format = cache.Format
+		current.status.Entries = len(cache.Entries)
+		current.status.Skipped = cache.Skipped
+		current.status.LastUpdate = cache.UpdatedAt
+	})
+	return err
+}
+
+func fetchDomainSubscriptionContent(ctx context.Context, client *http.Client, rawURL string, cache domainSubscriptionCache) (domainSubscriptionCache, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return cache, "", err
+	}
+	req.Header.Set("User-Agent", domainSubscriptionUserAgent)
+	if cache.URL == rawURL {
+		if cache.ETag != "" {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return cache, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cache.URL == rawURL {
+		return cache, DomainSubStatusNotModified, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cache, "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, domainSubMaxBodySize+1))
+	if err != nil {
+		return cache, "", err
+	}
+	if len(body) > domainSubMaxBodySize {
+		return cache, "", fmt.Errorf("订阅内容超过%dMB", domainSubMaxBodySize>>20)
+	}
+
+	entries, format, skipped := parseDomainSubscription(body)
+	if len(entries) == 0 {
+		return cache, "", fmt.Errorf("订阅内容中没有可用的条目（格式: %s，跳过%d行）", format, skipped)
+	}
+	list := make([]string, 0, len(entries))
+	for entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Strings(list)
+	return domainSubscriptionCache{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Format:       format,
+		Skipped:      skipped,
+		UpdatedAt:    time.Now(),
+		Entries:      list,
+	}, DomainSubStatusOK, nil
+}
+
+// loadDomainSubscriptionCaches 启动时先加载磁盘缓存，订阅服务器不可达时也能使用上次的结果
+func (t *Tunnel) loadDomainSubscriptionCaches() {
+	urls, _, _ := t.domainSubs.settings()
+	for _, rawURL := range urls {
+		sub, ok := t.domainSubs.get(rawURL)
+		if !ok || sub.cacheFile == "" {
+			continue
+		}
+		cache, err := loadDomainSubscriptionCache(sub.cacheFile)
+		if err != nil || cache.URL != rawURL {
+			continue
+		}
+		t.domainSubs.update(rawURL, func(current *domainSubscription) {
+			current.cache = cache
+			current.status.Format = cache.Format
+			current.status.Entries = len(cache.Entries)
+			current.status.Skipped = cache.Skipped
+			current.status.LastUpdate = cache.UpdatedAt
+		})
+	}
+	t.setSubscriptionDomains(t.domainSubs.entries())
+}
+
+// refreshDomainSubscriptions 下载全部订阅并合并到域名过滤条目，返回距下次刷新的时间
+func (t *Tunnel) refreshDomainSubscriptions(ctx context.Context) time.Duration {
+	urls, interval, viaSSH := t.domainSubs.settings()
+	if len(urls) == 0 {
+		t.setSubscriptionDomains(nil)
+		return interval
+	}
+	client := t.domainSubscriptionClient(viaSSH)
+	failed := false
+	for _, rawURL := range urls {
+		if ctx.Err() != nil {
+			return interval
+		}
+		if err := t.fetchDomainSubscription(ctx, client, rawURL, viaSSH); err != nil {
+			failed = true
+			log.Printf("域名列表订阅下载失败 %s: %v", domainSubscriptionDisplayURL(rawURL), err)
+		}
+	}
+	entries := t.domainSubs.entries()
+	t.setSubscriptionDomains(entries)
+	log.Printf("domain subscriptions refreshed! subscriptions: %d, entries: %d", len(urls), len(entries))
+	if failed && interval > domainSubRetryInterval {
+		return domainSubRetryInterval
+	}
+	return interval
+}
+
+// startDomainSubscriptions 启动后台订阅刷新：先应用磁盘缓存，之后按间隔或收到刷新请求时重新下载
+func (t *Tunnel) startDomainSubscriptions(ctx context.Context) {
+	trigger := t.domainSubs.triggerChan()
+	safe.GO(func() {
+		t.loadDomainSubscriptionCaches()
+		// 启动前 configure 发出的刷新请求由第一次刷新处理
+		select {
+		case <-trigger:
+		default:
+		}
+		for {
+			timer := time.NewTimer(t.refreshDomainSubscriptions(ctx))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-trigger:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	})
+}
+
+// setSubscriptionDomains 替换订阅条目，与本地域名过滤条目合并后重建匹配器
+func (t *Tunnel) setSubscriptionDomains(entries map[string]bool) {
+	t.domainMutex.Lock()
+	t.subscriptionDomains = entries
+	t.domainMatcher = newDomainMatcher(mergeDomainEntries(t.domains, entries))
+	t.domainMutex.Unlock()
+	t.domainMatchCacheStore().reset()
+}
+
+func mergeDomainEntries(local, subscribed map[string]bool) map[string]bool {
+	merged := make(map[string]bool, len(local)+len(subscribed))
+	for entry, enabled := range subscribed {
+		merged[entry] = enabled
+	}
+	for entry, enabled := range local {
+		merged[entry] = enabled
+	}
+	return merged
+}
+
+// DomainSubscriptions 返回各订阅的最近一次下载状态
+func (t *Tunnel) DomainSubscriptions() []DomainSubscriptionStatus {
+	return t.domainSubs.statuses()
+}
+
+// RefreshDomainSubscriptions 请求立即刷新全部订阅
+func (t *Tunnel) RefreshDomainSubscriptions() {
+	t.domainSubs.requestRefresh()
+}
@@ -0,0 +1,128 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseDomainSubscriptionFormats(t *testing.T) {
+	gfwlist := base64.StdEncoding.EncodeToString([]byte(`[AutoProxy 0.2.9]
+! 注释
+||google.com
+.twitter.com
+|http://85.17.73.31/
+@@||cn.example.com
+example.org/path
+/^https?:\/\/[^\/]+blogspot\.(.*)/
+`))
+	for name, tc := range map[string]struct {
+		content  string
+		format   string
+		expected []string
+		skipped  int
+	}{
+		"gfwlist": {
+			content:  gfwlist[:20] + "\n" + gfwlist[20:],
+			format:   domainSubFormatGfwlist,
+			expected: []string{"google.com", "twitter.com", "85.17.73.31", "!cn.example.com", "example.org"},
+			skipped:  1,
+		},
+		"adblock": {
+			content:  "[Adblock Plus 2.0]\n! Title\n||ads.example.com^\n||tracker.net^$third-party\n@@||good.example.com^\n||bad*.com^\n",
+			format:   domainSubFormatAdblock,
+			expected: []string{"ads.example.com", "tracker.net", "!good.example.com"},
+			skipped:  1,
+		},
+		"plain": {
+			content:  "# list\nexample.com\nfull:a.test\n!b.example.com\n10.0.0.0/8\nbad domain\n",
+			format:   domainSubFormatPlain,
+			expected: []string{"example.com", "full:a.test", "!b.example.com", "10.0.0.0/8"},
+			skipped:  1,
+		},
+	} {
+		entries, format, skipped := parseDomainSubscription([]byte(tc.content))
+		expected := make(map[string]bool)
+		for _, entry := range tc.expected {
+			expected[entry] = true
+		}
+		if format != tc.format || skipped != tc.skipped || !reflect.DeepEqual(entries, expected) {
+			t.Errorf("%s: got format=%s skipped=%d entries=%v", name, format, skipped, entries)
+		}
+	}
+}
+
+func TestDomainSubscriptionRefreshUsesETagAndCache(t *testing.T) {
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("||remote.example.com^\n@@||local.test^\n"))
+	}))
+	defer server.Close()
+
+	homeDir := t.TempDir()
+	tunnel := newTestTunnel()
+	tunnel.SetDomains(map[string]bool{"local.test": true})
+	tunnel.domainSubs.configure([]string{server.URL + "/list.txt", "http://127.0.0.1:1/unreachable"}, time.Hour, false, homeDir)
+
+	if next := tunnel.refreshDomainSubscriptions(context.Background()); next != domainSubRetryInterval {
+		t.Fatalf("expected retry interval after a failed subscription, got %v", next)
+	}
+	statuses := tunnel.DomainSubscriptions()
+	if len(statuses) != 2 || statuses[0].Status != DomainSubStatusOK || statuses[0].Entries != 2 || statuses[0].Format != domainSubFormatAdblock {
+		t.Fatalf("unexpected statuses %+v", statuses)
+	}
+	if statuses[1].Status != DomainSubStatusError || statuses[1].Error == "" {
+		t.Fatalf("expected unreachable subscription to report an error, got %+v", statuses[1])
+	}
+	// 订阅条目与本地条目合并，订阅中的排除条目同样生效
+	if !tunnel.shouldUseSSHForHost("www.remote.example.com:443") || tunnel.shouldUseSSHForHost("local.test") {
+		t.Fatal("expected subscription entries to be merged with local entries")
+	}
+	if domains := tunnel.Domains(); len(domains) != 1 {
+		t.Fatalf("expected Domains to only return local entries, got %v", domains)
+	}
+
+	tunnel.refreshDomainSubscriptions(context.Background())
+	if atomic.LoadInt32(&notModified) != 1 || tunnel.DomainSubscriptions()[0].Status != DomainSubStatusNotModified {
+		t.Fatalf("expected conditional request to return 304, got %+v", tunnel.DomainSubscriptions()[0])
+	}
+
+	// 新实例先加载磁盘缓存，并用缓存的 ETag 发起条件请求
+	restarted := newTestTunnel()
+	restarted.domainSubs.configure([]string{server.URL + "/list.txt"}, time.Hour, false, homeDir)
+	restarted.loadDomainSubscriptionCaches()
+	if !restarted.shouldUseSSHForHost("remote.example.com") {
+		t.Fatal("expected cached subscription entries to be applied on startup")
+	}
+	restarted.refreshDomainSubscriptions(context.Background())
+	if atomic.LoadInt32(&notModified) != 2 || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("expected cached ETag to be reused, requests=%d notModified=%d", requests, notModified)
+	}
+}
+
+func TestDomainSubscriptionViaSSH(t *testing.T) {
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("example.com\n"))
+	}))
+	defer server.Close()
+
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.domainSubs.configure([]string{server.URL}, time.Hour, true, "")
+	tunnel.refreshDomainSubscriptions(context.Background())
+	if status := tunnel.DomainSubscriptions()[0]; status.Status != DomainSubStatusOK || !status.ViaSSH || status.Entries != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
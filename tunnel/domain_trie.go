@@ -0,0 +1,245 @@
+package tunnel
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// domainEntryExactPrefix 只匹配域名本身，不匹配子域名
+	domainEntryExactPrefix = "full:"
+	// domainEntryWildcardPrefix 只匹配子域名，不匹配域名本身
+	domainEntryWildcardPrefix = "*."
+
+	defaultDomainCacheSize = 4096
+	defaultDomainCacheTTL  = 10 * time.Minute
+)
+
+// domainTrieNode 按标签倒序（com -> example -> www）组织的后缀树节点
+type domainTrieNode struct {
+	children map[string]*domainTrieNode
+	// exact 匹配到此节点为止的域名本身
+	exact bool
+	// subdomains 匹配此节点下的任意子域名
+	subdomains bool
+}
+
+// domainTrie 域名后缀树，按标签边界匹配：example.com 匹配 www.example.com，不匹配 notexample.com。
+// 查找耗时只与主机名的标签数有关，与条目数量无关
+type domainTrie struct {
+	root domainTrieNode
+	size int
+}
+
+// newDomainTrie 由域名条目构建后缀树：普通条目匹配域名本身及其子域名，full: 前缀只匹配域名本身，*. 前缀只匹配子域名
+func newDomainTrie(entries map[string]bool) *domainTrie {
+	trie := &domainTrie{}
+	for entry, enabled := range entries {
+		if enabled {
+			trie.insert(entry)
+		}
+	}
+	return trie
+}
+
+func (d *domainTrie) insert(entry string) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	exact, subdomains := true, true
+	switch {
+	case strings.HasPrefix(entry, domainEntryExactPrefix):
+		entry, subdomains = strings.TrimPrefix(entry, domainEntryExactPrefix), false
+	case strings.HasPrefix(entry, domainEntryWildcardPrefix):
+		entry, exact = strings.TrimPrefix(entry, domainEntryWildcardPrefix), false
+	}
+	entry = strings.Trim(entry, ".")
+	if entry == "" {
+		return
+	}
+
+	node := &d.root
+	labels := strings.Split(entry, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child := node.children[labels[i]]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*domainTrieNode)
+			}
+			child = &domainTrieNode{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	if !node.exact && !node.subdomains {
+		d.size++
+	}
+	node.exact = node.exact || exact
+	node.subdomains = node.subdomains || subdomains
+}
+
+// match 判断规范化后的主机名（小写、无端口、无首尾点）是否命中任一条目
+func (d *domainTrie) match(host string) bool {
+	if d == nil || host == "" {
+		return false
+	}
+	node := &d.root
+	rest := host
+	for rest != "" {
+		label := rest
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			rest = ""
+		}
+		node = node.children[label]
+		if node == nil {
+			return false
+		}
+		if rest == "" {
+			return node.exact
+		}
+		if node.subdomains {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomainHost 去掉端口与首尾的点并转为小写，作为匹配与缓存的键；IP 地址转为标准形式
+func normalizeDomainHost(host string) string {
+	if splitHost, _, err := net.SplitHostPort(host); err == nil {
+		host = splitHost
+	} else if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		host = ip.String()
+	} else {
+		host = strings.Split(host, ":")[0]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(strings.Trim(host, "."))
+}
+
+// DomainCacheStats 域名匹配缓存统计
+type DomainCacheStats struct {
+	Size       int     `json:"size"`
+	Capacity   int     `json:"capacity"`
+	TTLSeconds int     `json:"ttlSeconds"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	Evictions  uint64  `json:"evictions"`
+	HitRate    float64 `json:"hitRate"`
+}
+
+type domainCacheEntry struct {
+	host    string
+	matched bool
+	expires time.Time
+}
+
+// domainMatchCache 有容量上限与过期时间的 LRU 缓存，记录主机名是否命中域名过滤
+type domainMatchCache struct {
+	mu        sync.Mutex
+	capacity  int
+	ttl       time.Duration
+	order     *list.List
+	items     map[string]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func newDomainMatchCache(capacity int, ttl time.Duration) *domainMatchCache {
+	if capacity <= 0 {
+		capacity = defaultDomainCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultDomainCacheTTL
+	}
+	return &domainMatchCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *domainMatchCache) get(host string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[host]
+	if !ok {
+		c.misses++
+		return false, false
+	}
+	entry := element.Value.(*domainCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.items, host)
+		c.misses++
+		return false, false
+	}
+	c.order.MoveToFront(element)
+	c.hits++
+	return entry.matched, true
+}
+
+func (c *domainMatchCache) put(host string, matched bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if element, ok := c.items[host]; ok {
+		entry := element.Value.(*domainCacheEntry)
+		entry.matched, entry.expires = matched, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[host] = c.order.PushFront(&domainCacheEntry{host: host, matched: matched, expires: expires})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*domainCacheEntry).host)
+		c.evictions++
+	}
+}
+
+// reset 清空缓存条目，保留统计数据
+func (c *domainMatchCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// snapshot 返回未过期的缓存条目
+func (c *domainMatchCache) snapshot() map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	result := make(map[string]bool, len(c.items))
+	for host, element := range c.items {
+		if entry := element.Value.(*domainCacheEntry); now.Before(entry.expires) {
+			result[host] = entry.matched
+		}
+	}
+	return result
+}
+
+func (c *domainMatchCache) stats() DomainCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := DomainCacheStats{
+		Size:       len(c.items),
+		Capacity:   c.capacity,
+		TTLSeconds: int(c.ttl / time.Second),
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,110 @@
+package tunnel
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDomainTrieRespectsLabelBoundaries(t *testing.T) {
+	trie := newDomainTrie(map[string]bool{
+		"example.com":         true,
+		"full:exact.org":      true,
+		"*.wild.net":          true,
+		"disabled.io":         false,
+		"full:api.wild.net":   true,
+		".trailing.dot.test.": true,
+	})
+
+	for host, expected := range map[string]bool{
+		"example.com":         true,
+		"www.example.com":     true,
+		"a.b.example.com":     true,
+		"ample.com":           false,
+		"notexample.com":      false,
+		"example.com.cn":      false,
+		"exact.org":           true,
+		"www.exact.org":       false,
+		"wild.net":            false,
+		"a.wild.net":          true,
+		"api.wild.net":        true,
+		"disabled.io":         false,
+		"trailing.dot.test":   true,
+		"x.trailing.dot.test": true,
+		"com":                 false,
+		"":                    false,
+	} {
+		if matched := trie.match(host); matched != expected {
+			t.Errorf("%q: expected %v, got %v", host, expected, matched)
+		}
+	}
+}
+
+func TestShouldUseSSHForHostCachesByHostWithoutPort(t *testing.T) {
+	tunnel := newTestTunnel()
+	tunnel.configureDomainCache(2, time.Minute)
+	tunnel.SetDomains(map[string]bool{"example.com": true})
+
+	for _, host := range []string{"www.example.com:443", "WWW.example.com:80", "www.example.com"} {
+		if !tunnel.shouldUseSSHForHost(host) {
+			t.Fatalf("expected %s to match", host)
+		}
+	}
+	if tunnel.shouldUseSSHForHost("ample.com:443") {
+		t.Fatal("expected suffix without label boundary not to match")
+	}
+	stats := tunnel.DomainCacheStats()
+	if stats.Size != 2 || stats.Hits != 2 || stats.Misses != 2 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+
+	// 超出容量时淘汰最久未使用的条目
+	tunnel.shouldUseSSHForHost("www.example.com")
+	tunnel.shouldUseSSHForHost("third.test")
+	cached := tunnel.DomainMatchCache()
+	if _, ok := cached["ample.com"]; ok || len(cached) != 2 || tunnel.DomainCacheStats().Evictions != 1 {
+		t.Fatalf("expected least recently used entry to be evicted, got %v", cached)
+	}
+
+	// 修改条目后旧的缓存结果失效
+	tunnel.SetDomains(map[string]bool{"ample.com": true})
+	if tunnel.shouldUseSSHForHost("www.example.com") || !tunnel.shouldUseSSHForHost("ample.com") {
+		t.Fatal("expected cache to be invalidated after domains change")
+	}
+}
+
+func TestDomainMatchCacheExpiresEntries(t *testing.T) {
+	cache := newDomainMatchCache(10, 20*time.Millisecond)
+	cache.put("example.com", true)
+	if matched, ok := cache.get("example.com"); !ok || !matched {
+		t.Fatal("expected fresh entry to be cached")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.get("example.com"); ok {
+		t.Fatal("expected expired entry to be dropped")
+	}
+	if stats := cache.stats(); stats.Size != 0 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func benchmarkDomainTrie(b *testing.B, entries int) {
+	domains := make(map[string]bool, entries)
+	for i := 0; i < entries; i++ {
+		domains[fmt.Sprintf("site%d.example%d.com", i, i%97)] = true
+	}
+	trie := newDomainTrie(domains)
+	hosts := []string{
+		fmt.Sprintf("www.site%d.example%d.com", entries/2, (entries/2)%97),
+		"cdn.unrelated-host.net",
+		fmt.Sprintf("site%d.example%d.com", entries-1, (entries-1)%97),
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.match(hosts[i%len(hosts)])
+	}
+}
+
+// 条目数从 1k 增加到 100k，单次查找耗时应基本不变
+func BenchmarkDomainTrieMatch1k(b *testing.B)   { benchmarkDomainTrie(b, 1000) }
+func BenchmarkDomainTrieMatch100k(b *testing.B) { benchmarkDomainTrie(b, 100000) }
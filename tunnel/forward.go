@@ -0,0 +1,258 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ssh-tunnel/cfg"
+	"ssh-tunnel/safe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LocalForwardStatus 静态端口转发的配置与统计
+type LocalForwardStatus struct {
+	Name          string       `json:"name"`
+	ListenAddress string       `json:"listenAddress"`
+	Target        string       `json:"target"`
+	Network       string       `json:"network"`
+	Stats         ForwardStats `json:"stats"`
+}
+
+// localForward 运行中的静态端口转发，cancel 关闭监听及其上的连接，done 在监听关闭后关闭
+type localForward struct {
+	config cfg.LocalForward
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (f *localForward) stop() {
+	f.cancel()
+	<-f.done
+}
+
+// StreamLocalForbidden 服务器拒绝 direct-streamlocal 通道（sshd 未开启 AllowStreamLocalForwarding 或不支持）
+var StreamLocalForbidden = errors.New("stream-local forwarding forbidden by server")
+
+// ValidateLocalForward 校验静态端口转发的名称、监听地址与目标地址（TCP 地址或Unix套接字路径）
+func ValidateLocalForward(forward cfg.LocalForward) error {
+	if strings.TrimSpace(forward.Name) == "" {
+		return errors.New("转发名称不能为空")
+	}
+	if _, port, err := net.SplitHostPort(forward.ListenAddress); err != nil || !validPort(port) {
+		return fmt.Errorf("监听地址无效: %q", forward.ListenAddress)
+	}
+	switch forwardNetwork(forward) {
+	case "tcp":
+		if host, port, err := net.SplitHostPort(forward.Target); err != nil || host == "" || !validPort(port) {
+			return fmt.Errorf("目标地址无效: %q", forward.Target)
+		}
+	case "unix":
+		if !strings.HasPrefix(forward.Target, "/") {
+			return fmt.Errorf("目标套接字路径必须为绝对路径: %q", forward.Target)
+		}
+	default:
+		return fmt.Errorf("不支持的转发类型: %q", forward.Network)
+	}
+	return nil
+}
+
+// forwardNetwork 返回转发目标的网络类型，未设置时为 tcp
+func forwardNetwork(forward cfg.LocalForward) string {
+	if forward.Network == "" {
+		return "tcp"
+	}
+	return forward.Network
+}
+
+// mapStreamLocalError 将 direct-streamlocal 通道被拒绝的原因转换为可读的错误
+func mapStreamLocalError(path string, err error) error {
+	var openErr *ssh.OpenChannelError
+	if !errors.As(err, &openErr) {
+		return err
+	}
+	switch openErr.Reason {
+	case ssh.Prohibited, ssh.UnknownChannelType:
+		return fmt.Errorf("%w: 无法转发到 %s，请检查 sshd 的 AllowStreamLocalForwarding/DisableForwarding 设置 (%v)", StreamLocalForbidden, path, err)
+	case ssh.ConnectionFailed:
+		return fmt.Errorf("服务器无法连接套接字 %s，请确认路径存在且登录用户有权限访问: %w", path, err)
+	}
+	return err
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// StartLocalForward 启动（或按名称替换）一条静态端口转发，不影响SOCKS5/HTTP/混合端口及其他转发的监听
+func (t *Tunnel) StartLocalForward(ctx context.Context, forward cfg.LocalForward) error {
+	if err := ValidateLocalForward(forward); err != nil {
+		return err
+	}
+	if (t.enableSocks5 && forward.ListenAddress == t.localAddress) || (t.enableHttp && forward.ListenAddress == t.httpLocalAddress) ||
+		(t.enableMixed && forward.ListenAddress == t.mixedLocalAddress) {
+		return fmt.Errorf("监听地址 %s 已被SOCKS5/HTTP/混合端口代理使用", forward.ListenAddress)
+	}
+
+	t.localForwardsMutex.Lock()
+	defer t.localForwardsMutex.Unlock()
+	for name, running := range t.localForwards {
+		if name != forward.Name && running.config.ListenAddress == forward.ListenAddress {
+			return fmt.Errorf("监听地址 %s 已被转发 %s 使用", forward.ListenAddress, name)
+		}
+	}
+	running, ok := t.localForwards[forward.Name]
+	if ok && running.config == forward {
+		return nil
+	}
+	// 替换监听地址不变的转发时需要先释放旧监听，监听失败后恢复旧转发
+	sameAddress := ok && running.config.ListenAddress == forward.ListenAddress
+	if sameAddress {
+		running.stop()
+		delete(t.localForwards, forward.Name)
+	}
+	// 先同步监听一次，端口被占用等错误直接返回；之后监听中断由后台重试
+	listener, err := net.Listen("tcp", forward.ListenAddress)
+	if err != nil {
+		if sameAddress {
+			t.startLocalForwardLocked(ctx, running.config, nil)
+		}
+		return fmt.Errorf("监听 %s 失败: %w", forward.ListenAddress, err)
+	}
+	if ok && !sameAddress {
+		running.stop()
+		delete(t.localForwards, forward.Name)
+	}
+	t.startLocalForwardLocked(ctx, forward, listener)
+	return nil
+}
+
+// StopLocalForward 关闭指定名称的静态端口转发及其上的连接，返回该转发是否在运行
+func (t *Tunnel) StopLocalForward(name string) bool {
+	t.localForwardsMutex.Lock()
+	defer t.localForwardsMutex.Unlock()
+	running, ok := t.localForwards[name]
+	if !ok {
+		return false
+	}
+	running.stop()
+	delete(t.localForwards, name)
+	log.Printf("静态端口转发 %s 已停止", name)
+	return true
+}
+
+// SyncLocalForwards 使运行中的转发与 forwards 一致：停止已删除或已修改的转发，启动新增的转发
+func (t *Tunnel) SyncLocalForwards(ctx context.Context, forwards []cfg.LocalForward) {
+	wanted := make(map[string]cfg.LocalForward, len(forwards))
+	for _, forward := range forwards {
+		wanted[forward.Name] = forward
+	}
+
+	t.localForwardsMutex.Lock()
+	defer t.localForwardsMutex.Unlock()
+	for name, running := range t.localForwards {
+		if forward, ok := wanted[name]; !ok || forward != running.config {
+			running.stop()
+			delete(t.localForwards, name)
+		}
+	}
+	for _, forward := range forwards {
+		if _, ok := t.localForwards[forward.Name]; ok {
+			continue
+		}
+		if err := ValidateLocalForward(forward); err != nil {
+			log.Printf("跳过静态端口转发 %s: %v", forward.Name, err)
+			continue
+		}
+		t.startLocalForwardLocked(ctx, forward, nil)
+	}
+}
+
+// LocalForwards 返回运行中的静态端口转发及各自的统计，按名称排序
+func (t *Tunnel) LocalForwards() []LocalForwardStatus {
+	t.localForwardsMutex.Lock()
+	configs := make([]cfg.LocalForward, 0, len(t.localForwards))
+	for _, running := range t.localForwards {
+		configs = append(configs, running.config)
+	}
+	t.localForwardsMutex.Unlock()
+
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	tracker := t.GetRequestTracker()
+	result := make([]LocalForwardStatus, 0, len(configs))
+	for _, config := range configs {
+		result = append(result, LocalForwardStatus{
+			Name:          config.Name,
+			ListenAddress: config.ListenAddress,
+			Target:        config.Target,
+			Network:       forwardNetwork(config),
+			Stats:         tracker.ForwardStats(config.Name),
+		})
+	}
+	return result
+}
+
+// startLocalForwardLocked 在后台运行转发，listener 为 nil 时由后台负责监听
+func (t *Tunnel) startLocalForwardLocked(ctx context.Context, forward cfg.LocalForward, listener net.Listener) {
+	if t.localForwards == nil {
+		t.localForwards = make(map[string]*localForward)
+	}
+	forwardCtx, cancel := context.WithCancel(t.reconnectContext(ctx))
+	running := &localForward{config: forward, cancel: cancel, done: make(chan struct{})}
+	t.localForwards[forward.Name] = running
+
+	safe.GO(func() {
+		defer close(running.done)
+		t.serveTCPListener(forwardCtx, listener, forward.ListenAddress, "FORWARD "+forward.Name, func(conn net.Conn) {
+			t.handleLocalForward(forwardCtx, forward, conn)
+		})
+	})
+}
+
+// handleLocalForward 经共享的SSH连接把本地连接转发到固定目标
+func (t *Tunnel) handleLocalForward(ctx context.Context, forward cfg.LocalForward, conn net.Conn) {
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	safe.GO(func() {
+		<-connCtx.Done()
+		conn.Close()
+	})
+
+	tracker := t.GetRequestTracker()
+	network := forwardNetwork(forward)
+	host, port := forward.Target, ""
+	if network == "tcp" {
+		host, port = splitHostPort(forward.Target)
+	}
+	req := tracker.StartForwardRequest(forward.Name, host, port)
+
+	server, client, err := t.createSSHNetworkConn(network, forward.Target)
+	if shouldReconnect(err) {
+		if client != nil {
+			t.invalidateSSHClientIfMatch(client, "local forward dial failed: "+err.Error())
+		}
+		t.ReconnectSSHWithSource(t.reconnectContext(ctx), "local-forward")
+		server, _, err = t.createSSHNetworkConn(network, forward.Target)
+	}
+	if err != nil {
+		log.Printf("静态端口转发 %s 连接 %s 失败: %v", forward.Name, forward.Target, err)
+		tracker.MarkFailed(req, err.Error())
+		return
+	}
+
+	tracker.MarkActive(req)
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+	safe.GO(func() {
+		tracker.AddForwardBytes(forward.Name, t.copyProxyData(server, conn, true), 0)
+	})
+	tracker.AddForwardBytes(forward.Name, 0, t.copyProxyData(conn, server, false))
+	tracker.MarkCompleted(req)
+}
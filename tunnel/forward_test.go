@@ -0,0 +1,290 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestEchoServer 启动回显服务，作为静态端口转发的目标
+func startTestEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func freeLocalAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func dialWithRetry(t *testing.T, address string) net.Conn {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dial %s: %v", address, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLocalForwardAddAndRemoveAtRuntime(t *testing.T) {
+	target := startTestEchoServer(t)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := cfg.LocalForward{Name: "db", ListenAddress: freeLocalAddress(t), Target: target}
+	other := cfg.LocalForward{Name: "other", ListenAddress: freeLocalAddress(t), Target: target}
+	tunnel.SyncLocalForwards(ctx, []cfg.LocalForward{other})
+	if err := tunnel.StartLocalForward(ctx, db); err != nil {
+		t.Fatalf("start forward: %v", err)
+	}
+	if err := tunnel.StartLocalForward(ctx, cfg.LocalForward{Name: "dup", ListenAddress: db.ListenAddress, Target: target}); err == nil {
+		t.Fatal("expected duplicate listen address to be rejected")
+	}
+
+	conn := dialWithRetry(t, db.ListenAddress)
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats := tunnel.GetRequestTracker().ForwardStats("db")
+		if stats.TotalConns == 1 && stats.ActiveConns == 0 && stats.UploadBytes == 4 && stats.DownloadBytes == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected forward stats %+v", stats)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if stats := tunnel.GetRequestTracker().ForwardStats("other"); stats.TotalConns != 0 {
+		t.Fatalf("expected other forward to have no traffic, got %+v", stats)
+	}
+
+	// 删除转发只关闭它自己的监听
+	if !tunnel.StopLocalForward("db") {
+		t.Fatal("expected db forward to be running")
+	}
+	if conn, err := net.Dial("tcp", db.ListenAddress); err == nil {
+		conn.Close()
+		t.Fatal("expected db listener to be closed")
+	}
+	dialWithRetry(t, other.ListenAddress).Close()
+	if forwards := tunnel.LocalForwards(); len(forwards) != 1 || forwards[0].Name != "other" {
+		t.Fatalf("unexpected running forwards %+v", forwards)
+	}
+}
+
+func TestLocalForwardListenErrorIsReturned(t *testing.T) {
+	target := startTestEchoServer(t)
+	tunnel := newTestTunnel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	if err := tunnel.StartLocalForward(ctx, cfg.LocalForward{Name: "busy", ListenAddress: occupied.Addr().String(), Target: target}); err == nil {
+		t.Fatal("expected listening on an occupied port to fail")
+	}
+	if forwards := tunnel.LocalForwards(); len(forwards) != 0 {
+		t.Fatalf("expected failed forward not to be running, got %+v", forwards)
+	}
+
+	// 替换同一监听地址的转发：先释放旧监听再监听，新配置立即生效
+	forward := cfg.LocalForward{Name: "db", ListenAddress: freeLocalAddress(t), Target: target}
+	if err := tunnel.StartLocalForward(ctx, forward); err != nil {
+		t.Fatal(err)
+	}
+	forward.Target = freeLocalAddress(t)
+	if err := tunnel.StartLocalForward(ctx, forward); err != nil {
+		t.Fatalf("expected replacing a forward on the same address to succeed: %v", err)
+	}
+	if forwards := tunnel.LocalForwards(); len(forwards) != 1 || forwards[0].Target != forward.Target {
+		t.Fatalf("unexpected running forwards %+v", forwards)
+	}
+}
+
+func TestLocalForwardRecordsDialFailure(t *testing.T) {
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	forward := cfg.LocalForward{Name: "broken", ListenAddress: freeLocalAddress(t), Target: freeLocalAddress(t)}
+	if err := tunnel.StartLocalForward(ctx, forward); err != nil {
+		t.Fatal(err)
+	}
+	conn := dialWithRetry(t, forward.ListenAddress)
+	defer conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected connection to be closed when the target is unreachable")
+	}
+
+	stats := tunnel.GetRequestTracker().ForwardStats("broken")
+	if stats.FailedConns != 1 || stats.ActiveConns != 0 || stats.LastError == "" {
+		t.Fatalf("unexpected forward stats %+v", stats)
+	}
+	snapshot := tunnel.GetRequestTracker().Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Forward != "broken" || snapshot[0].Status != RequestStatusFailed {
+		t.Fatalf("unexpected request snapshot %+v", snapshot)
+	}
+}
+
+func TestValidateLocalForward(t *testing.T) {
+	cases := []cfg.LocalForward{
+		{ListenAddress: "127.0.0.1:15432", Target: "db.internal:5432"},
+		{Name: "db", ListenAddress: "15432", Target: "db.internal:5432"},
+		{Name: "db", ListenAddress: "127.0.0.1:15432", Target: ":5432"},
+		{Name: "db", ListenAddress: "127.0.0.1:15432", Target: "db.internal:pg"},
+		{Name: "docker", ListenAddress: "127.0.0.1:2375", Target: "docker.sock", Network: "unix"},
+		{Name: "docker", ListenAddress: "127.0.0.1:2375", Target: "/var/run/docker.sock", Network: "udp"},
+	}
+	for _, forward := range cases {
+		if err := ValidateLocalForward(forward); err == nil {
+			t.Fatalf("expected %+v to be rejected", forward)
+		}
+	}
+	if err := ValidateLocalForward(cfg.LocalForward{Name: "db", ListenAddress: "127.0.0.1:15432", Target: "db.internal:5432"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// forwardDirectStreamLocal 处理 direct-streamlocal 通道，将流量转发到请求的Unix套接字
+func forwardDirectStreamLocal(_ *ssh.ServerConn, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-streamlocal@openssh.com" {
+		newChannel.Reject(ssh.UnknownChannelType, "not supported")
+		return
+	}
+	var payload struct {
+		SocketPath string
+		Reserved0  string
+		Reserved1  uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	target, err := net.Dial("unix", payload.SocketPath)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(target, channel)
+		target.Close()
+	}()
+	io.Copy(channel, target)
+	channel.Close()
+}
+
+func TestLocalForwardToRemoteUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectStreamLocal)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	forward := cfg.LocalForward{Name: "docker", ListenAddress: freeLocalAddress(t), Target: socketPath, Network: "unix"}
+	if err := tunnel.StartLocalForward(ctx, forward); err != nil {
+		t.Fatal(err)
+	}
+	conn := dialWithRetry(t, forward.ListenAddress)
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+	if snapshot := tunnel.GetRequestTracker().Snapshot(); len(snapshot) != 1 || snapshot[0].Host != socketPath {
+		t.Fatalf("unexpected request snapshot %+v", snapshot)
+	}
+}
+
+func TestStreamLocalForbiddenIsMapped(t *testing.T) {
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), func(_ *ssh.ServerConn, newChannel ssh.NewChannel) {
+		newChannel.Reject(ssh.Prohibited, "open failed")
+	})
+	tunnel := newJumpTestTunnel(addr, "secret")
+
+	_, _, err := tunnel.createSSHNetworkConn("unix", "/var/run/docker.sock")
+	if !errors.Is(err, StreamLocalForbidden) {
+		t.Fatalf("expected stream-local forbidden error, got %v", err)
+	}
+	if shouldReconnect(err) {
+		t.Fatal("forbidden stream-local forwarding should not trigger a reconnect")
+	}
+}
@@ -0,0 +1,315 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	HostKeyPolicyTOFU     = "tofu"
+	HostKeyPolicyStrict   = "strict"
+	HostKeyPolicyInsecure = "insecure"
+
+	defaultTrustedHostsFileName = "known_hosts"
+)
+
+// HostKeyMismatchError 服务器提供的主机公钥与固定指纹或 known_hosts 记录不一致
+type HostKeyMismatchError struct {
+	Host     string
+	KeyType  string
+	Offered  string
+	Expected []string
+	Source   string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s (%s): offered %s, expected %s",
+		e.Host, e.Source, e.Offered, strings.Join(e.Expected, " / "))
+}
+
+// HostKeyUnknownError strict 模式下主机不在 known_hosts 中且未固定指纹
+type HostKeyUnknownError struct {
+	Host    string
+	Offered string
+}
+
+func (e *HostKeyUnknownError) Error() string {
+	return fmt.Sprintf("host key for %s is unknown (offered %s) and host key policy is strict", e.Host, e.Offered)
+}
+
+// HostKeyMismatchInfo 最近一次主机公钥不匹配的详情，供管理页面展示
+type HostKeyMismatchInfo struct {
+	Host       string    `json:"host"`
+	KeyType    string    `json:"keyType"`
+	Offered    string    `json:"offered"`
+	Expected   []string  `json:"expected"`
+	Source     string    `json:"source"`
+	JumpHost   int       `json:"jumpHost,omitempty"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// HostKeyStatus 当前主机公钥校验配置与状态
+type HostKeyStatus struct {
+	ProfileID           string   `json:"profileId"`
+	Policy              string   `json:"policy"`
+	PinnedFingerprint   string   `json:"pinnedFingerprint"`
+	KnownHostsFiles     []string `json:"knownHostsFiles"`
+	HostCAFiles         []string `json:"hostCaFiles,omitempty"`
+	VerifiedFingerprint string   `json:"verifiedFingerprint"`
+	// VerifiedByCA 最近一次通过主机证书校验时签发CA的指纹
+	VerifiedByCA string               `json:"verifiedByCa,omitempty"`
+	Mismatch     *HostKeyMismatchInfo `json:"mismatch,omitempty"`
+}
+
+type hostKeyVerifier struct {
+	mu              sync.Mutex
+	policy          string
+	pinned          string
+	knownHostsFiles []string
+	hostCAFiles     []string
+	// authority 最近一次通过主机证书校验时签发CA的指纹
+	authority string
+	// persist 在 TOFU 首次信任时持久化主机公钥
+	persist func(hostname string, key ssh.PublicKey) error
+}
+
+func normalizeHostKeyPolicy(policy string) string {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case HostKeyPolicyStrict:
+		return HostKeyPolicyStrict
+	case HostKeyPolicyInsecure:
+		return HostKeyPolicyInsecure
+	default:
+		return HostKeyPolicyTOFU
+	}
+}
+
+func expandHomePath(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
+
+func defaultKnownHostsFiles(homeDir string) []string {
+	files := make([]string, 0, 2)
+	if userHome, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(userHome, ".ssh", "known_hosts"))
+	}
+	if strings.TrimSpace(homeDir) != "" {
+		files = append(files, filepath.Join(homeDir, defaultTrustedHostsFileName))
+	}
+	return files
+}
+
+func existingFiles(paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = expandHomePath(p)
+		if p == "" {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func fingerprintEqual(a, b string) bool {
+	a = strings.TrimPrefix(strings.TrimSpace(a), "SHA256:")
+	b = strings.TrimPrefix(strings.TrimSpace(b), "SHA256:")
+	return a != "" && a == b
+}
+
+func (v *hostKeyVerifier) snapshot() (string, string, []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.policy, v.pinned, append([]string(nil), v.knownHostsFiles...)
+}
+
+func (v *hostKeyVerifier) setAuthority(authority string) {
+	v.mu.Lock()
+	v.authority = authority
+	v.mu.Unlock()
+}
+
+func (v *hostKeyVerifier) verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	policy, pinned, files := v.snapshot()
+
+	if policy == HostKeyPolicyInsecure {
+		return nil
+	}
+
+	v.setAuthority("")
+	if cert, ok := key.(*ssh.Certificate); ok {
+		authority, err := verifyHostCertificate(hostname, remote, cert, v.hostCAFiles, files)
+		if err != nil {
+			return err
+		}
+		if authority != "" {
+			v.setAuthority(authority)
+			return nil
+		}
+		// 签发CA不受信任时，按证书内的公钥走固定指纹/known_hosts/TOFU 流程
+		key = cert.Key
+	}
+	offered := ssh.FingerprintSHA256(key)
+
+	if pinned != "" {
+		if fingerprintEqual(pinned, offered) {
+			return nil
+		}
+		return &HostKeyMismatchError{Host: hostname, KeyType: key.Type(), Offered: offered, Expected: []string{pinned}, Source: "pinned fingerprint"}
+	}
+
+	if files = existingFiles(files); len(files) > 0 {
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return fmt.Errorf("load known_hosts failed: %w", err)
+		}
+		err = callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			expected := make([]string, 0, len(keyErr.Want))
+			for _, want := range keyErr.Want {
+				expected = append(expected, ssh.FingerprintSHA256(want.Key))
+			}
+			return &HostKeyMismatchError{Host: hostname, KeyType: key.Type(), Offered: offered, Expected: expected, Source: "known_hosts"}
+		}
+	}
+
+	if policy == HostKeyPolicyStrict {
+		return &HostKeyUnknownError{Host: hostname, Offered: offered}
+	}
+
+	if v.persist != nil {
+		if err := v.persist(hostname, key); err != nil {
+			log.Printf("持久化主机公钥失败(%s): %v", hostname, err)
+		}
+	}
+	v.mu.Lock()
+	v.pinned = offered
+	v.mu.Unlock()
+	log.Printf("首次连接 %s，已信任并固定主机公钥指纹: %s", hostname, offered)
+	return nil
+}
+
+// newHostKeyVerifier 构建主机公钥校验器；TOFU 首次信任时有 profile 则通过 pin 固定到 profile，否则追加到 <home.dir>/known_hosts
+func newHostKeyVerifier(homeDir, policy, pinned string, knownHostsFiles []string, hostCAFiles []string, profileID string, pin func(fingerprint string) error) *hostKeyVerifier {
+	if len(knownHostsFiles) == 0 {
+		knownHostsFiles = defaultKnownHostsFiles(homeDir)
+	}
+	trustedHostsFile := filepath.Join(homeDir, defaultTrustedHostsFileName)
+
+	verifier := &hostKeyVerifier{
+		policy:          normalizeHostKeyPolicy(policy),
+		pinned:          strings.TrimSpace(pinned),
+		knownHostsFiles: knownHostsFiles,
+		hostCAFiles:     hostCAFiles,
+		persist: func(hostname string, key ssh.PublicKey) error {
+			if profileID != "" {
+				return pin(ssh.FingerprintSHA256(key))
+			}
+			return appendKnownHost(trustedHostsFile, hostname, key)
+		},
+	}
+	if verifier.policy == HostKeyPolicyInsecure {
+		log.Printf("警告: profile(%s) 已关闭SSH主机公钥校验，连接可能遭受中间人攻击", profileID)
+	}
+	return verifier
+}
+
+func appendKnownHost(filePath string, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+	return err
+}
+
+// hostKeyCallback 包装校验器并记录结果，jumpHost 为跳板机序号(从1开始)，0 表示目标服务器
+func (t *Tunnel) hostKeyCallback(v *hostKeyVerifier, jumpHost int) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := v.verify(hostname, remote, key)
+		t.recordHostKeyResult(key, err, jumpHost)
+		return err
+	}
+}
+
+func (t *Tunnel) recordHostKeyResult(key ssh.PublicKey, err error, jumpHost int) {
+	t.reconnectMutex.Lock()
+	defer t.reconnectMutex.Unlock()
+
+	if err == nil {
+		if jumpHost == 0 {
+			t.hostKeyFingerprint = hostKeyFingerprint(key)
+		}
+		return
+	}
+
+	var mismatch *HostKeyMismatchError
+	if errors.As(err, &mismatch) {
+		t.lastHostKeyMismatch = &HostKeyMismatchInfo{
+			Host:       mismatch.Host,
+			KeyType:    mismatch.KeyType,
+			Offered:    mismatch.Offered,
+			Expected:   append([]string(nil), mismatch.Expected...),
+			Source:     mismatch.Source,
+			JumpHost:   jumpHost,
+			DetectedAt: time.Now(),
+		}
+	}
+}
+
+// HostKeyStatus 返回当前主机公钥校验配置、最近一次校验通过的指纹以及最近的不匹配记录
+func (t *Tunnel) HostKeyStatus() HostKeyStatus {
+	t.authMutex.Lock()
+	verifier := t.hostKeyVerifier
+	status := HostKeyStatus{ProfileID: t.profileID, Policy: HostKeyPolicyTOFU}
+	t.authMutex.Unlock()
+
+	if verifier != nil {
+		policy, pinned, files := verifier.snapshot()
+		status.Policy = policy
+		status.PinnedFingerprint = pinned
+		status.KnownHostsFiles = files
+		status.HostCAFiles = append([]string(nil), verifier.hostCAFiles...)
+		verifier.mu.Lock()
+		status.VerifiedByCA = verifier.authority
+		verifier.mu.Unlock()
+	}
+
+	t.reconnectMutex.Lock()
+	defer t.reconnectMutex.Unlock()
+	status.VerifiedFingerprint = t.hostKeyFingerprint
+	if t.lastHostKeyMismatch != nil {
+		mismatch := *t.lastHostKeyMismatch
+		status.Mismatch = &mismatch
+	}
+	return status
+}
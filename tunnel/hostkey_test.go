@@ -0,0 +1,155 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"ssh-tunnel/cfg"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("convert key: %v", err)
+	}
+	return key
+}
+
+var testRemoteAddr = &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+func TestHostKeyVerifierPinnedMismatch(t *testing.T) {
+	pinnedKey := newTestHostKey(t)
+	offeredKey := newTestHostKey(t)
+	verifier := &hostKeyVerifier{policy: HostKeyPolicyTOFU, pinned: ssh.FingerprintSHA256(pinnedKey)}
+
+	if err := verifier.verify("192.0.2.10:22", testRemoteAddr, pinnedKey); err != nil {
+		t.Fatalf("expected pinned key to be accepted, got %v", err)
+	}
+
+	err := verifier.verify("192.0.2.10:22", testRemoteAddr, offeredKey)
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected host key mismatch error, got %v", err)
+	}
+	if mismatch.Offered != ssh.FingerprintSHA256(offeredKey) {
+		t.Fatalf("unexpected offered fingerprint %q", mismatch.Offered)
+	}
+	if len(mismatch.Expected) != 1 || mismatch.Expected[0] != ssh.FingerprintSHA256(pinnedKey) {
+		t.Fatalf("unexpected expected fingerprints %v", mismatch.Expected)
+	}
+}
+
+func TestHostKeyVerifierKnownHostsMismatch(t *testing.T) {
+	knownKey := newTestHostKey(t)
+	offeredKey := newTestHostKey(t)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("192.0.2.10:22")}, knownKey) + "\n"
+	if err := os.WriteFile(knownHostsFile, []byte(line), 0600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+
+	verifier := &hostKeyVerifier{policy: HostKeyPolicyTOFU, knownHostsFiles: []string{knownHostsFile}}
+	if err := verifier.verify("192.0.2.10:22", testRemoteAddr, knownKey); err != nil {
+		t.Fatalf("expected known host key to be accepted, got %v", err)
+	}
+
+	err := verifier.verify("192.0.2.10:22", testRemoteAddr, offeredKey)
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected host key mismatch error, got %v", err)
+	}
+	if mismatch.Source != "known_hosts" {
+		t.Fatalf("expected known_hosts source, got %q", mismatch.Source)
+	}
+}
+
+func TestHostKeyVerifierTrustOnFirstUse(t *testing.T) {
+	firstKey := newTestHostKey(t)
+	var persisted string
+	verifier := &hostKeyVerifier{
+		policy: HostKeyPolicyTOFU,
+		persist: func(hostname string, key ssh.PublicKey) error {
+			persisted = ssh.FingerprintSHA256(key)
+			return nil
+		},
+	}
+
+	if err := verifier.verify("192.0.2.10:22", testRemoteAddr, firstKey); err != nil {
+		t.Fatalf("expected first key to be trusted, got %v", err)
+	}
+	if persisted != ssh.FingerprintSHA256(firstKey) {
+		t.Fatalf("expected first key to be persisted, got %q", persisted)
+	}
+
+	err := verifier.verify("192.0.2.10:22", testRemoteAddr, newTestHostKey(t))
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected changed key to be rejected after TOFU pin, got %v", err)
+	}
+}
+
+func TestHostKeyVerifierStrictRejectsUnknownHost(t *testing.T) {
+	verifier := &hostKeyVerifier{policy: HostKeyPolicyStrict}
+	err := verifier.verify("192.0.2.10:22", testRemoteAddr, newTestHostKey(t))
+	var unknown *HostKeyUnknownError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected unknown host error, got %v", err)
+	}
+}
+
+func TestReconnectStopsOnHostKeyMismatch(t *testing.T) {
+	tunnel := newTestTunnel()
+	attempts := 0
+	tunnel.sshDialFn = func() (*ssh.Client, error) {
+		attempts++
+		return nil, &HostKeyMismatchError{Host: "192.0.2.10:22", Offered: "SHA256:new", Expected: []string{"SHA256:old"}}
+	}
+
+	tunnel.ReconnectSSHWithSource(t.Context(), "test")
+
+	if attempts != 1 {
+		t.Fatalf("expected reconnect to stop after host key mismatch, got %d attempts", attempts)
+	}
+}
+
+func TestRefreshHostKeyVerifierConcurrentWithStatus(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.properties")
+	if err := os.WriteFile(configFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	cfg.SetConfigInstance(v)
+	appConfig := cfg.NewAppConfig()
+
+	tunnel := newTestTunnel()
+	tunnel.refreshHostKeyVerifier(appConfig)
+
+	// 刷新配置与读取状态并发进行，-race 下不应报告数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			tunnel.refreshHostKeyVerifier(appConfig)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if status := tunnel.HostKeyStatus(); status.Policy == "" {
+			t.Fatalf("unexpected host key status %+v", status)
+		}
+	}
+	<-done
+}
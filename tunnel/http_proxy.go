@@ -0,0 +1,423 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"ssh-tunnel/safe"
+)
+
+// defaultHttpKeepAliveTimeout 持久连接上等待下一个请求的最长时间
+const defaultHttpKeepAliveTimeout = 60 * time.Second
+
+// hopByHopHeaders 只对单跳有效、不能转发给上游或客户端的头部（RFC 7230 6.1）
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// httpUpstream 客户端持久连接上复用的上游连接，按目标地址区分
+type httpUpstream struct {
+	dest   destinationConn
+	reader *bufio.Reader
+}
+
+// readCloser 从带缓冲的 reader 读取、关闭底层连接，避免丢失已预读的数据
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// handleClientRequest 处理HTTP代理连接：逐个读取请求（支持持久连接与管道化），每个请求按自己的目标路由；CONNECT 请求转为隧道
+func (t *Tunnel) handleClientRequest(ctx context.Context, client net.Conn) {
+	defer client.Close()
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println("panic occurred:", err)
+		}
+	}()
+
+	reader := bufio.NewReader(client)
+	upstreams := make(map[string]*httpUpstream)
+	defer func() {
+		for _, upstream := range upstreams {
+			_ = upstream.dest.conn.Close()
+		}
+	}()
+
+	for served := 0; ; served++ {
+		timeout := t.proxyHandshakeTimeout()
+		if served > 0 {
+			timeout = defaultHttpKeepAliveTimeout
+		}
+		_ = client.SetReadDeadline(time.Now().Add(timeout))
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			// 持久连接上客户端关闭或空闲超时属于正常结束
+			if served == 0 && !errors.Is(err, io.EOF) {
+				log.Println(err)
+				writeHTTPProxyError(client, http.StatusBadRequest, "invalid request")
+			}
+			return
+		}
+		_ = client.SetReadDeadline(time.Time{})
+
+		user, status := t.httpProxyAuthorize(client, req.Header)
+		if status != 0 {
+			_, _ = io.Copy(io.Discard, req.Body)
+			if status == http.StatusTooManyRequests {
+				writeHTTPProxyError(client, status, "too many failed authentication attempts")
+				return
+			}
+			_, _ = fmt.Fprint(client, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"Http Proxy\"\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			return
+		}
+
+		if req.Method == http.MethodConnect {
+			t.handleHTTPConnect(ctx, client, reader, req, user)
+			return
+		}
+		if !t.forwardHTTPRequest(ctx, client, reader, req, user, upstreams) {
+			return
+		}
+	}
+}
+
+// httpProxyAuthorize 校验 Proxy-Authorization 头，返回认证通过的用户名；失败时返回应答状态码（407 或被限流时的 429）。
+// 未启用HTTP基本认证时总是通过
+func (t *Tunnel) httpProxyAuthorize(client net.Conn, header http.Header) (string, int) {
+	if !t.enableHttpBasic {
+		return "", 0
+	}
+	ip := clientIP(client)
+	if t.authLimiter.blocked(ip) {
+		return "", http.StatusTooManyRequests
+	}
+	credentials := header.Get("Proxy-Authorization")
+	if credentials == "" {
+		// 客户端通常先不带凭据请求，收到407后再重试，不计入失败次数
+		return "", http.StatusProxyAuthRequired
+	}
+	user, password, ok := parseProxyBasicAuth(credentials)
+	if ok && t.authenticateProxyUser(user, password) {
+		t.authLimiter.recordSuccess(ip)
+		return user, 0
+	}
+	log.Printf("HTTP代理认证失败: user=%q, client=%s", user, ip)
+	if t.authLimiter.recordFailure(ip) {
+		return "", http.StatusTooManyRequests
+	}
+	return "", http.StatusProxyAuthRequired
+}
+
+// parseProxyBasicAuth 解析 Basic 认证头中的用户名与密码
+func parseProxyBasicAuth(credentials string) (string, string, bool) {
+	scheme, encoded, ok := strings.Cut(credentials, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// handleHTTPConnect 建立 CONNECT 隧道，客户端已发送的后续数据从 reader 中继续转发
+func (t *Tunnel) handleHTTPConnect(ctx context.Context, client net.Conn, reader *bufio.Reader, req *http.Request, user string) {
+	address := req.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "443")
+	}
+	tracker := t.GetRequestTracker()
+	rHost, rPort := splitHostPort(address)
+	trackReq := tracker.StartRequest(rHost, rPort, "HTTPS", t.enableHttpOverSSH)
+	tracker.SetUser(trackReq, user)
+	route := t.routeFor(address, clientIP(client), t.httpDefaultAction(address))
+	tracker.SetRoute(trackReq, route)
+	if route.Action == RouteActionReject {
+		writeHTTPProxyError(client, http.StatusForbidden, errRouteRejected.Error())
+		tracker.MarkFailed(trackReq, errRouteRejected.Error())
+		return
+	}
+
+	dest, done := t.getConn(ctx, client, address, route.Action)
+	if done || dest.conn == nil {
+		tracker.MarkFailed(trackReq, "connection failed")
+		return
+	}
+	tracker.MarkActive(trackReq)
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+
+	if _, err := fmt.Fprint(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		_ = dest.conn.Close()
+		tracker.MarkFailed(trackReq, err.Error())
+		return
+	}
+	safe.GO(func() {
+		t.copyProxyData(dest.conn, readCloser{Reader: reader, Closer: client}, true)
+	})
+	t.copyProxyData(client, dest.conn, false)
+	tracker.MarkCompleted(trackReq)
+}
+
+// forwardHTTPRequest 转发一个普通HTTP请求并写回响应，返回客户端连接是否可以继续使用
+func (t *Tunnel) forwardHTTPRequest(ctx context.Context, client net.Conn, reader *bufio.Reader, req *http.Request, user string, upstreams map[string]*httpUpstream) bool {
+	address, err := httpRequestAddress(req)
+	if err != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		writeHTTPProxyError(client, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	tracker := t.GetRequestTracker()
+	rHost, rPort := splitHostPort(address)
+	trackReq := tracker.StartRequest(rHost, rPort, "HTTP", t.enableHttpOverSSH)
+	tracker.SetUser(trackReq, user)
+	route := t.routeFor(address, clientIP(client), t.httpDefaultAction(address))
+	tracker.SetRoute(trackReq, route)
+	if route.Action == RouteActionReject {
+		_, _ = io.Copy(io.Discard, req.Body)
+		writeHTTPProxyError(client, http.StatusForbidden, errRouteRejected.Error())
+		tracker.MarkFailed(trackReq, errRouteRejected.Error())
+		return false
+	}
+
+	upgrade := isUpgradeRequest(req.Header)
+	upgradeType := req.Header.Get("Upgrade")
+	clientClose := req.Close
+	removeHopByHopHeaders(req.Header)
+	if upgrade {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgradeType)
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// 避免 Request.Write 补上默认的 Go User-Agent
+		req.Header.Set("User-Agent", "")
+	}
+	req.Close = false
+	req.RequestURI = ""
+
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+
+	upstream, resp, uploaded, err := t.roundTripHTTP(ctx, client, address, route.Action, req, upstreams)
+	if upstream == nil {
+		// getConn 已向客户端写入错误响应
+		tracker.MarkFailed(trackReq, "connection failed")
+		return false
+	}
+	t.addProxyUploadBytes(uploaded)
+	if err != nil {
+		log.Printf("HTTP代理请求 %s 失败: %v", address, err)
+		t.dropHTTPUpstream(upstreams, address, err)
+		writeHTTPProxyError(client, http.StatusBadGateway, err.Error())
+		tracker.MarkFailed(trackReq, err.Error())
+		return false
+	}
+	tracker.MarkActive(trackReq)
+
+	if upgrade && resp.StatusCode == http.StatusSwitchingProtocols {
+		delete(upstreams, address)
+		return t.relayHTTPUpgrade(client, reader, upstream, resp, trackReq)
+	}
+
+	upstreamClose := resp.Close
+	removeHopByHopHeaders(resp.Header)
+	resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	resp.Close = clientClose
+	keepAlive := !clientClose
+	if resp.ContentLength < 0 && !isChunked(resp.TransferEncoding) && resp.Body != http.NoBody {
+		// 上游以关闭连接表示响应结束，客户端侧也只能关闭
+		keepAlive = false
+	}
+
+	writer := &countingWriter{Writer: client}
+	err = resp.Write(writer)
+	_ = resp.Body.Close()
+	t.addProxyDownloadBytes(writer.n)
+	if err != nil {
+		t.dropHTTPUpstream(upstreams, address, err)
+		tracker.MarkFailed(trackReq, err.Error())
+		return false
+	}
+	if upstreamClose {
+		t.dropHTTPUpstream(upstreams, address, nil)
+	}
+	tracker.MarkCompleted(trackReq)
+	return keepAlive
+}
+
+// roundTripHTTP 在目标地址的上游连接上发送请求并读取响应头；复用的连接已被对端关闭且请求没有请求体时，换新连接重试一次
+func (t *Tunnel) roundTripHTTP(ctx context.Context, client net.Conn, address, action string, req *http.Request, upstreams map[string]*httpUpstream) (*httpUpstream, *http.Response, int64, error) {
+	for attempt := 0; ; attempt++ {
+		upstream, reused := upstreams[address]
+		if !reused {
+			dest, done := t.getConn(ctx, client, address, action)
+			if done || dest.conn == nil {
+				return nil, nil, 0, errors.New("connection failed")
+			}
+			upstream = &httpUpstream{dest: dest, reader: bufio.NewReader(dest.conn)}
+			upstreams[address] = upstream
+		}
+
+		writer := &countingWriter{Writer: upstream.dest.conn}
+		err := req.Write(writer)
+		var resp *http.Response
+		if err == nil {
+			resp, err = t.readFinalHTTPResponse(client, upstream.reader, req)
+		}
+		if err == nil {
+			return upstream, resp, writer.n, nil
+		}
+		retryable := reused && attempt == 0 && (req.Body == nil || req.Body == http.NoBody)
+		if !retryable {
+			return upstream, nil, writer.n, err
+		}
+		t.dropHTTPUpstream(upstreams, address, err)
+	}
+}
+
+// readFinalHTTPResponse 读取上游响应头，期间收到的 1xx 临时响应（如 100 Continue）原样写回客户端后继续读取；
+// 101 作为最终响应返回，由调用方走升级流程
+func (t *Tunnel) readFinalHTTPResponse(client net.Conn, reader *bufio.Reader, req *http.Request) (*http.Response, error) {
+	for {
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 100 || resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+		writer := &countingWriter{Writer: client}
+		if _, err := fmt.Fprintf(writer, "HTTP/1.1 %s\r\n", resp.Status); err == nil {
+			if err = resp.Header.Write(writer); err == nil {
+				_, err = io.WriteString(writer, "\r\n")
+			}
+		}
+		t.addProxyDownloadBytes(writer.n)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// relayHTTPUpgrade 把 101 响应写回客户端后双向转发升级后的连接（如 WebSocket）
+func (t *Tunnel) relayHTTPUpgrade(client net.Conn, reader *bufio.Reader, upstream *httpUpstream, resp *http.Response, trackReq *ProxyRequest) bool {
+	tracker := t.GetRequestTracker()
+	if err := resp.Write(client); err != nil {
+		_ = upstream.dest.conn.Close()
+		tracker.MarkFailed(trackReq, err.Error())
+		return false
+	}
+	safe.GO(func() {
+		t.copyProxyData(upstream.dest.conn, readCloser{Reader: reader, Closer: client}, true)
+	})
+	t.copyProxyData(client, readCloser{Reader: upstream.reader, Closer: upstream.dest.conn}, false)
+	tracker.MarkCompleted(trackReq)
+	return false
+}
+
+// dropHTTPUpstream 关闭并移除上游连接；经SSH的连接出现SSH层错误时使当前SSH客户端失效
+func (t *Tunnel) dropHTTPUpstream(upstreams map[string]*httpUpstream, address string, err error) {
+	upstream, ok := upstreams[address]
+	if !ok {
+		return
+	}
+	delete(upstreams, address)
+	_ = upstream.dest.conn.Close()
+	if err != nil && upstream.dest.viaSSH && upstream.dest.sshClient != nil && isSSHReconnectError(err) {
+		t.invalidateSSHClientIfMatch(upstream.dest.sshClient, "http upstream failed: "+err.Error())
+	}
+}
+
+// httpRequestAddress 返回请求的目标 host:port，绝对URI优先，其次 Host 头，默认端口80
+func httpRequestAddress(req *http.Request) (string, error) {
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+	if req.URL.Scheme != "" && req.URL.Scheme != "http" {
+		return "", fmt.Errorf("unsupported scheme: %s", req.URL.Scheme)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "80")
+	}
+	return host, nil
+}
+
+// isUpgradeRequest 请求是否携带 Connection: Upgrade 与 Upgrade 头
+func isUpgradeRequest(header http.Header) bool {
+	if header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "Upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeHopByHopHeaders 删除逐跳头部、Connection 中列出的头部以及所有 Proxy-* 头部
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	for name := range header {
+		if strings.HasPrefix(name, "Proxy-") {
+			delete(header, name)
+		}
+	}
+}
+
+func isChunked(transferEncoding []string) bool {
+	return len(transferEncoding) > 0 && transferEncoding[0] == "chunked"
+}
+
+// writeHTTPProxyError 写入代理自身产生的错误响应并要求关闭连接
+func writeHTTPProxyError(client net.Conn, status int, message string) {
+	_, _ = fmt.Fprintf(client, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, http.StatusText(status), len(message), message)
+}
@@ -0,0 +1,221 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestOrigin 启动源站：返回自己的名称、收到的请求头名称与请求体；/upgrade 路径模拟 WebSocket 升级后回显
+func startTestOrigin(t *testing.T, name string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upgrade" {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+			io.Copy(conn, rw)
+			return
+		}
+		names := make([]string, 0, len(r.Header))
+		for key := range r.Header {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Origin", name)
+		w.Header().Set("X-Headers", strings.Join(names, ","))
+		fmt.Fprintf(w, "%s:%s", name, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func startTestHTTPProxy(t *testing.T, tunnel *Tunnel) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go tunnel.handleClientRequest(context.Background(), conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newHTTPProxyTestTunnel(t *testing.T) *Tunnel {
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.enableHttpOverSSH = true
+	return tunnel
+}
+
+func readProxyResponse(t *testing.T, reader *bufio.Reader) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestHTTPProxyPipelinedRequestsRouteByHost(t *testing.T) {
+	originA := startTestOrigin(t, "a")
+	originB := startTestOrigin(t, "b")
+	tunnel := newHTTPProxyTestTunnel(t)
+
+	conn, err := net.Dial("tcp", startTestHTTPProxy(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 三个请求一次性发出：两个不同主机，第三个复用到A的上游连接
+	fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n\r\n", originA, originA)
+	fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n\r\n", originB, originB)
+	fmt.Fprintf(conn, "POST http://%s/ HTTP/1.1\r\nHost: %s\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", originA, originA)
+
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"a:", "b:", "a:hello world"} {
+		resp, body := readProxyResponse(t, reader)
+		if resp.StatusCode != http.StatusOK || body != expected {
+			t.Fatalf("expected %q, got %d %q", expected, resp.StatusCode, body)
+		}
+	}
+
+	snapshot := tunnel.GetRequestTracker().Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("expected one tracker entry per request, got %+v", snapshot)
+	}
+	for _, req := range snapshot {
+		if req.Protocol != "HTTP" || req.Status != RequestStatusCompleted {
+			t.Fatalf("unexpected request record %+v", req)
+		}
+	}
+}
+
+func TestHTTPProxyRelaysInterimResponses(t *testing.T) {
+	origin := startTestOrigin(t, "a")
+	tunnel := newHTTPProxyTestTunnel(t)
+
+	conn, err := net.Dial("tcp", startTestHTTPProxy(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "POST http://%s/ HTTP/1.1\r\nHost: %s\r\nExpect: 100-continue\r\nContent-Length: 7\r\n\r\npayload", origin, origin)
+	fmt.Fprintf(conn, "GET http://%s/next HTTP/1.1\r\nHost: %s\r\n\r\n", origin, origin)
+
+	reader := bufio.NewReader(conn)
+	interim, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interim.StatusCode != http.StatusContinue || interim.Header.Get("Content-Length") != "" {
+		t.Fatalf("expected a bare 100 Continue, got %d %v", interim.StatusCode, interim.Header)
+	}
+	// 临时响应之后是 POST 的最终响应，再之后才是下一个请求的响应
+	for _, expected := range []string{"a:payload", "a:"} {
+		resp, body := readProxyResponse(t, reader)
+		if resp.StatusCode != http.StatusOK || body != expected {
+			t.Fatalf("expected %q, got %d %q", expected, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHTTPProxyStripsHopByHopHeaders(t *testing.T) {
+	origin := startTestOrigin(t, "a")
+	tunnel := newHTTPProxyTestTunnel(t)
+
+	conn, err := net.Dial("tcp", startTestHTTPProxy(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\nProxy-Authorization: Basic Zm9vOmJhcg==\r\nProxy-Connection: keep-alive\r\nConnection: X-Secret\r\nX-Secret: 1\r\nX-Keep: 1\r\n\r\n", origin, origin)
+
+	resp, _ := readProxyResponse(t, bufio.NewReader(conn))
+	if headers := resp.Header.Get("X-Headers"); headers != "X-Keep" {
+		t.Fatalf("unexpected headers forwarded upstream: %q", headers)
+	}
+}
+
+func TestHTTPProxyWebSocketUpgrade(t *testing.T) {
+	origin := startTestOrigin(t, "ws")
+	tunnel := newHTTPProxyTestTunnel(t)
+
+	conn, err := net.Dial("tcp", startTestHTTPProxy(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET http://%s/upgrade HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", origin, origin)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("unexpected upgrade response %v: %v", resp, err)
+	}
+	conn.Write([]byte("frame"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "frame" {
+		t.Fatalf("unexpected upgraded echo %q: %v", buf, err)
+	}
+}
+
+func TestHTTPProxyRequiresBasicAuth(t *testing.T) {
+	origin := startTestOrigin(t, "a")
+	tunnel := newHTTPProxyTestTunnel(t)
+	tunnel.enableHttpBasic = true
+	tunnel.httpBasicUserName = "foo"
+	tunnel.httpBasicPassword = "bar"
+	proxy := startTestHTTPProxy(t, tunnel)
+
+	for _, tc := range []struct {
+		auth   string
+		status int
+	}{
+		{"", http.StatusProxyAuthRequired},
+		{"Proxy-Authorization: Basic Zm9vOmJheg==\r\n", http.StatusProxyAuthRequired},
+		{"Proxy-Authorization: Basic Zm9vOmJhcg==\r\n", http.StatusOK},
+	} {
+		conn, err := net.Dial("tcp", proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n%s\r\n", origin, origin, tc.auth)
+		resp, _ := readProxyResponse(t, bufio.NewReader(conn))
+		conn.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("auth %q: expected %d, got %d", tc.auth, tc.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpTlsCertFileName = "http_proxy.crt"
+	httpTlsKeyFileName  = "http_proxy.key"
+
+	httpTlsSelfSignedValidity = 10 * 365 * 24 * time.Hour
+)
+
+// httpTlsConfig HTTP代理监听端口的TLS配置；未配置证书时在 homeDir 下生成并复用自签名证书
+type httpTlsConfig struct {
+	enabled  bool
+	certFile string
+	keyFile  string
+	homeDir  string
+}
+
+// certReloader 按证书与私钥文件的修改时间按需重新加载，替换证书无需重启；加载失败时继续使用上一次的证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certInfo, certErr := os.Stat(r.certFile)
+	keyInfo, keyErr := os.Stat(r.keyFile)
+	if certErr == nil && keyErr == nil && r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	if err := errors.Join(certErr, keyErr); err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			log.Printf("重新加载HTTP代理TLS证书失败，继续使用旧证书: %v", err)
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	if r.cert != nil {
+		log.Printf("HTTP代理TLS证书已重新加载: %s", r.certFile)
+	}
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	return r.cert, nil
+}
+
+// httpProxyTLSConfig 返回HTTP代理监听端口使用的 tls.Config，证书在每次握手时按需重新加载
+func (t *Tunnel) httpProxyTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := strings.TrimSpace(t.httpTls.certFile), strings.TrimSpace(t.httpTls.keyFile)
+	if certFile == "" && keyFile == "" {
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCertificate(t.httpTls.homeDir)
+		if err != nil {
+			return nil, err
+		}
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("HTTP代理TLS证书与私钥文件需要同时配置")
+	}
+
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.GetCertificate(nil); err != nil {
+		return nil, fmt.Errorf("加载HTTP代理TLS证书失败: %w", err)
+	}
+	return &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"http/1.1"},
+	}, nil
+}
+
+// ensureSelfSignedCertificate 返回 dir 下的自签名证书与私钥，不存在时生成
+func ensureSelfSignedCertificate(dir string) (string, string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", "", errors.New("未配置主目录，无法生成HTTP代理自签名证书")
+	}
+	certFile := filepath.Join(dir, httpTlsCertFileName)
+	keyFile := filepath.Join(dir, httpTlsKeyFileName)
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return certFile, keyFile, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := writeSelfSignedCertificate(certFile, keyFile); err != nil {
+		return "", "", err
+	}
+	log.Printf("已生成HTTP代理自签名证书: %s", certFile)
+	return certFile, keyFile, nil
+}
+
+// writeSelfSignedCertificate 生成覆盖 localhost、回环地址与本机主机名的 ECDSA 自签名证书
+func writeSelfSignedCertificate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ssh-tunnel http proxy"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(httpTlsSelfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// 先写私钥再写证书，证书文件存在即表示两者都已就绪
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
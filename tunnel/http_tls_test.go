@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func trustCertificateFile(t *testing.T, certFile string) *x509.CertPool {
+	t.Helper()
+	pemData, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		t.Fatal("failed to parse generated certificate")
+	}
+	return pool
+}
+
+func TestHTTPSProxyListenerWithSelfSignedCertificate(t *testing.T) {
+	target := startTestEchoServer(t)
+	tunnel := newHTTPProxyTestTunnel(t)
+	tunnel.enableHttpBasic = true
+	tunnel.httpBasicUserName = "foo"
+	tunnel.httpBasicPassword = "bar"
+	tunnel.httpLocalAddress = freeLocalAddress(t)
+	tunnel.httpTls = httpTlsConfig{enabled: true, homeDir: t.TempDir()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tunnel.httpProxyStartEx(ctx, nil)
+
+	certFile := filepath.Join(tunnel.httpTls.homeDir, httpTlsCertFileName)
+	dialWithRetry(t, tunnel.httpLocalAddress).Close()
+	tlsConfig := &tls.Config{RootCAs: trustCertificateFile(t, certFile)}
+	conn, err := tls.Dial("tcp", tunnel.httpLocalAddress, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\nProxy-Authorization: Basic Zm9vOmJhcg==\r\n\r\n", target, target)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected CONNECT response %v: %v", resp, err)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+
+	// 已存在的自签名证书被复用，不会重新生成
+	before, _ := os.ReadFile(certFile)
+	if _, _, err := ensureSelfSignedCertificate(tunnel.httpTls.homeDir); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Fatal("expected persisted certificate to be reused")
+	}
+}
+
+func TestHTTPProxyCertificateReloadsWithoutRestart(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "proxy.crt")
+	keyFile := filepath.Join(dir, "proxy.key")
+	if err := writeSelfSignedCertificate(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	tunnel := newTestTunnel()
+	tunnel.httpTls = httpTlsConfig{enabled: true, certFile: certFile, keyFile: keyFile}
+	config, err := tunnel.httpProxyTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := config.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeSelfSignedCertificate(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	second, err := config.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.Certificate[0]) == string(second.Certificate[0]) {
+		t.Fatal("expected replaced certificate to be served")
+	}
+
+	// 写坏证书时继续使用上一次成功加载的证书
+	os.WriteFile(certFile, []byte("broken"), 0644)
+	os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute))
+	third, err := config.GetCertificate(nil)
+	if err != nil || string(third.Certificate[0]) != string(second.Certificate[0]) {
+		t.Fatalf("expected previous certificate to be kept, err=%v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-tunnel/cfg"
+	"ssh-tunnel/safe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpHop 一个跳板机的运行时配置
+type jumpHop struct {
+	index    int
+	name     string
+	address  string
+	user     string
+	chain    *authChain
+	verifier *hostKeyVerifier
+	// algorithms 该跳使用的SSH算法，字段为 nil 时使用默认值
+	algorithms ssh.Algorithms
+}
+
+// HopError 连接链路中某一跳失败，Hop 为跳板机序号(从1开始)，0 表示目标服务器
+type HopError struct {
+	Hop     int
+	Name    string
+	Address string
+	Err     error
+}
+
+func (e *HopError) Error() string {
+	if e.Hop == 0 {
+		return fmt.Sprintf("target %s: %v", e.Address, e.Err)
+	}
+	return fmt.Sprintf("jump host #%d %s: %v", e.Hop, e.Label(), e.Err)
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+// Label 返回便于展示的跳板机名称
+func (e *HopError) Label() string {
+	if e.Name != "" && e.Name != e.Address {
+		return e.Name + " (" + e.Address + ")"
+	}
+	return e.Address
+}
+
+func (h *jumpHop) label() string {
+	if h.name != "" {
+		return h.name
+	}
+	return h.user + "@" + h.address
+}
+
+// buildJumpHops 根据 profile 构建跳板机链路，认证字段未设置时沿用 profile 的配置（密码不沿用）
+func (t *Tunnel) buildJumpHops(config *cfg.AppConfig, profileID string, profile cfg.SSHProfile) ([]*jumpHop, error) {
+	hops := make([]*jumpHop, 0, len(profile.JumpHosts))
+	closeAll := func() {
+		for _, hop := range hops {
+			hop.chain.close()
+		}
+	}
+
+	for i, jump := range profile.JumpHosts {
+		index := i + 1
+		host := strings.TrimSpace(jump.Host)
+		if host == "" {
+			closeAll()
+			return nil, fmt.Errorf("jump host #%d: host is required", index)
+		}
+		port := jump.Port
+		if port <= 0 {
+			port = 22
+		}
+		user := strings.TrimSpace(jump.User)
+		if user == "" {
+			user = config.LoginUser.GetValue()
+		}
+
+		spec := authSpec{
+			methods:       jump.AuthMethods,
+			keyPath:       jump.PrivateKeyPath,
+			certificate:   jump.CertificateFile,
+			identityFiles: jump.IdentityFiles,
+			agentSocket:   profile.IdentityAgent,
+			password:      jump.Password,
+		}
+		if len(spec.methods) == 0 {
+			spec.methods = profile.AuthMethods
+		}
+		if spec.keyPath == "" && len(spec.identityFiles) == 0 {
+			spec.keyPath = config.SshPrivateKeyPath.GetValue()
+			spec.certificate = profile.CertificateFile
+			spec.identityFiles = profile.IdentityFiles
+		}
+		algorithmConfig := jump.Algorithms
+		if algorithmConfig == nil {
+			algorithmConfig = profile.Algorithms
+		}
+		algorithms, err := ResolveAlgorithms(algorithmConfig)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("jump host #%d %s: %w", index, host, err)
+		}
+		chain, err := t.buildAuthChain(spec, config.SshPrivateKeyPassphrase.GetValue())
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("jump host #%d %s: %w", index, host, err)
+		}
+
+		hostCAFiles := jump.HostCAFiles
+		if len(hostCAFiles) == 0 {
+			hostCAFiles = profile.HostCAFiles
+		}
+		verifier := newHostKeyVerifier(config.HomeDir.GetValue(), jump.HostKeyPolicy, jump.HostKeyFingerprint, jump.KnownHostsFiles, hostCAFiles, profileID,
+			func(fingerprint string) error {
+				_, err := cfg.SetProfileJumpHostFingerprint(profileID, index, fingerprint, config)
+				return err
+			})
+
+		hops = append(hops, &jumpHop{
+			index:      index,
+			name:       strings.TrimSpace(jump.Name),
+			address:    net.JoinHostPort(host, strconv.Itoa(port)),
+			user:       user,
+			chain:      chain,
+			verifier:   verifier,
+			algorithms: algorithms,
+		})
+	}
+	return hops, nil
+}
+
+// dialSSHThrough 建立一跳SSH连接：prev 为空时直接拨号（配置了传输代理或封装时经 transport 拨号），否则通过上一跳的 direct-tcpip 通道握手
+func dialSSHThrough(prev *ssh.Client, transport *sshTransport, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case prev != nil:
+		conn, err = prev.Dial("tcp", address)
+	case transport != nil:
+		conn, err = transport.dial(address, clientConfig.Timeout)
+	default:
+		return ssh.Dial("tcp", address, clientConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialJumpChain 依次连接所有跳板机（第一跳经 transport），返回最后一跳的客户端及已打开的客户端列表（用于关闭）
+func (t *Tunnel) dialJumpChain(hops []*jumpHop, transport *sshTransport, timeout time.Duration) (*ssh.Client, []*ssh.Client, error) {
+	var prev *ssh.Client
+	opened := make([]*ssh.Client, 0, len(hops))
+	for _, hop := range hops {
+		hop.chain.resetAttempt()
+		client, err := dialSSHThrough(prev, transport, hop.address, applyAlgorithms(&ssh.ClientConfig{
+			User:            hop.user,
+			Auth:            hop.chain.authMethods(),
+			HostKeyCallback: t.hostKeyCallback(hop.verifier, hop.index),
+			Timeout:         timeout,
+		}, hop.algorithms))
+		if err != nil {
+			closeSSHClients(opened)
+			return nil, nil, &HopError{Hop: hop.index, Name: hop.label(), Address: hop.address, Err: err}
+		}
+		log.Printf("已连接跳板机 #%d %s，认证方式: %s", hop.index, hop.label(), hop.chain.lastMethod())
+		opened = append(opened, client)
+		prev = client
+	}
+	return prev, opened, nil
+}
+
+func closeSSHClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// closeJumpsWhenDone 目标连接关闭后按相反顺序关闭跳板机连接
+func closeJumpsWhenDone(target *ssh.Client, jumps []*ssh.Client) {
+	if len(jumps) == 0 {
+		return
+	}
+	safe.GO(func() {
+		target.Wait()
+		closeSSHClients(jumps)
+	})
+}
+
+// failedHop 返回错误对应的跳数描述，没有跳板机信息时返回空字符串
+func failedHop(err error) string {
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		return "transport proxy " + proxyErr.Proxy
+	}
+	var wrapErr *TransportWrapError
+	if errors.As(err, &wrapErr) {
+		return "transport " + wrapErr.Type + " " + wrapErr.Address
+	}
+	var hopErr *HopError
+	if !errors.As(err, &hopErr) {
+		return ""
+	}
+	if hopErr.Hop == 0 {
+		return "target " + hopErr.Address
+	}
+	return fmt.Sprintf("jump host #%d %s", hopErr.Hop, hopErr.Label())
+}
@@ -0,0 +1,100 @@
+package tunnel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func passwordServerConfig(password string) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != password {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+}
+
+func newJumpTestTunnel(targetAddr string, targetPassword string, hops ...*jumpHop) *Tunnel {
+	tunnel := newTestTunnel()
+	tunnel.serverAddress = targetAddr
+	tunnel.user = "target"
+	tunnel.hostKeys = ssh.InsecureIgnoreHostKey()
+	chain := &authChain{methods: []string{AuthMethodPassword}, password: targetPassword}
+	tunnel.authChain = chain
+	tunnel.auth = chain.authMethods()
+	tunnel.jumpHops = hops
+	return tunnel
+}
+
+func newTestJumpHop(index int, address string, password string) *jumpHop {
+	return &jumpHop{
+		index:    index,
+		name:     "bastion" + string(rune('0'+index)),
+		address:  address,
+		user:     "jump",
+		chain:    &authChain{methods: []string{AuthMethodPassword}, password: password},
+		verifier: &hostKeyVerifier{policy: HostKeyPolicyInsecure},
+	}
+}
+
+func TestDialThroughJumpHosts(t *testing.T) {
+	targetConfig := passwordServerConfig("target-pass")
+	var targetUser string
+	targetCallback := targetConfig.PasswordCallback
+	targetConfig.PasswordCallback = func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+		targetUser = conn.User()
+		return targetCallback(conn, pass)
+	}
+	targetAddr := startTestSSHServer(t, targetConfig, nil)
+	secondAddr := startTestSSHServer(t, passwordServerConfig("jump2-pass"), forwardDirectTCPIP)
+	firstAddr := startTestSSHServer(t, passwordServerConfig("jump1-pass"), forwardDirectTCPIP)
+
+	tunnel := newJumpTestTunnel(targetAddr, "target-pass",
+		newTestJumpHop(1, firstAddr, "jump1-pass"),
+		newTestJumpHop(2, secondAddr, "jump2-pass"))
+
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial through jump hosts: %v", err)
+	}
+	defer client.Close()
+	if targetUser != "target" {
+		t.Fatalf("expected target server to authenticate the final hop, got user %q", targetUser)
+	}
+	if got := tunnel.SnapshotSSHConnectionStats().AuthMethodUsed; got != AuthMethodPassword {
+		t.Fatalf("unexpected auth method %q", got)
+	}
+}
+
+func TestJumpHostFailureIsAttributedToHop(t *testing.T) {
+	targetAddr := startTestSSHServer(t, passwordServerConfig("target-pass"), nil)
+	secondAddr := startTestSSHServer(t, passwordServerConfig("jump2-pass"), forwardDirectTCPIP)
+	firstAddr := startTestSSHServer(t, passwordServerConfig("jump1-pass"), forwardDirectTCPIP)
+
+	tunnel := newJumpTestTunnel(targetAddr, "target-pass",
+		newTestJumpHop(1, firstAddr, "jump1-pass"),
+		newTestJumpHop(2, secondAddr, "wrong"))
+	_, err := tunnel.dialSSH()
+	var hopErr *HopError
+	if !errors.As(err, &hopErr) || hopErr.Hop != 2 {
+		t.Fatalf("expected failure at jump host #2, got %v", err)
+	}
+	tunnel.recordReconnectFailure(err)
+	if got := tunnel.SnapshotSSHConnectionStats().LastFailedHop; !strings.HasPrefix(got, "jump host #2") {
+		t.Fatalf("unexpected failed hop %q", got)
+	}
+
+	tunnel = newJumpTestTunnel(targetAddr, "wrong", newTestJumpHop(1, firstAddr, "jump1-pass"))
+	_, err = tunnel.dialSSH()
+	if !errors.As(err, &hopErr) || hopErr.Hop != 0 {
+		t.Fatalf("expected failure at target, got %v", err)
+	}
+	if !strings.HasPrefix(failedHop(err), "target ") {
+		t.Fatalf("unexpected failed hop %q", failedHop(err))
+	}
+}
@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"ssh-tunnel/safe"
+)
+
+// peekedConn 已预读首字节的连接，读取时先返回缓冲中的数据
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (t *Tunnel) bindMixedTunnel(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("bindMixedTunnel panic recovered: %v", err)
+		}
+	}()
+
+	t.serveTCPProxy(ctx, t.mixedLocalAddress, "MIXED", func(conn net.Conn) {
+		t.handleMixedConn(ctx, conn)
+	})
+}
+
+// handleMixedConn 按首字节分发混合端口上的连接：0x04/0x05 为SOCKS4/SOCKS5，其余按HTTP代理处理
+func (t *Tunnel) handleMixedConn(ctx context.Context, conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(t.proxyHandshakeTimeout()))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	peeked := &peekedConn{Conn: conn, reader: reader}
+	switch first[0] {
+	case 0x04, 0x05:
+		t.handleSocksConn(ctx, peeked)
+	default:
+		t.handleClientRequest(ctx, peeked)
+	}
+}
+
+// handleSocksConn 处理一个SOCKS连接，SSH连接失效时在后台触发重连
+func (t *Tunnel) handleSocksConn(ctx context.Context, conn net.Conn) {
+	resolveErr := t.socks5Proxy(ctx, conn)
+	if resolveErr != nil && errors.Is(resolveErr, SSHReconnectRequired) {
+		t.needReBind = true
+		safe.GO(func() {
+			t.ReconnectSSHWithSource(ctx, "socks5-proxy")
+		})
+	}
+}
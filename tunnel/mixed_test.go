@@ -0,0 +1,68 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMixedListenerDispatchesByFirstByte(t *testing.T) {
+	target := startTestEchoServer(t)
+	targetAddr, _ := net.ResolveTCPAddr("tcp", target)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	tunnel.enableHttpOverSSH = true
+	tunnel.mixedLocalAddress = freeLocalAddress(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tunnel.bindMixedTunnel(ctx)
+
+	expectEcho := func(conn net.Conn, reader io.Reader) {
+		t.Helper()
+		conn.Write([]byte("ping"))
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("unexpected echo %q: %v", buf, err)
+		}
+	}
+
+	socks5 := dialWithRetry(t, tunnel.mixedLocalAddress)
+	defer socks5.Close()
+	if method, _, rep := socks5Connect(t, socks5, []byte{socks5MethodNoAuth}, "", "", target); method != socks5MethodNoAuth || rep != 0x00 {
+		t.Fatalf("unexpected socks5 handshake method=%d rep=%d", method, rep)
+	}
+	expectEcho(socks5, socks5)
+
+	socks4 := dialWithRetry(t, tunnel.mixedLocalAddress)
+	defer socks4.Close()
+	if code := socks4Connect(t, socks4, targetAddr.IP, targetAddr.Port, ""); code != socks4ReplyGranted {
+		t.Fatalf("unexpected socks4 reply %x", code)
+	}
+	expectEcho(socks4, socks4)
+
+	httpConn := dialWithRetry(t, tunnel.mixedLocalAddress)
+	defer httpConn.Close()
+	httpConn.SetDeadline(time.Now().Add(3 * time.Second))
+	fmt.Fprintf(httpConn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	reader := bufio.NewReader(httpConn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected CONNECT response %v: %v", resp, err)
+	}
+	expectEcho(httpConn, reader)
+
+	protocols := map[string]bool{}
+	for _, req := range tunnel.GetRequestTracker().Snapshot() {
+		protocols[req.Protocol] = true
+	}
+	if !protocols["SOCKS5"] || !protocols["SOCKS4"] || !protocols["HTTPS"] {
+		t.Fatalf("expected SOCKS5, SOCKS4 and HTTPS requests, got %v", protocols)
+	}
+}
@@ -0,0 +1,216 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ssh-tunnel/safe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	channelProbeHistorySize         = 60
+	defaultChannelProbeInterval     = 30 * time.Second
+	defaultChannelProbeTimeout      = 5 * time.Second
+	defaultChannelProbeFailureLimit = 3
+)
+
+// ChannelProbeSample 一次 direct-tcpip 通道探测的结果
+type ChannelProbeSample struct {
+	At        time.Time `json:"at"`
+	Success   bool      `json:"success"`
+	LatencyMs int64     `json:"latencyMs"`
+	Rejected  bool      `json:"rejected,omitempty"` // 服务器拒绝打开通道（如目标端口未监听），通道层仍可用，不计入失败
+	Error     string    `json:"error,omitempty"`
+}
+
+// ChannelProbeStats 通道健康探测的配置与最近的探测历史
+type ChannelProbeStats struct {
+	Enabled             bool                 `json:"enabled"`
+	Target              string               `json:"target,omitempty"`
+	IntervalSec         int                  `json:"intervalSec"`
+	FailureThreshold    int                  `json:"failureThreshold"`
+	ConsecutiveFailures int                  `json:"consecutiveFailures"`
+	TotalProbes         uint64               `json:"totalProbes"`
+	TotalFailures       uint64               `json:"totalFailures"`
+	TotalRejected       uint64               `json:"totalRejected"`
+	Invalidations       uint64               `json:"invalidations"`
+	History             []ChannelProbeSample `json:"history"`
+}
+
+// channelProbeConfig 通道探测配置，由 RefreshRuntimeConfigFromAppConfig 写入，新连接建立时生效
+type channelProbeConfig struct {
+	enabled          bool
+	target           string
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+}
+
+type channelProbeState struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	totalProbes         uint64
+	totalFailures       uint64
+	totalRejected       uint64
+	invalidations       uint64
+	history             []ChannelProbeSample
+}
+
+func (s *channelProbeState) record(sample ChannelProbeSample) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.totalProbes++
+	switch {
+	case sample.Success:
+		s.consecutiveFailures = 0
+	case sample.Rejected:
+		s.totalRejected++
+		s.consecutiveFailures = 0
+	default:
+		s.totalFailures++
+		s.consecutiveFailures++
+	}
+	s.history = append(s.history, sample)
+	if len(s.history) > channelProbeHistorySize {
+		s.history = append([]ChannelProbeSample(nil), s.history[len(s.history)-channelProbeHistorySize:]...)
+	}
+	return s.consecutiveFailures
+}
+
+// probeChannel 通过SSH连接打开一个到 target 的 direct-tcpip 通道，返回打开通道所用的时间
+func probeChannel(client *ssh.Client, target string, timeout time.Duration) (time.Duration, error) {
+	type result struct {
+		closeFn func() error
+		err     error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	safe.GO(func() {
+		conn, err := client.Dial("tcp", target)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{closeFn: conn.Close}
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			var openErr *ssh.OpenChannelError
+			if errors.As(r.err, &openErr) {
+				// 服务器已应答通道请求，往返时间同样反映通道层延迟
+				return time.Since(start), r.err
+			}
+			return 0, r.err
+		}
+		r.closeFn()
+		return time.Since(start), nil
+	case <-timer.C:
+		// 通道打开卡住时不再等待，之后若打开成功立即关闭
+		safe.GO(func() {
+			if r := <-done; r.closeFn != nil {
+				r.closeFn()
+			}
+		})
+		return 0, fmt.Errorf("open direct-tcpip channel to %s timed out after %s", target, timeout)
+	}
+}
+
+// startChannelProbe 启用通道探测时，定期经当前SSH连接打开 direct-tcpip 通道；
+// 连续失败达到阈值后作废该连接并重新连接（服务器仍响应 keepalive 但通道无法打开的情况）
+func (t *Tunnel) startChannelProbe(ctx context.Context, client *ssh.Client) {
+	config := t.channelProbe
+	if !config.enabled || config.target == "" || client == nil {
+		return
+	}
+	interval := config.interval
+	if interval <= 0 {
+		interval = defaultChannelProbeInterval
+	}
+	timeout := config.timeout
+	if timeout <= 0 {
+		timeout = defaultChannelProbeTimeout
+	}
+	threshold := config.failureThreshold
+	if threshold <= 0 {
+		threshold = defaultChannelProbeFailureLimit
+	}
+
+	safe.GO(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if t.currentSSHClient() != client {
+				return
+			}
+
+			latency, err := probeChannel(client, config.target, timeout)
+			sample := ChannelProbeSample{At: time.Now(), Success: err == nil, LatencyMs: latency.Milliseconds()}
+			var openErr *ssh.OpenChannelError
+			if err != nil {
+				sample.Error = err.Error()
+				sample.Rejected = errors.As(err, &openErr)
+			}
+			failures := t.channelProbeState.record(sample)
+			if err == nil {
+				continue
+			}
+			if sample.Rejected {
+				// 只有超时与传输错误说明通道层异常；目标拒绝连接不应触发重连
+				log.Printf("SSH通道健康探测目标拒绝连接: %v", err)
+				continue
+			}
+			log.Printf("SSH通道健康探测失败(%d/%d): %v", failures, threshold, err)
+			if failures < threshold {
+				continue
+			}
+
+			if !t.invalidateSSHClientIfMatch(client, fmt.Sprintf("channel probe failed %d times", failures)) {
+				return
+			}
+			t.channelProbeState.mu.Lock()
+			t.channelProbeState.invalidations++
+			t.channelProbeState.consecutiveFailures = 0
+			t.channelProbeState.mu.Unlock()
+			log.Printf("SSH通道健康探测连续失败，准备重新连接")
+			safe.GO(func() {
+				t.ReconnectSSHWithSource(ctx, "channel-probe")
+			})
+			return
+		}
+	})
+}
+
+// SnapshotChannelProbeStats 返回通道健康探测的配置与最近 60 次探测记录
+func (t *Tunnel) SnapshotChannelProbeStats() ChannelProbeStats {
+	config := t.channelProbe
+	s := &t.channelProbeState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ChannelProbeStats{
+		Enabled:             config.enabled,
+		Target:              config.target,
+		IntervalSec:         int(config.interval / time.Second),
+		FailureThreshold:    config.failureThreshold,
+		ConsecutiveFailures: s.consecutiveFailures,
+		TotalProbes:         s.totalProbes,
+		TotalFailures:       s.totalFailures,
+		TotalRejected:       s.totalRejected,
+		Invalidations:       s.invalidations,
+		History:             append([]ChannelProbeSample{}, s.history...),
+	}
+}
@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestChannelProbeInvalidatesStuckConnection(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// 第一个连接的 direct-tcpip 通道永远不应答（keepalive 仍正常），之后的连接正常转发
+	var mu sync.Mutex
+	var stuckSession string
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), func(conn *ssh.ServerConn, newChannel ssh.NewChannel) {
+		mu.Lock()
+		if stuckSession == "" {
+			stuckSession = string(conn.SessionID())
+		}
+		stuck := stuckSession == string(conn.SessionID())
+		mu.Unlock()
+		if stuck {
+			return
+		}
+		forwardDirectTCPIP(conn, newChannel)
+	})
+
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.channelProbe = channelProbeConfig{
+		enabled:          true,
+		target:           target.Addr().String(),
+		interval:         50 * time.Millisecond,
+		timeout:          100 * time.Millisecond,
+		failureThreshold: 2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	first := tunnel.PeekSSHClient()
+	if first == nil {
+		t.Fatal("expected ssh client")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stats := tunnel.SnapshotChannelProbeStats()
+		current := tunnel.PeekSSHClient()
+		if current != nil && current != first && stats.Invalidations == 1 && stats.ConsecutiveFailures == 0 && lastProbeSucceeded(stats) {
+			if stats.TotalFailures < 2 {
+				t.Fatalf("expected at least 2 failed probes, got %+v", stats)
+			}
+			if len(stats.History) == 0 || stats.History[0].Success || stats.History[0].Error == "" {
+				t.Fatalf("expected failed probe in history, got %+v", stats.History)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected channel probe to replace the stuck connection, stats: %+v", tunnel.SnapshotChannelProbeStats())
+}
+
+func TestChannelProbeIgnoresRejectedChannel(t *testing.T) {
+	// 探测目标端口未监听：服务器以 OpenChannelError 拒绝通道，连接本身仍然健康
+	target := freeLocalAddress(t)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.channelProbe = channelProbeConfig{
+		enabled:          true,
+		target:           target,
+		interval:         20 * time.Millisecond,
+		timeout:          time.Second,
+		failureThreshold: 2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	first := tunnel.PeekSSHClient()
+	if first == nil {
+		t.Fatal("expected ssh client")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats := tunnel.SnapshotChannelProbeStats(); stats.TotalRejected >= 5 {
+			if stats.Invalidations != 0 || stats.TotalFailures != 0 || stats.ConsecutiveFailures != 0 {
+				t.Fatalf("expected rejected probes not to count as failures, got %+v", stats)
+			}
+			if sample := stats.History[0]; sample.Success || !sample.Rejected || sample.Error == "" {
+				t.Fatalf("expected rejected probe in history, got %+v", sample)
+			}
+			if tunnel.PeekSSHClient() != first {
+				t.Fatal("expected ssh client to be kept")
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected rejected probes to be recorded, stats: %+v", tunnel.SnapshotChannelProbeStats())
+}
+
+func lastProbeSucceeded(stats ChannelProbeStats) bool {
+	return len(stats.History) > 0 && stats.History[len(stats.History)-1].Success
+}
+
+func TestChannelProbeHistoryIsBounded(t *testing.T) {
+	var state channelProbeState
+	for i := 0; i < channelProbeHistorySize+10; i++ {
+		state.record(ChannelProbeSample{Success: i%2 == 0, LatencyMs: int64(i)})
+	}
+	if len(state.history) != channelProbeHistorySize {
+		t.Fatalf("expected history to be capped at %d, got %d", channelProbeHistorySize, len(state.history))
+	}
+	if state.history[0].LatencyMs != 10 || state.totalProbes != channelProbeHistorySize+10 {
+		t.Fatalf("unexpected history state: first=%d total=%d", state.history[0].LatencyMs, state.totalProbes)
+	}
+}
@@ -0,0 +1,393 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authFailurePruneThreshold 失败记录超过该数量时清理已过期的记录
+const authFailurePruneThreshold = 1024
+
+// proxyUserStore 代理多用户表：用户名到 htpasswd 密码哈希的映射，由用户文件加载并热更新
+type proxyUserStore struct {
+	mu       sync.RWMutex
+	filePath string
+	users    map[string]string
+	watch    restartableWatch
+}
+
+// setFilePath 切换用户文件，文件变化时清空已加载的用户并返回 true
+func (s *proxyUserStore) setFilePath(filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filePath == filePath {
+		return false
+	}
+	s.users = nil
+	s.filePath = filePath
+	return true
+}
+
+func (s *proxyUserStore) path() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filePath
+}
+
+func (s *proxyUserStore) setUsers(users map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = users
+}
+
+// verify 校验用户名密码，用户不存在时仍做一次哈希比较以避免通过耗时判断用户是否存在
+func (s *proxyUserStore) verify(user, password string) bool {
+	s.mu.RLock()
+	hash, ok := s.users[user]
+	s.mu.RUnlock()
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyProxyUserHash, []byte(password))
+		return false
+	}
+	return verifyHtpasswdPassword(hash, password)
+}
+
+func (s *proxyUserStore) names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.users))
+	for name := range s.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dummyProxyUserHash 用于用户不存在时的占位比较
+var dummyProxyUserHash, _ = bcrypt.GenerateFromPassword([]byte("ssh-tunnel"), bcrypt.MinCost)
+
+// parseHtpasswd 解析 htpasswd 格式内容（每行 user:hash，# 开头为注释），跳过不支持的哈希格式
+func parseHtpasswd(data []byte) map[string]string {
+	users := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		user = strings.TrimSpace(user)
+		hash = strings.TrimSpace(hash)
+		if !ok || user == "" || hash == "" {
+			log.Printf("用户文件第%d行格式错误，已跳过", i+1)
+			continue
+		}
+		if !isSupportedHtpasswdHash(hash) {
+			log.Printf("用户文件第%d行(%s)的密码哈希格式不受支持，仅支持bcrypt与{SHA}，已跳过", i+1, user)
+			continue
+		}
+		users[user] = hash
+	}
+	return users
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func isSupportedHtpasswdHash(hash string) bool {
+	return isBcryptHash(hash) || strings.HasPrefix(hash, "{SHA}")
+}
+
+// verifyHtpasswdPassword 按哈希格式校验密码：bcrypt($2a$/$2b$/$2y$) 或 {SHA}（base64编码的SHA-1）
+func verifyHtpasswdPassword(hash, password string) bool {
+	switch {
+	case isBcryptHash(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(hash, "{SHA}")), []byte(expected)) == 1
+	}
+	return false
+}
+
+// loadProxyUsersFile 读取用户文件，文件不存在时视为空用户表
+func loadProxyUsersFile(filePath string) (map[string]string, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseHtpasswd(data), nil
+}
+
+// writeProxyUsersFile 按用户名排序写入用户文件，先写临时文件再替换，避免监听方读到半个文件
+func writeProxyUsersFile(filePath string, users map[string]string) error {
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name + ":" + users[name] + "\n")
+	}
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".htpasswd-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(builder.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// proxyUsersFileWatcher 加载用户文件并监听其变化，文件修改后自动重新加载，删除后清空用户
+func proxyUsersFileWatcher(ctx context.Context, filePath string, tunnel *Tunnel) error {
+	// 切换用户文件后，旧文件的监听在退出前不再修改用户表
+	current := func() bool { return tunnel.proxyUsers.path() == filePath }
+	return watchFile(ctx, filePath, func() {
+		if !current() {
+			return
+		}
+		users, err := loadProxyUsersFile(filePath)
+		if err != nil {
+			log.Printf("读取代理用户文件失败: %v", err)
+			return
+		}
+		tunnel.proxyUsers.setUsers(users)
+		log.Printf("代理用户文件已加载: %s, 用户数: %d", filePath, len(users))
+	}, func() {
+		if !current() {
+			return
+		}
+		tunnel.proxyUsers.setUsers(make(map[string]string))
+		log.Printf("代理用户文件已删除，已清空用户: %s", filePath)
+	})
+}
+
+// startProxyUsersWatcher 配置了用户文件时在后台加载并监听，运行时修改用户文件路径后监听随之切换
+func (t *Tunnel) startProxyUsersWatcher(ctx context.Context) {
+	t.proxyUsers.watch.bind(ctx)
+	t.restartProxyUsersWatcher()
+}
+
+// setProxyUsersFile 切换代理用户文件，路径变化时清空旧用户并监听新文件
+func (t *Tunnel) setProxyUsersFile(filePath string) {
+	if t.proxyUsers.setFilePath(filePath) {
+		t.restartProxyUsersWatcher()
+	}
+}
+
+func (t *Tunnel) restartProxyUsersWatcher() {
+	filePath := t.proxyUsers.path()
+	if filePath == "" {
+		t.proxyUsers.watch.restart(nil)
+		return
+	}
+	t.proxyUsers.watch.restart(func(ctx context.Context) {
+		if err := proxyUsersFileWatcher(ctx, filePath, t); err != nil {
+			log.Printf("代理用户文件监听失败: %v", err)
+		}
+	})
+}
+
+// authenticateProxyUser 校验代理用户：用户文件中的用户与配置的HTTP基本认证用户均可通过
+func (t *Tunnel) authenticateProxyUser(user, password string) bool {
+	if t.proxyUsers.path() != "" && t.proxyUsers.verify(user, password) {
+		return true
+	}
+	if t.httpBasicUserName == "" {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(t.httpBasicUserName)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(t.httpBasicPassword)) == 1
+	return userOK && passwordOK
+}
+
+// ProxyUsers 返回用户文件中的用户名列表与文件路径
+func (t *Tunnel) ProxyUsers() ([]string, string) {
+	return t.proxyUsers.names(), t.proxyUsers.path()
+}
+
+// UpsertProxyUser 新增或修改代理用户，密码以bcrypt哈希写入用户文件
+func (t *Tunnel) UpsertProxyUser(user, password string) error {
+	if err := validateProxyUserName(user); err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("密码不能为空")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return t.updateProxyUsersFile(func(users map[string]string) error {
+		users[user] = string(hash)
+		return nil
+	})
+}
+
+// DeleteProxyUser 从用户文件删除代理用户
+func (t *Tunnel) DeleteProxyUser(user string) error {
+	return t.updateProxyUsersFile(func(users map[string]string) error {
+		if _, ok := users[user]; !ok {
+			return fmt.Errorf("用户不存在: %s", user)
+		}
+		delete(users, user)
+		return nil
+	})
+}
+
+// updateProxyUsersFile 以磁盘上的用户文件为准修改后写回，并立即更新内存中的用户表
+func (t *Tunnel) updateProxyUsersFile(update func(users map[string]string) error) error {
+	filePath := t.proxyUsers.path()
+	if filePath == "" {
+		return errors.New("未配置代理用户文件(http.auth.users.file)")
+	}
+	t.proxyUsersWriteMu.Lock()
+	defer t.proxyUsersWriteMu.Unlock()
+
+	users, err := loadProxyUsersFile(filePath)
+	if err != nil {
+		return err
+	}
+	if err := update(users); err != nil {
+		return err
+	}
+	if err := writeProxyUsersFile(filePath, users); err != nil {
+		return err
+	}
+	t.proxyUsers.setUsers(users)
+	return nil
+}
+
+func validateProxyUserName(user string) error {
+	if user == "" {
+		return errors.New("用户名不能为空")
+	}
+	if strings.ContainsAny(user, ":\r\n#") || strings.TrimSpace(user) != user {
+		return errors.New("用户名不能包含冒号、#、换行或首尾空白")
+	}
+	return nil
+}
+
+// authFailureLimiter 按客户端IP统计连续认证失败次数，达到上限后在封禁时长内直接拒绝该IP
+type authFailureLimiter struct {
+	mu            sync.Mutex
+	maxFailures   int
+	blockDuration time.Duration
+	records       map[string]*authFailureRecord
+}
+
+type authFailureRecord struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+func (l *authFailureLimiter) configure(maxFailures int, blockDuration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxFailures = maxFailures
+	l.blockDuration = blockDuration
+}
+
+// blocked 返回客户端IP当前是否处于封禁期
+func (l *authFailureLimiter) blocked(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxFailures <= 0 {
+		return false
+	}
+	record, ok := l.records[ip]
+	return ok && time.Now().Before(record.blockedUntil)
+}
+
+// recordFailure 记录一次认证失败，达到上限时开始封禁并返回 true
+func (l *authFailureLimiter) recordFailure(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxFailures <= 0 {
+		return false
+	}
+	now := time.Now()
+	if l.records == nil {
+		l.records = make(map[string]*authFailureRecord)
+	}
+	if len(l.records) >= authFailurePruneThreshold {
+		l.pruneLocked(now)
+	}
+	record, ok := l.records[ip]
+	if !ok {
+		record = &authFailureRecord{}
+		l.records[ip] = record
+	}
+	// 距上次失败超过封禁时长的旧失败不再累计
+	if now.Sub(record.lastFailure) > l.blockDuration {
+		record.failures = 0
+	}
+	record.failures++
+	record.lastFailure = now
+	if record.failures < l.maxFailures {
+		return false
+	}
+	record.failures = 0
+	record.blockedUntil = now.Add(l.blockDuration)
+	log.Printf("客户端 %s 连续认证失败%d次，封禁 %s", ip, l.maxFailures, l.blockDuration)
+	return true
+}
+
+// recordSuccess 认证成功后清除该IP的失败记录
+func (l *authFailureLimiter) recordSuccess(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.records, ip)
+}
+
+func (l *authFailureLimiter) pruneLocked(now time.Time) {
+	for ip, record := range l.records {
+		if now.After(record.blockedUntil) && now.Sub(record.lastFailure) > l.blockDuration {
+			delete(l.records, ip)
+		}
+	}
+}
+
+// clientIP 返回连接对端的IP，用于认证失败限流
+func clientIP(conn net.Conn) string {
+	addr := safeSSHAddrString(conn.RemoteAddr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
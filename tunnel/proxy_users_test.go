@@ -0,0 +1,191 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func basicProxyAuthorization(user, password string) string {
+	return "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)) + "\r\n"
+}
+
+func TestParseHtpasswdSupportsBcryptAndSHA(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-pw"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// htpasswd -B 生成的是 $2y$ 前缀
+	bcryptY := "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+	sum := sha1.Sum([]byte("bob-pw"))
+	content := fmt.Sprintf("# comment\nalice:%s\n\nbob:{SHA}%s\ncarol:$apr1$abc$def\nbroken\n",
+		bcryptY, base64.StdEncoding.EncodeToString(sum[:]))
+
+	users := parseHtpasswd([]byte(content))
+	if len(users) != 2 {
+		t.Fatalf("expected only supported entries, got %v", users)
+	}
+	if !verifyHtpasswdPassword(users["alice"], "alice-pw") || verifyHtpasswdPassword(users["alice"], "wrong") {
+		t.Fatal("unexpected bcrypt verification result")
+	}
+	if !verifyHtpasswdPassword(users["bob"], "bob-pw") || verifyHtpasswdPassword(users["bob"], "wrong") {
+		t.Fatal("unexpected {SHA} verification result")
+	}
+}
+
+func TestProxyUsersFileHotReloadAndAdminUpdates(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "htpasswd")
+	tunnel := newTestTunnel()
+	tunnel.proxyUsers.setFilePath(filePath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go proxyUsersFileWatcher(ctx, filePath, tunnel)
+
+	waitFor := func(user, password string, expected bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for tunnel.authenticateProxyUser(user, password) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("user %s: expected authenticated=%v", user, expected)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	sum := sha1.Sum([]byte("pw1"))
+	if err := os.WriteFile(filePath, []byte("alice:{SHA}"+base64.StdEncoding.EncodeToString(sum[:])+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("alice", "pw1", true)
+
+	if err := tunnel.UpsertProxyUser("bob", "pw2"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("bob", "pw2", true)
+	data, _ := os.ReadFile(filePath)
+	if strings.Contains(string(data), "pw2") || !strings.Contains(string(data), "bob:$2a$") {
+		t.Fatalf("expected bcrypt hash to be persisted, got %q", data)
+	}
+	if users, _ := tunnel.ProxyUsers(); strings.Join(users, ",") != "alice,bob" {
+		t.Fatalf("unexpected users %v", users)
+	}
+
+	if err := tunnel.DeleteProxyUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("alice", "pw1", false)
+	if err := tunnel.DeleteProxyUser("alice"); err == nil {
+		t.Fatal("expected deleting a missing user to fail")
+	}
+	if err := tunnel.UpsertProxyUser("bad:name", "pw"); err == nil {
+		t.Fatal("expected invalid user name to be rejected")
+	}
+
+	os.Remove(filePath)
+	waitFor("bob", "pw2", false)
+}
+
+func TestProxyUsersFileSwitchRestartsWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeUser := func(name, user, password string) string {
+		sum := sha1.Sum([]byte(password))
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte(user+":{SHA}"+base64.StdEncoding.EncodeToString(sum[:])+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filePath
+	}
+	first := writeUser("first", "alice", "pw1")
+	second := writeUser("second", "bob", "pw2")
+
+	tunnel := newTestTunnel()
+	tunnel.setProxyUsersFile(first)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tunnel.startProxyUsersWatcher(ctx)
+
+	waitFor := func(user, password string, expected bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for tunnel.authenticateProxyUser(user, password) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("user %s: expected authenticated=%v", user, expected)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitFor("alice", "pw1", true)
+
+	// 运行时切换用户文件：新文件被加载并监听，旧文件的改动不再生效
+	tunnel.setProxyUsersFile(second)
+	waitFor("bob", "pw2", true)
+	waitFor("alice", "pw1", false)
+	writeUser("first", "carol", "pw3")
+	writeUser("second", "dave", "pw4")
+	waitFor("dave", "pw4", true)
+	if tunnel.authenticateProxyUser("carol", "pw3") {
+		t.Fatal("expected the previous users file to be ignored")
+	}
+}
+
+func TestHTTPProxyUsersFileTracksUserAndRateLimitsFailures(t *testing.T) {
+	origin := startTestOrigin(t, "a")
+	tunnel := newHTTPProxyTestTunnel(t)
+	tunnel.enableHttpBasic = true
+	tunnel.proxyUsers.setFilePath(filepath.Join(t.TempDir(), "htpasswd"))
+	tunnel.authLimiter.configure(2, time.Minute)
+	if err := tunnel.UpsertProxyUser("alice", "secret-pw"); err != nil {
+		t.Fatal(err)
+	}
+	proxy := startTestHTTPProxy(t, tunnel)
+
+	request := func(auth string) int {
+		t.Helper()
+		conn, err := net.Dial("tcp", proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n%s\r\n", origin, origin, auth)
+		resp, _ := readProxyResponse(t, bufio.NewReader(conn))
+		return resp.StatusCode
+	}
+
+	if status := request(basicProxyAuthorization("alice", "secret-pw")); status != http.StatusOK {
+		t.Fatalf("expected users file credentials to be accepted, got %d", status)
+	}
+	snapshot := tunnel.GetRequestTracker().Snapshot()
+	if len(snapshot) != 1 || snapshot[0].User != "alice" {
+		t.Fatalf("expected request to be attributed to alice, got %+v", snapshot)
+	}
+
+	// 未携带凭据的请求不计入失败次数
+	for i := 0; i < 3; i++ {
+		if status := request(""); status != http.StatusProxyAuthRequired {
+			t.Fatalf("expected 407 without credentials, got %d", status)
+		}
+	}
+	if status := request(basicProxyAuthorization("alice", "wrong")); status != http.StatusProxyAuthRequired {
+		t.Fatalf("expected 407 on first failure, got %d", status)
+	}
+	if status := request(basicProxyAuthorization("alice", "wrong")); status != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the failure limit is reached, got %d", status)
+	}
+	// 封禁期内正确的凭据同样被拒绝
+	if status := request(basicProxyAuthorization("alice", "secret-pw")); status != http.StatusTooManyRequests {
+		t.Fatalf("expected blocked client to be rejected, got %d", status)
+	}
+}
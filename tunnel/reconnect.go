@@ -2,6 +2,7 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"ssh-tunnel/safe"
@@ -61,10 +62,21 @@ func (t *Tunnel) ReconnectSSHWithSource(ctx context.Context, source string) {
 		if err == nil {
 			t.setSSHClient(cl, source)
 			t.startKeepAlive(reconnectCtx, cl)
+			t.startChannelProbe(reconnectCtx, cl)
+			t.startRemoteForwards(reconnectCtx, cl)
 			return
 		}
 
 		t.recordReconnectFailure(err)
+		var mismatch *HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			log.Printf("SSH主机公钥不匹配，停止重试(source=%s): %v", source, err)
+			return
+		}
+		if isAuthChallengeAborted(err) {
+			log.Printf("SSH键盘交互认证未获应答，停止重试(source=%s): %v", source, err)
+			return
+		}
 		if attempt == maxRetries {
 			log.Printf("SSH重连失败，已达到最大重试次数(source=%s, attempts=%d): %v", source, attempt, err)
 			return
@@ -138,6 +150,8 @@ func (t *Tunnel) setSSHClient(cl *ssh.Client, source string) {
 		t.lastReconnectError = ""
 		t.lastReconnectAt = time.Now()
 		t.lastReconnectFailureAt = time.Time{}
+		t.lastHostKeyMismatch = nil
+		t.lastFailedHop = ""
 		t.resetExitIPInfo()
 		if t.sshConnectedOnce {
 			t.reconnectCount++
@@ -192,6 +206,7 @@ func (t *Tunnel) recordReconnectFailure(err error) {
 	t.lastReconnectFailureAt = time.Now()
 	if err != nil {
 		t.lastReconnectError = err.Error()
+		t.lastFailedHop = failedHop(err)
 	}
 }
 
@@ -200,25 +215,61 @@ func (t *Tunnel) dialSSH() (*ssh.Client, error) {
 	if t.sshDialFn != nil {
 		return t.sshDialFn()
 	}
+	return t.dialSSHClient()
+}
 
+func (t *Tunnel) dialSSHClient() (*ssh.Client, error) {
 	timeout := t.sshDialTimeout
 	if timeout <= 0 {
 		timeout = 5 * time.Second
 	}
 
-	cl, err := ssh.Dial("tcp", t.serverAddress, &ssh.ClientConfig{
+	t.authMutex.Lock()
+	auth := t.auth
+	chain := t.authChain
+	hops := t.jumpHops
+	algorithms := t.algorithms
+	hostKeys := t.hostKeys
+	transport := newSSHTransport(t.transportProxy, t.transportWrapper)
+	t.authMutex.Unlock()
+
+	jumpClient, jumps, err := t.dialJumpChain(hops, transport, timeout)
+	if err != nil {
+		log.Printf("SSH连接失败: %v", err)
+		return nil, err
+	}
+
+	if chain != nil {
+		chain.resetAttempt()
+	}
+	cl, err := dialSSHThrough(jumpClient, transport, t.serverAddress, applyAlgorithms(&ssh.ClientConfig{
 		User:            t.user,
-		Auth:            t.auth,
-		HostKeyCallback: t.hostKeys,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
 		Timeout:         timeout,
-	})
+	}, algorithms))
 
 	if err != nil {
+		closeSSHClients(jumps)
+		if len(hops) > 0 {
+			err = &HopError{Address: t.serverAddress, Err: err}
+		}
 		log.Printf("SSH连接失败: %v", err)
 		return nil, err
 	}
+	closeJumpsWhenDone(cl, jumps)
 
 	// 连接成功
+	if chain != nil {
+		method := chain.lastMethod()
+		t.reconnectMutex.Lock()
+		t.authMethodUsed = method
+		t.reconnectMutex.Unlock()
+		log.Printf("SSH认证成功，认证方式: %s", method)
+	}
+	if negotiated := negotiatedAlgorithms(cl); negotiated != nil {
+		log.Printf("SSH协商算法: kex=%s, hostkey=%s, cipher=%s, mac=%s", negotiated.KeyExchange, negotiated.HostKey, negotiated.Write.Cipher, negotiated.Write.MAC)
+	}
 	log.Println("成功重新连接到SSH服务器")
 	return cl, nil
 }
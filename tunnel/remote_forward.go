@@ -0,0 +1,230 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-tunnel/cfg"
+	"ssh-tunnel/safe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteForwardStatus 远程端口转发的配置、服务器上实际监听的地址与统计；统计在重连之间累计
+type RemoteForwardStatus struct {
+	Name          string `json:"name"`
+	RemoteAddress string `json:"remoteAddress"`
+	LocalTarget   string `json:"localTarget"`
+	BoundAddress  string `json:"boundAddress,omitempty"`
+	Listening     bool   `json:"listening"`
+	ActiveConns   int64  `json:"activeConns"`
+	TotalConns    uint64 `json:"totalConns"`
+	FailedConns   uint64 `json:"failedConns"`
+	UploadBytes   uint64 `json:"uploadBytes"`   // 本地服务发往远端
+	DownloadBytes uint64 `json:"downloadBytes"` // 远端发往本地服务
+	LastError     string `json:"lastError,omitempty"`
+}
+
+// remoteForward 单条远程端口转发的运行状态，由 remoteForwardsMutex 保护
+type remoteForward struct {
+	status   RemoteForwardStatus
+	listener net.Listener
+}
+
+// ValidateRemoteForward 校验远程端口转发的名称、服务器监听地址与本地目标地址
+func ValidateRemoteForward(forward cfg.RemoteForward) error {
+	if strings.TrimSpace(forward.Name) == "" {
+		return errors.New("转发名称不能为空")
+	}
+	host, port, err := net.SplitHostPort(forward.RemoteAddress)
+	if n, convErr := strconv.Atoi(port); err != nil || host == "" || convErr != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("远程监听地址无效: %q", forward.RemoteAddress)
+	}
+	if host, port, err := net.SplitHostPort(forward.LocalTarget); err != nil || host == "" || !validPort(port) {
+		return fmt.Errorf("本地目标地址无效: %q", forward.LocalTarget)
+	}
+	return nil
+}
+
+// setRemoteForwardConfigs 更新远程端口转发配置；保留名称与配置均未变化的转发的统计。
+// 被删除或修改的转发立即关闭其在服务器上的监听，新增或修改的转发在当前SSH连接上立即监听
+func (t *Tunnel) setRemoteForwardConfigs(forwards []cfg.RemoteForward) {
+	t.remoteForwardsMutex.Lock()
+	states := make(map[string]*remoteForward, len(forwards))
+	configs := make([]cfg.RemoteForward, 0, len(forwards))
+	var added []cfg.RemoteForward
+	for _, forward := range forwards {
+		if err := ValidateRemoteForward(forward); err != nil {
+			log.Printf("跳过远程端口转发 %s: %v", forward.Name, err)
+			continue
+		}
+		state, ok := t.remoteForwardStates[forward.Name]
+		if !ok || state.status.RemoteAddress != forward.RemoteAddress || state.status.LocalTarget != forward.LocalTarget {
+			state = &remoteForward{status: RemoteForwardStatus{Name: forward.Name, RemoteAddress: forward.RemoteAddress, LocalTarget: forward.LocalTarget}}
+			added = append(added, forward)
+		}
+		states[forward.Name] = state
+		configs = append(configs, forward)
+	}
+	var stale []net.Listener
+	for name, state := range t.remoteForwardStates {
+		if state.listener != nil && states[name] != state {
+			stale = append(stale, state.listener)
+		}
+	}
+	t.remoteForwards = configs
+	t.remoteForwardStates = states
+	t.remoteForwardsMutex.Unlock()
+
+	for _, listener := range stale {
+		_ = listener.Close()
+	}
+	if client := t.PeekSSHClient(); client != nil {
+		ctx := t.reconnectContext(context.Background())
+		for _, forward := range added {
+			t.startRemoteForward(ctx, client, forward)
+		}
+	}
+}
+
+// startRemoteForwards 在新建立的SSH连接上重新请求所有远程端口转发，单条失败不影响其它转发
+func (t *Tunnel) startRemoteForwards(ctx context.Context, client *ssh.Client) {
+	t.remoteForwardsMutex.Lock()
+	forwards := append([]cfg.RemoteForward(nil), t.remoteForwards...)
+	t.remoteForwardsMutex.Unlock()
+
+	for _, forward := range forwards {
+		t.startRemoteForward(ctx, client, forward)
+	}
+}
+
+// startRemoteForward 在服务器上为单条远程端口转发建立监听并开始接受连接
+func (t *Tunnel) startRemoteForward(ctx context.Context, client *ssh.Client, forward cfg.RemoteForward) {
+	listener, err := client.Listen("tcp", forward.RemoteAddress)
+	if err != nil {
+		log.Printf("远程端口转发 %s 在服务器上监听 %s 失败: %v", forward.Name, forward.RemoteAddress, err)
+		t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+			state.listener = nil
+			state.status.Listening = false
+			state.status.BoundAddress = ""
+			state.status.LastError = err.Error()
+		})
+		return
+	}
+
+	bound := listener.Addr().String()
+	current := false
+	t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+		if state.status.RemoteAddress != forward.RemoteAddress || state.status.LocalTarget != forward.LocalTarget {
+			return
+		}
+		current = true
+		state.listener = listener
+		state.status.Listening = true
+		state.status.BoundAddress = bound
+	})
+	if !current {
+		// 监听期间转发已被删除或修改
+		_ = listener.Close()
+		return
+	}
+	log.Printf("远程端口转发 %s 已在服务器 %s 上监听，转发到 %s", forward.Name, bound, forward.LocalTarget)
+
+	safe.GO(func() {
+		t.acceptRemoteForward(ctx, forward, listener)
+	})
+}
+
+func (t *Tunnel) acceptRemoteForward(ctx context.Context, forward cfg.RemoteForward, listener net.Listener) {
+	stop := make(chan struct{})
+	defer close(stop)
+	safe.GO(func() {
+		select {
+		case <-ctx.Done():
+			_ = listener.Close()
+		case <-stop:
+		}
+	})
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// SSH连接断开时监听随之关闭，重连成功后由 startRemoteForwards 重新建立
+			t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+				if state.listener == listener {
+					state.listener = nil
+					state.status.Listening = false
+				}
+			})
+			return
+		}
+		safe.GO(func() {
+			t.handleRemoteForwardConn(forward, conn)
+		})
+	}
+}
+
+// handleRemoteForwardConn 把服务器上接受的连接转发到本地目标
+func (t *Tunnel) handleRemoteForwardConn(forward cfg.RemoteForward, conn net.Conn) {
+	t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+		state.status.TotalConns++
+		state.status.ActiveConns++
+	})
+
+	timeout := t.sshDestTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	local, err := net.DialTimeout("tcp", forward.LocalTarget, timeout)
+	if err != nil {
+		_ = conn.Close()
+		log.Printf("远程端口转发 %s 连接本地 %s 失败: %v", forward.Name, forward.LocalTarget, err)
+		t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+			state.status.ActiveConns--
+			state.status.FailedConns++
+			state.status.LastError = err.Error()
+		})
+		return
+	}
+
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+	downloaded := make(chan int64, 1)
+	safe.GO(func() {
+		downloaded <- t.copyProxyData(local, conn, false)
+	})
+	uploaded := t.copyProxyData(conn, local, true)
+	download := <-downloaded
+	t.updateRemoteForward(forward.Name, func(state *remoteForward) {
+		state.status.ActiveConns--
+		state.status.UploadBytes += uint64(uploaded)
+		state.status.DownloadBytes += uint64(download)
+	})
+}
+
+func (t *Tunnel) updateRemoteForward(name string, update func(state *remoteForward)) {
+	t.remoteForwardsMutex.Lock()
+	defer t.remoteForwardsMutex.Unlock()
+	if state, ok := t.remoteForwardStates[name]; ok {
+		update(state)
+	}
+}
+
+// RemoteForwards 返回远程端口转发的状态与统计，顺序与配置一致
+func (t *Tunnel) RemoteForwards() []RemoteForwardStatus {
+	t.remoteForwardsMutex.Lock()
+	defer t.remoteForwardsMutex.Unlock()
+	result := make([]RemoteForwardStatus, 0, len(t.remoteForwards))
+	for _, forward := range t.remoteForwards {
+		if state, ok := t.remoteForwardStates[forward.Name]; ok {
+			result = append(result, state.status)
+		}
+	}
+	return result
+}
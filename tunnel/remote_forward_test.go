@@ -0,0 +1,227 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"ssh-tunnel/cfg"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// handleTestTCPIPForward 处理 tcpip-forward 全局请求：在本机监听并把接受的连接作为 forwarded-tcpip 通道发回客户端；
+// cancel-tcpip-forward 时关闭对应监听
+func handleTestTCPIPForward(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for req := range reqs {
+		if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		if req.Type == "cancel-tcpip-forward" {
+			address := net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port)))
+			if listener, ok := listeners[address]; ok {
+				listener.Close()
+				delete(listeners, address)
+			}
+			req.Reply(true, nil)
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		listeners[net.JoinHostPort(payload.Addr, strconv.Itoa(int(port)))] = listener
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+		go func() {
+			for {
+				client, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer client.Close()
+					origin := client.RemoteAddr().(*net.TCPAddr)
+					channel, requests, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+						Addr       string
+						Port       uint32
+						OriginAddr string
+						OriginPort uint32
+					}{payload.Addr, port, origin.IP.String(), uint32(origin.Port)}))
+					if err != nil {
+						return
+					}
+					defer channel.Close()
+					go ssh.DiscardRequests(requests)
+					go func() {
+						io.Copy(channel, client)
+						channel.CloseWrite()
+					}()
+					io.Copy(client, channel)
+				}()
+			}
+		}()
+	}
+}
+
+func TestRemoteForwardReestablishedAfterReconnect(t *testing.T) {
+	local := startTestEchoServer(t)
+	addr := startTestSSHServerWithRequests(t, passwordServerConfig("secret"), nil, handleTestTCPIPForward)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.setRemoteForwardConfigs([]cfg.RemoteForward{
+		{Name: "dev", RemoteAddress: "127.0.0.1:0", LocalTarget: local},
+		{Name: "broken", RemoteAddress: "127.0.0.1:0", LocalTarget: freeLocalAddress(t)},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	roundTrip := func(address string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("unexpected echo %q: %v", buf, err)
+		}
+	}
+
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	forwards := tunnel.RemoteForwards()
+	if len(forwards) != 2 || !forwards[0].Listening || forwards[0].BoundAddress == "" {
+		t.Fatalf("unexpected remote forwards %+v", forwards)
+	}
+	firstBound := forwards[0].BoundAddress
+	roundTrip(firstBound)
+
+	// 本地目标不可达时只记录失败，不影响其它转发
+	if conn, err := net.Dial("tcp", forwards[1].BoundAddress); err == nil {
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	// 断开后重连，转发在新连接上重新建立
+	tunnel.invalidateSSHClientIfMatch(tunnel.PeekSSHClient(), "test")
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		forwards = tunnel.RemoteForwards()
+		if forwards[0].Listening && forwards[0].BoundAddress != firstBound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected remote forward to be re-established, got %+v", forwards)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	roundTrip(forwards[0].BoundAddress)
+
+	deadline = time.Now().Add(3 * time.Second)
+	for {
+		forwards = tunnel.RemoteForwards()
+		dev, broken := forwards[0], forwards[1]
+		if dev.TotalConns == 2 && dev.ActiveConns == 0 && dev.UploadBytes == 10 && dev.DownloadBytes == 10 && broken.FailedConns == 1 && broken.LastError != "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected remote forward stats %+v", forwards)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRemoteForwardConfigChangeAppliesToCurrentConnection(t *testing.T) {
+	local := startTestEchoServer(t)
+	addr := startTestSSHServerWithRequests(t, passwordServerConfig("secret"), nil, handleTestTCPIPForward)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.setRemoteForwardConfigs([]cfg.RemoteForward{
+		{Name: "dev", RemoteAddress: "127.0.0.1:0", LocalTarget: local},
+		{Name: "old", RemoteAddress: "127.0.0.1:0", LocalTarget: local},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	forwards := tunnel.RemoteForwards()
+	if len(forwards) != 2 || !forwards[0].Listening || !forwards[1].Listening {
+		t.Fatalf("unexpected remote forwards %+v", forwards)
+	}
+	devBound, oldBound := forwards[0].BoundAddress, forwards[1].BoundAddress
+
+	// 不重连：删除的转发停止在服务器上监听，新增的转发在当前连接上立即监听
+	tunnel.setRemoteForwardConfigs([]cfg.RemoteForward{
+		{Name: "dev", RemoteAddress: "127.0.0.1:0", LocalTarget: local},
+		{Name: "new", RemoteAddress: "127.0.0.1:0", LocalTarget: local},
+	})
+	forwards = tunnel.RemoteForwards()
+	if len(forwards) != 2 || forwards[0].BoundAddress != devBound || forwards[1].Name != "new" || !forwards[1].Listening {
+		t.Fatalf("unexpected remote forwards after update %+v", forwards)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", oldBound)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatalf("expected removed remote forward %s to stop listening", oldBound)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	conn, err := net.Dial("tcp", forwards[1].BoundAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+}
+
+func TestValidateRemoteForward(t *testing.T) {
+	if err := ValidateRemoteForward(cfg.RemoteForward{Name: "dev", RemoteAddress: "0.0.0.0:8080", LocalTarget: "127.0.0.1:3000"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, forward := range []cfg.RemoteForward{
+		{RemoteAddress: "0.0.0.0:8080", LocalTarget: "127.0.0.1:3000"},
+		{Name: "dev", RemoteAddress: ":8080", LocalTarget: "127.0.0.1:3000"},
+		{Name: "dev", RemoteAddress: "0.0.0.0:8080", LocalTarget: "127.0.0.1:0"},
+	} {
+		if err := ValidateRemoteForward(forward); err == nil {
+			t.Fatalf("expected %+v to be rejected", forward)
+		}
+	}
+}
@@ -17,15 +17,20 @@ const (
 
 // ProxyRequest 单条代理请求记录
 type ProxyRequest struct {
-	ID        uint64             `json:"id"`
-	Host      string             `json:"host"`
-	Port      string             `json:"port"`
-	Protocol  string             `json:"protocol"` // SOCKS5 / HTTP / HTTPS
-	Status    ProxyRequestStatus `json:"status"`
-	StartTime time.Time          `json:"startTime"`
-	EndTime   time.Time          `json:"endTime,omitempty"`
-	Error     string             `json:"error,omitempty"`
-	ViaSSH    bool               `json:"viaSSH"`
+	ID            uint64             `json:"id"`
+	Host          string             `json:"host"`
+	Port          string             `json:"port"`
+	Protocol      string             `json:"protocol"`          // SOCKS5 / SOCKS5-UDP / SOCKS5-BIND / SOCKS4 / SOCKS4A / HTTP / HTTPS / FORWARD
+	Forward       string             `json:"forward,omitempty"` // 静态端口转发名称，仅 FORWARD 请求
+	User          string             `json:"user,omitempty"`    // 认证通过的用户名
+	Rule          string             `json:"rule,omitempty"`    // 命中的路由规则，为空表示使用默认路由
+	Status        ProxyRequestStatus `json:"status"`
+	StartTime     time.Time          `json:"startTime"`
+	EndTime       time.Time          `json:"endTime,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	ViaSSH        bool               `json:"viaSSH"`
+	UploadBytes   uint64             `json:"uploadBytes,omitempty"`   // 目前仅 SOCKS5-UDP 关联记录
+	DownloadBytes uint64             `json:"downloadBytes,omitempty"` // 目前仅 SOCKS5-UDP 关联记录
 }
 
 // ProxyRequestTracker 代理请求跟踪器（环形缓冲，保留最近 N 条）
@@ -34,6 +39,18 @@ type ProxyRequestTracker struct {
 	requests []*ProxyRequest
 	maxSize  int
 	nextID   uint64
+	forwards map[string]*ForwardStats
+}
+
+// ForwardStats 单个静态端口转发的累计统计，不受环形缓冲淘汰影响
+type ForwardStats struct {
+	TotalConns    uint64    `json:"totalConns"`
+	ActiveConns   int       `json:"activeConns"`
+	FailedConns   uint64    `json:"failedConns"`
+	UploadBytes   uint64    `json:"uploadBytes"`
+	DownloadBytes uint64    `json:"downloadBytes"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastConnAt    time.Time `json:"lastConnAt,omitempty"`
 }
 
 // NewProxyRequestTracker 创建跟踪器
@@ -45,6 +62,7 @@ func NewProxyRequestTracker(maxSize int) *ProxyRequestTracker {
 		requests: make([]*ProxyRequest, 0, maxSize),
 		maxSize:  maxSize,
 		nextID:   1,
+		forwards: make(map[string]*ForwardStats),
 	}
 }
 
@@ -72,6 +90,96 @@ func (prt *ProxyRequestTracker) StartRequest(host, port, protocol string, viaSSH
 	return req
 }
 
+// SetUser 记录请求认证通过的用户名
+func (prt *ProxyRequestTracker) SetUser(req *ProxyRequest, user string) {
+	if req == nil || user == "" {
+		return
+	}
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	req.User = user
+}
+
+// SetRoute 记录请求的路由结果：命中的规则与是否经SSH
+func (prt *ProxyRequestTracker) SetRoute(req *ProxyRequest, route RouteDecision) {
+	if req == nil {
+		return
+	}
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	req.Rule = route.Rule
+	req.ViaSSH = route.Action == RouteActionSSH
+}
+
+// AddRequestBytes 累加请求的上传/下载字节数
+func (prt *ProxyRequestTracker) AddRequestBytes(req *ProxyRequest, upload, download int) {
+	if req == nil {
+		return
+	}
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	req.UploadBytes += uint64(upload)
+	req.DownloadBytes += uint64(download)
+}
+
+// StartForwardRequest 记录一条经静态端口转发的新请求，并计入该转发的统计
+func (prt *ProxyRequestTracker) StartForwardRequest(forward, host, port string) *ProxyRequest {
+	req := prt.StartRequest(host, port, "FORWARD", true)
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	req.Forward = forward
+	stats := prt.forwardStatsLocked(forward)
+	stats.TotalConns++
+	stats.ActiveConns++
+	stats.LastConnAt = req.StartTime
+	return req
+}
+
+func (prt *ProxyRequestTracker) forwardStatsLocked(forward string) *ForwardStats {
+	if prt.forwards == nil {
+		prt.forwards = make(map[string]*ForwardStats)
+	}
+	stats, ok := prt.forwards[forward]
+	if !ok {
+		stats = &ForwardStats{}
+		prt.forwards[forward] = stats
+	}
+	return stats
+}
+
+// finishForwardLocked 请求结束时更新所属转发的活跃数，每条请求只计一次
+func (prt *ProxyRequestTracker) finishForwardLocked(req *ProxyRequest) *ForwardStats {
+	if req.Forward == "" || req.Status == RequestStatusCompleted || req.Status == RequestStatusFailed {
+		return nil
+	}
+	stats := prt.forwardStatsLocked(req.Forward)
+	stats.ActiveConns--
+	return stats
+}
+
+// AddForwardBytes 累加静态端口转发的上传/下载字节数
+func (prt *ProxyRequestTracker) AddForwardBytes(forward string, upload, download int64) {
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	stats := prt.forwardStatsLocked(forward)
+	if upload > 0 {
+		stats.UploadBytes += uint64(upload)
+	}
+	if download > 0 {
+		stats.DownloadBytes += uint64(download)
+	}
+}
+
+// ForwardStats 返回指定静态端口转发的统计副本
+func (prt *ProxyRequestTracker) ForwardStats(forward string) ForwardStats {
+	prt.mu.Lock()
+	defer prt.mu.Unlock()
+	if stats, ok := prt.forwards[forward]; ok {
+		return *stats
+	}
+	return ForwardStats{}
+}
+
 // MarkActive 标记请求为传输中
 func (prt *ProxyRequestTracker) MarkActive(req *ProxyRequest) {
 	if req == nil {
@@ -89,6 +197,7 @@ func (prt *ProxyRequestTracker) MarkCompleted(req *ProxyRequest) {
 	}
 	prt.mu.Lock()
 	defer prt.mu.Unlock()
+	prt.finishForwardLocked(req)
 	req.Status = RequestStatusCompleted
 	req.EndTime = time.Now()
 }
@@ -100,6 +209,10 @@ func (prt *ProxyRequestTracker) MarkFailed(req *ProxyRequest, errMsg string) {
 	}
 	prt.mu.Lock()
 	defer prt.mu.Unlock()
+	if stats := prt.finishForwardLocked(req); stats != nil {
+		stats.FailedConns++
+		stats.LastError = errMsg
+	}
 	req.Status = RequestStatusFailed
 	req.EndTime = time.Now()
 	req.Error = errMsg
@@ -0,0 +1,258 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RuleImportFormatClash = "clash"
+	RuleImportFormatSurge = "surge"
+)
+
+// RuleImportResult Clash/Surge 规则导入结果：转换后的规则（rules.txt 格式）、策略名映射与无法转换的行
+type RuleImportResult struct {
+	Format      string            `json:"format"`
+	Rules       []string          `json:"rules"`
+	Policies    map[string]string `json:"policies"`
+	Unsupported []RouteRuleError  `json:"unsupported"`
+}
+
+// ParseRulePolicies 解析 "策略名=DIRECT|SSH|REJECT" 形式、逗号分隔的策略映射
+func ParseRulePolicies(value string) (map[string]string, error) {
+	policies := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, action, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("策略映射格式应为 策略名=DIRECT|SSH|REJECT: %s", item)
+		}
+		resolved, err := parseRouteAction(action)
+		if err != nil {
+			return nil, err
+		}
+		policies[strings.TrimSpace(name)] = resolved
+	}
+	return policies, nil
+}
+
+// ImportRuleSet 把 Clash YAML 的 rules: 或 Surge 配置的 [Rule] 段转换为路由规则。
+// policies 指定策略名对应的动作（不区分大小写）；未指定时 DIRECT 直连，REJECT 系列拒绝，其余策略（代理或策略组）经SSH
+func ImportRuleSet(data []byte, policies map[string]string) (RuleImportResult, error) {
+	result := RuleImportResult{Policies: make(map[string]string)}
+	var lines []importedRuleLine
+	var err error
+	if surgeLines, ok := surgeRuleLines(data); ok {
+		result.Format, lines = RuleImportFormatSurge, surgeLines
+	} else if lines, err = clashRuleLines(data); err == nil {
+		result.Format = RuleImportFormatClash
+	} else {
+		return result, err
+	}
+	if len(lines) == 0 {
+		return result, errors.New("没有找到规则")
+	}
+
+	for _, line := range lines {
+		rule, policy, err := convertImportedRule(line.content, policies)
+		if err != nil {
+			result.Unsupported = append(result.Unsupported, RouteRuleError{Line: line.line, Content: line.content, Message: err.Error()})
+			continue
+		}
+		if policy != "" {
+			result.Policies[policy] = rule.Action
+		}
+		result.Rules = append(result.Rules, rule.String())
+	}
+	return result, nil
+}
+
+type importedRuleLine struct {
+	line    int
+	content string
+}
+
+// surgeRuleLines 返回 Surge 配置 [Rule] 段中的规则行，没有 [Rule] 段时返回 false
+func surgeRuleLines(data []byte) ([]importedRuleLine, bool) {
+	var lines []importedRuleLine
+	found, inRule := false, false
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inRule = strings.EqualFold(line, "[Rule]")
+			found = found || inRule
+			continue
+		}
+		if !inRule || line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		lines = append(lines, importedRuleLine{line: i + 1, content: line})
+	}
+	return lines, found
+}
+
+// clashRuleLines 返回 Clash YAML 顶层 rules: 列表中的规则
+func clashRuleLines(data []byte) ([]importedRuleLine, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("既不是 Surge 配置（缺少 [Rule] 段），也不是有效的 Clash YAML: %v", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("既不是 Surge 配置（缺少 [Rule] 段），也不是 Clash 配置（缺少 rules:）")
+	}
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "rules" {
+			continue
+		}
+		rules := root.Content[i+1]
+		if rules.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("第%d行: rules 应为列表", rules.Line)
+		}
+		lines := make([]importedRuleLine, 0, len(rules.Content))
+		for _, item := range rules.Content {
+			lines = append(lines, importedRuleLine{line: item.Line, content: strings.TrimSpace(item.Value)})
+		}
+		return lines, nil
+	}
+	return nil, errors.New("既不是 Surge 配置（缺少 [Rule] 段），也不是 Clash 配置（缺少 rules:）")
+}
+
+// convertImportedRule 转换一条 Clash/Surge 规则，返回规则与其使用的策略名
+func convertImportedRule(line string, policies map[string]string) (routeRule, string, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	ruleType := strings.ToUpper(fields[0])
+	var value, policy string
+	switch ruleType {
+	case "FINAL", "MATCH":
+		// FINAL,策略[,dns-failed]
+		if len(fields) < 2 {
+			return routeRule{}, "", errors.New("缺少策略")
+		}
+		ruleType, policy = "MATCH", fields[1]
+	case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD", "IP-CIDR", "IP-CIDR6", "GEOIP", "DST-PORT", "DEST-PORT", "SRC-IP-CIDR":
+		// TYPE,值,策略[,no-resolve 等选项]
+		if len(fields) < 3 || fields[1] == "" {
+			return routeRule{}, "", errors.New("规则格式应为 TYPE,VALUE,POLICY")
+		}
+		value, policy = fields[1], fields[2]
+		switch ruleType {
+		case "SRC-IP-CIDR":
+			ruleType = "SRC-IP"
+		case "DEST-PORT":
+			// Surge 的目标端口规则
+			ruleType = "DST-PORT"
+		case "GEOIP":
+			// 导入时无法提供国家代码的地址段数据，只有 LAN 可以直接生效
+			if code := strings.ToUpper(value); code != geoipLAN {
+				return routeRule{}, "", fmt.Errorf("GEOIP,%s 依赖 %s/%s.txt 地址段数据，准备好数据文件后手动添加", code, geoipDirName, code)
+			}
+		}
+	default:
+		return routeRule{}, "", fmt.Errorf("不支持的规则类型: %s", fields[0])
+	}
+
+	action := importedPolicyAction(policy, policies)
+	text := ruleType + "," + value + "," + action
+	if ruleType == "MATCH" {
+		text = ruleType + "," + action
+	}
+	rule, err := parseRouteRule(text)
+	if err != nil {
+		return routeRule{}, "", err
+	}
+	return rule, policy, nil
+}
+
+func importedPolicyAction(policy string, policies map[string]string) string {
+	for name, action := range policies {
+		if strings.EqualFold(name, policy) {
+			return action
+		}
+	}
+	upper := strings.ToUpper(policy)
+	switch {
+	case upper == RouteActionDirect:
+		return RouteActionDirect
+	case strings.HasPrefix(upper, RouteActionReject):
+		// REJECT、REJECT-TINYGIF、REJECT-DROP 等
+		return RouteActionReject
+	}
+	return RouteActionSSH
+}
+
+// RenderImportedRules 生成 rules.txt 内容，无法转换的行以注释形式保留在文件末尾
+func RenderImportedRules(result RuleImportResult, source string) []byte {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# 由 %s 规则导入", result.Format)
+	if source != "" {
+		fmt.Fprintf(&builder, "（%s）", source)
+	}
+	fmt.Fprintf(&builder, "，%s\n", time.Now().Format("2006-01-02 15:04:05"))
+	names := make([]string, 0, len(result.Policies))
+	for name := range result.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&builder, "# 策略 %s -> %s\n", name, result.Policies[name])
+	}
+	for _, rule := range result.Rules {
+		builder.WriteString(rule + "\n")
+	}
+	if len(result.Unsupported) > 0 {
+		builder.WriteString("\n# 以下规则无法转换，未导入\n")
+		for _, unsupported := range result.Unsupported {
+			fmt.Fprintf(&builder, "# 第%d行 %s: %s\n", unsupported.Line, unsupported.Message, unsupported.Content)
+		}
+	}
+	return []byte(builder.String())
+}
+
+// WriteRouteRulesFile 写入规则文件：原文件备份为 .bak，先写临时文件再重命名
+func WriteRouteRulesFile(filePath string, content []byte) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(filePath); err == nil {
+		if err := os.WriteFile(filePath+".bak", existing, 0644); err != nil {
+			return fmt.Errorf("备份规则文件失败: %w", err)
+		}
+	}
+	tmp, err := os.CreateTemp(dir, ".rules-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// RouteRulesFilePath 返回当前使用的路由规则文件路径
+func (t *Tunnel) RouteRulesFilePath() string {
+	_, filePath := t.routeRules.settings()
+	return filePath
+}
@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportClashRules(t *testing.T) {
+	result, err := ImportRuleSet([]byte(`port: 7890
+proxies:
+  - name: hk
+    type: ss
+rules:
+  - DOMAIN-SUFFIX,google.com,🚀 节点选择
+  - 'DOMAIN-KEYWORD,ads,REJECT-TINYGIF'
+  - IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+  - GEOIP,CN,DIRECT
+  - PROCESS-NAME,curl,DIRECT
+  - RULE-SET,reject,REJECT
+  - DOMAIN-SUFFIX,internal.corp,Office
+  - GEOIP,LAN,DIRECT
+  - MATCH,Final
+`), map[string]string{"office": RouteActionDirect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != RuleImportFormatClash {
+		t.Fatalf("unexpected format %s", result.Format)
+	}
+	expected := []string{
+		"DOMAIN-SUFFIX,google.com,SSH",
+		"DOMAIN-KEYWORD,ads,REJECT",
+		"IP-CIDR,10.0.0.0/8,DIRECT",
+		"DOMAIN-SUFFIX,internal.corp,DIRECT",
+		"GEOIP,LAN,DIRECT",
+		"MATCH,SSH",
+	}
+	if !reflect.DeepEqual(result.Rules, expected) {
+		t.Fatalf("unexpected rules %v", result.Rules)
+	}
+	// 没有地址段数据的 GEOIP 与无法转换的规则一样列在报告中
+	if len(result.Unsupported) != 3 || result.Unsupported[0].Line != 9 || result.Unsupported[1].Line != 10 || result.Unsupported[2].Line != 11 ||
+		!strings.Contains(result.Unsupported[0].Message, "geoip/CN.txt") {
+		t.Fatalf("expected GEOIP,CN, PROCESS-NAME and RULE-SET on lines 9 to 11 to be reported, got %+v", result.Unsupported)
+	}
+	if result.Policies["🚀 节点选择"] != RouteActionSSH || result.Policies["Office"] != RouteActionDirect {
+		t.Fatalf("unexpected policy mapping %v", result.Policies)
+	}
+
+	// 转换结果本身应能被规则解析器完整解析
+	rules, ruleErrors := parseRouteRules(RenderImportedRules(result, "clash.yaml"))
+	if len(rules) != len(expected) || len(ruleErrors) != 0 {
+		t.Fatalf("rendered rules do not round-trip: %d rules, errors %+v", len(rules), ruleErrors)
+	}
+}
+
+func TestImportSurgeRules(t *testing.T) {
+	result, err := ImportRuleSet([]byte(`[General]
+loglevel = notify
+
+[Rule]
+# 注释
+DOMAIN-SUFFIX,apple.com,DIRECT
+IP-CIDR,192.168.0.0/16,DIRECT
+IP-CIDR6,2001:db8::/32,Proxy,no-resolve
+USER-AGENT,Instagram*,Proxy
+DOMAIN-KEYWORD,tracker,REJECT
+DEST-PORT,25,REJECT
+FINAL,Proxy,dns-failed
+
+[URL Rewrite]
+^http://example.com http://example.org 302
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"DOMAIN-SUFFIX,apple.com,DIRECT",
+		"IP-CIDR,192.168.0.0/16,DIRECT",
+		"IP-CIDR6,2001:db8::/32,SSH",
+		"DOMAIN-KEYWORD,tracker,REJECT",
+		"DST-PORT,25,REJECT",
+		"MATCH,SSH",
+	}
+	if result.Format != RuleImportFormatSurge || !reflect.DeepEqual(result.Rules, expected) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(result.Unsupported) != 1 || result.Unsupported[0].Line != 9 {
+		t.Fatalf("expected USER-AGENT on line 9 to be reported, got %+v", result.Unsupported)
+	}
+
+	if _, err := ImportRuleSet([]byte("just some text"), nil); err == nil {
+		t.Fatal("expected unrecognised input to fail")
+	}
+	if _, err := ParseRulePolicies("Proxy=SSH,Bad=PROXY"); err == nil {
+		t.Fatal("expected unknown action in policy mapping to fail")
+	}
+}
+
+func TestGeoIPRulesLoadCountryNetworks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, geoipDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, geoipDirName, "CN.txt"), []byte("# cn\n1.0.1.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rulesFile := filepath.Join(dir, routeRulesFileName)
+	content := "GEOIP,LAN,DIRECT\ngeoip,cn,DIRECT\nGEOIP,JP,REJECT\nMATCH,SSH\n"
+	if err := WriteRouteRulesFile(rulesFile, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteRouteRulesFile(rulesFile, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(rulesFile + ".bak"); err != nil {
+		t.Fatalf("expected existing rules file to be backed up: %v", err)
+	}
+
+	rules, ruleErrors, err := loadRouteRulesFile(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ruleErrors) != 1 || ruleErrors[0].Line != 3 || !strings.Contains(ruleErrors[0].Message, "GeoIP") {
+		t.Fatalf("expected missing JP data to be reported on line 3, got %+v", ruleErrors)
+	}
+	tunnel := newTestTunnel()
+	tunnel.routeRules.configure(true, rulesFile)
+	tunnel.routeRules.set(rules, ruleErrors)
+	for address, expected := range map[string]string{
+		"192.168.1.1:80": RouteActionDirect,
+		"1.0.1.5:443":    RouteActionDirect,
+		"8.8.8.8:53":     RouteActionSSH,
+		"cn.example:443": RouteActionSSH,
+	} {
+		if decision := tunnel.routeFor(address, "", RouteActionDirect); decision.Action != expected {
+			t.Errorf("%s: expected %s, got %+v", address, expected, decision)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RouteActionDirect = "DIRECT"
+	RouteActionSSH    = "SSH"
+	RouteActionReject = "REJECT"
+
+	routeRulesFileName = "rules.txt"
+	geoipDirName       = "geoip"
+	geoipLAN           = "LAN"
+)
+
+var errRouteRejected = errors.New("rejected by routing rule")
+
+// lanNetworks GEOIP,LAN 匹配的内网与保留地址段
+var lanNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "169.254.0.0/16", "100.64.0.0/10",
+	"::1/128", "fc00::/7", "fe80::/10")
+
+func mustParseCIDRs(values ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// routeRule 一条路由规则，格式为 TYPE,VALUE,ACTION；MATCH 规则没有 VALUE
+type routeRule struct {
+	Type   string
+	Value  string
+	Action string
+	Line   int
+
+	regex     *regexp.Regexp
+	network   *net.IPNet
+	networks  []*net.IPNet
+	portStart int
+	portEnd   int
+}
+
+func (r routeRule) String() string {
+	if r.Type == "MATCH" {
+		return r.Type + "," + r.Action
+	}
+	return r.Type + "," + r.Value + "," + r.Action
+}
+
+// routeTarget 规则匹配的输入：目标主机（域名小写、去掉末尾的点）、目标端口与客户端IP
+type routeTarget struct {
+	host  string
+	ip    net.IP
+	port  int
+	srcIP net.IP
+}
+
+func newRouteTarget(address, srcIP string) routeTarget {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	port, _ := strconv.Atoi(portText)
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return routeTarget{host: host, ip: net.ParseIP(host), port: port, srcIP: net.ParseIP(srcIP)}
+}
+
+func (r routeRule) match(target routeTarget) bool {
+	switch r.Type {
+	case "DOMAIN":
+		return target.ip == nil && target.host == r.Value
+	case "DOMAIN-SUFFIX":
+		return target.ip == nil && (target.host == r.Value || strings.HasSuffix(target.host, "."+r.Value))
+	case "DOMAIN-KEYWORD":
+		return target.ip == nil && strings.Contains(target.host, r.Value)
+	case "DOMAIN-REGEX":
+		return target.ip == nil && r.regex.MatchString(target.host)
+	case "IP-CIDR", "IP-CIDR6":
+		// 不为匹配而在本地解析域名，避免本应经SSH访问的域名在本地泄露DNS查询
+		return target.ip != nil && r.network.Contains(target.ip)
+	case "GEOIP":
+		return target.ip != nil && containsIP(r.networks, target.ip)
+	case "SRC-IP":
+		return target.srcIP != nil && r.network.Contains(target.srcIP)
+	case "DST-PORT":
+		return target.port >= r.portStart && target.port <= r.portEnd
+	case "MATCH":
+		return true
+	}
+	return false
+}
+
+// RouteRuleError 规则解析错误，带行号
+type RouteRuleError struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Message string `json:"message"`
+}
+
+func (e RouteRuleError) Error() string {
+	return fmt.Sprintf("第%d行: %s", e.Line, e.Message)
+}
+
+// parseRouteRules 逐行解析规则，跳过空行与 # 注释；错误的行不会生效并在返回的错误列表中说明
+func parseRouteRules(data []byte) ([]routeRule, []RouteRuleError) {
+	var rules []routeRule
+	var ruleErrors []RouteRuleError
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRouteRule(line)
+		if err != nil {
+			ruleErrors = append(ruleErrors, RouteRuleError{Line: i + 1, Content: line, Message: err.Error()})
+			continue
+		}
+		rule.Line = i + 1
+		rules = append(rules, rule)
+	}
+	return rules, ruleErrors
+}
+
+func parseRouteRule(line string) (routeRule, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	ruleType := strings.ToUpper(fields[0])
+	if ruleType == "MATCH" {
+		if len(fields) != 2 {
+			return routeRule{}, errors.New("MATCH 规则格式应为 MATCH,ACTION")
+		}
+		action, err := parseRouteAction(fields[1])
+		return routeRule{Type: ruleType, Action: action}, err
+	}
+	// IP 规则允许 Clash 风格的 no-resolve 选项，本地本就不解析域名，忽略即可
+	if len(fields) == 4 && strings.EqualFold(fields[3], "no-resolve") {
+		fields = fields[:3]
+	}
+	if len(fields) != 3 || fields[1] == "" {
+		return routeRule{}, errors.New("规则格式应为 TYPE,VALUE,ACTION")
+	}
+	action, err := parseRouteAction(fields[2])
+	if err != nil {
+		return routeRule{}, err
+	}
+	rule := routeRule{Type: ruleType, Value: fields[1], Action: action}
+
+	switch ruleType {
+	case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD":
+		rule.Value = strings.ToLower(strings.Trim(rule.Value, "."))
+	case "DOMAIN-REGEX":
+		if rule.regex, err = regexp.Compile(rule.Value); err != nil {
+			return routeRule{}, fmt.Errorf("正则表达式无效: %v", err)
+		}
+	case "IP-CIDR", "IP-CIDR6", "SRC-IP":
+		if rule.network, err = parseRouteNetwork(rule.Value); err != nil {
+			return routeRule{}, err
+		}
+	case "DST-PORT":
+		if rule.portStart, rule.portEnd, err = parsePortRange(rule.Value); err != nil {
+			return routeRule{}, err
+		}
+	case "GEOIP":
+		// 国家代码的地址段在加载规则文件时从 geoip 目录读取
+		rule.Value = strings.ToUpper(rule.Value)
+		if rule.Value == geoipLAN {
+			rule.networks = lanNetworks
+		}
+	default:
+		return routeRule{}, fmt.Errorf("不支持的规则类型: %s", fields[0])
+	}
+	return rule, nil
+}
+
+func parseRouteAction(action string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(action)) {
+	case RouteActionDirect:
+		return RouteActionDirect, nil
+	case RouteActionSSH:
+		return RouteActionSSH, nil
+	case RouteActionReject:
+		return RouteActionReject, nil
+	}
+	return "", fmt.Errorf("不支持的动作: %s（可选 DIRECT/SSH/REJECT）", action)
+}
+
+// parseRouteNetwork 解析 CIDR，单个IP按 /32 或 /128 处理
+func parseRouteNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("IP地址无效: %s", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("CIDR无效: %s", value)
+	}
+	return network, nil
+}
+
+// parsePortRange 解析单个端口或 start-end 端口范围
+func parsePortRange(value string) (int, int, error) {
+	startText, endText, isRange := strings.Cut(value, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startText))
+	end := start
+	if err == nil && isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(endText))
+	}
+	if err != nil || start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("端口无效: %s", value)
+	}
+	return start, end, nil
+}
+
+// RouteDecision 路由结果；Rule 为空表示没有规则命中，使用协议的默认路由
+type RouteDecision struct {
+	Action string `json:"action"`
+	Rule   string `json:"rule,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// routeRuleSet 当前生效的路由规则，由规则文件加载并热更新
+type routeRuleSet struct {
+	mu       sync.RWMutex
+	enabled  bool
+	filePath string
+	rules    []routeRule
+	errors   []RouteRuleError
+	watch    restartableWatch
+}
+
+// configure 设置是否启用与规则文件，文件变化时清空已加载的规则；设置有变化时返回 true
+func (s *routeRuleSet) configure(enabled bool, filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enabled == enabled && s.filePath == filePath {
+		return false
+	}
+	if s.filePath != filePath {
+		s.rules, s.errors = nil, nil
+	}
+	s.enabled = enabled
+	s.filePath = filePath
+	return true
+}
+
+func (s *routeRuleSet) set(rules []routeRule, ruleErrors []RouteRuleError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+	s.errors = ruleErrors
+}
+
+func (s *routeRuleSet) settings() (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled, s.filePath
+}
+
+// match 按顺序返回第一条命中的规则
+func (s *routeRuleSet) match(target routeTarget) (routeRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.enabled {
+		return routeRule{}, false
+	}
+	for _, rule := range s.rules {
+		if rule.match(target) {
+			return rule, true
+		}
+	}
+	return routeRule{}, false
+}
+
+// loadRouteRulesFile 读取并解析规则文件，文件不存在时视为没有规则
+func loadRouteRulesFile(filePath string) ([]routeRule, []RouteRuleError, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, ruleErrors := parseRouteRules(data)
+	rules, ruleErrors = resolveGeoIPRules(rules, ruleErrors, filepath.Join(filepath.Dir(filePath), geoipDirName))
+	return rules, ruleErrors, nil
+}
+
+// resolveGeoIPRules 为 GEOIP 规则加载 geoipDir/<国家代码>.txt 中的地址段（每行一个 CIDR），
+// 数据文件不可用的规则不生效并记为错误
+func resolveGeoIPRules(rules []routeRule, ruleErrors []RouteRuleError, geoipDir string) ([]routeRule, []RouteRuleError) {
+	loaded := make(map[string][]*net.IPNet)
+	failed := make(map[string]error)
+	resolved := rules[:0]
+	for _, rule := range rules {
+		if rule.Type != "GEOIP" || rule.networks != nil {
+			resolved = append(resolved, rule)
+			continue
+		}
+		networks, ok := loaded[rule.Value]
+		if !ok && failed[rule.Value] == nil {
+			var err error
+			if networks, err = loadGeoIPNetworks(filepath.Join(geoipDir, rule.Value+".txt")); err != nil {
+				failed[rule.Value] = err
+			} else {
+				loaded[rule.Value] = networks
+			}
+		}
+		if err := failed[rule.Value]; err != nil {
+			ruleErrors = append(ruleErrors, RouteRuleError{Line: rule.Line, Content: rule.String(), Message: fmt.Sprintf("GeoIP 数据不可用: %v", err)})
+			continue
+		}
+		rule.networks = networks
+		resolved = append(resolved, rule)
+	}
+	sort.SliceStable(ruleErrors, func(i, j int) bool { return ruleErrors[i].Line < ruleErrors[j].Line })
+	return resolved, ruleErrors
+}
+
+func loadGeoIPNetworks(filePath string) ([]*net.IPNet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var networks []*net.IPNet
+	for i, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		network, err := parseRouteNetwork(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s 第%d行: %v", filePath, i+1, err)
+		}
+		networks = append(networks, network)
+	}
+	if len(networks) == 0 {
+		return nil, fmt.Errorf("%s 中没有地址段", filePath)
+	}
+	return networks, nil
+}
+
+// RouteRulesFilePath 返回规则文件路径，未配置时使用主目录下的 rules.txt
+func RouteRulesFilePath(configured, homeDir string) string {
+	if configured = strings.TrimSpace(configured); configured != "" {
+		return configured
+	}
+	return filepath.Join(homeDir, routeRulesFileName)
+}
+
+// routeRulesFileWatcher 加载规则文件并监听其变化，修改后自动重新加载，删除后清空规则
+func routeRulesFileWatcher(ctx context.Context, filePath string, tunnel *Tunnel) error {
+	// 切换规则文件后，旧文件的监听在退出前不再修改规则
+	current := func() bool {
+		_, configured := tunnel.routeRules.settings()
+		return configured == filePath
+	}
+	return watchFile(ctx, filePath, func() {
+		if !current() {
+			return
+		}
+		rules, ruleErrors, err := loadRouteRulesFile(filePath)
+		if err != nil {
+			log.Printf("读取路由规则文件失败: %v", err)
+			return
+		}
+		for _, ruleErr := range ruleErrors {
+			log.Printf("路由规则文件 %s %v，已跳过", filePath, ruleErr)
+		}
+		tunnel.routeRules.set(rules, ruleErrors)
+		log.Printf("路由规则已加载: %s, 规则数: %d", filePath, len(rules))
+	}, func() {
+		if !current() {
+			return
+		}
+		tunnel.routeRules.set(nil, nil)
+		log.Printf("路由规则文件已删除，已清空规则: %s", filePath)
+	})
+}
+
+// startRouteRulesWatcher 启用规则路由时在后台加载并监听规则文件，运行时修改启用状态或文件路径后监听随之切换
+func (t *Tunnel) startRouteRulesWatcher(ctx context.Context) {
+	t.routeRules.watch.bind(ctx)
+	t.restartRouteRulesWatcher()
+}
+
+// configureRouteRules 设置规则路由，启用状态或规则文件变化时重新加载并监听
+func (t *Tunnel) configureRouteRules(enabled bool, filePath string) {
+	if t.routeRules.configure(enabled, filePath) {
+		t.restartRouteRulesWatcher()
+	}
+}
+
+func (t *Tunnel) restartRouteRulesWatcher() {
+	enabled, filePath := t.routeRules.settings()
+	if !enabled {
+		t.routeRules.watch.restart(nil)
+		return
+	}
+	t.routeRules.watch.restart(func(ctx context.Context) {
+		if err := routeRulesFileWatcher(ctx, filePath, t); err != nil {
+			log.Printf("路由规则文件监听失败: %v", err)
+		}
+	})
+}
+
+// routeFor 返回 address 的路由：按顺序第一条命中的规则生效，没有规则命中时使用 fallback
+func (t *Tunnel) routeFor(address, srcIP, fallback string) RouteDecision {
+	rule, ok := t.routeRules.match(newRouteTarget(address, srcIP))
+	if !ok {
+		return RouteDecision{Action: fallback}
+	}
+	return RouteDecision{Action: rule.Action, Rule: rule.String(), Line: rule.Line}
+}
+
+// httpDefaultAction HTTP代理在没有规则命中时的路由：未启用经SSH时直连，启用域名过滤时只有名单内的域名经SSH
+func (t *Tunnel) httpDefaultAction(address string) string {
+	if !t.enableHttpOverSSH {
+		return RouteActionDirect
+	}
+	if t.enableHttpDomainFilter && !t.shouldUseSSHForHost(address) {
+		return RouteActionDirect
+	}
+	return RouteActionSSH
+}
+
+// TestRoute 返回指定协议下目标地址会命中的路由，protocol 为 http 时使用HTTP代理的默认路由，其它协议默认经SSH
+func (t *Tunnel) TestRoute(address, srcIP, protocol string) RouteDecision {
+	fallback := RouteActionSSH
+	if strings.EqualFold(protocol, "http") || strings.EqualFold(protocol, "https") {
+		fallback = t.httpDefaultAction(address)
+	}
+	return t.routeFor(address, srcIP, fallback)
+}
+
+// RouteRules 返回规则路由是否启用、规则文件路径、生效的规则与解析错误
+func (t *Tunnel) RouteRules() (bool, string, []string, []RouteRuleError) {
+	t.routeRules.mu.RLock()
+	defer t.routeRules.mu.RUnlock()
+	rules := make([]string, 0, len(t.routeRules.rules))
+	for _, rule := range t.routeRules.rules {
+		rules = append(rules, rule.String())
+	}
+	ruleErrors := append([]RouteRuleError(nil), t.routeRules.errors...)
+	return t.routeRules.enabled, t.routeRules.filePath, rules, ruleErrors
+}
+
+// directDialTimeout 直连目标的超时，与经SSH连接目标使用同一配置
+func (t *Tunnel) directDialTimeout() time.Duration {
+	if t.sshDestTimeout > 0 {
+		return t.sshDestTimeout
+	}
+	return 3 * time.Second
+}
+
+// dialRoute 按路由动作连接目标
+func (t *Tunnel) dialRoute(address, action string) (destinationConn, error) {
+	switch action {
+	case RouteActionReject:
+		return destinationConn{}, errRouteRejected
+	case RouteActionDirect:
+		conn, err := net.DialTimeout("tcp", address, t.directDialTimeout())
+		return destinationConn{conn: conn}, err
+	}
+	conn, client, err := t.createSSHConn(address)
+	return destinationConn{conn: conn, sshClient: client, viaSSH: true}, err
+}
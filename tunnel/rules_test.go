@@ -0,0 +1,189 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadTestRouteRules(t *testing.T, tunnel *Tunnel, content string) []RouteRuleError {
+	t.Helper()
+	rules, ruleErrors := parseRouteRules([]byte(content))
+	tunnel.routeRules.configure(true, "")
+	tunnel.routeRules.set(rules, ruleErrors)
+	return ruleErrors
+}
+
+func TestRouteRulesMatchInOrder(t *testing.T) {
+	tunnel := newTestTunnel()
+	ruleErrors := loadTestRouteRules(t, tunnel, `# 注释
+DOMAIN,exact.example.com,REJECT
+DOMAIN-SUFFIX,example.com,SSH
+DOMAIN-KEYWORD,tracker,REJECT
+DOMAIN-REGEX,^cdn[0-9]+\.test$,DIRECT
+IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+SRC-IP,192.168.1.50,REJECT
+DST-PORT,8000-8100,DIRECT
+UNKNOWN,foo,SSH
+DOMAIN-SUFFIX,foo.com,PROXY
+MATCH,SSH
+`)
+	if len(ruleErrors) != 2 || ruleErrors[0].Line != 9 || ruleErrors[1].Line != 10 {
+		t.Fatalf("expected errors on lines 9 and 10, got %+v", ruleErrors)
+	}
+
+	for _, tc := range []struct {
+		address string
+		src     string
+		action  string
+		line    int
+	}{
+		{"exact.example.com:443", "", RouteActionReject, 2},
+		{"www.example.com:443", "", RouteActionSSH, 3},
+		{"example.com.:80", "", RouteActionSSH, 3},
+		{"ample.com:443", "", RouteActionSSH, 11},
+		{"ad.tracker.net:443", "", RouteActionReject, 4},
+		{"cdn12.test:443", "", RouteActionDirect, 5},
+		{"10.1.2.3:22", "", RouteActionDirect, 6},
+		{"11.1.2.3:22", "192.168.1.50", RouteActionReject, 7},
+		{"11.1.2.3:8080", "", RouteActionDirect, 8},
+		{"11.1.2.3:22", "", RouteActionSSH, 11},
+	} {
+		decision := tunnel.routeFor(tc.address, tc.src, RouteActionDirect)
+		if decision.Action != tc.action || decision.Line != tc.line {
+			t.Fatalf("%s from %q: expected %s (line %d), got %+v", tc.address, tc.src, tc.action, tc.line, decision)
+		}
+	}
+
+	tunnel.routeRules.configure(false, "")
+	if decision := tunnel.routeFor("www.example.com:443", "", RouteActionDirect); decision.Action != RouteActionDirect || decision.Rule != "" {
+		t.Fatalf("expected fallback when routing is disabled, got %+v", decision)
+	}
+}
+
+func TestRouteRulesConfigureRestartsWatcher(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	if err := os.WriteFile(first, []byte("DOMAIN-SUFFIX,first.test,REJECT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("DOMAIN-SUFFIX,second.test,REJECT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel := newTestTunnel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 启动时未启用规则路由，运行时启用后才开始加载
+	tunnel.configureRouteRules(false, first)
+	tunnel.startRouteRulesWatcher(ctx)
+	waitFor := func(address, expected string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for tunnel.routeFor(address, "", RouteActionSSH).Action != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: expected %s, got %+v", address, expected, tunnel.routeFor(address, "", RouteActionSSH))
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	tunnel.configureRouteRules(true, first)
+	waitFor("a.first.test:443", RouteActionReject)
+
+	// 切换规则文件：新文件被加载并监听，旧文件的改动不再生效
+	tunnel.configureRouteRules(true, second)
+	waitFor("a.second.test:443", RouteActionReject)
+	waitFor("a.first.test:443", RouteActionSSH)
+	if err := os.WriteFile(first, []byte("MATCH,REJECT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("MATCH,DIRECT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("a.second.test:443", RouteActionDirect)
+}
+
+func TestSocks5RouteRulesDirectAndReject(t *testing.T) {
+	target := startTestEchoServer(t)
+	// 没有SSH连接：DIRECT 规则的请求仍能直连目标
+	tunnel := newTestTunnel()
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	loadTestRouteRules(t, tunnel, "DOMAIN,blocked.test,REJECT\nIP-CIDR,127.0.0.0/8,DIRECT\n")
+	proxy := startTestSocks5Listener(t, tunnel)
+
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, _, rep := socks5Connect(t, conn, []byte{socks5MethodNoAuth}, "", "", target); rep != 0x00 {
+		t.Fatalf("expected direct connection to succeed, rep=%d", rep)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+
+	rejected, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	if _, _, rep := socks5Connect(t, rejected, []byte{socks5MethodNoAuth}, "", "", "blocked.test:443"); rep != 0x02 {
+		t.Fatalf("expected ruleset rejection (0x02), got %d", rep)
+	}
+
+	rules := map[string]ProxyRequest{}
+	for _, req := range tunnel.GetRequestTracker().Snapshot() {
+		rules[req.Host] = req
+	}
+	if req := rules["127.0.0.1"]; req.Rule != "IP-CIDR,127.0.0.0/8,DIRECT" || req.ViaSSH {
+		t.Fatalf("unexpected direct request record %+v", req)
+	}
+	if req := rules["blocked.test"]; req.Rule != "DOMAIN,blocked.test,REJECT" || req.Status != RequestStatusFailed {
+		t.Fatalf("unexpected rejected request record %+v", req)
+	}
+}
+
+func TestHTTPProxyRouteRules(t *testing.T) {
+	origin := startTestOrigin(t, "a")
+	tunnel := newTestTunnel()
+	tunnel.enableHttpOverSSH = true
+	loadTestRouteRules(t, tunnel, "DOMAIN-SUFFIX,blocked.test,REJECT\nIP-CIDR,127.0.0.1/32,DIRECT\n")
+	proxy := startTestHTTPProxy(t, tunnel)
+
+	for _, tc := range []struct {
+		host   string
+		status int
+	}{
+		{origin, http.StatusOK},
+		{"www.blocked.test", http.StatusForbidden},
+	} {
+		conn, err := net.Dial("tcp", proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n\r\n", tc.host, tc.host)
+		resp, _ := readProxyResponse(t, bufio.NewReader(conn))
+		conn.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: expected %d, got %d", tc.host, tc.status, resp.StatusCode)
+		}
+	}
+
+	if decision := tunnel.TestRoute("www.blocked.test:80", "", "http"); decision.Action != RouteActionReject {
+		t.Fatalf("unexpected route test result %+v", decision)
+	}
+	if decision := tunnel.TestRoute("other.test:80", "", "http"); decision.Action != RouteActionSSH || decision.Rule != "" {
+		t.Fatalf("expected default HTTP route over SSH, got %+v", decision)
+	}
+}
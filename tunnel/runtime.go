@@ -6,7 +6,6 @@ import (
 	"log"
 	"net"
 	"ssh-tunnel/safe"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -94,64 +93,43 @@ func (t *Tunnel) beginActiveProxyConn() func() {
 	}
 }
 
+// shouldUseSSHForHost 判断主机是否命中域名过滤条目，结果按主机名（不含端口）缓存
 func (t *Tunnel) shouldUseSSHForHost(host string) bool {
-	if matched, ok := t.cachedDomainMatch(host); ok {
+	hostOnly := normalizeDomainHost(host)
+	cache := t.domainMatchCacheStore()
+	if matched, ok := cache.get(hostOnly); ok {
 		return matched
 	}
 
-	hostOnly := host
-	if splitHost, _, err := net.SplitHostPort(host); err == nil {
-		hostOnly = splitHost
-	} else {
-		hostOnly = strings.Split(host, ":")[0]
-	}
-	hostOnly = strings.ToLower(strings.Trim(hostOnly, "."))
-
 	t.domainMutex.RLock()
-	domains := cloneStringBoolMap(t.domains)
+	matcher := t.domainMatcher
 	t.domainMutex.RUnlock()
 
-	for domain := range domains {
-		if domain == "" {
-			continue
-		}
-		if strings.HasSuffix(hostOnly, strings.ToLower(domain)) {
-			t.rememberDomainMatch(host, true)
-			return true
-		}
-	}
-
-	t.rememberDomainMatch(host, false)
-	return false
+	matched := matcher.match(hostOnly)
+	cache.put(hostOnly, matched)
+	return matched
 }
 
-func (t *Tunnel) cachedDomainMatch(host string) (bool, bool) {
-	t.domainMutex.RLock()
-	defer t.domainMutex.RUnlock()
-
-	value, ok := t.domainMatchCache[host]
-	return value, ok
-}
-
-func (t *Tunnel) rememberDomainMatch(host string, matched bool) {
-	t.domainMutex.Lock()
-	defer t.domainMutex.Unlock()
-
-	if t.domainMatchCache == nil {
-		t.domainMatchCache = make(map[string]bool)
-	}
-	t.domainMatchCache[host] = matched
+func (t *Tunnel) serveTCPProxy(ctx context.Context, address string, name string, handler func(net.Conn)) {
+	t.serveTCPListener(ctx, nil, address, name, handler)
 }
 
-func (t *Tunnel) serveTCPProxy(ctx context.Context, address string, name string, handler func(net.Conn)) {
+// serveTCPListener 与 serveTCPProxy 相同，但先使用调用方已打开的 listener（为 nil 时自行监听），监听出错后在后台重新监听 address
+func (t *Tunnel) serveTCPListener(ctx context.Context, listener net.Listener, address string, name string, handler func(net.Conn)) {
 	backoff := defaultListenerRetryMin
 
 	for {
 		if ctx.Err() != nil {
+			if listener != nil {
+				_ = listener.Close()
+			}
 			return
 		}
 
-		listener, err := net.Listen("tcp", address)
+		var err error
+		if listener == nil {
+			listener, err = net.Listen("tcp", address)
+		}
 		if err != nil {
 			log.Printf("Failed to start %s proxy server: %v", name, err)
 			if !waitWithContext(ctx, backoff) {
@@ -166,6 +144,7 @@ func (t *Tunnel) serveTCPProxy(ctx context.Context, address string, name string,
 
 		err = t.acceptLoop(ctx, listener, name, handler)
 		_ = listener.Close()
+		listener = nil
 		if ctx.Err() != nil {
 			return
 		}
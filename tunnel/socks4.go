@@ -0,0 +1,129 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"ssh-tunnel/safe"
+)
+
+const (
+	socks4CmdConnect byte = 0x01
+
+	socks4ReplyGranted  byte = 0x5A
+	socks4ReplyRejected byte = 0x5B
+
+	// socks4MaxFieldLength USERID 与 SOCKS4a 域名字段的最大长度
+	socks4MaxFieldLength = 255
+)
+
+// socks4Proxy 处理 SOCKS4/4a CONNECT 请求，command 为已读取的 CD 字段；SOCKS4 没有密码认证，禁用SOCKS5无认证时一并拒绝
+func (t *Tunnel) socks4Proxy(conn net.Conn, command byte) error {
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	userID, err := readSocks4String(conn)
+	if err != nil {
+		_ = writeSocks4Reply(conn, socks4ReplyRejected, nil)
+		return err
+	}
+
+	port := binary.BigEndian.Uint16(header[:2])
+	ip := net.IP(header[2:6])
+	host := ip.String()
+	protocol := "SOCKS4"
+	// SOCKS4a: DSTIP 为 0.0.0.x (x≠0) 时，USERID 之后紧跟目标域名
+	if ip[0] == 0 && ip[1] == 0 && ip[2] == 0 && ip[3] != 0 {
+		host, err = readSocks4String(conn)
+		if err != nil || host == "" {
+			_ = writeSocks4Reply(conn, socks4ReplyRejected, nil)
+			return fmt.Errorf("invalid socks4a hostname: %v", err)
+		}
+		protocol = "SOCKS4A"
+	}
+	if command != socks4CmdConnect {
+		_ = writeSocks4Reply(conn, socks4ReplyRejected, nil)
+		return fmt.Errorf("unsupported socks4 command: %d", command)
+	}
+	if !t.socks5Auth.allowNoAuth {
+		_ = writeSocks4Reply(conn, socks4ReplyRejected, nil)
+		log.Printf("拒绝SOCKS4请求(未启用无认证连接): userid=%q, client=%s", userID, safeSSHAddrString(conn.RemoteAddr))
+		return errors.New("socks4 rejected: no-auth connections disabled")
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	tracker := t.GetRequestTracker()
+	req := tracker.StartRequest(host, strconv.Itoa(int(port)), protocol, true)
+	route := t.routeFor(addr, clientIP(conn), RouteActionSSH)
+	tracker.SetRoute(req, route)
+
+	dest, err := t.dialRoute(addr, route.Action)
+	server, client := dest.conn, dest.sshClient
+	if err != nil {
+		log.Println(err)
+		_ = writeSocks4Reply(conn, socks4ReplyRejected, nil)
+		tracker.MarkFailed(req, err.Error())
+		if dest.viaSSH && shouldReconnect(err) {
+			if client != nil {
+				t.invalidateSSHClientIfMatch(client, "socks4 dial failed: "+err.Error())
+			}
+			return SSHReconnectRequired
+		}
+		return err
+	}
+
+	if err := writeSocks4Reply(conn, socks4ReplyGranted, server.LocalAddr()); err != nil {
+		_ = server.Close()
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+
+	tracker.MarkActive(req)
+	_ = conn.SetReadDeadline(time.Time{})
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+	safe.GO(func() {
+		t.copyProxyData(server, conn, true)
+	})
+	t.copyProxyData(conn, server, false)
+	tracker.MarkCompleted(req)
+	return nil
+}
+
+// readSocks4String 逐字节读取以 NUL 结尾的字段，避免多读走请求之后的数据
+func readSocks4String(conn net.Conn) (string, error) {
+	value := make([]byte, 0, 32)
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		if b[0] == 0x00 {
+			return string(value), nil
+		}
+		if len(value) >= socks4MaxFieldLength {
+			return "", errors.New("socks4 field too long")
+		}
+		value = append(value, b[0])
+	}
+}
+
+// writeSocks4Reply 写入 SOCKS4 应答：VN=0 CD DSTPORT DSTIP
+func writeSocks4Reply(conn net.Conn, code byte, bindAddr net.Addr) error {
+	response := []byte{0x00, code, 0, 0, 0, 0, 0, 0}
+	if tcpAddr, ok := bindAddr.(*net.TCPAddr); ok && tcpAddr != nil {
+		binary.BigEndian.PutUint16(response[2:], uint16(tcpAddr.Port))
+		if ip4 := tcpAddr.IP.To4(); ip4 != nil {
+			copy(response[4:], ip4)
+		}
+	}
+	_, err := conn.Write(response)
+	return err
+}
@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// socks4Connect 发送 SOCKS4 CONNECT 请求；hostname 非空时按 SOCKS4a 发送域名
+func socks4Connect(t *testing.T, conn net.Conn, ip net.IP, port int, hostname string) byte {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	request := []byte{0x04, socks4CmdConnect}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	request = append(request, ip.To4()...)
+	request = append(request, "legacy"...)
+	request = append(request, 0x00)
+	if hostname != "" {
+		request = append(request, hostname...)
+		request = append(request, 0x00)
+	}
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != 0x00 {
+		t.Fatalf("unexpected socks4 reply version %d", reply[0])
+	}
+	return reply[1]
+}
+
+func TestSocks4AndSocks4aConnect(t *testing.T) {
+	target := startTestEchoServer(t)
+	targetAddr, _ := net.ResolveTCPAddr("tcp", target)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	listen := startTestSocks5Listener(t, tunnel)
+
+	for _, hostname := range []string{"", "localhost"} {
+		conn, err := net.Dial("tcp", listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := targetAddr.IP
+		if hostname != "" {
+			ip = net.IPv4(0, 0, 0, 1)
+		}
+		if code := socks4Connect(t, conn, ip, targetAddr.Port, hostname); code != socks4ReplyGranted {
+			t.Fatalf("expected request granted for hostname %q, got %x", hostname, code)
+		}
+		conn.Write([]byte("ping"))
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("unexpected echo %q: %v", buf, err)
+		}
+		conn.Close()
+	}
+
+	snapshot := tunnel.GetRequestTracker().Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Protocol != "SOCKS4A" || snapshot[0].Host != "localhost" || snapshot[1].Protocol != "SOCKS4" {
+		t.Fatalf("unexpected request snapshot %+v", snapshot)
+	}
+}
+
+func TestSocks4RejectedWhenNoAuthDisabled(t *testing.T) {
+	tunnel := newTestTunnel()
+	tunnel.socks5Auth = socks5AuthConfig{enabled: true}
+	conn, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if code := socks4Connect(t, conn, net.IPv4(127, 0, 0, 1), 80, ""); code != socks4ReplyRejected {
+		t.Fatalf("expected request rejected, got %x", code)
+	}
+	if snapshot := tunnel.GetRequestTracker().Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("rejected request should not be tracked, got %+v", snapshot)
+	}
+}
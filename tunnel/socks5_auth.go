@@ -0,0 +1,104 @@
+package tunnel
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+)
+
+const (
+	socks5MethodNoAuth       byte = 0x00
+	socks5MethodUserPass     byte = 0x02
+	socks5MethodNoAcceptable byte = 0xFF
+
+	socks5UserPassVersion byte = 0x01
+)
+
+// socks5AuthConfig SOCKS5认证配置；allowNoAuth 为 false 时拒绝无认证连接，shareHttpBasic 为 true 时使用HTTP基本认证的用户名密码
+type socks5AuthConfig struct {
+	enabled        bool
+	allowNoAuth    bool
+	shareHttpBasic bool
+	username       string
+	password       string
+}
+
+// socks5Credentials 返回SOCKS5认证使用的用户名和密码
+func (t *Tunnel) socks5Credentials() (string, string) {
+	if t.socks5Auth.shareHttpBasic {
+		return t.httpBasicUserName, t.httpBasicPassword
+	}
+	return t.socks5Auth.username, t.socks5Auth.password
+}
+
+// socks5Authenticate 校验SOCKS5用户名密码；共享HTTP基本认证时同样接受代理用户文件中的用户
+func (t *Tunnel) socks5Authenticate(user, password string) bool {
+	if t.socks5Auth.shareHttpBasic {
+		return t.authenticateProxyUser(user, password)
+	}
+	expectedUser, expectedPassword := t.socks5Credentials()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(expectedUser)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(expectedPassword)) == 1
+	return expectedUser != "" && userOK && passwordOK
+}
+
+// selectSocks5Method 按配置从客户端提供的方法中选择认证方式：启用认证时优先用户名密码，其次（允许时）无认证
+func (t *Tunnel) selectSocks5Method(methods []byte) byte {
+	offered := func(method byte) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	if t.socks5Auth.enabled && offered(socks5MethodUserPass) {
+		return socks5MethodUserPass
+	}
+	if t.socks5Auth.allowNoAuth && offered(socks5MethodNoAuth) {
+		return socks5MethodNoAuth
+	}
+	return socks5MethodNoAcceptable
+}
+
+// socks5UserPassAuth 执行 RFC 1929 用户名密码认证子协商，成功时返回用户名
+func (t *Tunnel) socks5UserPassAuth(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5UserPassVersion {
+		return "", fmt.Errorf("unsupported socks5 user/pass auth version: %d", header[0])
+	}
+	username := make([]byte, int(header[1]))
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(conn, header[:1]); err != nil {
+		return "", err
+	}
+	password := make([]byte, int(header[0]))
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return "", err
+	}
+
+	ip := clientIP(conn)
+	if t.authLimiter.blocked(ip) {
+		_, _ = conn.Write([]byte{socks5UserPassVersion, 0x01})
+		return "", fmt.Errorf("socks5 client %s is blocked after repeated authentication failures", ip)
+	}
+	if !t.socks5Authenticate(string(username), string(password)) {
+		_, _ = conn.Write([]byte{socks5UserPassVersion, 0x01})
+		log.Printf("SOCKS5认证失败: user=%q, client=%s", string(username), safeSSHAddrString(conn.RemoteAddr))
+		t.authLimiter.recordFailure(ip)
+		return "", errors.New("socks5 authentication failed")
+	}
+	t.authLimiter.recordSuccess(ip)
+	if _, err := conn.Write([]byte{socks5UserPassVersion, 0x00}); err != nil {
+		return "", err
+	}
+	return string(username), nil
+}
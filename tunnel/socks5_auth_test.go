@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// socks5Connect 以指定的认证方法完成SOCKS5握手并请求连接 target(IPv4)，返回服务器选择的方法与认证结果
+func socks5Connect(t *testing.T, conn net.Conn, methods []byte, user string, password string, target string) (byte, byte, byte) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	method := reply[1]
+	if method == socks5MethodNoAcceptable {
+		return method, 0, 0
+	}
+	if method == socks5MethodUserPass {
+		request := []byte{socks5UserPassVersion, byte(len(user))}
+		request = append(request, user...)
+		request = append(request, byte(len(password)))
+		request = append(request, password...)
+		conn.Write(request)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply[1] != 0x00 {
+			return method, reply[1], 0
+		}
+	}
+
+	host, portText, err := net.SplitHostPort(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portText)
+	request := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		request = append(append(request, 0x01), ip...)
+	} else {
+		// 域名目标不在本地解析，交由代理处理
+		request = append(append(request, 0x03, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	conn.Write(request)
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	return method, 0, header[1]
+}
+
+func TestSocks5UserPassAuthentication(t *testing.T) {
+	target := startTestEchoServer(t)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.httpBasicUserName = "web"
+	tunnel.httpBasicPassword = "web-pass"
+	tunnel.socks5Auth = socks5AuthConfig{enabled: true, username: "alice", password: "s3cret"}
+
+	serve := func() net.Conn {
+		client, server := net.Pipe()
+		go tunnel.socks5Proxy(context.Background(), server)
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+
+	conn := serve()
+	method, authStatus, rep := socks5Connect(t, conn, []byte{socks5MethodNoAuth, socks5MethodUserPass}, "alice", "s3cret", target)
+	if method != socks5MethodUserPass || authStatus != 0 || rep != 0x00 {
+		t.Fatalf("unexpected handshake result method=%d auth=%d rep=%d", method, authStatus, rep)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+	if snapshot := tunnel.GetRequestTracker().Snapshot(); len(snapshot) != 1 || snapshot[0].User != "alice" {
+		t.Fatalf("expected authenticated user on request, got %+v", snapshot)
+	}
+
+	if _, authStatus, _ := socks5Connect(t, serve(), []byte{socks5MethodUserPass}, "alice", "wrong", target); authStatus == 0 {
+		t.Fatal("expected wrong password to be rejected")
+	}
+
+	// 禁用无认证后，只提供无认证方法的客户端被拒绝
+	if method, _, _ := socks5Connect(t, serve(), []byte{socks5MethodNoAuth}, "", "", target); method != socks5MethodNoAcceptable {
+		t.Fatalf("expected no acceptable method, got %d", method)
+	}
+
+	// 与HTTP基本认证共用用户名密码
+	tunnel.socks5Auth.shareHttpBasic = true
+	if _, authStatus, rep := socks5Connect(t, serve(), []byte{socks5MethodUserPass}, "web", "web-pass", target); authStatus != 0 || rep != 0x00 {
+		t.Fatalf("expected shared http basic credentials to be accepted, auth=%d rep=%d", authStatus, rep)
+	}
+}
+
+func TestSelectSocks5Method(t *testing.T) {
+	tunnel := &Tunnel{socks5Auth: socks5AuthConfig{allowNoAuth: true}}
+	if method := tunnel.selectSocks5Method([]byte{socks5MethodUserPass, socks5MethodNoAuth}); method != socks5MethodNoAuth {
+		t.Fatalf("expected no-auth when authentication is disabled, got %d", method)
+	}
+	tunnel.socks5Auth.enabled = true
+	if method := tunnel.selectSocks5Method([]byte{socks5MethodNoAuth, socks5MethodUserPass}); method != socks5MethodUserPass {
+		t.Fatalf("expected user/pass to be preferred, got %d", method)
+	}
+	if method := tunnel.selectSocks5Method([]byte{socks5MethodNoAuth}); method != socks5MethodNoAuth {
+		t.Fatalf("expected no-auth fallback while allowed, got %d", method)
+	}
+	tunnel.socks5Auth.allowNoAuth = false
+	if method := tunnel.selectSocks5Method([]byte{socks5MethodNoAuth}); method != socks5MethodNoAcceptable {
+		t.Fatalf("expected no acceptable method, got %d", method)
+	}
+}
@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"ssh-tunnel/safe"
+)
+
+const (
+	socks5CmdBind byte = 0x02
+
+	// socks5BindAcceptTimeout BIND 等待对端连入的最长时间
+	socks5BindAcceptTimeout = 2 * time.Minute
+)
+
+// socks5Bind 处理 BIND 命令：在SSH服务器上开远程监听，第一次应答监听地址，对端连入后第二次应答对端地址再转发数据。
+// 监听 0.0.0.0 需要 sshd 开启 GatewayPorts，否则服务器只会在回环地址上监听。
+// 路由规则按 DST.ADDR（预期连入的对端）判断：REJECT 直接拒绝；监听只能开在SSH服务器上，DIRECT 与 SSH 相同
+func (t *Tunnel) socks5Bind(ctx context.Context, conn net.Conn, addr string, user string) error {
+	tracker := t.GetRequestTracker()
+	sHost, sPort := splitHostPort(addr)
+	req := tracker.StartRequest(sHost, sPort, "SOCKS5-BIND", true)
+	tracker.SetUser(req, user)
+	route := t.routeFor(addr, clientIP(conn), RouteActionSSH)
+	if route.Action == RouteActionDirect {
+		route.Action = RouteActionSSH
+	}
+	tracker.SetRoute(req, route)
+	if route.Action == RouteActionReject {
+		_ = writeSocks5Reply(conn, 0x02, nil)
+		tracker.MarkFailed(req, errRouteRejected.Error())
+		return errRouteRejected
+	}
+
+	sshClient := t.GetSSHClient()
+	if sshClient == nil {
+		_ = writeSocks5Reply(conn, 0x01, nil)
+		tracker.MarkFailed(req, "SSH client not connected")
+		return SSHReconnectRequired
+	}
+
+	listener, err := sshClient.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		log.Printf("SOCKS5 BIND 在服务器上监听失败: %v", err)
+		_ = writeSocks5Reply(conn, 0x01, nil)
+		tracker.MarkFailed(req, err.Error())
+		if isSSHReconnectError(err) {
+			t.invalidateSSHClientIfMatch(sshClient, "socks5 bind listen failed: "+err.Error())
+			return SSHReconnectRequired
+		}
+		return err
+	}
+	defer listener.Close()
+
+	// 服务器返回的是通配地址时，用SSH服务器的地址告知客户端
+	bound := listener.Addr().(*net.TCPAddr)
+	if bound.IP == nil || bound.IP.IsUnspecified() {
+		if serverAddr, ok := sshClient.RemoteAddr().(*net.TCPAddr); ok {
+			bound = &net.TCPAddr{IP: serverAddr.IP, Port: bound.Port}
+		}
+	}
+	if err := writeSocks5Reply(conn, 0x00, bound); err != nil {
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	acceptCtx, cancel := context.WithTimeout(ctx, socks5BindAcceptTimeout)
+	defer cancel()
+	safe.GO(func() {
+		<-acceptCtx.Done()
+		_ = listener.Close()
+	})
+	peer, err := listener.Accept()
+	if err != nil {
+		rep := byte(0x01)
+		if acceptCtx.Err() == context.DeadlineExceeded {
+			rep = 0x06
+		}
+		_ = writeSocks5Reply(conn, rep, nil)
+		tracker.MarkFailed(req, "等待对端连入失败: "+err.Error())
+		return err
+	}
+	// 只接受一个连入连接
+	_ = listener.Close()
+
+	if err := writeSocks5Reply(conn, 0x00, peer.RemoteAddr()); err != nil {
+		_ = peer.Close()
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+
+	tracker.MarkActive(req)
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+	safe.GO(func() {
+		t.copyProxyData(peer, conn, true)
+	})
+	t.copyProxyData(conn, peer, false)
+	tracker.MarkCompleted(req)
+	return nil
+}
@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func readSocks5ReplyAddress(t *testing.T, conn net.Conn) (byte, *net.TCPAddr) {
+	t.Helper()
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply[1], &net.TCPAddr{IP: net.IP(reply[4:8]), Port: int(binary.BigEndian.Uint16(reply[8:]))}
+}
+
+func TestSocks5BindThroughRemoteListener(t *testing.T) {
+	addr := startTestSSHServerWithRequests(t, passwordServerConfig("secret"), nil, handleTestTCPIPForward)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+
+	conn, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{0x05, 0x01, socks5MethodNoAuth})
+	if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{0x05, socks5CmdBind, 0x00, 0x01, 127, 0, 0, 1, 0x00, 0x15})
+
+	// 第一次应答：服务器上的监听地址
+	rep, bound := readSocks5ReplyAddress(t, conn)
+	if rep != 0x00 || bound.Port == 0 || bound.IP.IsUnspecified() {
+		t.Fatalf("unexpected first bind reply rep=%d addr=%v", rep, bound)
+	}
+
+	peer, err := net.Dial("tcp", bound.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	// 第二次应答：连入的对端地址
+	rep, origin := readSocks5ReplyAddress(t, conn)
+	if rep != 0x00 || origin.Port != peer.LocalAddr().(*net.TCPAddr).Port {
+		t.Fatalf("unexpected second bind reply rep=%d addr=%v, peer %v", rep, origin, peer.LocalAddr())
+	}
+
+	peer.Write([]byte("220 ready"))
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "220 ready" {
+		t.Fatalf("unexpected data from peer %q: %v", buf, err)
+	}
+	conn.Write([]byte("USER"))
+	peer.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadFull(peer, buf[:4]); err != nil || string(buf[:4]) != "USER" {
+		t.Fatalf("unexpected data from client %q: %v", buf[:4], err)
+	}
+
+	snapshot := tunnel.GetRequestTracker().Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Protocol != "SOCKS5-BIND" || snapshot[0].Status != RequestStatusActive {
+		t.Fatalf("unexpected request snapshot %+v", snapshot)
+	}
+}
+
+func TestSocks5BindRouteReject(t *testing.T) {
+	addr := startTestSSHServerWithRequests(t, passwordServerConfig("secret"), nil, handleTestTCPIPForward)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	loadTestRouteRules(t, tunnel, "IP-CIDR,127.0.0.0/8,REJECT\n")
+
+	conn, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{0x05, 0x01, socks5MethodNoAuth})
+	if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{0x05, socks5CmdBind, 0x00, 0x01, 127, 0, 0, 1, 0x00, 0x15})
+	if rep, _ := readSocks5ReplyAddress(t, conn); rep != 0x02 {
+		t.Fatalf("expected bind to be rejected by routing rule, got reply %d", rep)
+	}
+	if snapshot := tunnel.GetRequestTracker().Snapshot(); len(snapshot) != 1 || snapshot[0].Status != RequestStatusFailed {
+		t.Fatalf("unexpected request snapshot %+v", snapshot)
+	}
+}
@@ -0,0 +1,383 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ssh-tunnel/safe"
+)
+
+const socks5CmdUdpAssociate byte = 0x03
+
+// udpgw 协议标志位（badvpn-udpgw 兼容）
+const (
+	udpgwFlagKeepAlive byte = 0x01
+	udpgwFlagIPv6      byte = 0x08
+
+	// udpgwMaxFrame 单帧（不含2字节长度前缀）的最大长度
+	udpgwMaxFrame = 65535
+)
+
+// socks5UdpConfig SOCKS5 UDP ASSOCIATE 配置；relayAddress 为经SSH连接访问的 udpgw 兼容中继地址
+type socks5UdpConfig struct {
+	enabled      bool
+	relayAddress string
+	idleTimeout  time.Duration
+}
+
+// socks5UdpAssociation 一个UDP关联：本地UDP中继端口与一条经SSH的 udpgw 帧化TCP通道
+type socks5UdpAssociation struct {
+	tunnel     *Tunnel
+	req        *ProxyRequest
+	packetConn *net.UDPConn
+	relay      net.Conn
+	clientIP   net.IP
+	clientAddr atomic.Pointer[net.UDPAddr]
+	lastActive atomic.Int64
+
+	mu         sync.Mutex
+	connIDs    map[string]uint16 // 目标地址 -> udpgw 连接ID
+	targets    map[string]*net.UDPAddr
+	rejected   map[string]bool // 被路由规则拒绝的目标地址
+	nextConnID uint16
+}
+
+// socks5UdpAssociate 处理 UDP ASSOCIATE 命令，阻塞直到控制连接关闭、中继断开或关联空闲超时
+func (t *Tunnel) socks5UdpAssociate(ctx context.Context, conn net.Conn, user string) error {
+	tracker := t.GetRequestTracker()
+	relayHost, relayPort := splitHostPort(t.socks5Udp.relayAddress)
+	req := tracker.StartRequest(relayHost, relayPort, "SOCKS5-UDP", true)
+	tracker.SetUser(req, user)
+
+	bindIP := net.IPv4(127, 0, 0, 1)
+	var clientIP net.IP
+	if tcpAddr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		bindIP = tcpAddr.IP
+	}
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		clientIP = tcpAddr.IP
+	}
+	packetConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: bindIP})
+	if err != nil {
+		_ = writeSocks5Reply(conn, 0x01, nil)
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+	defer packetConn.Close()
+
+	relay, client, err := t.createSSHConn(t.socks5Udp.relayAddress)
+	if shouldReconnect(err) {
+		if client != nil {
+			t.invalidateSSHClientIfMatch(client, "socks5 udp relay dial failed: "+err.Error())
+		}
+		t.ReconnectSSHWithSource(t.reconnectContext(ctx), "socks5-udp")
+		relay, _, err = t.createSSHConn(t.socks5Udp.relayAddress)
+	}
+	if err != nil {
+		log.Printf("SOCKS5 UDP连接中继 %s 失败: %v", t.socks5Udp.relayAddress, err)
+		_ = writeSocks5Reply(conn, mapSocks5ReplyCode(err), nil)
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+	defer relay.Close()
+
+	bound := packetConn.LocalAddr().(*net.UDPAddr)
+	if err := writeSocks5Reply(conn, 0x00, &net.TCPAddr{IP: bound.IP, Port: bound.Port}); err != nil {
+		tracker.MarkFailed(req, err.Error())
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	tracker.MarkActive(req)
+	finishProxyConn := t.beginActiveProxyConn()
+	defer finishProxyConn()
+
+	association := &socks5UdpAssociation{
+		tunnel:     t,
+		req:        req,
+		packetConn: packetConn,
+		relay:      relay,
+		clientIP:   clientIP,
+		connIDs:    make(map[string]uint16),
+		targets:    make(map[string]*net.UDPAddr),
+		rejected:   make(map[string]bool),
+	}
+	association.touch()
+
+	assocCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reason := make(chan string, 4)
+	finish := func(why string) {
+		select {
+		case reason <- why:
+		default:
+		}
+		cancel()
+	}
+	safe.GO(func() {
+		// RFC 1928: 控制连接关闭时UDP关联随之结束
+		_, _ = io.Copy(io.Discard, conn)
+		finish("控制连接关闭")
+	})
+	safe.GO(func() {
+		finish(association.clientToRelay())
+	})
+	safe.GO(func() {
+		finish(association.relayToClient())
+	})
+	safe.GO(func() {
+		association.watchIdle(assocCtx, t.socks5UdpIdleTimeout(), finish)
+	})
+
+	<-assocCtx.Done()
+	_ = packetConn.Close()
+	_ = relay.Close()
+	_ = conn.Close()
+	why := "上下文取消"
+	select {
+	case why = <-reason:
+	default:
+	}
+	log.Printf("SOCKS5 UDP关联 %s 结束: %s", bound, why)
+	tracker.MarkCompleted(req)
+	return nil
+}
+
+func (t *Tunnel) socks5UdpIdleTimeout() time.Duration {
+	if t.socks5Udp.idleTimeout <= 0 {
+		return 60 * time.Second
+	}
+	return t.socks5Udp.idleTimeout
+}
+
+func (a *socks5UdpAssociation) touch() {
+	a.lastActive.Store(time.Now().UnixNano())
+}
+
+// watchIdle 在两个方向都没有数据报超过 timeout 时结束关联
+func (a *socks5UdpAssociation) watchIdle(ctx context.Context, timeout time.Duration, finish func(string)) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		idle := time.Since(time.Unix(0, a.lastActive.Load()))
+		if idle >= timeout {
+			finish("空闲超时")
+			return
+		}
+		timer.Reset(timeout - idle)
+	}
+}
+
+// clientToRelay 读取客户端的SOCKS5 UDP数据报，按目标地址分配 udpgw 连接ID后写入中继通道
+func (a *socks5UdpAssociation) clientToRelay() string {
+	buf := make([]byte, udpgwMaxFrame)
+	for {
+		n, from, err := a.packetConn.ReadFromUDP(buf)
+		if err != nil {
+			return "本地UDP端口关闭: " + err.Error()
+		}
+		// 只接受与控制连接同一来源IP的数据报
+		if a.clientIP != nil && !a.clientIP.IsUnspecified() && !from.IP.Equal(a.clientIP) {
+			continue
+		}
+		a.clientAddr.Store(from)
+
+		target, payload, err := parseSocks5UdpDatagram(buf[:n])
+		if err != nil {
+			log.Printf("丢弃SOCKS5 UDP数据报(来自 %s): %v", from, err)
+			continue
+		}
+		connID, addr, err := a.resolveTarget(target)
+		if errors.Is(err, errRouteRejected) {
+			continue
+		}
+		if err != nil {
+			log.Printf("SOCKS5 UDP目标 %s 解析失败: %v", target, err)
+			continue
+		}
+		if err := writeUdpgwFrame(a.relay, 0, connID, addr, payload); err != nil {
+			return "写入UDP中继失败: " + err.Error()
+		}
+		a.touch()
+		a.tunnel.addProxyUploadBytes(int64(len(payload)))
+		a.tunnel.GetRequestTracker().AddRequestBytes(a.req, len(payload), 0)
+	}
+}
+
+// relayToClient 读取中继返回的 udpgw 帧，封装为SOCKS5 UDP数据报发回客户端
+func (a *socks5UdpAssociation) relayToClient() string {
+	for {
+		flags, _, addr, payload, err := readUdpgwFrame(a.relay)
+		if err != nil {
+			return "UDP中继通道关闭: " + err.Error()
+		}
+		if flags&udpgwFlagKeepAlive != 0 {
+			continue
+		}
+		client := a.clientAddr.Load()
+		if client == nil {
+			continue
+		}
+		datagram := append(socks5UdpHeader(addr), payload...)
+		if _, err := a.packetConn.WriteToUDP(datagram, client); err != nil {
+			return "写入本地UDP端口失败: " + err.Error()
+		}
+		a.touch()
+		a.tunnel.addProxyDownloadBytes(int64(len(payload)))
+		a.tunnel.GetRequestTracker().AddRequestBytes(a.req, 0, len(payload))
+	}
+}
+
+// resolveTarget 返回目标对应的 udpgw 连接ID；udpgw 只传输IP地址，域名目标在本地解析一次后缓存。
+// 每个目标第一次出现时按路由规则判断：REJECT 的目标返回 errRouteRejected，之后的数据报直接丢弃；
+// UDP 没有本地直连通道，DIRECT 与 SSH 一样经SSH服务器上的 udpgw 中继发送
+func (a *socks5UdpAssociation) resolveTarget(target string) (uint16, *net.UDPAddr, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if connID, ok := a.connIDs[target]; ok {
+		return connID, a.targets[target], nil
+	}
+	if a.rejected[target] {
+		return 0, nil, errRouteRejected
+	}
+	srcIP := ""
+	if a.clientIP != nil {
+		srcIP = a.clientIP.String()
+	}
+	if route := a.tunnel.routeFor(target, srcIP, RouteActionSSH); route.Action == RouteActionReject {
+		a.rejected[target] = true
+		log.Printf("SOCKS5 UDP目标 %s 被路由规则拒绝(%s)，丢弃发往该目标的数据报", target, route.Rule)
+		return 0, nil, errRouteRejected
+	}
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return 0, nil, err
+	}
+	a.nextConnID++
+	a.connIDs[target] = a.nextConnID
+	a.targets[target] = addr
+	return a.nextConnID, addr, nil
+}
+
+// parseSocks5UdpDatagram 解析SOCKS5 UDP请求头(RSV FRAG ATYP DST.ADDR DST.PORT)，不支持分片
+func parseSocks5UdpDatagram(datagram []byte) (string, []byte, error) {
+	if len(datagram) < 4 {
+		return "", nil, errors.New("datagram too short")
+	}
+	if datagram[2] != 0x00 {
+		return "", nil, fmt.Errorf("fragmented datagram not supported: %d", datagram[2])
+	}
+	var host string
+	offset := 4
+	switch datagram[3] {
+	case 0x01:
+		if len(datagram) < offset+4+2 {
+			return "", nil, errors.New("datagram too short")
+		}
+		host = net.IP(datagram[offset : offset+4]).String()
+		offset += 4
+	case 0x03:
+		if len(datagram) < offset+1 {
+			return "", nil, errors.New("datagram too short")
+		}
+		hostLen := int(datagram[offset])
+		offset++
+		if hostLen == 0 || len(datagram) < offset+hostLen+2 {
+			return "", nil, errors.New("invalid domain length")
+		}
+		host = string(datagram[offset : offset+hostLen])
+		offset += hostLen
+	case 0x04:
+		if len(datagram) < offset+16+2 {
+			return "", nil, errors.New("datagram too short")
+		}
+		host = net.IP(datagram[offset : offset+16]).String()
+		offset += 16
+	default:
+		return "", nil, fmt.Errorf("unsupported address type: %d", datagram[3])
+	}
+	port := binary.BigEndian.Uint16(datagram[offset:])
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), datagram[offset+2:], nil
+}
+
+// socks5UdpHeader 构造发回客户端的SOCKS5 UDP响应头
+func socks5UdpHeader(addr *net.UDPAddr) []byte {
+	header := []byte{0x00, 0x00, 0x00}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		header = append(header, 0x01)
+		header = append(header, ip4...)
+	} else {
+		header = append(header, 0x04)
+		header = append(header, addr.IP.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(header, uint16(addr.Port))
+}
+
+// writeUdpgwFrame 写入一帧 udpgw 数据：2字节小端长度 + flags + 大端连接ID + 目标地址(IPv4/IPv6 + 大端端口) + 数据
+func writeUdpgwFrame(w io.Writer, flags byte, connID uint16, addr *net.UDPAddr, payload []byte) error {
+	ip := addr.IP.To4()
+	if ip == nil {
+		ip = addr.IP.To16()
+		flags |= udpgwFlagIPv6
+	}
+	if ip == nil {
+		return fmt.Errorf("invalid udpgw address: %v", addr)
+	}
+	frameLen := 3 + len(ip) + 2 + len(payload)
+	if frameLen > udpgwMaxFrame {
+		return fmt.Errorf("udpgw frame too large: %d", frameLen)
+	}
+	frame := make([]byte, 0, 2+frameLen)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(frameLen))
+	frame = append(frame, flags)
+	frame = binary.BigEndian.AppendUint16(frame, connID)
+	frame = append(frame, ip...)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(addr.Port))
+	frame = append(frame, payload...)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readUdpgwFrame 读取一帧 udpgw 数据
+func readUdpgwFrame(r io.Reader) (byte, uint16, *net.UDPAddr, []byte, error) {
+	lenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return 0, 0, nil, nil, err
+	}
+	frame := make([]byte, binary.LittleEndian.Uint16(lenBuf))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, 0, nil, nil, err
+	}
+	if len(frame) < 3 {
+		return 0, 0, nil, nil, errors.New("udpgw frame too short")
+	}
+	flags := frame[0]
+	connID := binary.BigEndian.Uint16(frame[1:3])
+	if flags&udpgwFlagKeepAlive != 0 {
+		return flags, connID, nil, nil, nil
+	}
+	ipLen := 4
+	if flags&udpgwFlagIPv6 != 0 {
+		ipLen = 16
+	}
+	if len(frame) < 3+ipLen+2 {
+		return 0, 0, nil, nil, errors.New("udpgw frame too short")
+	}
+	ip := make(net.IP, ipLen)
+	copy(ip, frame[3:3+ipLen])
+	port := binary.BigEndian.Uint16(frame[3+ipLen:])
+	return flags, connID, &net.UDPAddr{IP: ip, Port: int(port)}, frame[3+ipLen+2:], nil
+}
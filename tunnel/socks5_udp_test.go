@@ -0,0 +1,276 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestUdpEchoServer 启动UDP回显服务
+func startTestUdpEchoServer(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+// startTestUdpgwRelay 启动进程内的 udpgw 替身：每个连接ID对应一个UDP套接字，回包按原连接ID写回
+func startTestUdpgwRelay(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestUdpgw(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveTestUdpgw(conn net.Conn) {
+	defer conn.Close()
+	var writeMu sync.Mutex
+	sockets := make(map[uint16]*net.UDPConn)
+	defer func() {
+		for _, socket := range sockets {
+			socket.Close()
+		}
+	}()
+	for {
+		flags, connID, addr, payload, err := readUdpgwFrame(conn)
+		if err != nil {
+			return
+		}
+		if flags&udpgwFlagKeepAlive != 0 {
+			continue
+		}
+		socket, ok := sockets[connID]
+		if !ok {
+			socket, err = net.DialUDP("udp", nil, addr)
+			if err != nil {
+				return
+			}
+			sockets[connID] = socket
+			go func() {
+				buf := make([]byte, 65535)
+				for {
+					n, err := socket.Read(buf)
+					if err != nil {
+						return
+					}
+					writeMu.Lock()
+					writeUdpgwFrame(conn, 0, connID, addr, buf[:n])
+					writeMu.Unlock()
+				}
+			}()
+		}
+		socket.Write(payload)
+	}
+}
+
+// socks5UdpAssociateRequest 完成无认证握手并发送 UDP ASSOCIATE，返回应答码与中继地址
+func socks5UdpAssociateRequest(t *testing.T, conn net.Conn) (byte, *net.UDPAddr) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte{0x05, 0x01, socks5MethodNoAuth})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{0x05, socks5CmdUdpAssociate, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return header[1], &net.UDPAddr{IP: net.IP(header[4:8]), Port: int(binary.BigEndian.Uint16(header[8:]))}
+}
+
+func startTestSocks5Listener(t *testing.T, tunnel *Tunnel) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go tunnel.socks5Proxy(context.Background(), conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSocks5UdpAssociateThroughRelay(t *testing.T) {
+	echo := startTestUdpEchoServer(t)
+	relay := startTestUdpgwRelay(t)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	tunnel.socks5Udp = socks5UdpConfig{enabled: true, relayAddress: relay, idleTimeout: 300 * time.Millisecond}
+
+	control, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+	rep, bound := socks5UdpAssociateRequest(t, control)
+	if rep != 0x00 {
+		t.Fatalf("expected udp associate to succeed, got reply %d", rep)
+	}
+
+	client, err := net.DialUDP("udp", nil, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(3 * time.Second))
+	datagram := append(socks5UdpHeader(echo), []byte("ping")...)
+	if _, err := client.Write(datagram); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, payload, err := parseSocks5UdpDatagram(buf[:n])
+	if err != nil || target != echo.String() || string(payload) != "ping" {
+		t.Fatalf("unexpected reply target=%q payload=%q err=%v", target, payload, err)
+	}
+
+	// 空闲超时后关联结束，控制连接被关闭
+	control.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := control.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Fatalf("expected control connection to be closed on idle timeout, got %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		snapshot := tunnel.GetRequestTracker().Snapshot()
+		if len(snapshot) == 1 && snapshot[0].Status == RequestStatusCompleted {
+			if snapshot[0].Protocol != "SOCKS5-UDP" || snapshot[0].UploadBytes != 4 || snapshot[0].DownloadBytes != 4 {
+				t.Fatalf("unexpected association record %+v", snapshot[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("association not completed: %+v", snapshot)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSocks5UdpAssociateRouteRejectDropsDatagrams(t *testing.T) {
+	echo := startTestUdpEchoServer(t)
+	rejected := startTestUdpEchoServer(t)
+	relay := startTestUdpgwRelay(t)
+	addr := startTestSSHServer(t, passwordServerConfig("secret"), forwardDirectTCPIP)
+	tunnel := newJumpTestTunnel(addr, "secret")
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	tunnel.socks5Udp = socks5UdpConfig{enabled: true, relayAddress: relay}
+	// MATCH,DIRECT 对UDP不生效，仍经SSH中继
+	loadTestRouteRules(t, tunnel, fmt.Sprintf("DST-PORT,%d,REJECT\nMATCH,DIRECT\n", rejected.Port))
+
+	control, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+	rep, bound := socks5UdpAssociateRequest(t, control)
+	if rep != 0x00 {
+		t.Fatalf("expected udp associate to succeed, got reply %d", rep)
+	}
+
+	client, err := net.DialUDP("udp", nil, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(3 * time.Second))
+	for _, target := range []*net.UDPAddr{rejected, echo} {
+		if _, err := client.Write(append(socks5UdpHeader(target), []byte("ping")...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, _, err := parseSocks5UdpDatagram(buf[:n]); err != nil || target != echo.String() {
+		t.Fatalf("expected only the allowed target to reply, got %q (%v)", target, err)
+	}
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := client.Read(buf); err == nil {
+		t.Fatalf("expected datagram to the rejected target to be dropped, got %q", buf[:n])
+	}
+}
+
+func TestSocks5UdpAssociateDisabled(t *testing.T) {
+	tunnel := newTestTunnel()
+	tunnel.socks5Auth = socks5AuthConfig{allowNoAuth: true}
+	control, err := net.Dial("tcp", startTestSocks5Listener(t, tunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+	if rep, _ := socks5UdpAssociateRequest(t, control); rep != 0x07 {
+		t.Fatalf("expected command not supported, got %d", rep)
+	}
+}
+
+func TestUdpgwFrameWireFormat(t *testing.T) {
+	var buf bytes.Buffer
+	addr := &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 53}
+	if err := writeUdpgwFrame(&buf, 0, 0x0102, addr, []byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{10, 0, 0x00, 0x01, 0x02, 8, 8, 8, 8, 0x00, 0x35, 'q'}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("unexpected frame % x", buf.Bytes())
+	}
+
+	buf.Reset()
+	v6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	writeUdpgwFrame(&buf, 0, 7, v6, []byte("data"))
+	flags, connID, got, payload, err := readUdpgwFrame(&buf)
+	if err != nil || flags&udpgwFlagIPv6 == 0 || connID != 7 || got.String() != v6.String() || string(payload) != "data" {
+		t.Fatalf("unexpected ipv6 frame flags=%x conn=%d addr=%v payload=%q err=%v", flags, connID, got, payload, err)
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
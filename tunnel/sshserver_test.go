@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer 在本地启动一个进程内SSH服务器，返回监听地址；handleChannel 为空时拒绝所有通道
+func startTestSSHServer(t *testing.T, config *ssh.ServerConfig, handleChannel func(conn *ssh.ServerConn, newChannel ssh.NewChannel)) string {
+	t.Helper()
+	return startTestSSHServerWithRequests(t, config, handleChannel, nil)
+}
+
+// startTestSSHServerWithRequests 同 startTestSSHServer，handleRequests 非空时由其处理全局请求(如 tcpip-forward)
+func startTestSSHServerWithRequests(t *testing.T, config *ssh.ServerConfig, handleChannel func(conn *ssh.ServerConn, newChannel ssh.NewChannel), handleRequests func(conn *ssh.ServerConn, reqs <-chan *ssh.Request)) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("host signer: %v", err)
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			nConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+				if err != nil {
+					nConn.Close()
+					return
+				}
+				defer conn.Close()
+				if handleRequests != nil {
+					go handleRequests(conn, reqs)
+				} else {
+					go ssh.DiscardRequests(reqs)
+				}
+				for newChannel := range chans {
+					if handleChannel == nil {
+						newChannel.Reject(ssh.UnknownChannelType, "not supported")
+						continue
+					}
+					go handleChannel(conn, newChannel)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// acceptPublicKeys 返回只接受指定公钥的服务器认证回调
+func acceptPublicKeys(keys ...ssh.PublicKey) func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+	return func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		for _, k := range keys {
+			if string(k.Marshal()) == string(key.Marshal()) {
+				return nil, nil
+			}
+		}
+		return nil, errTestAuthRejected
+	}
+}
+
+// forwardDirectTCPIP 处理 direct-tcpip 通道，将流量转发到请求的目标地址
+func forwardDirectTCPIP(_ *ssh.ServerConn, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		newChannel.Reject(ssh.UnknownChannelType, "not supported")
+		return
+	}
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(channel, target)
+		channel.CloseWrite()
+	}()
+	io.Copy(target, channel)
+	target.Close()
+	channel.Close()
+}
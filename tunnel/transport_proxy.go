@@ -0,0 +1,348 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-tunnel/cfg"
+)
+
+const (
+	TransportProxyHTTP   = "http"
+	TransportProxySOCKS5 = "socks5"
+)
+
+// transportProxy 连接SSH服务器（有跳板机时为第一个跳板机）前经过的上游代理
+type transportProxy struct {
+	kind     string
+	address  string
+	username string
+	password string
+}
+
+// ProxyError 传输代理一段失败（代理不可达、认证失败或代理拒绝连接目标）
+type ProxyError struct {
+	Proxy string
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("transport proxy %s: %v", e.Proxy, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// newTransportProxy 解析 profile 中的传输代理配置，未启用时返回 nil；
+// URL 支持 http://host:port(HTTP CONNECT) 与 socks5://host:port，认证信息可写在 URL 中或单独配置
+func newTransportProxy(config *cfg.TransportProxy) (*transportProxy, error) {
+	if config == nil || !config.Enabled || strings.TrimSpace(config.URL) == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(strings.TrimSpace(config.URL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid transport proxy url: %w", err)
+	}
+
+	proxy := &transportProxy{username: config.Username}
+	defaultPort := ""
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		proxy.kind, defaultPort = TransportProxyHTTP, "80"
+	case "socks5", "socks5h":
+		proxy.kind, defaultPort = TransportProxySOCKS5, "1080"
+	default:
+		return nil, fmt.Errorf("unsupported transport proxy scheme %q, expected http or socks5", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("transport proxy host is required")
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	proxy.address = net.JoinHostPort(u.Hostname(), port)
+
+	password := config.Password
+	if u.User != nil && proxy.username == "" {
+		proxy.username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if proxy.password, err = cfg.DecryptSecret(password); err != nil {
+		return nil, fmt.Errorf("decrypt transport proxy password: %w", err)
+	}
+	return proxy, nil
+}
+
+// ValidateTransportProxy 校验传输代理配置，未启用时不做检查
+func ValidateTransportProxy(config *cfg.TransportProxy) error {
+	_, err := newTransportProxy(config)
+	return err
+}
+
+// String 返回不含认证信息的代理地址，用于日志和状态展示
+func (p *transportProxy) String() string {
+	return p.kind + "://" + p.address
+}
+
+// dial 经代理建立到 address 的TCP连接，失败时返回 *ProxyError
+func (p *transportProxy) dial(address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.address, timeout)
+	if err != nil {
+		return nil, &ProxyError{Proxy: p.String(), Err: err}
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	switch p.kind {
+	case TransportProxySOCKS5:
+		err = p.socks5Connect(conn, address)
+	default:
+		conn, err = p.httpConnect(conn, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &ProxyError{Proxy: p.String(), Err: err}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// bufferedConn 读取CONNECT响应时 bufio 可能多读了服务器的数据（如SSH版本行），需要先返回这部分
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (p *transportProxy) httpConnect(conn net.Conn, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.username + ":" + p.password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return conn, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("CONNECT %s rejected: %s", address, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// socks5Connect 按 RFC 1928/1929 完成握手，目标主机名交给代理解析
+func (p *transportProxy) socks5Connect(conn net.Conn, address string) error {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", portText)
+	}
+
+	methods := []byte{0x00}
+	if p.username != "" {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read method selection: %w", err)
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("unexpected socks version %d", reply[0])
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if len(p.username) > 255 || len(p.password) > 255 {
+			return errors.New("socks5 username or password too long")
+		}
+		auth := []byte{0x01, byte(len(p.username))}
+		auth = append(auth, p.username...)
+		auth = append(auth, byte(len(p.password)))
+		auth = append(auth, p.password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("read auth reply: %w", err)
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5 authentication failed")
+		}
+	default:
+		return errors.New("socks5 proxy requires an unsupported authentication method")
+	}
+
+	request := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(request, 0x01)
+		request = append(request, ip.To4()...)
+	} else if ip != nil {
+		request = append(request, 0x04)
+		request = append(request, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5 host name too long")
+		}
+		request = append(request, 0x03, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("read connect reply: %w", err)
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("socks5 connect %s failed: %s", address, socks5ReplyText(header[1]))
+	}
+	var skip int
+	switch header[3] {
+	case 0x01:
+		skip = net.IPv4len + 2
+	case 0x04:
+		skip = net.IPv6len + 2
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0]) + 2
+	default:
+		return fmt.Errorf("unexpected socks5 address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
+
+func socks5ReplyText(code byte) string {
+	switch code {
+	case 0x01:
+		return "general failure"
+	case 0x02:
+		return "connection not allowed by ruleset"
+	case 0x03:
+		return "network unreachable"
+	case 0x04:
+		return "host unreachable"
+	case 0x05:
+		return "connection refused"
+	case 0x06:
+		return "TTL expired"
+	case 0x07:
+		return "command not supported"
+	case 0x08:
+		return "address type not supported"
+	}
+	return fmt.Sprintf("reply code %d", code)
+}
+
+// TransportProbe 传输链路探测结果，FailedLeg 为 proxy(代理一段)、tls/websocket(封装一段)、ssh(SSH一段) 或空(正常)
+type TransportProbe struct {
+	Proxy     string `json:"proxy,omitempty"`
+	Wrap      string `json:"wrap,omitempty"`
+	Target    string `json:"target"`
+	FailedLeg string `json:"failedLeg,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Banner    string `json:"banner,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// ProbeTransport 经传输代理和封装（如已配置）连接第一跳并读取SSH版本行，用于区分代理、封装与SSH服务器的失败
+func (t *Tunnel) ProbeTransport() TransportProbe {
+	timeout := t.sshDialTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	t.authMutex.Lock()
+	proxy := t.transportProxy
+	transport := newSSHTransport(t.transportProxy, t.transportWrapper)
+	target := t.serverAddress
+	if len(t.jumpHops) > 0 {
+		target = t.jumpHops[0].address
+	}
+	t.authMutex.Unlock()
+
+	probe := TransportProbe{Target: target}
+	if proxy != nil {
+		probe.Proxy = proxy.String()
+	}
+	if transport != nil && transport.wrapper != nil {
+		probe.Wrap = transport.wrapper.kind
+	}
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if transport != nil {
+		conn, err = transport.dial(target, timeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", target, timeout)
+	}
+	if err != nil {
+		probe.Error = err.Error()
+		probe.FailedLeg = "ssh"
+		var proxyErr *ProxyError
+		var wrapErr *TransportWrapError
+		if errors.As(err, &proxyErr) {
+			probe.FailedLeg = "proxy"
+		} else if errors.As(err, &wrapErr) {
+			probe.FailedLeg = wrapErr.Type
+		}
+		return probe
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	probe.LatencyMs = time.Since(start).Milliseconds()
+	banner = strings.TrimSpace(banner)
+	if err != nil || !strings.HasPrefix(banner, "SSH-") {
+		probe.FailedLeg = "ssh"
+		if err != nil {
+			probe.Error = fmt.Sprintf("read ssh banner: %v", err)
+		} else {
+			probe.Error = fmt.Sprintf("unexpected ssh banner %q", banner)
+		}
+		return probe
+	}
+	probe.Banner = banner
+	return probe
+}
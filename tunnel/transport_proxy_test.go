@@ -0,0 +1,226 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"ssh-tunnel/cfg"
+)
+
+// startTestConnectProxy 启动只支持 CONNECT 的HTTP代理，user 非空时要求 Basic 认证
+func startTestConnectProxy(t *testing.T, user string, password string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				if user != "" {
+					want := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+					if req.Header.Get("Proxy-Authorization") != want {
+						io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+						return
+					}
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer target.Close()
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(target, reader)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startTestSocks5Proxy 启动要求用户名密码认证的SOCKS5代理，只支持 CONNECT 域名/IPv4 目标
+func startTestSocks5Proxy(t *testing.T, user string, password string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{0x05, 0x02})
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				gotUser := make([]byte, buf[1])
+				io.ReadFull(conn, gotUser)
+				io.ReadFull(conn, buf[:1])
+				gotPassword := make([]byte, buf[0])
+				io.ReadFull(conn, gotPassword)
+				if string(gotUser) != user || string(gotPassword) != password {
+					conn.Write([]byte{0x01, 0x01})
+					return
+				}
+				conn.Write([]byte{0x01, 0x00})
+
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 0x01:
+					io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 0x03:
+					io.ReadFull(conn, buf[:1])
+					name := make([]byte, buf[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				io.ReadFull(conn, buf[:2])
+				port := binary.BigEndian.Uint16(buf[:2])
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+				if err != nil {
+					conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialThroughTransportProxy(t *testing.T) {
+	targetAddr := startTestSSHServer(t, passwordServerConfig("secret"), nil)
+	httpProxy := startTestConnectProxy(t, "alice", "p@ss")
+	socksProxy := startTestSocks5Proxy(t, "bob", "s3cret")
+
+	cases := []struct {
+		name  string
+		proxy cfg.TransportProxy
+	}{
+		{"http", cfg.TransportProxy{Enabled: true, URL: "http://" + httpProxy, Username: "alice", Password: "p@ss"}},
+		{"socks5", cfg.TransportProxy{Enabled: true, URL: "socks5://" + socksProxy, Username: "bob", Password: "s3cret"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := newTransportProxy(&tc.proxy)
+			if err != nil {
+				t.Fatalf("newTransportProxy: %v", err)
+			}
+			tunnel := newJumpTestTunnel(targetAddr, "secret")
+			tunnel.transportProxy = proxy
+
+			client, err := tunnel.dialSSH()
+			if err != nil {
+				t.Fatalf("dial through %s proxy: %v", tc.name, err)
+			}
+			client.Close()
+
+			if probe := tunnel.ProbeTransport(); probe.FailedLeg != "" || probe.Banner == "" {
+				t.Fatalf("unexpected probe result %+v", probe)
+			}
+		})
+	}
+
+	// 代理认证失败属于代理一段
+	proxy, _ := newTransportProxy(&cfg.TransportProxy{Enabled: true, URL: "http://" + httpProxy, Username: "alice", Password: "wrong"})
+	tunnel := newJumpTestTunnel(targetAddr, "secret")
+	tunnel.transportProxy = proxy
+	_, err := tunnel.dialSSH()
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		t.Fatalf("expected proxy error, got %v", err)
+	}
+	if hop := failedHop(err); hop != "transport proxy http://"+httpProxy {
+		t.Fatalf("unexpected failed hop %q", hop)
+	}
+	if probe := tunnel.ProbeTransport(); probe.FailedLeg != "proxy" {
+		t.Fatalf("expected proxy leg failure, got %+v", probe)
+	}
+}
+
+func TestProbeTransportReportsSSHLeg(t *testing.T) {
+	// 代理可用，但目标端口不是SSH服务
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			conn.Close()
+		}
+	}()
+
+	proxy, err := newTransportProxy(&cfg.TransportProxy{Enabled: true, URL: "http://" + startTestConnectProxy(t, "", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel := newJumpTestTunnel(listener.Addr().String(), "secret")
+	tunnel.transportProxy = proxy
+	if probe := tunnel.ProbeTransport(); probe.FailedLeg != "ssh" {
+		t.Fatalf("expected ssh leg failure, got %+v", probe)
+	}
+}
+
+func TestNewTransportProxyValidation(t *testing.T) {
+	if proxy, err := newTransportProxy(&cfg.TransportProxy{URL: "http://proxy:8080"}); proxy != nil || err != nil {
+		t.Fatalf("disabled proxy should be ignored, got %+v, %v", proxy, err)
+	}
+	if _, err := newTransportProxy(&cfg.TransportProxy{Enabled: true, URL: "ftp://proxy:21"}); err == nil {
+		t.Fatal("expected unsupported scheme to be rejected")
+	}
+	proxy, err := newTransportProxy(&cfg.TransportProxy{Enabled: true, URL: "socks5://user:pw@proxy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy.address != "proxy:1080" || proxy.username != "user" || proxy.password != "pw" || proxy.String() != "socks5://proxy:1080" {
+		t.Fatalf("unexpected proxy %+v", proxy)
+	}
+}
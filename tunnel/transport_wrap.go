@@ -0,0 +1,435 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-tunnel/cfg"
+)
+
+const (
+	TransportWrapTLS       = "tls"
+	TransportWrapWebSocket = "websocket"
+
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// transportWrapper 将连接第一跳的TCP流封装为TLS或WebSocket
+type transportWrapper struct {
+	kind      string
+	tlsConfig *tls.Config
+	wsURL     *url.URL
+	headers   http.Header
+}
+
+// TransportWrapError TLS握手或WebSocket升级失败
+type TransportWrapError struct {
+	Type    string
+	Address string
+	Err     error
+}
+
+func (e *TransportWrapError) Error() string {
+	return fmt.Sprintf("%s wrapper %s: %v", e.Type, e.Address, e.Err)
+}
+
+func (e *TransportWrapError) Unwrap() error {
+	return e.Err
+}
+
+// newTransportWrapper 解析 profile 中的封装配置，未配置时返回 nil
+func newTransportWrapper(config *cfg.TransportWrap) (*transportWrapper, error) {
+	if config == nil || strings.TrimSpace(config.Type) == "" {
+		return nil, nil
+	}
+	w := &transportWrapper{kind: strings.ToLower(strings.TrimSpace(config.Type))}
+	useTLS := w.kind == TransportWrapTLS
+
+	switch w.kind {
+	case TransportWrapTLS:
+	case TransportWrapWebSocket:
+		u, err := url.Parse(strings.TrimSpace(config.URL))
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket url: %w", err)
+		}
+		switch u.Scheme {
+		case "ws":
+		case "wss":
+			useTLS = true
+		default:
+			return nil, fmt.Errorf("unsupported websocket scheme %q, expected ws or wss", u.Scheme)
+		}
+		if u.Hostname() == "" {
+			return nil, errors.New("websocket url host is required")
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		w.wsURL = u
+		w.headers = make(http.Header)
+		for k, v := range config.Headers {
+			w.headers.Set(k, v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transport wrap type %q, expected tls or websocket", config.Type)
+	}
+
+	if useTLS {
+		tlsConfig, err := newWrapTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		w.tlsConfig = tlsConfig
+	}
+	return w, nil
+}
+
+func newWrapTLSConfig(config *cfg.TransportWrap) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         strings.TrimSpace(config.ServerName),
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if caFile := expandHomePath(config.CAFile); caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile := expandHomePath(config.ClientCertFile); certFile != "" {
+		keyFile := expandHomePath(config.ClientKeyFile)
+		if keyFile == "" {
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// ValidateTransportWrap 校验封装配置（含证书文件是否可读），未配置时不做检查
+func ValidateTransportWrap(config *cfg.TransportWrap) error {
+	_, err := newTransportWrapper(config)
+	return err
+}
+
+// dialAddress 返回实际建立TCP连接的地址：WebSocket 连接网关，TLS 直接连接SSH服务器地址
+func (w *transportWrapper) dialAddress(target string) string {
+	if w.kind != TransportWrapWebSocket {
+		return target
+	}
+	port := w.wsURL.Port()
+	if port == "" {
+		port = "80"
+		if w.wsURL.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(w.wsURL.Hostname(), port)
+}
+
+// wrap 在已建立的TCP连接上完成TLS握手或WebSocket升级，失败时关闭连接并返回 *TransportWrapError
+func (w *transportWrapper) wrap(conn net.Conn, address string) (net.Conn, error) {
+	wrapped, err := w.handshake(conn, address)
+	if err != nil {
+		conn.Close()
+		return nil, &TransportWrapError{Type: w.kind, Address: address, Err: err}
+	}
+	return wrapped, nil
+}
+
+func (w *transportWrapper) handshake(conn net.Conn, address string) (net.Conn, error) {
+	if w.tlsConfig != nil {
+		tlsConfig := w.tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			tlsConfig.ServerName = host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+	if w.kind == TransportWrapWebSocket {
+		return w.upgradeWebSocket(conn)
+	}
+	return conn, nil
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (w *transportWrapper) upgradeWebSocket(conn net.Conn) (net.Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: w.wsURL.Path, RawQuery: w.wsURL.RawQuery},
+		Host:       w.wsURL.Host,
+		Header:     w.headers.Clone(),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("read websocket upgrade response: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket upgrade rejected: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		return nil, errors.New("invalid Sec-WebSocket-Accept")
+	}
+	return newWebSocketConn(conn, reader, true), nil
+}
+
+// webSocketConn 以二进制帧承载字节流的 net.Conn；客户端发送的帧需要掩码，服务端(测试网关)不需要
+type webSocketConn struct {
+	net.Conn
+	reader    *bufio.Reader
+	masked    bool
+	writeMu   sync.Mutex
+	remaining uint64
+	maskKey   []byte
+	maskPos   int
+	closed    bool
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, masked bool) *webSocketConn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	return &webSocketConn{Conn: conn, reader: reader, masked: masked}
+}
+
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.closed {
+			return 0, io.EOF
+		}
+		if err := c.nextDataFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.reader.Read(b)
+	if c.maskKey != nil {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.maskKey[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// nextDataFrame 读取下一个数据帧的头部；控制帧在这里直接处理
+func (c *webSocketConn) nextDataFrame() error {
+	opcode, length, maskKey, err := c.readFrameHeader()
+	if err != nil {
+		return err
+	}
+	switch opcode {
+	case wsOpContinuation, wsOpText, wsOpBinary:
+		c.remaining, c.maskKey, c.maskPos = length, maskKey, 0
+		return nil
+	}
+
+	if length > 125 {
+		return errors.New("websocket control frame too large")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+	for i := range payload {
+		if maskKey != nil {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+	switch opcode {
+	case wsOpPing:
+		return c.writeFrame(wsOpPong, payload)
+	case wsOpClose:
+		c.closed = true
+		c.writeFrame(wsOpClose, payload)
+		return io.EOF
+	}
+	return nil
+}
+
+func (c *webSocketConn) readFrameHeader() (byte, uint64, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return 0, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return 0, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	var maskKey []byte
+	if header[1]&0x80 != 0 {
+		maskKey = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, maskKey); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return opcode, length, maskKey, nil
+}
+
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsOpBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+	maskBit := byte(0)
+	if c.masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if c.masked {
+		maskKey := make([]byte, 4)
+		if _, err := io.ReadFull(rand.Reader, maskKey); err != nil {
+			return err
+		}
+		frame = append(frame, maskKey...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := start; i < len(frame); i++ {
+			frame[i] ^= maskKey[(i-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *webSocketConn) Close() error {
+	c.writeFrame(wsOpClose, []byte{0x03, 0xe8})
+	return c.Conn.Close()
+}
+
+// sshTransport 第一跳的传输链路：可选的上游代理 + 可选的TLS/WebSocket封装
+type sshTransport struct {
+	proxy   *transportProxy
+	wrapper *transportWrapper
+}
+
+func newSSHTransport(proxy *transportProxy, wrapper *transportWrapper) *sshTransport {
+	if proxy == nil && wrapper == nil {
+		return nil
+	}
+	return &sshTransport{proxy: proxy, wrapper: wrapper}
+}
+
+// dial 建立到第一跳的连接，返回的连接可直接用于 ssh.NewClientConn
+func (tr *sshTransport) dial(address string, timeout time.Duration) (net.Conn, error) {
+	target := address
+	if tr.wrapper != nil {
+		target = tr.wrapper.dialAddress(address)
+	}
+
+	var conn net.Conn
+	var err error
+	if tr.proxy != nil {
+		conn, err = tr.proxy.dial(target, timeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", target, timeout)
+	}
+	if err != nil || tr.wrapper == nil {
+		return conn, err
+	}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	conn, err = tr.wrapper.wrap(conn, target)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
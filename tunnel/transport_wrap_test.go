@@ -0,0 +1,284 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"ssh-tunnel/cfg"
+)
+
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	tlsCert tls.Certificate
+}
+
+// newTestCertificate 签发测试证书；parent 为空时生成自签名CA
+func newTestCertificate(t *testing.T, parent *testCertificate, commonName string, dnsNames []string, usage x509.ExtKeyUsage) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key, tlsCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func (c *testCertificate) writePEM(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// testGateway 记录网关侧的连接，便于模拟网关断开
+type testGateway struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (g *testGateway) pipe(conn net.Conn, targetAddr string) {
+	target, err := net.Dial("tcp", targetAddr)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	g.mu.Lock()
+	g.conns = append(g.conns, conn, target)
+	g.mu.Unlock()
+	go func() {
+		io.Copy(target, conn)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+	conn.Close()
+}
+
+func (g *testGateway) dropAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, conn := range g.conns {
+		conn.Close()
+	}
+	g.conns = nil
+}
+
+// startTestWebSocketGateway 模拟 websocat 类网关：升级为 WebSocket 后把二进制帧转发到SSH服务器
+func startTestWebSocketGateway(t *testing.T, targetAddr string, useTLS bool) (*httptest.Server, *testGateway) {
+	t.Helper()
+	gateway := &testGateway{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ssh" || r.Header.Get("X-Gateway-Token") != "token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		key := r.Header.Get("Sec-WebSocket-Key")
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: "+webSocketAccept(key)+"\r\n\r\n")
+		gateway.pipe(newWebSocketConn(conn, rw.Reader, false), targetAddr)
+	}))
+	if useTLS {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server, gateway
+}
+
+func TestDialThroughTLSWrapper(t *testing.T) {
+	dir := t.TempDir()
+	targetAddr := startTestSSHServer(t, passwordServerConfig("secret"), nil)
+	ca := newTestCertificate(t, nil, "test-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := newTestCertificate(t, ca, "gateway", []string{"gateway.test"}, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCertificate(t, ca, "client", nil, x509.ExtKeyUsageClientAuth)
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	clientCertFile, clientKeyFile := clientCert.writePEM(t, dir, "client")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	gateway := &testGateway{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go gateway.pipe(conn, targetAddr)
+		}
+	}()
+
+	dial := func(config cfg.TransportWrap) error {
+		wrapper, err := newTransportWrapper(&config)
+		if err != nil {
+			return err
+		}
+		tunnel := newJumpTestTunnel(listener.Addr().String(), "secret")
+		tunnel.transportWrapper = wrapper
+		client, err := tunnel.dialSSH()
+		if err == nil {
+			client.Close()
+		}
+		return err
+	}
+
+	if err := dial(cfg.TransportWrap{Type: "tls", ServerName: "gateway.test", CAFile: caFile, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}); err != nil {
+		t.Fatalf("dial through tls wrapper: %v", err)
+	}
+
+	// SNI 与证书不符、或缺少客户端证书时握手失败，并归因到封装一段
+	var wrapErr *TransportWrapError
+	if err := dial(cfg.TransportWrap{Type: "tls", ServerName: "other.test", CAFile: caFile, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}); !errors.As(err, &wrapErr) {
+		t.Fatalf("expected wrap error for wrong server name, got %v", err)
+	}
+	if err := dial(cfg.TransportWrap{Type: "tls", ServerName: "gateway.test", CAFile: caFile}); err == nil {
+		t.Fatal("expected dial without client certificate to fail")
+	}
+}
+
+func TestDialThroughSecureWebSocketWrapper(t *testing.T) {
+	targetAddr := startTestSSHServer(t, passwordServerConfig("secret"), nil)
+	server, _ := startTestWebSocketGateway(t, targetAddr, true)
+
+	caFile := filepath.Join(t.TempDir(), "gateway.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := newTransportWrapper(&cfg.TransportWrap{
+		Type:       "websocket",
+		URL:        "wss://" + server.Listener.Addr().String() + "/ssh",
+		ServerName: "example.com",
+		CAFile:     caFile,
+		Headers:    map[string]string{"X-Gateway-Token": "token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel := newJumpTestTunnel("ssh.internal:22", "secret")
+	tunnel.transportWrapper = wrapper
+	client, err := tunnel.dialSSH()
+	if err != nil {
+		t.Fatalf("dial through wss wrapper: %v", err)
+	}
+	client.Close()
+
+	if probe := tunnel.ProbeTransport(); probe.FailedLeg != "" || probe.Wrap != "websocket" {
+		t.Fatalf("unexpected probe %+v", probe)
+	}
+
+	// 网关拒绝升级（如鉴权失败）时归因到 websocket 一段
+	wrapper.headers.Del("X-Gateway-Token")
+	if probe := tunnel.ProbeTransport(); probe.FailedLeg != "websocket" {
+		t.Fatalf("expected websocket leg failure, got %+v", probe)
+	}
+}
+
+func TestWebSocketWrapperReconnectAndKeepAlive(t *testing.T) {
+	targetAddr := startTestSSHServer(t, passwordServerConfig("secret"), nil)
+	server, gateway := startTestWebSocketGateway(t, targetAddr, false)
+
+	wrapper, err := newTransportWrapper(&cfg.TransportWrap{
+		Type:    "websocket",
+		URL:     "ws://" + server.Listener.Addr().String() + "/ssh",
+		Headers: map[string]string{"X-Gateway-Token": "token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel := newJumpTestTunnel("ssh.internal:22", "secret")
+	tunnel.transportWrapper = wrapper
+	tunnel.keepAlive = KeepAliveConfig{Interval: 1, CountMax: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tunnel.ReconnectSSHWithSource(ctx, "test")
+	first := tunnel.PeekSSHClient()
+	if first == nil {
+		t.Fatal("expected ssh client after reconnect")
+	}
+
+	// 保活请求经 WebSocket 往返，连接应保持不变
+	time.Sleep(2500 * time.Millisecond)
+	if tunnel.PeekSSHClient() != first {
+		t.Fatal("expected keepalive to keep the wrapped connection alive")
+	}
+	if _, err := tunnel.MeasureSSHLatency(); err != nil {
+		t.Fatalf("latency through wrapper: %v", err)
+	}
+
+	// 网关断开后由保活监控触发重连，并再次经过封装建立连接
+	gateway.dropAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if current := tunnel.PeekSSHClient(); current != nil && current != first {
+			if stats := tunnel.SnapshotSSHConnectionStats(); stats.ReconnectCount != 1 {
+				t.Fatalf("expected one reconnect, got %d", stats.ReconnectCount)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("expected tunnel to reconnect through the websocket gateway")
+}
@@ -12,7 +12,6 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/url"
 	"ssh-tunnel/cfg"
 	"ssh-tunnel/safe"
 	"strings"
@@ -44,19 +43,38 @@ type KeepAliveConfig struct {
 type Tunnel struct {
 	enableSocks5           bool
 	enableHttp             bool
+	enableMixed            bool
 	enableHttpBasic        bool
 	enableHttpOverSSH      bool
 	enableHttpDomainFilter bool
 	httpLocalAddress       string
+	mixedLocalAddress      string
 	httpBasicUserName      string
 	httpBasicPassword      string
 	serverAddress          string
 	localAddress           string
 	user                   string
 	auth                   []ssh.AuthMethod
+	authChain              *authChain
+	authMutex              sync.Mutex
+	keyPassphrases         map[string]string
+	challenges             challengeBroker
+	jumpHops               []*jumpHop
+	algorithms             ssh.Algorithms
+	transportProxy         *transportProxy
+	transportWrapper       *transportWrapper
+	authChallengeTimeout   time.Duration
+	certExpiryWarn         time.Duration
 	hostKeys               ssh.HostKeyCallback
+	hostKeyVerifier        *hostKeyVerifier
+	profileID              string
 	domains                map[string]bool
-	domainMatchCache       map[string]bool
+	domainMatcher          *domainMatcher
+	domainCache            *domainMatchCache
+	domainListErrors       []DomainListError
+	domainListFiles        []string
+	domainSubs             domainSubscriptionSet
+	subscriptionDomains    map[string]bool
 	domainMutex            sync.RWMutex
 	appConfig              *cfg.AppConfig
 
@@ -74,11 +92,29 @@ type Tunnel struct {
 	lastReconnectError           string
 	lastReconnectAt              time.Time
 	lastReconnectFailureAt       time.Time
+	lastHostKeyMismatch          *HostKeyMismatchInfo
+	hostKeyFingerprint           string
+	authMethodUsed               string
+	lastFailedHop                string
 	tunnelCtx                    context.Context
 	reconnectMutex               sync.Mutex // 添加重连锁，确保同一时间只有一个重连过程
 	reconnecting                 bool
 	reconnectDone                chan struct{}
 	sshDialFn                    func() (*ssh.Client, error)
+	channelProbe                 channelProbeConfig
+	channelProbeState            channelProbeState
+	socks5Auth                   socks5AuthConfig
+	socks5Udp                    socks5UdpConfig
+	httpTls                      httpTlsConfig
+	proxyUsers                   proxyUserStore
+	proxyUsersWriteMu            sync.Mutex // 串行化用户文件的读改写
+	authLimiter                  authFailureLimiter
+	routeRules                   routeRuleSet
+	localForwards                map[string]*localForward
+	localForwardsMutex           sync.Mutex
+	remoteForwards               []cfg.RemoteForward
+	remoteForwardStates          map[string]*remoteForward
+	remoteForwardsMutex          sync.Mutex
 
 	proxyUploadBytes   uint64
 	proxyDownloadBytes uint64
@@ -112,12 +148,16 @@ type ProxyMetrics struct {
 }
 
 type SSHConnectionStats struct {
-	ConnectionCount              int       `json:"connectionCount"`
-	ReconnectCount               uint64    `json:"reconnectCount"`
-	ConsecutiveReconnectFailures uint64    `json:"consecutiveReconnectFailures"`
-	LastReconnectError           string    `json:"lastReconnectError,omitempty"`
-	LastReconnectAt              time.Time `json:"lastReconnectAt,omitempty"`
-	LastReconnectFailureAt       time.Time `json:"lastReconnectFailureAt,omitempty"`
+	ConnectionCount              int                  `json:"connectionCount"`
+	ReconnectCount               uint64               `json:"reconnectCount"`
+	ConsecutiveReconnectFailures uint64               `json:"consecutiveReconnectFailures"`
+	LastReconnectError           string               `json:"lastReconnectError,omitempty"`
+	LastReconnectAt              time.Time            `json:"lastReconnectAt,omitempty"`
+	LastReconnectFailureAt       time.Time            `json:"lastReconnectFailureAt,omitempty"`
+	HostKeyFingerprint           string               `json:"hostKeyFingerprint,omitempty"`
+	HostKeyMismatch              *HostKeyMismatchInfo `json:"hostKeyMismatch,omitempty"`
+	AuthMethodUsed               string               `json:"authMethodUsed,omitempty"`
+	LastFailedHop                string               `json:"lastFailedHop,omitempty"`
 }
 
 type ListenerStats struct {
@@ -246,22 +286,57 @@ func (t *Tunnel) Domains() map[string]bool {
 	return cloneStringBoolMap(t.domains)
 }
 
+// SetDomains 替换本地域名过滤条目，与订阅条目合并后重建匹配器，已缓存的匹配结果随之失效
 func (t *Tunnel) SetDomains(domains map[string]bool) {
 	t.domainMutex.Lock()
 	t.domains = cloneStringBoolMap(domains)
+	t.domainMatcher = newDomainMatcher(mergeDomainEntries(t.domains, t.subscriptionDomains))
 	t.domainMutex.Unlock()
+	t.domainMatchCacheStore().reset()
 }
 
 func (t *Tunnel) DomainMatchCache() map[string]bool {
-	t.domainMutex.RLock()
-	defer t.domainMutex.RUnlock()
-	return cloneStringBoolMap(t.domainMatchCache)
+	return t.domainMatchCacheStore().snapshot()
 }
 
+// SetDomainMatchCache 清空匹配缓存后写入给定的条目
 func (t *Tunnel) SetDomainMatchCache(domainMatchCache map[string]bool) {
+	cache := t.domainMatchCacheStore()
+	cache.reset()
+	for host, matched := range domainMatchCache {
+		cache.put(host, matched)
+	}
+}
+
+// DomainCacheStats 返回域名匹配缓存的容量、命中与淘汰统计
+func (t *Tunnel) DomainCacheStats() DomainCacheStats {
+	return t.domainMatchCacheStore().stats()
+}
+
+// configureDomainCache 容量或过期时间变化时重建域名匹配缓存
+func (t *Tunnel) configureDomainCache(capacity int, ttl time.Duration) {
+	cache := newDomainMatchCache(capacity, ttl)
 	t.domainMutex.Lock()
-	t.domainMatchCache = cloneStringBoolMap(domainMatchCache)
-	t.domainMutex.Unlock()
+	defer t.domainMutex.Unlock()
+	if t.domainCache != nil && t.domainCache.capacity == cache.capacity && t.domainCache.ttl == cache.ttl {
+		return
+	}
+	t.domainCache = cache
+}
+
+func (t *Tunnel) domainMatchCacheStore() *domainMatchCache {
+	t.domainMutex.RLock()
+	cache := t.domainCache
+	t.domainMutex.RUnlock()
+	if cache != nil {
+		return cache
+	}
+	t.domainMutex.Lock()
+	defer t.domainMutex.Unlock()
+	if t.domainCache == nil {
+		t.domainCache = newDomainMatchCache(defaultDomainCacheSize, defaultDomainCacheTTL)
+	}
+	return t.domainCache
 }
 
 func (t *Tunnel) GetRequestTracker() *ProxyRequestTracker {
@@ -293,7 +368,7 @@ func (t *Tunnel) addProxyDownloadBytes(n int64) {
 	atomic.AddUint64(&t.proxyDownloadBytes, uint64(n))
 }
 
-func (t *Tunnel) copyProxyData(destination io.WriteCloser, source io.ReadCloser, upload bool) {
+func (t *Tunnel) copyProxyData(destination io.WriteCloser, source io.ReadCloser, upload bool) int64 {
 	defer destination.Close()
 	defer source.Close()
 
@@ -307,6 +382,7 @@ func (t *Tunnel) copyProxyData(destination io.WriteCloser, source io.ReadCloser,
 	if err != nil && !isIgnorableProxyErr(err) {
 		log.Printf("proxy copy failed: %v", err)
 	}
+	return n
 }
 
 func (t *Tunnel) SnapshotProxyMetrics() ProxyMetrics {
@@ -360,6 +436,12 @@ func (t *Tunnel) SnapshotSSHConnectionStats() SSHConnectionStats {
 		count = 1
 	}
 
+	var mismatch *HostKeyMismatchInfo
+	if t.lastHostKeyMismatch != nil {
+		copied := *t.lastHostKeyMismatch
+		mismatch = &copied
+	}
+
 	return SSHConnectionStats{
 		ConnectionCount:              count,
 		ReconnectCount:               t.reconnectCount,
@@ -367,6 +449,10 @@ func (t *Tunnel) SnapshotSSHConnectionStats() SSHConnectionStats {
 		LastReconnectError:           t.lastReconnectError,
 		LastReconnectAt:              t.lastReconnectAt,
 		LastReconnectFailureAt:       t.lastReconnectFailureAt,
+		HostKeyFingerprint:           t.hostKeyFingerprint,
+		HostKeyMismatch:              mismatch,
+		AuthMethodUsed:               t.authMethodUsed,
+		LastFailedHop:                t.lastFailedHop,
 	}
 }
 
@@ -418,13 +504,7 @@ func (t *Tunnel) socks5ProxyStart(ctx context.Context) {
 
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	t.serveTCPProxy(ctx, t.localAddress, "SOCKS5", func(conn net.Conn) {
-		resolveErr := t.socks5Proxy(ctx, conn)
-		if resolveErr != nil && errors.Is(resolveErr, SSHReconnectRequired) {
-			t.needReBind = true
-			safe.GO(func() {
-				t.ReconnectSSHWithSource(ctx, "socks5-proxy")
-			})
-		}
+		t.handleSocksConn(ctx, conn)
 	})
 }
 
@@ -442,27 +522,15 @@ func (t *Tunnel) handleHTTP(ctx context.Context, w http.ResponseWriter, req *htt
 }
 
 func (t *Tunnel) getDestConn(host string) (destinationConn, error) {
-	if !t.enableHttpOverSSH {
-		conn, err := net.DialTimeout("tcp", host, 3*time.Second)
-		return destinationConn{conn: conn}, err
-	}
-
-	if !t.enableHttpDomainFilter {
-		conn, client, err := t.createSSHConn(host)
-		return destinationConn{conn: conn, sshClient: client, viaSSH: true}, err
-	}
-
-	if t.shouldUseSSHForHost(host) {
-		conn, client, err := t.createSSHConn(host)
-		return destinationConn{conn: conn, sshClient: client, viaSSH: true}, err
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
-	return destinationConn{conn: conn}, err
-
+	return t.dialRoute(host, t.httpDefaultAction(host))
 }
 
 func (t *Tunnel) createSSHConn(host string) (net.Conn, *ssh.Client, error) {
+	return t.createSSHNetworkConn("tcp", host)
+}
+
+// createSSHNetworkConn 经SSH连接打开到 address 的通道；network 为 unix 时 address 为服务器上的套接字路径
+func (t *Tunnel) createSSHNetworkConn(network string, address string) (net.Conn, *ssh.Client, error) {
 	client := t.GetSSHClient()
 	if client == nil {
 		return nil, nil, SSHReconnectRequired
@@ -475,11 +543,14 @@ func (t *Tunnel) createSSHConn(host string) (net.Conn, *ssh.Client, error) {
 	timeoutCtx, cancel := context.WithTimeout(background, timeout)
 	defer cancel()
 
-	conn, err := client.DialContext(timeoutCtx, "tcp", host)
+	conn, err := client.DialContext(timeoutCtx, network, address)
 	if err != nil {
 		if isSSHReconnectError(err) {
 			return nil, client, fmt.Errorf("%w: %v", SSHDialError, err)
 		}
+		if network == "unix" {
+			return nil, client, mapStreamLocalError(address, err)
+		}
 		return nil, client, err
 	}
 
@@ -553,11 +624,7 @@ func (t *Tunnel) basicAuth(w http.ResponseWriter, r *http.Request) bool {
 		if err == nil {
 			if ms := strings.Split(string(up), ":"); len(ms) == 2 {
 				var user, password = ms[0], ms[1]
-				var ok = false
-				if user == t.httpBasicUserName && password == t.httpBasicPassword {
-					ok = true
-				}
-				if ok {
+				if t.authenticateProxyUser(user, password) {
 					return true
 				}
 			}
@@ -579,106 +646,27 @@ func (t *Tunnel) httpProxyStartEx(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	t.serveTCPProxy(ctx, t.httpLocalAddress, "HTTP", func(client net.Conn) {
-		t.handleClientRequest(ctx, client)
-	})
-}
-
-func (t *Tunnel) handleClientRequest(ctx context.Context, client net.Conn) {
-	defer client.Close()
-	defer func() {
-		if err := recover(); err != nil {
-			log.Println("panic occurred:", err)
-		}
-	}()
-	var b [1024]byte
-	_ = client.SetReadDeadline(time.Now().Add(t.proxyHandshakeTimeout()))
-	n, err := client.Read(b[:])
-	if err != nil {
-		log.Println(err)
-		fmt.Fprint(client, "HTTP/1.1 500 "+err.Error()+"\r\n\r\n")
-		return
-	}
-	_ = client.SetReadDeadline(time.Time{})
-	var method, host, address string
-	firstLineEnd := bytes.IndexByte(b[:n], '\n')
-	if firstLineEnd < 0 {
-		log.Println("invalid http proxy request: missing request line")
-		fmt.Fprint(client, "HTTP/1.1 400 invalid request\r\n\r\n")
-		return
-	}
-	fmt.Sscanf(string(b[:firstLineEnd]), "%s%s", &method, &host)
-
-	if method == http.MethodConnect {
-		address = host
-	} else {
-		hostPortURL, err := url.Parse(host)
-		if err != nil {
-			log.Println(err)
-			fmt.Fprint(client, "HTTP/1.1 500 "+err.Error()+"\r\n\r\n")
+	name := "HTTP"
+	var tlsConfig *tls.Config
+	if t.httpTls.enabled {
+		var err error
+		if tlsConfig, err = t.httpProxyTLSConfig(); err != nil {
+			log.Printf("HTTP代理未启动: %v", err)
 			return
 		}
-		if hostPortURL.Opaque == "443" { //https访问
-			address = hostPortURL.Scheme + ":443"
-		} else { //http访问
-			if strings.Index(hostPortURL.Host, ":") == -1 { //host不带端口， 默认80
-				address = hostPortURL.Host + ":80"
-			} else {
-				address = hostPortURL.Host
-			}
-		}
-	}
-
-	protocol := "HTTP"
-	if method == http.MethodConnect {
-		protocol = "HTTPS"
-	}
-	tracker := t.GetRequestTracker()
-	rHost, rPort := splitHostPort(address)
-	req := tracker.StartRequest(rHost, rPort, protocol, t.enableHttpOverSSH)
-
-	dest, done := t.getConn(ctx, client, address)
-	if done {
-		tracker.MarkFailed(req, "connection failed")
-		return
-	}
-	if dest.conn == nil {
-		tracker.MarkFailed(req, "destination connection is nil")
-		log.Println("Get Dest Connection Failed: destination connection is nil")
-		fmt.Fprint(client, "HTTP/1.1 500 destination connection is nil\r\n\r\n")
-		return
+		name = "HTTPS"
 	}
-	destConn := dest.conn
-	tracker.MarkActive(req)
-	finishProxyConn := t.beginActiveProxyConn()
-	defer finishProxyConn()
-
-	if method == "CONNECT" {
-		fmt.Fprint(client, "HTTP/1.1 200 Connection established\r\n\r\n")
-	} else {
-		if _, writeErr := destConn.Write(b[:n]); writeErr != nil {
-			log.Printf("write initial request to destination failed: %v", writeErr)
-			if dest.viaSSH && dest.sshClient != nil && isSSHReconnectError(writeErr) {
-				t.invalidateSSHClientIfMatch(dest.sshClient, "http initial write failed: "+writeErr.Error())
-				safe.GO(func() {
-					t.ReconnectSSHWithSource(ctx, "http-proxy-write")
-				})
-			}
-			fmt.Fprint(client, "HTTP/1.1 500 "+writeErr.Error()+"\r\n\r\n")
-			tracker.MarkFailed(req, writeErr.Error())
-			return
+	t.serveTCPProxy(ctx, t.httpLocalAddress, name, func(client net.Conn) {
+		if tlsConfig != nil {
+			// 握手在首次读取请求时进行，受握手超时约束
+			client = tls.Server(client, tlsConfig)
 		}
-	}
-	//进行转发
-	safe.GO(func() {
-		t.copyProxyData(destConn, client, true)
+		t.handleClientRequest(ctx, client)
 	})
-	t.copyProxyData(client, destConn, false)
-	tracker.MarkCompleted(req)
 }
 
-func (t *Tunnel) getConn(ctx context.Context, client net.Conn, address string) (destinationConn, bool) {
-	dest, err := t.getDestConn(address)
+func (t *Tunnel) getConn(ctx context.Context, client net.Conn, address string, action string) (destinationConn, bool) {
+	dest, err := t.dialRoute(address, action)
 	if err == nil && dest.conn != nil {
 		return dest, false
 	}
@@ -695,7 +683,7 @@ func (t *Tunnel) getConn(ctx context.Context, client net.Conn, address string) (
 			return destinationConn{}, true
 		}
 
-		dest, err = t.getDestConn(address)
+		dest, err = t.dialRoute(address, action)
 		if err == nil && dest.conn != nil {
 			return dest, false
 		}
@@ -817,6 +805,10 @@ func (t *Tunnel) socks5Proxy(ctx context.Context, conn net.Conn) error {
 		return err
 	}
 
+	if verNMethods[0] == 0x04 {
+		return t.socks4Proxy(conn, verNMethods[1])
+	}
+
 	if verNMethods[0] != 0x05 {
 		return fmt.Errorf("unsupported socks version: %d", verNMethods[0])
 	}
@@ -833,24 +825,26 @@ func (t *Tunnel) socks5Proxy(ctx context.Context, conn net.Conn) error {
 		return err
 	}
 
-	methodOK := false
-	for _, method := range methods {
-		if method == 0x00 {
-			methodOK = true
-			break
-		}
-	}
-
-	if !methodOK {
-		_, _ = conn.Write([]byte{0x05, 0xFF})
-		return errors.New("socks5 no-auth method not supported by client")
+	method := t.selectSocks5Method(methods)
+	if method == socks5MethodNoAcceptable {
+		_, _ = conn.Write([]byte{0x05, socks5MethodNoAcceptable})
+		return errors.New("no acceptable socks5 auth method offered by client")
 	}
 
-	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+	if _, err := conn.Write([]byte{0x05, method}); err != nil {
 		log.Println(err)
 		return err
 	}
 
+	user := ""
+	if method == socks5MethodUserPass {
+		authUser, err := t.socks5UserPassAuth(conn)
+		if err != nil {
+			return err
+		}
+		user = authUser
+	}
+
 	requestHeader := make([]byte, 4)
 	if _, err := io.ReadFull(conn, requestHeader); err != nil {
 		log.Println(err)
@@ -862,6 +856,24 @@ func (t *Tunnel) socks5Proxy(ctx context.Context, conn net.Conn) error {
 		return fmt.Errorf("invalid socks request version: %d", requestHeader[0])
 	}
 
+	if requestHeader[1] == socks5CmdUdpAssociate && t.socks5Udp.enabled {
+		// DST.ADDR 为客户端预期的发送地址，通常为 0.0.0.0:0，来源校验以控制连接的对端IP为准
+		if _, err := readSocks5TargetAddress(conn, requestHeader[3]); err != nil {
+			_ = writeSocks5Reply(conn, 0x08, nil)
+			return err
+		}
+		return t.socks5UdpAssociate(connCtx, conn, user)
+	}
+
+	if requestHeader[1] == socks5CmdBind {
+		addr, err := readSocks5TargetAddress(conn, requestHeader[3])
+		if err != nil {
+			_ = writeSocks5Reply(conn, 0x08, nil)
+			return err
+		}
+		return t.socks5Bind(connCtx, conn, addr, user)
+	}
+
 	if requestHeader[1] != 0x01 {
 		_ = writeSocks5Reply(conn, 0x07, nil)
 		return fmt.Errorf("unsupported socks command: %d", requestHeader[1])
@@ -877,31 +889,50 @@ func (t *Tunnel) socks5Proxy(ctx context.Context, conn net.Conn) error {
 	tracker := t.GetRequestTracker()
 	sHost, sPort := splitHostPort(addr)
 	req := tracker.StartRequest(sHost, sPort, "SOCKS5", true)
+	tracker.SetUser(req, user)
+	route := t.routeFor(addr, clientIP(conn), RouteActionSSH)
+	tracker.SetRoute(req, route)
+
+	var server net.Conn
+	switch route.Action {
+	case RouteActionReject:
+		_ = writeSocks5Reply(conn, 0x02, nil)
+		tracker.MarkFailed(req, errRouteRejected.Error())
+		return errRouteRejected
+	case RouteActionDirect:
+		server, err = net.DialTimeout("tcp", addr, t.directDialTimeout())
+		if err != nil {
+			log.Println(err)
+			_ = writeSocks5Reply(conn, mapSocks5ReplyCode(err), nil)
+			tracker.MarkFailed(req, err.Error())
+			return err
+		}
+	default:
+		sshClient := t.GetSSHClient()
+		if sshClient == nil {
+			_ = writeSocks5Reply(conn, 0x01, nil)
+			tracker.MarkFailed(req, "SSH client not connected")
+			return SSHReconnectRequired
+		}
 
-	sshClient := t.GetSSHClient()
-	if sshClient == nil {
-		_ = writeSocks5Reply(conn, 0x01, nil)
-		tracker.MarkFailed(req, "SSH client not connected")
-		return SSHReconnectRequired
-	}
-
-	timeout := t.sshDestTimeout
-	if timeout <= 0 {
-		timeout = 3 * time.Second
-	}
-	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), timeout)
-	defer timeoutCancel()
+		timeout := t.sshDestTimeout
+		if timeout <= 0 {
+			timeout = 3 * time.Second
+		}
+		timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), timeout)
+		defer timeoutCancel()
 
-	server, err := sshClient.DialContext(timeoutCtx, "tcp", addr)
-	if err != nil {
-		log.Println(err)
-		_ = writeSocks5Reply(conn, mapSocks5ReplyCode(err), nil)
-		tracker.MarkFailed(req, err.Error())
-		if isSSHReconnectError(err) {
-			t.invalidateSSHClientIfMatch(sshClient, "socks5 dial failed: "+err.Error())
-			return SSHReconnectRequired
+		server, err = sshClient.DialContext(timeoutCtx, "tcp", addr)
+		if err != nil {
+			log.Println(err)
+			_ = writeSocks5Reply(conn, mapSocks5ReplyCode(err), nil)
+			tracker.MarkFailed(req, err.Error())
+			if isSSHReconnectError(err) {
+				t.invalidateSSHClientIfMatch(sshClient, "socks5 dial failed: "+err.Error())
+				return SSHReconnectRequired
+			}
+			return err
 		}
-		return err
 	}
 
 	if err := writeSocks5Reply(conn, 0x00, server.LocalAddr()); err != nil {
@@ -36,6 +36,8 @@ import (
 type Data struct {
 	Domains                map[string]bool
 	DomainMatchResultCache map[string]bool
+	DomainListErrors       []tunnel2.DomainListError
+	DomainSubscriptions    []tunnel2.DomainSubscriptionStatus
 }
 
 type SSHClientState struct {
@@ -50,6 +52,11 @@ type SSHClientState struct {
 	LastReconnectAt              string
 	LastReconnectFailureAt       string
 	LastReconnectError           string
+	HostKeyFingerprint           string
+	HostKeyMismatch              *tunnel2.HostKeyMismatchInfo
+	AuthMethodUsed               string
+	CertificateWarnings          []tunnel2.CertificateStatus
+	Algorithms                   *tunnel2.NegotiatedAlgorithms
 }
 
 func ListStaticFiles(w http.ResponseWriter, r *http.Request) {
@@ -130,6 +137,8 @@ func ShowDomainsView(response http.ResponseWriter, request *http.Request) {
 	var data = Data{
 		Domains:                tunnel.Domains(),
 		DomainMatchResultCache: tunnel.DomainMatchCache(),
+		DomainListErrors:       tunnel.DomainListErrors(),
+		DomainSubscriptions:    tunnel.DomainSubscriptions(),
 	}
 
 	tmpl, err := template.ParseFS(views.HtmlFs, "layout.gohtml",
@@ -202,6 +211,11 @@ func ShowSSHClientStateView(response http.ResponseWriter, request *http.Request)
 		LastReconnectAt:              formatTime(stats.LastReconnectAt),
 		LastReconnectFailureAt:       formatTime(stats.LastReconnectFailureAt),
 		LastReconnectError:           stats.LastReconnectError,
+		HostKeyFingerprint:           stats.HostKeyFingerprint,
+		HostKeyMismatch:              stats.HostKeyMismatch,
+		AuthMethodUsed:               stats.AuthMethodUsed,
+		CertificateWarnings:          tunnel.CertificateWarnings(),
+		Algorithms:                   tunnel.NegotiatedAlgorithms(),
 	}
 
 	tmpl, err := template.ParseFS(views.HtmlFs, "layout.gohtml",
@@ -249,16 +263,40 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"ServerSshPort":              appConfig.ServerSshPort.GetValue(),
 		"LoginUser":                  appConfig.LoginUser.GetValue(),
 		"SshPrivateKeyPath":          appConfig.SshPrivateKeyPath.GetValue(),
+		"SshPrivateKeyPassphrase":    appConfig.SshPrivateKeyPassphrase.GetValue(),
 		"LocalAddress":               appConfig.LocalAddress.GetValue(),
 		"HttpLocalAddress":           appConfig.HttpLocalAddress.GetValue(),
+		"MixedLocalAddress":          appConfig.MixedLocalAddress.GetValue(),
 		"EnableHttp":                 appConfig.EnableHttp.GetValue(),
+		"HttpTlsEnable":              appConfig.HttpTlsEnable.GetValue(),
+		"HttpTlsCertFile":            appConfig.HttpTlsCertFile.GetValue(),
+		"HttpTlsKeyFile":             appConfig.HttpTlsKeyFile.GetValue(),
+		"HttpAuthUsersFile":          appConfig.HttpAuthUsersFile.GetValue(),
+		"HttpAuthMaxFailures":        appConfig.HttpAuthMaxFailures.GetValue(),
+		"HttpAuthBlockSec":           appConfig.HttpAuthBlockSec.GetValue(),
+		"RouteEnable":                appConfig.RouteEnable.GetValue(),
+		"RouteRulesFile":             appConfig.RouteRulesFile.GetValue(),
 		"EnableSocks5":               appConfig.EnableSocks5.GetValue(),
+		"EnableMixed":                appConfig.EnableMixed.GetValue(),
+		"Socks5UdpEnable":            appConfig.Socks5UdpEnable.GetValue(),
+		"Socks5UdpRelayAddress":      appConfig.Socks5UdpRelayAddress.GetValue(),
+		"Socks5UdpIdleTimeoutSec":    appConfig.Socks5UdpIdleTimeoutSec.GetValue(),
 		"EnableHttpOverSSH":          appConfig.EnableHttpOverSSH.GetValue(),
 		"HttpBasicAuthEnable":        appConfig.HttpBasicAuthEnable.GetValue(),
 		"HttpBasicUserName":          appConfig.HttpBasicUserName.GetValue(),
 		"HttpBasicPassword":          appConfig.HttpBasicPassword.GetValue(),
+		"Socks5AuthEnable":           appConfig.Socks5AuthEnable.GetValue(),
+		"Socks5NoAuthEnable":         appConfig.Socks5NoAuthEnable.GetValue(),
+		"Socks5AuthShareHttpBasic":   appConfig.Socks5AuthShareHttpBasic.GetValue(),
+		"Socks5AuthUserName":         appConfig.Socks5AuthUserName.GetValue(),
+		"Socks5AuthPassword":         appConfig.Socks5AuthPassword.GetValue(),
 		"EnableHttpDomainFilter":     appConfig.EnableHttpDomainFilter.GetValue(),
 		"HttpDomainFilterFilePath":   appConfig.HttpDomainFilterFilePath.GetValue(),
+		"HttpDomainCacheSize":        appConfig.HttpDomainCacheSize.GetValue(),
+		"HttpDomainCacheTTLSec":      appConfig.HttpDomainCacheTTLSec.GetValue(),
+		"HttpDomainSubscriptions":    appConfig.HttpDomainSubscriptions.GetValue(),
+		"HttpDomainSubIntervalMin":   appConfig.HttpDomainSubIntervalMin.GetValue(),
+		"HttpDomainSubViaSSH":        appConfig.HttpDomainSubViaSSH.GetValue(),
 		"EnableAdmin":                appConfig.EnableAdmin.GetValue(),
 		"AdminAddress":               appConfig.AdminAddress.GetValue(),
 		"RetryIntervalSec":           appConfig.RetryIntervalSec.GetValue(),
@@ -268,6 +306,13 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"SSHKeepAliveCountMax":       appConfig.SSHKeepAliveCountMax.GetValue(),
 		"SSHReconnectMaxRetries":     appConfig.SSHReconnectMaxRetries.GetValue(),
 		"SSHReconnectMaxIntervalSec": appConfig.SSHReconnectMaxIntervalSec.GetValue(),
+		"SSHAuthChallengeTimeoutSec": appConfig.SSHAuthChallengeTimeoutSec.GetValue(),
+		"SSHCertExpiryWarnMin":       appConfig.SSHCertExpiryWarnMin.GetValue(),
+		"SSHProbeEnable":             appConfig.SSHProbeEnable.GetValue(),
+		"SSHProbeTarget":             appConfig.SSHProbeTarget.GetValue(),
+		"SSHProbeIntervalSec":        appConfig.SSHProbeIntervalSec.GetValue(),
+		"SSHProbeTimeoutSec":         appConfig.SSHProbeTimeoutSec.GetValue(),
+		"SSHProbeFailureThreshold":   appConfig.SSHProbeFailureThreshold.GetValue(),
 		"LogFilePath":                appConfig.LogFilePath.GetValue(),
 		"HomeDir":                    appConfig.HomeDir.GetValue(),
 	}
@@ -278,16 +323,40 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"ServerSshPort":              {Type: "int", Description: "SSH服务器端口", Category: "服务器配置", Required: true, ActualKey: appConfig.ServerSshPort.Key},
 		"LoginUser":                  {Type: "string", Description: "SSH登录用户名", Category: "服务器配置", Required: true, ActualKey: appConfig.LoginUser.Key},
 		"SshPrivateKeyPath":          {Type: "string", Description: "SSH私钥文件路径", Category: "SSH配置", Required: true, ActualKey: appConfig.SshPrivateKeyPath.Key},
+		"SshPrivateKeyPassphrase":    {Type: "string", Description: "SSH私钥口令(用于加密私钥)", Category: "SSH配置", Required: false, ActualKey: appConfig.SshPrivateKeyPassphrase.Key},
 		"LocalAddress":               {Type: "string", Description: "本地SOCKS5代理监听地址", Category: "代理配置", Required: true, ActualKey: appConfig.LocalAddress.Key},
 		"HttpLocalAddress":           {Type: "string", Description: "本地HTTP代理监听地址", Category: "代理配置", Required: false, ActualKey: appConfig.HttpLocalAddress.Key},
+		"MixedLocalAddress":          {Type: "string", Description: "混合端口本地地址", Category: "代理配置", Required: false, ActualKey: appConfig.MixedLocalAddress.Key},
 		"EnableHttp":                 {Type: "bool", Description: "启用HTTP代理", Category: "代理配置", Required: false, ActualKey: appConfig.EnableHttp.Key},
+		"HttpTlsEnable":              {Type: "bool", Description: "HTTP代理监听端口启用TLS(https代理)", Category: "代理配置", Required: false, ActualKey: appConfig.HttpTlsEnable.Key},
+		"HttpTlsCertFile":            {Type: "string", Description: "HTTP代理TLS证书文件(留空则在主目录生成自签名证书)", Category: "代理配置", Required: false, ActualKey: appConfig.HttpTlsCertFile.Key},
+		"HttpTlsKeyFile":             {Type: "string", Description: "HTTP代理TLS私钥文件", Category: "代理配置", Required: false, ActualKey: appConfig.HttpTlsKeyFile.Key},
+		"HttpAuthUsersFile":          {Type: "string", Description: "HTTP代理多用户文件(htpasswd格式,支持bcrypt/SHA)", Category: "代理配置", Required: false, ActualKey: appConfig.HttpAuthUsersFile.Key},
+		"HttpAuthMaxFailures":        {Type: "int", Description: "同一客户端IP允许的连续认证失败次数(0为不限制)", Category: "代理配置", Required: false, ActualKey: appConfig.HttpAuthMaxFailures.Key},
+		"HttpAuthBlockSec":           {Type: "int", Description: "认证失败次数超限后封禁客户端IP的时长(秒)", Category: "代理配置", Required: false, ActualKey: appConfig.HttpAuthBlockSec.Key},
+		"RouteEnable":                {Type: "bool", Description: "启用规则路由(DIRECT/SSH/REJECT)", Category: "代理配置", Required: false, ActualKey: appConfig.RouteEnable.Key},
+		"RouteRulesFile":             {Type: "string", Description: "路由规则文件(留空则使用主目录下的rules.txt)", Category: "代理配置", Required: false, ActualKey: appConfig.RouteRulesFile.Key},
 		"EnableSocks5":               {Type: "bool", Description: "启用SOCKS5代理", Category: "代理配置", Required: false, ActualKey: appConfig.EnableSocks5.Key},
+		"EnableMixed":                {Type: "bool", Description: "开启混合端口代理(自动识别SOCKS5/SOCKS4/HTTP)", Category: "代理配置", Required: false, ActualKey: appConfig.EnableMixed.Key},
+		"Socks5UdpEnable":            {Type: "bool", Description: "是否启用SOCKS5 UDP ASSOCIATE", Category: "代理配置", Required: false, ActualKey: appConfig.Socks5UdpEnable.Key},
+		"Socks5UdpRelayAddress":      {Type: "string", Description: "SOCKS5 UDP中继地址(经SSH连接的udpgw兼容服务)", Category: "代理配置", Required: false, ActualKey: appConfig.Socks5UdpRelayAddress.Key},
+		"Socks5UdpIdleTimeoutSec":    {Type: "int", Description: "SOCKS5 UDP关联空闲超时(秒)", Category: "代理配置", Required: false, ActualKey: appConfig.Socks5UdpIdleTimeoutSec.Key},
 		"EnableHttpOverSSH":          {Type: "bool", Description: "启用HTTP Over SSH", Category: "代理配置", Required: false, ActualKey: appConfig.EnableHttpOverSSH.Key},
 		"HttpBasicAuthEnable":        {Type: "bool", Description: "启用HTTP Basic认证", Category: "认证配置", Required: false, ActualKey: appConfig.HttpBasicAuthEnable.Key},
 		"HttpBasicUserName":          {Type: "string", Description: "HTTP Basic认证用户名", Category: "认证配置", Required: false, ActualKey: appConfig.HttpBasicUserName.Key},
 		"HttpBasicPassword":          {Type: "string", Description: "HTTP Basic认证密码", Category: "认证配置", Required: false, ActualKey: appConfig.HttpBasicPassword.Key},
+		"Socks5AuthEnable":           {Type: "bool", Description: "是否启用SOCKS5用户名密码认证(RFC 1929)", Category: "认证配置", Required: false, ActualKey: appConfig.Socks5AuthEnable.Key},
+		"Socks5NoAuthEnable":         {Type: "bool", Description: "是否允许SOCKS5无认证连接", Category: "认证配置", Required: false, ActualKey: appConfig.Socks5NoAuthEnable.Key},
+		"Socks5AuthShareHttpBasic":   {Type: "bool", Description: "SOCKS5认证使用HTTP基本认证的用户名密码", Category: "认证配置", Required: false, ActualKey: appConfig.Socks5AuthShareHttpBasic.Key},
+		"Socks5AuthUserName":         {Type: "string", Description: "SOCKS5认证用户名", Category: "认证配置", Required: false, ActualKey: appConfig.Socks5AuthUserName.Key},
+		"Socks5AuthPassword":         {Type: "string", Description: "SOCKS5认证密码", Category: "认证配置", Required: false, ActualKey: appConfig.Socks5AuthPassword.Key},
 		"EnableHttpDomainFilter":     {Type: "bool", Description: "启用域名过滤", Category: "过滤配置", Required: false, ActualKey: appConfig.EnableHttpDomainFilter.Key},
 		"HttpDomainFilterFilePath":   {Type: "string", Description: "域名过滤文件路径", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainFilterFilePath.Key},
+		"HttpDomainCacheSize":        {Type: "int", Description: "域名匹配缓存容量(条)", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainCacheSize.Key},
+		"HttpDomainCacheTTLSec":      {Type: "int", Description: "域名匹配缓存过期时间(秒)", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainCacheTTLSec.Key},
+		"HttpDomainSubscriptions":    {Type: "string", Description: "域名列表订阅地址(多个用逗号分隔)", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainSubscriptions.Key},
+		"HttpDomainSubIntervalMin":   {Type: "int", Description: "域名列表订阅刷新间隔(分钟)", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainSubIntervalMin.Key},
+		"HttpDomainSubViaSSH":        {Type: "bool", Description: "通过SSH隧道下载域名列表订阅", Category: "过滤配置", Required: false, ActualKey: appConfig.HttpDomainSubViaSSH.Key},
 		"EnableAdmin":                {Type: "bool", Description: "启用管理界面", Category: "管理配置", Required: false, ActualKey: appConfig.EnableAdmin.Key},
 		"AdminAddress":               {Type: "string", Description: "管理界面监听地址", Category: "管理配置", Required: false, ActualKey: appConfig.AdminAddress.Key},
 		"RetryIntervalSec":           {Type: "int", Description: "连接重试间隔(秒)", Category: "高级配置", Required: false, ActualKey: appConfig.RetryIntervalSec.Key},
@@ -297,6 +366,13 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"SSHKeepAliveCountMax":       {Type: "int", Description: "SSH保活最大连续失败次数", Category: "高级配置", Required: false, ActualKey: appConfig.SSHKeepAliveCountMax.Key},
 		"SSHReconnectMaxRetries":     {Type: "int", Description: "SSH重连最大重试次数", Category: "高级配置", Required: false, ActualKey: appConfig.SSHReconnectMaxRetries.Key},
 		"SSHReconnectMaxIntervalSec": {Type: "int", Description: "SSH重连最大退避间隔(秒)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHReconnectMaxIntervalSec.Key},
+		"SSHAuthChallengeTimeoutSec": {Type: "int", Description: "SSH键盘交互认证等待应答超时(秒)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHAuthChallengeTimeoutSec.Key},
+		"SSHCertExpiryWarnMin":       {Type: "int", Description: "SSH用户证书到期提前告警时间(分钟)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHCertExpiryWarnMin.Key},
+		"SSHProbeEnable":             {Type: "bool", Description: "是否启用direct-tcpip通道健康探测", Category: "高级配置", Required: false, ActualKey: appConfig.SSHProbeEnable.Key},
+		"SSHProbeTarget":             {Type: "string", Description: "通道健康探测目标地址(由SSH服务器连接)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHProbeTarget.Key},
+		"SSHProbeIntervalSec":        {Type: "int", Description: "通道健康探测间隔(秒)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHProbeIntervalSec.Key},
+		"SSHProbeTimeoutSec":         {Type: "int", Description: "通道健康探测超时(秒)", Category: "高级配置", Required: false, ActualKey: appConfig.SSHProbeTimeoutSec.Key},
+		"SSHProbeFailureThreshold":   {Type: "int", Description: "通道健康探测连续失败多少次后重建SSH连接", Category: "高级配置", Required: false, ActualKey: appConfig.SSHProbeFailureThreshold.Key},
 		"LogFilePath":                {Type: "string", Description: "日志文件路径", Category: "高级配置", Required: false, ActualKey: appConfig.LogFilePath.Key},
 		"HomeDir":                    {Type: "string", Description: "应用主目录", Category: "高级配置", Required: false, ActualKey: appConfig.HomeDir.Key},
 	}
@@ -307,16 +383,40 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"ServerSshPort":              appConfig.ServerSshPort.Key,
 		"LoginUser":                  appConfig.LoginUser.Key,
 		"SshPrivateKeyPath":          appConfig.SshPrivateKeyPath.Key,
+		"SshPrivateKeyPassphrase":    appConfig.SshPrivateKeyPassphrase.Key,
 		"LocalAddress":               appConfig.LocalAddress.Key,
 		"HttpLocalAddress":           appConfig.HttpLocalAddress.Key,
+		"MixedLocalAddress":          appConfig.MixedLocalAddress.Key,
 		"EnableHttp":                 appConfig.EnableHttp.Key,
+		"HttpTlsEnable":              appConfig.HttpTlsEnable.Key,
+		"HttpTlsCertFile":            appConfig.HttpTlsCertFile.Key,
+		"HttpTlsKeyFile":             appConfig.HttpTlsKeyFile.Key,
+		"HttpAuthUsersFile":          appConfig.HttpAuthUsersFile.Key,
+		"HttpAuthMaxFailures":        appConfig.HttpAuthMaxFailures.Key,
+		"HttpAuthBlockSec":           appConfig.HttpAuthBlockSec.Key,
+		"RouteEnable":                appConfig.RouteEnable.Key,
+		"RouteRulesFile":             appConfig.RouteRulesFile.Key,
 		"EnableSocks5":               appConfig.EnableSocks5.Key,
+		"EnableMixed":                appConfig.EnableMixed.Key,
+		"Socks5UdpEnable":            appConfig.Socks5UdpEnable.Key,
+		"Socks5UdpRelayAddress":      appConfig.Socks5UdpRelayAddress.Key,
+		"Socks5UdpIdleTimeoutSec":    appConfig.Socks5UdpIdleTimeoutSec.Key,
 		"EnableHttpOverSSH":          appConfig.EnableHttpOverSSH.Key,
 		"HttpBasicAuthEnable":        appConfig.HttpBasicAuthEnable.Key,
 		"HttpBasicUserName":          appConfig.HttpBasicUserName.Key,
 		"HttpBasicPassword":          appConfig.HttpBasicPassword.Key,
+		"Socks5AuthEnable":           appConfig.Socks5AuthEnable.Key,
+		"Socks5NoAuthEnable":         appConfig.Socks5NoAuthEnable.Key,
+		"Socks5AuthShareHttpBasic":   appConfig.Socks5AuthShareHttpBasic.Key,
+		"Socks5AuthUserName":         appConfig.Socks5AuthUserName.Key,
+		"Socks5AuthPassword":         appConfig.Socks5AuthPassword.Key,
 		"EnableHttpDomainFilter":     appConfig.EnableHttpDomainFilter.Key,
 		"HttpDomainFilterFilePath":   appConfig.HttpDomainFilterFilePath.Key,
+		"HttpDomainCacheSize":        appConfig.HttpDomainCacheSize.Key,
+		"HttpDomainCacheTTLSec":      appConfig.HttpDomainCacheTTLSec.Key,
+		"HttpDomainSubscriptions":    appConfig.HttpDomainSubscriptions.Key,
+		"HttpDomainSubIntervalMin":   appConfig.HttpDomainSubIntervalMin.Key,
+		"HttpDomainSubViaSSH":        appConfig.HttpDomainSubViaSSH.Key,
 		"EnableAdmin":                appConfig.EnableAdmin.Key,
 		"AdminAddress":               appConfig.AdminAddress.Key,
 		"RetryIntervalSec":           appConfig.RetryIntervalSec.Key,
@@ -326,6 +426,13 @@ func ShowAppConfigView(response http.ResponseWriter, request *http.Request) {
 		"SSHKeepAliveCountMax":       appConfig.SSHKeepAliveCountMax.Key,
 		"SSHReconnectMaxRetries":     appConfig.SSHReconnectMaxRetries.Key,
 		"SSHReconnectMaxIntervalSec": appConfig.SSHReconnectMaxIntervalSec.Key,
+		"SSHAuthChallengeTimeoutSec": appConfig.SSHAuthChallengeTimeoutSec.Key,
+		"SSHCertExpiryWarnMin":       appConfig.SSHCertExpiryWarnMin.Key,
+		"SSHProbeEnable":             appConfig.SSHProbeEnable.Key,
+		"SSHProbeTarget":             appConfig.SSHProbeTarget.Key,
+		"SSHProbeIntervalSec":        appConfig.SSHProbeIntervalSec.Key,
+		"SSHProbeTimeoutSec":         appConfig.SSHProbeTimeoutSec.Key,
+		"SSHProbeFailureThreshold":   appConfig.SSHProbeFailureThreshold.Key,
 		"LogFilePath":                appConfig.LogFilePath.Key,
 		"HomeDir":                    appConfig.HomeDir.Key,
 	}